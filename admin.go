@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// An action of the admin subcommand, run with the same pipeline functions as the API and
+// writing its result to w as JSON
+type adminAction struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, s *state, w io.Writer, args []string) error
+}
+
+// Actions of the admin subcommand
+var adminActions = map[string]adminAction{
+	"users": {
+		summary: "lists every user",
+		run:     adminListUsers,
+	},
+	"user": {
+		usage:   "<firebase-id>",
+		summary: "shows the user and their feeds",
+		run:     adminShowUser,
+	},
+	"dump": {
+		usage:   "<firebase-id>",
+		summary: "dumps the user's feeds along with each feed's channels",
+		run:     adminDumpUser,
+	},
+	"orphans": {
+		summary: "lists channels that are not in any feed",
+		run:     adminListOrphans,
+	},
+	"purge-orphans": {
+		summary: "deletes channels that are not in any feed",
+		run:     adminPurgeOrphans,
+	},
+	"resolve": {
+		usage:   "<channel-id|@handle>",
+		summary: "re-resolves a channel from YouTube, refreshing its metadata and status",
+		run:     adminResolveChannel,
+	},
+	"refresh": {
+		usage:   "<feed-id>",
+		summary: "retrieves the feed's videos from YouTube, storing new ones",
+		run:     adminRefreshFeed,
+	},
+	"quota": {
+		summary: "prints today's YouTube quota usage and recent daily totals",
+		run:     adminPrintQuota,
+	},
+}
+
+// A user as shown by the admin actions
+type adminUser struct {
+	ID         int32          `json:"id"`
+	FirebaseID string         `json:"firebaseId"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+	Feeds      []feedResource `json:"feeds,omitempty"`
+}
+
+// A feed along with its channels, as dumped by the admin dump action
+type adminFeed struct {
+	feedResource
+	Channels []channelResource `json:"channels"`
+}
+
+func toAdminUser(user database.User) adminUser {
+	return adminUser{
+		ID:         user.ID,
+		FirebaseID: user.FbUserID,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
+	}
+}
+
+// Runs the admin subcommand: <action> [arguments]
+func runAdmin(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		printAdminActions(os.Stderr)
+		return fmt.Errorf("in runAdmin(): expected an action")
+	}
+	if args[0] == "help" && len(args) == 1 {
+		printAdminActions(os.Stdout)
+		return nil
+	}
+
+	action, ok := adminActions[args[0]]
+	if !ok {
+		printAdminActions(os.Stderr)
+		return fmt.Errorf("in runAdmin(): unknown action<%s>", args[0])
+	}
+	wantArgs := 0
+	if action.usage != "" {
+		wantArgs = 1
+	}
+	if len(args)-1 != wantArgs {
+		return fmt.Errorf("in runAdmin(): usage: admin %s %s", args[0], action.usage)
+	}
+
+	secrets, err := loadSecrets(&cfg)
+	if err != nil {
+		return fmt.Errorf("in runAdmin(): %s", err)
+	}
+	s, err := getState(cfg)
+	if err != nil {
+		return fmt.Errorf("in runAdmin(): error initializing state: %s", err)
+	}
+	defer s.conn.Close()
+
+	ctx := jobContext(context.Background(), "admin")
+	err = configureAdminYouTube(ctx, s, secrets)
+	if err != nil {
+		return fmt.Errorf("in runAdmin(): %s", err)
+	}
+
+	err = action.run(ctx, s, os.Stdout, args[1:])
+
+	// units used by the action count against the shared daily budget
+	flushErr := youtube.FlushQuota(context.Background())
+	if flushErr != nil {
+		logging.FromContext(ctx).Error("in runAdmin(): error flushing quota usage", logging.Err(flushErr))
+	}
+
+	if err != nil {
+		return fmt.Errorf("in runAdmin(): %s", err)
+	}
+	return nil
+}
+
+// Sets up the youtube package as the server does so actions that call the API store what they
+// retrieve and share the server's quota budget
+func configureAdminYouTube(ctx context.Context, s *state, secrets config.SecretProvider) error {
+	configureYouTubeClient(s.cfg.YouTube)
+
+	apiKey, err := secrets.GetSecret(ctx, config.SecretYouTubeAPIKey)
+	if err != nil && !errors.Is(err, config.ErrSecretNotFound) {
+		return fmt.Errorf("in configureAdminYouTube(): error loading YouTube API key: %s", err)
+	}
+	youtube.SetAPIKey(apiKey)
+
+	err = initQuota(ctx, s)
+	if err != nil {
+		return fmt.Errorf("in configureAdminYouTube(): %s", err)
+	}
+	if s.cfg.Features.Events {
+		// new videos reach the servers' event streams
+		s.events.db = s.db
+	}
+	youtube.SetDeadChannelReporter(deadChannelReporter{s: s})
+	youtube.SetVideoStore(videoStore{db: s.db, events: s.events, webhooks: s.cfg.Features.Webhooks})
+
+	return nil
+}
+
+// Lists the admin actions
+func printAdminActions(w io.Writer) {
+	names := make([]string, 0, len(adminActions))
+	for name := range adminActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage: youtube-custom-feeds admin <action> [arguments] [flags]")
+	fmt.Fprintln(w, "Actions:")
+	for _, name := range names {
+		action := adminActions[name]
+		fmt.Fprintf(w, "  %-34s %s\n", name+" "+action.usage, action.summary)
+	}
+}
+
+// Retrieves the user with the firebase id
+func getAdminUser(ctx context.Context, s *state, firebaseId string) (adminUser, error) {
+	userId, err := getUserId(ctx, s, firebaseId)
+	if err != nil {
+		return adminUser{}, fmt.Errorf("in getAdminUser(): user with firebase id %s: %s", firebaseId, err)
+	}
+
+	user, err := s.db.GetUserById(ctx, userId)
+	if err != nil {
+		return adminUser{}, fmt.Errorf("in getAdminUser(): error retrieving user with id %v: %s", userId, err)
+	}
+
+	return toAdminUser(user), nil
+}
+
+// Retrieves the user's feeds
+func getAdminUserFeeds(ctx context.Context, s *state, userId int32) ([]feedResource, error) {
+	feeds, err := getAllUserFeedDetails(ctx, s, userId)
+	if err != nil {
+		return []feedResource{}, fmt.Errorf("in getAdminUserFeeds(): %s", err)
+	}
+
+	resources := []feedResource{}
+	for _, feed := range feeds {
+		resources = append(resources, toFeedResource(database.GetUserFeedRow(feed)))
+	}
+
+	return resources, nil
+}
+
+func adminListUsers(ctx context.Context, s *state, w io.Writer, args []string) error {
+	users, err := s.db.GetAllUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("in adminListUsers(): error retrieving users: %s", err)
+	}
+
+	resBody := []adminUser{}
+	for _, user := range users {
+		resBody = append(resBody, toAdminUser(user))
+	}
+
+	return printJSON(w, resBody)
+}
+
+func adminShowUser(ctx context.Context, s *state, w io.Writer, args []string) error {
+	user, err := getAdminUser(ctx, s, args[0])
+	if err != nil {
+		return fmt.Errorf("in adminShowUser(): %s", err)
+	}
+
+	user.Feeds, err = getAdminUserFeeds(ctx, s, user.ID)
+	if err != nil {
+		return fmt.Errorf("in adminShowUser(): %s", err)
+	}
+
+	return printJSON(w, user)
+}
+
+func adminDumpUser(ctx context.Context, s *state, w io.Writer, args []string) error {
+	user, err := getAdminUser(ctx, s, args[0])
+	if err != nil {
+		return fmt.Errorf("in adminDumpUser(): %s", err)
+	}
+
+	feeds, err := getAdminUserFeeds(ctx, s, user.ID)
+	if err != nil {
+		return fmt.Errorf("in adminDumpUser(): %s", err)
+	}
+
+	type returnVals struct {
+		User  adminUser   `json:"user"`
+		Feeds []adminFeed `json:"feeds"`
+	}
+	resBody := returnVals{User: user, Feeds: []adminFeed{}}
+
+	for _, feed := range feeds {
+		channels, err := getAllFeedChannelDetails(ctx, s, feed.ID)
+		if err != nil {
+			return fmt.Errorf("in adminDumpUser(): %s", err)
+		}
+
+		dumped := adminFeed{feedResource: feed, Channels: []channelResource{}}
+		for _, channel := range channels {
+			resource := toChannelResource(database.GetFeedChannelDetailsRow(channel))
+			resource.PreviousHandles, err = getPreviousChannelHandles(ctx, s, channel.ChannelID, channel.ChannelHandle)
+			if err != nil {
+				return fmt.Errorf("in adminDumpUser(): %s", err)
+			}
+			dumped.Channels = append(dumped.Channels, resource)
+		}
+		resBody.Feeds = append(resBody.Feeds, dumped)
+	}
+
+	return printJSON(w, resBody)
+}
+
+type orphanedChannel struct {
+	ID     string `json:"id"`
+	Handle string `json:"handle"`
+}
+
+func adminListOrphans(ctx context.Context, s *state, w io.Writer, args []string) error {
+	channels, err := getOrphanedChannels(ctx, s)
+	if err != nil {
+		return fmt.Errorf("in adminListOrphans(): %s", err)
+	}
+
+	resBody := []orphanedChannel{}
+	for _, channel := range channels {
+		resBody = append(resBody, orphanedChannel{ID: channel.ChannelID, Handle: channel.ChannelHandle})
+	}
+
+	return printJSON(w, resBody)
+}
+
+func adminPurgeOrphans(ctx context.Context, s *state, w io.Writer, args []string) error {
+	deleted, err := purgeOrphanedChannels(ctx, s)
+
+	type returnVals struct {
+		Deleted []string `json:"deleted"`
+	}
+	printErr := printJSON(w, returnVals{Deleted: deleted})
+
+	if err != nil {
+		return fmt.Errorf("in adminPurgeOrphans(): %s", err)
+	}
+	return printErr
+}
+
+func adminResolveChannel(ctx context.Context, s *state, w io.Writer, args []string) error {
+	channelId, active, err := resolveChannel(ctx, s, args[0])
+	if err != nil {
+		return fmt.Errorf("in adminResolveChannel(): %w", err)
+	}
+
+	type returnVals struct {
+		ChannelID string `json:"channelId"`
+		Status    string `json:"status"`
+	}
+	resBody := returnVals{ChannelID: channelId, Status: CHANNEL_ACTIVE}
+	if !active {
+		resBody.Status = CHANNEL_DEAD
+	}
+
+	return printJSON(w, resBody)
+}
+
+func adminRefreshFeed(ctx context.Context, s *state, w io.Writer, args []string) error {
+	feedId, err := strconv.ParseInt(args[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("in adminRefreshFeed(): invalid feed id<%s>", args[0])
+	}
+
+	exists, err := containsFeedId(ctx, s, int32(feedId))
+	if err != nil {
+		return fmt.Errorf("in adminRefreshFeed(): %s", err)
+	}
+	if !exists {
+		return fmt.Errorf("in adminRefreshFeed(): feed with id %d does not exist", feedId)
+	}
+
+	channels, err := getAllFeedChannelPriorities(ctx, s, int32(feedId))
+	if err != nil {
+		return fmt.Errorf("in adminRefreshFeed(): %s", err)
+	}
+	if len(channels) == 0 {
+		return fmt.Errorf("in adminRefreshFeed(): feed with id %d has no channels", feedId)
+	}
+
+	videos, status := youtube.GetFeedVideosByDate(ctx, int64(s.cfg.Feeds.VideoLimit), channels)
+
+	type returnVals struct {
+		FeedID   int32              `json:"feedId"`
+		Status   youtube.FeedStatus `json:"status"`
+		Channels int                `json:"channels"`
+		Videos   int                `json:"videos"`
+	}
+
+	return printJSON(w, returnVals{FeedID: int32(feedId), Status: status, Channels: len(channels), Videos: len(videos)})
+}
+
+func adminPrintQuota(ctx context.Context, s *state, w io.Writer, args []string) error {
+	report, err := getQuotaReport(ctx, s, QUOTA_HISTORY_DAYS)
+	if err != nil {
+		return fmt.Errorf("in adminPrintQuota(): %s", err)
+	}
+
+	return printJSON(w, report)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+)
+
+// Runs the named admin action against s, returning what it printed
+func runAdminAction(t *testing.T, s *state, name string, args ...string) (string, error) {
+	var buf bytes.Buffer
+	err := adminActions[name].run(context.Background(), s, &buf, args)
+	return buf.String(), err
+}
+
+func TestAdminShowUser(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetUserById", row(int64(1), "firebase-user", testTime, testTime))
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2), feedDetailsRow(2, "science", 0))
+
+	output, err := runAdminAction(t, s, "user", "firebase-user")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var user adminUser
+	err = json.Unmarshal([]byte(output), &user)
+	if err != nil {
+		t.Fatalf("error decoding output %q: %v", output, err)
+	}
+	if user.ID != 1 || user.FirebaseID != "firebase-user" || len(user.Feeds) != 2 || user.Feeds[0].ChannelCount != 2 {
+		t.Errorf("got user %+v", user)
+	}
+}
+
+func TestAdminShowUnknownUser(t *testing.T) {
+	s, _ := newFakeState(t)
+
+	_, err := runAdminAction(t, s, "user", "nobody")
+	if err == nil || !strings.Contains(err.Error(), "nobody") {
+		t.Errorf("got error %v, want one naming the firebase id", err)
+	}
+}
+
+func TestAdminDumpUser(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetUserById", row(int64(1), "firebase-user", testTime, testTime))
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2))
+	db.set("GetAllFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"), deadFeedChannelDetailsRow("UC2", "@band"))
+	db.set("GetChannelHandleHistory", row("@artist", testTime, testTime), row("@artistold", testTime, testTime))
+
+	output, err := runAdminAction(t, s, "dump", "firebase-user")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var dump struct {
+		User  adminUser `json:"user"`
+		Feeds []struct {
+			Name     string            `json:"name"`
+			Channels []channelResource `json:"channels"`
+		} `json:"feeds"`
+	}
+	err = json.Unmarshal([]byte(output), &dump)
+	if err != nil {
+		t.Fatalf("error decoding output %q: %v", output, err)
+	}
+	if dump.User.FirebaseID != "firebase-user" || len(dump.Feeds) != 1 || dump.Feeds[0].Name != "music" {
+		t.Fatalf("got dump %+v", dump)
+	}
+	channels := dump.Feeds[0].Channels
+	if len(channels) != 2 || channels[1].Status != CHANNEL_DEAD || len(channels[0].PreviousHandles) != 1 {
+		t.Errorf("got channels %+v", channels)
+	}
+}
+
+func TestAdminPurgeOrphans(t *testing.T) {
+	s, db := newFakeState(t)
+	db.set("PurgeOrphanedChannels", row("UC1"), row("UC2"))
+
+	output, err := runAdminAction(t, s, "purge-orphans")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(output, `"UC1"`) || !strings.Contains(output, `"UC2"`) {
+		t.Errorf("got output %q, want both channels reported deleted", output)
+	}
+}
+
+func TestAdminPurgeKeepsChannelsInFeeds(t *testing.T) {
+	queries := openTestDatabase(t)
+	ctx := context.Background()
+
+	for _, channelId := range []string{"UC1", "UC2"} {
+		_, err := queries.InsertChannel(ctx, database.InsertChannelParams{
+			ChannelID:       channelId,
+			ChannelUploadID: "UU" + channelId[2:],
+			ChannelHandle:   "@" + channelId,
+			ChannelUrl:      "https://www.youtube.com/channel/" + channelId,
+		})
+		if err != nil {
+			t.Fatalf("InsertChannel() error: %v", err)
+		}
+	}
+	userId, err := queries.CreateUser(ctx, database.CreateUserParams{FbUserID: "firebase-user", CreatedAt: testTime, UpdatedAt: testTime})
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	feed, err := queries.CreateFeed(ctx, database.CreateFeedParams{CreatedAt: testTime, UpdatedAt: testTime, Name: "music", UserID: userId})
+	if err != nil {
+		t.Fatalf("CreateFeed() error: %v", err)
+	}
+	err = queries.InsertFeedChannel(ctx, database.InsertFeedChannelParams{FeedID: feed.ID, ChannelID: "UC1"})
+	if err != nil {
+		t.Fatalf("InsertFeedChannel() error: %v", err)
+	}
+
+	deleted, err := queries.PurgeOrphanedChannels(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0] != "UC2" {
+		t.Errorf("PurgeOrphanedChannels() got %v, %v, want only UC2 deleted", deleted, err)
+	}
+	_, err = queries.GetUploadId(ctx, "UC1")
+	if err != nil {
+		t.Errorf("channel in a feed was deleted: %v", err)
+	}
+}
+
+func TestAdminResolveChannel(t *testing.T) {
+	cases := []struct {
+		name       string
+		items      string
+		wantStatus string
+		wantCall   string
+	}{
+		{
+			name:       "alive",
+			items:      `[{"id": "UC1", "snippet": {"customUrl": "@artist", "title": "Artist"}, "statistics": {"subscriberCount": "10", "videoCount": "2"}}]`,
+			wantStatus: CHANNEL_ACTIVE,
+			wantCall:   "MarkChannelActive",
+		},
+		{name: "gone", items: `[]`, wantStatus: CHANNEL_DEAD, wantCall: "MarkChannelDead"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			useFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"items": %s}`, c.items)
+			})
+			s, db := newFakeState(t)
+			db.set("GetUploadId", row("UU1"))
+
+			output, err := runAdminAction(t, s, "resolve", "UC1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(output, `"status": "`+c.wantStatus+`"`) {
+				t.Errorf("got output %q, want status %s", output, c.wantStatus)
+			}
+			if !db.called(c.wantCall) {
+				t.Errorf("%s was not called", c.wantCall)
+			}
+		})
+	}
+}
+
+func TestAdminResolveUnstoredChannel(t *testing.T) {
+	s, _ := newFakeState(t)
+
+	_, err := runAdminAction(t, s, "resolve", "UCunknown")
+	if err == nil || !strings.Contains(err.Error(), "not stored") {
+		t.Errorf("got error %v, want the channel reported as not stored", err)
+	}
+}
+
+func TestAdminRefreshFeed(t *testing.T) {
+	useFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [{"snippet": {"channelTitle": "Artist", "title": "Song", "publishedAt": "2024-11-01T12:00:00Z", "resourceId": {"videoId": "v1"}, "thumbnails": {"high": {"url": "https://i.ytimg.com/vi/v1/hqdefault.jpg"}}}}]}`)
+	})
+	s, db := newFakeState(t)
+	db.set("ContainsFeedId", row(true))
+	db.set("GetAllFeedChannelPriorities", row("UC9", "@artist", "UU9", "active", "", int64(1)))
+
+	output, err := runAdminAction(t, s, "refresh", "7")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(output, `"videos": 1`) || !strings.Contains(output, `"status": "ok"`) {
+		t.Errorf("got output %q, want one video retrieved", output)
+	}
+
+	db.set("ContainsFeedId", row(false))
+	_, err = runAdminAction(t, s, "refresh", "8")
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("got error %v, want the missing feed reported", err)
+	}
+
+	_, err = runAdminAction(t, s, "refresh", "seven")
+	if err == nil || !strings.Contains(err.Error(), "invalid feed id") {
+		t.Errorf("got error %v, want the feed id rejected", err)
+	}
+}
+
+func TestRunAdminRejectsUsage(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{nil, "expected an action"},
+		{[]string{"drop-tables"}, "unknown action"},
+		{[]string{"user"}, "usage: admin user <firebase-id>"},
+		{[]string{"quota", "today"}, "usage: admin quota"},
+	}
+
+	for _, c := range cases {
+		err := runAdmin(config.Defaults(), c.args)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("runAdmin(%v) got error %v, want one mentioning %s", c.args, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// ------------------------ //
+//		API V2 ENDPOINTS	//
+// ------------------------ //
+
+// v2 addresses feeds and channels by id rather than by name/handle and responds with full
+// resource representations. Handlers reuse the same pipeline functions as v1.
+
+type feedResource struct {
+	ID           int32     `json:"id"`
+	Name         string    `json:"name"`
+	Order        string    `json:"order"`
+	ChannelCount int64     `json:"channelCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type channelResource struct {
+	ID                string     `json:"id"`
+	Handle            string     `json:"handle"`
+	URL               string     `json:"url"`
+	UploadID          string     `json:"uploadId"`
+	Title             string     `json:"title"`
+	Description       string     `json:"description"`
+	Avatars           avatarURLs `json:"avatars"`
+	SubscriberCount   int64      `json:"subscriberCount"`
+	VideoCount        int64      `json:"videoCount"`
+	MetadataUpdatedAt *time.Time `json:"metadataUpdatedAt"`
+	Status            string     `json:"status"`
+	StatusReason      string     `json:"statusReason"`
+	StatusChangedAt   *time.Time `json:"statusChangedAt"`
+	Priority          int32      `json:"priority"`
+	AddedAt           time.Time  `json:"addedAt"`
+	PreviousHandles   []string   `json:"previousHandles,omitempty"`
+}
+
+type avatarURLs struct {
+	Default string `json:"default"`
+	Medium  string `json:"medium"`
+	High    string `json:"high"`
+}
+
+type createFeedV2Params struct {
+	Name string `json:"name"`
+}
+
+type updateFeedV2Params struct {
+	Name  *string `json:"name"`
+	Order *string `json:"order"`
+}
+
+type addChannelV2Params struct {
+	Handle string `json:"handle"`
+}
+
+type updateChannelV2Params struct {
+	Priority int32 `json:"priority"`
+}
+
+func toFeedResource(feed database.GetUserFeedRow) feedResource {
+	return feedResource{
+		ID:           feed.ID,
+		Name:         feed.Name,
+		Order:        feed.MergeStrategy,
+		ChannelCount: feed.ChannelCount,
+		CreatedAt:    feed.CreatedAt,
+		UpdatedAt:    feed.UpdatedAt,
+	}
+}
+
+func toChannelResource(channel database.GetFeedChannelDetailsRow) channelResource {
+	resource := channelResource{
+		ID:          channel.ChannelID,
+		Handle:      channel.ChannelHandle,
+		URL:         channel.ChannelUrl,
+		UploadID:    channel.ChannelUploadID,
+		Title:       channel.Title,
+		Description: channel.Description,
+		Avatars: avatarURLs{
+			Default: channel.AvatarDefaultUrl,
+			Medium:  channel.AvatarMediumUrl,
+			High:    channel.AvatarHighUrl,
+		},
+		SubscriberCount: channel.SubscriberCount,
+		VideoCount:      channel.VideoCount,
+		Status:          channel.Status,
+		StatusReason:    channel.StatusReason,
+		Priority:        channel.Priority,
+		AddedAt:         channel.AddedAt,
+	}
+	if channel.MetadataUpdatedAt.Valid {
+		resource.MetadataUpdatedAt = &channel.MetadataUpdatedAt.Time
+	}
+	if channel.StatusChangedAt.Valid {
+		resource.StatusChangedAt = &channel.StatusChangedAt.Time
+	}
+
+	return resource
+}
+
+// Decodes the JSON request body into params, returns statusCode if error
+func unpackV2Body[T any](params *T, r *http.Request) (int, error) {
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(params)
+	if err != nil {
+		return statusCodes.ErrDecoding, fmt.Errorf("in unpackV2Body(): error decoding parameters: %s", err)
+	}
+
+	return statusCodes.Success, nil
+}
+
+// Resolves the user and the {feedId} path variable, ensuring the feed belongs to the user.
+// Returns statusCode if error
+func unpackFeedRequest(r *http.Request, s *state) (int32, database.GetUserFeedRow, int, error) {
+	userId, statusCode, err := unpackGetRequest(r, s)
+	if err != nil {
+		return 0, database.GetUserFeedRow{}, statusCode, fmt.Errorf("in unpackFeedRequest(): %s", err)
+	}
+
+	feedId, err := strconv.ParseInt(mux.Vars(r)["feedId"], 10, 32)
+	if err != nil {
+		return 0, database.GetUserFeedRow{}, statusCodes.ErrRequest, fmt.Errorf("in unpackFeedRequest(): invalid feedId: %s", err)
+	}
+
+	feed, err := getUserFeed(r.Context(), s, userId, int32(feedId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, feed, statusCodes.ErrNotFound, fmt.Errorf("in unpackFeedRequest(): %s", err)
+	}
+	if err != nil {
+		return 0, feed, statusCodes.ErrServer, fmt.Errorf("in unpackFeedRequest(): %s", err)
+	}
+
+	return userId, feed, statusCodes.Success, nil
+}
+
+// GET - lists all of the user's feeds
+func (s *state) listFeedsV2(w http.ResponseWriter, r *http.Request) {
+	userId, statusCode, err := unpackGetRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in listFeedsV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	feeds, err := getAllUserFeedDetails(r.Context(), s, userId)
+	if err != nil {
+		logRequestError(r, "in listFeedsV2(): error retrieving feeds", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	type returnVals struct {
+		Feeds []feedResource `json:"feeds"`
+	}
+	resBody := returnVals{
+		Feeds: []feedResource{},
+	}
+	for _, feed := range feeds {
+		resBody.Feeds = append(resBody.Feeds, toFeedResource(database.GetUserFeedRow(feed)))
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
+
+// POST - creates a new feed
+func (s *state) createFeedV2(w http.ResponseWriter, r *http.Request) {
+	userId, statusCode, err := unpackGetRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in createFeedV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	params := createFeedV2Params{}
+	_, err = unpackV2Body(&params, r)
+	if err != nil || params.Name == "" {
+		logRequestError(r, "in createFeedV2(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	contains, created, err := createFeed(r.Context(), s, userId, params.Name)
+	if err != nil {
+		logRequestError(r, "in createFeedV2(): error creating feed", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
+		return
+	}
+	if contains {
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrConflict], statusCodes.ErrConflict)
+		return
+	}
+
+	feed, err := getUserFeed(r.Context(), s, userId, created.ID)
+	if err != nil {
+		logRequestError(r, "in createFeedV2(): error retrieving created feed", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	writeResponse(w, toFeedResource(feed), statusCodes.Created)
+}
+
+// GET - retrieves a single feed
+func (s *state) getFeedV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in getFeedV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	writeResponse(w, toFeedResource(feed), statusCodes.Success)
+}
+
+// PATCH - renames the feed and/or changes its order
+func (s *state) updateFeedV2(w http.ResponseWriter, r *http.Request) {
+	userId, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in updateFeedV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	params := updateFeedV2Params{}
+	statusCode, err = unpackV2Body(&params, r)
+	if err != nil {
+		logRequestError(r, "in updateFeedV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	// every change is validated before either is applied so a rejected request changes nothing
+	name := feed.Name
+	strategy := youtube.MergeStrategy(feed.MergeStrategy)
+	if params.Order != nil {
+		strategy, err = youtube.ParseMergeStrategy(*params.Order)
+		if err != nil {
+			logRequestError(r, "in updateFeedV2(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+			return
+		}
+	}
+
+	if params.Name != nil && *params.Name != feed.Name {
+		if *params.Name == "" {
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+			return
+		}
+
+		contains, err := containsUserFeed(r.Context(), s, userId, *params.Name)
+		if err != nil {
+			logRequestError(r, "in updateFeedV2(): error checking for existing feed name", err)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+			return
+		}
+		if contains {
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrConflict], statusCodes.ErrConflict)
+			return
+		}
+		name = *params.Name
+	}
+
+	if name != feed.Name || string(strategy) != feed.MergeStrategy {
+		err = updateFeed(r.Context(), s, feed.ID, name, strategy)
+		if err != nil {
+			logRequestError(r, "in updateFeedV2(): error updating feed", err, logging.KeyFeedID, feed.ID)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
+			return
+		}
+	}
+
+	feed, err = getUserFeed(r.Context(), s, userId, feed.ID)
+	if err != nil {
+		logRequestError(r, "in updateFeedV2(): error retrieving updated feed", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	writeResponse(w, toFeedResource(feed), statusCodes.Success)
+}
+
+// DELETE - deletes the feed and all of its feed-channels
+func (s *state) deleteFeedV2(w http.ResponseWriter, r *http.Request) {
+	userId, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in deleteFeedV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	err = deleteFeed(r.Context(), s, userId, feed.Name)
+	if err != nil {
+		logRequestError(r, "in deleteFeedV2(): error deleting feed", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	message := fmt.Sprintf("Successfully deleted feed with id - %v", feed.ID)
+	writeResponseMessage(w, message, statusCodes.Success)
+}
+
+// GET - lists the channels in the feed
+func (s *state) listFeedChannelsV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in listFeedChannelsV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	channels, err := getAllFeedChannelDetails(r.Context(), s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in listFeedChannelsV2(): error retrieving channels", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	type returnVals struct {
+		FeedID   int32             `json:"feedId"`
+		Channels []channelResource `json:"channels"`
+	}
+	resBody := returnVals{
+		FeedID:   feed.ID,
+		Channels: []channelResource{},
+	}
+	for _, channel := range channels {
+		resBody.Channels = append(resBody.Channels, toChannelResource(database.GetFeedChannelDetailsRow(channel)))
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
+
+// POST - adds a channel, by handle, to the feed
+func (s *state) addFeedChannelV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in addFeedChannelV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	params := addChannelV2Params{}
+	_, err = unpackV2Body(&params, r)
+	if err != nil || params.Handle == "" {
+		logRequestError(r, "in addFeedChannelV2(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	err = addChannelToFeed(r.Context(), s, feed.ID, params.Handle)
+	if errors.Is(err, youtube.ErrQuotaExceeded) {
+		logRequestError(r, "in addFeedChannelV2(): request failed", err, logging.KeyStatus, statusCodes.ErrQuota)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrQuota], statusCodes.ErrQuota)
+		return
+	}
+	if errors.Is(err, errChannelNotFound) {
+		logRequestError(r, "in addFeedChannelV2(): request failed", err, logging.KeyStatus, statusCodes.ErrNotFound)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrNotFound], statusCodes.ErrNotFound)
+		return
+	}
+	if errors.Is(err, youtube.ErrUnavailable) {
+		logRequestError(r, "in addFeedChannelV2(): request failed", err, logging.KeyStatus, statusCodes.ErrUpstream)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrUpstream], statusCodes.ErrUpstream)
+		return
+	}
+	if err != nil {
+		logRequestError(r, "in addFeedChannelV2(): error adding channel to feed", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	channelId, err := getChannelId(r.Context(), s, params.Handle)
+	if err != nil {
+		logRequestError(r, "in addFeedChannelV2(): error retrieving channelId", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	channel, err := getFeedChannelDetails(r.Context(), s, feed.ID, channelId)
+	if err != nil {
+		logRequestError(r, "in addFeedChannelV2(): error retrieving added channel", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	writeResponse(w, toChannelResource(channel), statusCodes.Created)
+}
+
+// Resolves the {channelId} path variable to a channel in the feed, returns statusCode if error
+func unpackFeedChannel(r *http.Request, s *state, feedId int32) (database.GetFeedChannelDetailsRow, int, error) {
+	channel, err := getFeedChannelDetails(r.Context(), s, feedId, mux.Vars(r)["channelId"])
+	if errors.Is(err, sql.ErrNoRows) {
+		return channel, statusCodes.ErrNotFound, fmt.Errorf("in unpackFeedChannel(): %s", err)
+	}
+	if err != nil {
+		return channel, statusCodes.ErrServer, fmt.Errorf("in unpackFeedChannel(): %s", err)
+	}
+
+	return channel, statusCodes.Success, nil
+}
+
+// GET - retrieves a single channel in the feed
+func (s *state) getFeedChannelV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in getFeedChannelV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	channel, statusCode, err := unpackFeedChannel(r, s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in getFeedChannelV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	resource := toChannelResource(channel)
+	resource.PreviousHandles, err = getPreviousChannelHandles(r.Context(), s, channel.ChannelID, channel.ChannelHandle)
+	if err != nil {
+		logRequestError(r, "in getFeedChannelV2(): error retrieving handle history", err, logging.KeyChannelID, channel.ChannelID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	writeResponse(w, resource, statusCodes.Success)
+}
+
+// PATCH - updates the priority of a channel in the feed
+func (s *state) updateFeedChannelV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in updateFeedChannelV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	channel, statusCode, err := unpackFeedChannel(r, s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in updateFeedChannelV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	params := updateChannelV2Params{}
+	_, err = unpackV2Body(&params, r)
+	if err == nil && params.Priority < 1 {
+		err = fmt.Errorf("priority must be at least 1, got %v", params.Priority)
+	}
+	if err != nil {
+		logRequestError(r, "in updateFeedChannelV2(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	err = updateFeedChannelPriority(r.Context(), s, feed.ID, channel.ChannelID, params.Priority)
+	if errors.Is(err, errFeedChannelNotFound) {
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrNotFound], statusCodes.ErrNotFound)
+		return
+	}
+	if err != nil {
+		logRequestError(r, "in updateFeedChannelV2(): error updating channel priority", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	channel.Priority = params.Priority
+	writeResponse(w, toChannelResource(channel), statusCodes.Success)
+}
+
+// DELETE - removes a channel from the feed
+func (s *state) deleteFeedChannelV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in deleteFeedChannelV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	channel, statusCode, err := unpackFeedChannel(r, s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in deleteFeedChannelV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	err = deleteFeedChannel(r.Context(), s, feed.ID, channel.ChannelID)
+	if err != nil {
+		logRequestError(r, "in deleteFeedChannelV2(): error deleting channel", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	message := fmt.Sprintf("Successfully deleted channel with id - %s from feed with id - %v", channel.ChannelID, feed.ID)
+	writeResponseMessage(w, message, statusCodes.Success)
+}
+
+// GET - retrieves youtube videos for the feed
+func (s *state) getFeedVideosV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in getFeedVideosV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	type returnVals struct {
+		FeedID   int32                   `json:"feedId"`
+		Status   youtube.FeedStatus      `json:"status"`
+		Count    int                     `json:"count"`
+		Videos   []youtube.Video         `json:"videos"`
+		Channels []youtube.ChannelStatus `json:"channels"`
+	}
+	resBody := returnVals{
+		FeedID:   feed.ID,
+		Status:   youtube.FeedEmpty,
+		Videos:   []youtube.Video{},
+		Channels: []youtube.ChannelStatus{},
+	}
+
+	if feed.ChannelCount == 0 {
+		writeResponse(w, resBody, statusCodes.Success)
+		return
+	}
+
+	feedChannels, err := getAllFeedChannelPriorities(r.Context(), s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in getFeedVideosV2(): error retrieving feed channels", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	mergeOptions, statusCode, err := getMergeOptions(r, s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in getFeedVideosV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	resBody.Videos, resBody.Channels, resBody.Status = youtube.GetFeedVideos(r.Context(), int64(s.cfg.Feeds.VideoLimit), feedChannels, mergeOptions)
+	resBody.Count = len(resBody.Videos)
+
+	// a partial listing must not be revalidated against the stored videos once the missing
+	// channels load
+	if resBody.Status == youtube.FeedPartial {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	if resBody.Status == youtube.FeedFailed {
+		logRequestError(r, "in getFeedVideosV2(): every channel in feed failed", nil, logging.KeyStatus, statusCodes.ErrUpstream, logging.KeyFeedID, feed.ID)
+		writeResponse(w, resBody, statusCodes.ErrUpstream)
+		return
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
@@ -3,51 +3,65 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
 	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
 	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
 )
 
+// Returned when a channel handle does not match any YouTube channel
+var errChannelNotFound = errors.New("channel handle did not match any youtube channel")
+
+// Returned when a channel is not in the feed it is addressed through
+var errFeedChannelNotFound = errors.New("channel is not in the feed")
+
 type state struct {
-	db  *database.Queries
-	cfg *config.Config
+	db       *database.Queries
+	conn     *sql.DB // pinged by the readiness probe
+	cfg      *config.Config
+	limiters *rateLimiters
+	events   *eventPublisher
+	metrics  *metrics
+	draining atomic.Bool // set once shutdown starts so the instance reports not ready
 }
 
-// retrieves the current state with sql database connection and current userName
-func getState() (*state, error) {
+// Connects to the database described by cfg and builds the server state
+func getState(cfg config.Config) (*state, error) {
 	var s state
+	s.cfg = &cfg
 
-	tempCfg, err := config.Read() // retrieves state from youtube-custom-feeds.json
-	if err != nil {
-		return &state{}, fmt.Errorf("in getState(): error retireving config json: %s", err)
-	}
-
-	s.cfg = &tempCfg
-
-	db, err := sql.Open("postgres", s.cfg.DBUrl)
+	db, err := sql.Open("postgres", cfg.Database.DSN())
 	if err != nil {
 		return &state{}, fmt.Errorf("in getState(): error connecting to database: %s", err)
 	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetimeMinutes) * time.Minute)
 
 	err = db.Ping()
 	if err != nil {
-		log.Printf("Error pinging database: %v", err)
 		return &state{}, fmt.Errorf("in getState(): error pinging database: %v", err)
 	}
 
-	s.db = database.New(db)
+	s.metrics = newMetrics()
+	s.conn = db
+	s.db = database.New(instrumentedDB{db: db, metrics: s.metrics})
+	s.limiters = newRateLimiters(s.cfg.RateLimit)
+	s.events = newEventPublisher()
 
 	return &s, nil
 }
 
 // Retrieves user id using a firebase user id
-func getUserId(s *state, firebaseId string) (int32, error) {
-	userId, err := s.db.GetUserIdByFirebaseId(context.Background(), firebaseId)
+func getUserId(ctx context.Context, s *state, firebaseId string) (int32, error) {
+	userId, err := s.db.GetUserIdByFirebaseId(ctx, firebaseId)
 	if err != nil {
 		return 0, fmt.Errorf("in getUserId(): error retrieving userId: %s", err)
 	}
@@ -56,14 +70,14 @@ func getUserId(s *state, firebaseId string) (int32, error) {
 }
 
 // Creates a new user in the database
-func registerUser(s *state, firebaseId string) error {
+func registerUser(ctx context.Context, s *state, firebaseId string) error {
 	params := database.CreateUserParams{
 		FbUserID:  firebaseId,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	_, err := s.db.CreateUser(context.Background(), params)
+	_, err := s.db.CreateUser(ctx, params)
 	if err != nil {
 		return fmt.Errorf("error in registerUser(): error creating user in database: %s", err)
 	}
@@ -76,9 +90,8 @@ func registerUser(s *state, firebaseId string) error {
 //************************************//
 
 // Creates a custom feed for a user
-func createFeed(s *state, userId int32, feedName string) (bool, database.Feed, error) {
+func createFeed(ctx context.Context, s *state, userId int32, feedName string) (bool, database.Feed, error) {
 	feed := database.Feed{}
-	ctx := context.Background()
 
 	containsParams := database.ContainsFeedParams{
 		UserID: userId,
@@ -105,15 +118,28 @@ func createFeed(s *state, userId int32, feedName string) (bool, database.Feed, e
 		return false, feed, fmt.Errorf("error creating feed \"%s\" for user with id %v", feedName, userId)
 	}
 
-	log.Printf("Successfully created feed with - feed_id: %v, feedName: %v, for user with userId: %v",
-		feed.ID, feed.Name, feed.UserID)
+	logging.FromContext(ctx).Info("in createFeed(): created feed", logging.KeyFeedID, feed.ID, "feed_name", feed.Name, logging.KeyUserID, feed.UserID)
 	return false, feed, nil
 }
 
+// Checks if the user already has a feed with the provided name
+func containsUserFeed(ctx context.Context, s *state, userId int32, feedName string) (bool, error) {
+	params := database.ContainsFeedParams{
+		UserID: userId,
+		Name:   feedName,
+	}
+
+	contains, err := s.db.ContainsFeed(ctx, params)
+	if err != nil {
+		return false, fmt.Errorf("in containsUserFeed(): error checking if user has feed \"%s\": %s", feedName, err)
+	}
+
+	return contains, nil
+}
+
 // Retrieves all feeds belonging to the specified user
-func getAllUserFeeds(s *state, userId int32) ([]database.GetAllUserFeedsRow, error) {
+func getAllUserFeeds(ctx context.Context, s *state, userId int32) ([]database.GetAllUserFeedsRow, error) {
 	feeds := []database.GetAllUserFeedsRow{}
-	ctx := context.Background()
 
 	exists, err := s.db.ContainsUserById(ctx, userId)
 	if err != nil {
@@ -132,8 +158,7 @@ func getAllUserFeeds(s *state, userId int32) ([]database.GetAllUserFeedsRow, err
 }
 
 // Retrieves all feedNames belonging to the specified user
-func getAllUserFeedNames(s *state, userId int32) ([]string, error) {
-	ctx := context.Background()
+func getAllUserFeedNames(ctx context.Context, s *state, userId int32) ([]string, error) {
 
 	exists, err := s.db.ContainsUserById(ctx, userId)
 	if err != nil {
@@ -152,8 +177,7 @@ func getAllUserFeedNames(s *state, userId int32) ([]string, error) {
 }
 
 // Retrieves feed id for the feed withe the provided name, belonging to the specified user
-func getUserFeedId(s *state, userId int32, feedName string) (int32, error) {
-	ctx := context.Background()
+func getUserFeedId(ctx context.Context, s *state, userId int32, feedName string) (int32, error) {
 
 	exists, err := s.db.ContainsUserById(ctx, userId)
 	if err != nil {
@@ -177,8 +201,7 @@ func getUserFeedId(s *state, userId int32, feedName string) (int32, error) {
 }
 
 // Deletes the user, including all of their feeds and subsequent channels
-func deleteUser(s *state, userId int32) error {
-	ctx := context.Background()
+func deleteUser(ctx context.Context, s *state, userId int32) error {
 
 	exists, err := s.db.ContainsUserById(ctx, userId)
 	if err != nil {
@@ -188,7 +211,7 @@ func deleteUser(s *state, userId int32) error {
 		return fmt.Errorf("in deleteUser(): error checking if userId exists: %s", err)
 	}
 
-	err = deleteAllFeeds(s, userId)
+	err = deleteAllFeeds(ctx, s, userId)
 	if err != nil {
 		return fmt.Errorf("in deleteUser(): error deleting all feeds: %s", err)
 	}
@@ -202,8 +225,7 @@ func deleteUser(s *state, userId int32) error {
 }
 
 // Deletes all feeds belonging to the specified user
-func deleteAllFeeds(s *state, userId int32) error {
-	ctx := context.Background()
+func deleteAllFeeds(ctx context.Context, s *state, userId int32) error {
 
 	exists, err := s.db.ContainsUserById(ctx, userId)
 	if err != nil {
@@ -213,13 +235,13 @@ func deleteAllFeeds(s *state, userId int32) error {
 		return fmt.Errorf("in deleteAllFeeds(): error user with id %v does not exist in database", userId)
 	}
 
-	feedNames, err := getAllUserFeedNames(s, userId)
+	feedNames, err := getAllUserFeedNames(ctx, s, userId)
 	if err != nil {
 		return fmt.Errorf("in deleteAllFeeds(): error retrieving all user feedNames: %s", err)
 	}
 
 	for _, feedName := range feedNames {
-		err := deleteFeed(s, userId, feedName)
+		err := deleteFeed(ctx, s, userId, feedName)
 		if err != nil {
 			return fmt.Errorf("in deleteAllFeeds(): Error deleing all feeds: %s", err)
 		}
@@ -230,8 +252,7 @@ func deleteAllFeeds(s *state, userId int32) error {
 
 // Deletes feed with given name belonging to the specified user.
 // Deletes all feed-channels as a consequence
-func deleteFeed(s *state, userId int32, feedName string) error {
-	ctx := context.Background()
+func deleteFeed(ctx context.Context, s *state, userId int32, feedName string) error {
 
 	exists, err := s.db.ContainsUserById(ctx, userId)
 	if err != nil {
@@ -241,12 +262,12 @@ func deleteFeed(s *state, userId int32, feedName string) error {
 		return fmt.Errorf("error user with id %v does not exist in database", userId)
 	}
 
-	feedId, err := getUserFeedId(s, userId, feedName)
+	feedId, err := getUserFeedId(ctx, s, userId, feedName)
 	if err != nil {
 		return fmt.Errorf("in deleteFeed(): error retrieving feedId: %s", err)
 	}
 
-	err = deleteAllFeedChannels(s, feedId)
+	err = deleteAllFeedChannels(ctx, s, feedId)
 	if err != nil {
 		return fmt.Errorf("in deleteFeed(): error deleting all feed-channels: %s", err)
 	}
@@ -265,7 +286,7 @@ func deleteFeed(s *state, userId int32, feedName string) error {
 }
 
 // Creates channel
-func createChannel(s *state, channelId, uploadId, channelHandle string) error {
+func createChannel(ctx context.Context, s *state, channelId, uploadId, channelHandle string) error {
 	channelUrl := youtube.GetChannelURL(channelId)
 
 	params := database.InsertChannelParams{
@@ -275,23 +296,92 @@ func createChannel(s *state, channelId, uploadId, channelHandle string) error {
 		ChannelHandle:   channelHandle,
 	}
 
-	channel, err := s.db.InsertChannel(context.Background(), params)
+	channel, err := s.db.InsertChannel(ctx, params)
 	if err != nil {
 		return fmt.Errorf("error inserting channel \"%s\" into database: %s", channelHandle, err)
 	}
 
-	log.Printf("Successfully inserted channel \"%s\" in database", channel.ChannelHandle)
+	logging.FromContext(ctx).Info("in createChannel(): inserted channel", logging.KeyChannelID, channel.ChannelID, "handle", channel.ChannelHandle)
+
+	err = recordChannelHandle(ctx, s, channelId, channelHandle)
+	if err != nil {
+		return fmt.Errorf("error recording handle of channel \"%s\": %s", channelHandle, err)
+	}
+
+	return nil
+}
+
+// Records handle as an alias of the channel and makes it the channel's current handle. A handle
+// previously belonging to another channel is moved to this one. Aliases are stored and looked up
+// in lower case as handles are case-insensitive
+func recordChannelHandle(ctx context.Context, s *state, channelId, handle string) error {
+
+	params := database.UpsertChannelHandleParams{
+		Handle:      handle,
+		ChannelID:   channelId,
+		FirstSeenAt: time.Now(),
+	}
+
+	err := s.db.UpsertChannelHandle(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in recordChannelHandle(): error recording handle %s for channel with id %s: %s", handle, channelId, err)
+	}
+
+	updateParams := database.UpdateChannelHandleParams{
+		ChannelID:     channelId,
+		ChannelHandle: handle,
+	}
+
+	err = s.db.UpdateChannelHandle(ctx, updateParams)
+	if err != nil {
+		return fmt.Errorf("in recordChannelHandle(): error updating handle for channel with id %s: %s", channelId, err)
+	}
+
 	return nil
 }
 
+// Retrieves every handle the channel has been known by, most recently seen first
+func getChannelHandleHistory(ctx context.Context, s *state, channelId string) ([]string, error) {
+	handles := []string{}
+
+	rows, err := s.db.GetChannelHandleHistory(ctx, channelId)
+	if err != nil {
+		return handles, fmt.Errorf("in getChannelHandleHistory(): error retrieving handles for channel with id %s: %s", channelId, err)
+	}
+
+	for _, row := range rows {
+		handles = append(handles, row.Handle)
+	}
+
+	return handles, nil
+}
+
+// Retrieves the handles the channel was known by before currentHandle, most recently seen first
+func getPreviousChannelHandles(ctx context.Context, s *state, channelId, currentHandle string) ([]string, error) {
+	handles, err := getChannelHandleHistory(ctx, s, channelId)
+	if err != nil {
+		return nil, fmt.Errorf("in getPreviousChannelHandles(): %s", err)
+	}
+
+	var previous []string
+	for _, handle := range handles {
+		// aliases are stored in lower case, the current handle as YouTube spells it
+		if !strings.EqualFold(handle, currentHandle) {
+			previous = append(previous, handle)
+		}
+	}
+
+	return previous, nil
+}
+
 // Creates feed channel
-func createFeedChannel(s *state, feedId int32, channelId, uploadId, channelHandle string) error {
+func createFeedChannel(ctx context.Context, s *state, feedId int32, channelId, uploadId, channelHandle string) error {
 	containsParams := database.ContainsFeedChannelParams{
 		FeedID:    feedId,
 		ChannelID: channelId,
 	}
 
-	exists, err := s.db.ContainsFeedChannel(context.Background(), containsParams)
+	exists, err := s.db.ContainsFeedChannel(ctx, containsParams)
 	if err != nil {
 		return err
 	}
@@ -299,12 +389,12 @@ func createFeedChannel(s *state, feedId int32, channelId, uploadId, channelHandl
 		return nil
 	}
 
-	exists, err = s.db.ContainsChannel(context.Background(), channelId)
+	exists, err = s.db.ContainsChannel(ctx, channelId)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		err = createChannel(s, channelId, uploadId, channelHandle)
+		err = createChannel(ctx, s, channelId, uploadId, channelHandle)
 		if err != nil {
 			return err
 		}
@@ -315,7 +405,7 @@ func createFeedChannel(s *state, feedId int32, channelId, uploadId, channelHandl
 		ChannelID: channelId,
 	}
 
-	err = s.db.InsertFeedChannel(context.Background(), params)
+	err = s.db.InsertFeedChannel(ctx, params)
 	if err != nil {
 		return fmt.Errorf("error inserting feedId: %v, and channelId %s, : %s", feedId, channelId, err)
 	}
@@ -324,8 +414,7 @@ func createFeedChannel(s *state, feedId int32, channelId, uploadId, channelHandl
 }
 
 // Deletes channel
-func deleteChannel(s *state, channelId string) error {
-	ctx := context.Background()
+func deleteChannel(ctx context.Context, s *state, channelId string) error {
 
 	err := s.db.DeleteChannel(ctx, channelId)
 	if err != nil {
@@ -335,9 +424,29 @@ func deleteChannel(s *state, channelId string) error {
 	return nil
 }
 
+// Retrieves the channels not in any feed, left behind when a deletion failed part way
+func getOrphanedChannels(ctx context.Context, s *state) ([]database.GetOrphanedChannelsRow, error) {
+	channels, err := s.db.GetOrphanedChannels(ctx)
+	if err != nil {
+		return []database.GetOrphanedChannelsRow{}, fmt.Errorf("in getOrphanedChannels(): error retrieving channels: %s", err)
+	}
+
+	return channels, nil
+}
+
+// Deletes every channel not in any feed, returns the ids of those deleted. The check and the
+// delete are one statement so a channel added to a feed meanwhile is kept
+func purgeOrphanedChannels(ctx context.Context, s *state) ([]string, error) {
+	deleted, err := s.db.PurgeOrphanedChannels(ctx)
+	if err != nil {
+		return []string{}, fmt.Errorf("in purgeOrphanedChannels(): error deleting channels: %s", err)
+	}
+
+	return deleted, nil
+}
+
 // Deletes feed channel and deletes channel if no remaining references in feeds_channels db
-func deleteFeedChannel(s *state, feedId int32, channelId string) error {
-	ctx := context.Background()
+func deleteFeedChannel(ctx context.Context, s *state, feedId int32, channelId string) error {
 
 	params := database.DeleteFeedChannelParams{
 		FeedID:    feedId,
@@ -354,21 +463,21 @@ func deleteFeedChannel(s *state, feedId int32, channelId string) error {
 		return err
 	}
 	if !exists { // deleting channel from channels if no more references in feeds_channels
-		return deleteChannel(s, channelId)
+		return deleteChannel(ctx, s, channelId)
 	}
 
 	return nil
 }
 
 // Deletes all channels in the provided feed
-func deleteAllFeedChannels(s *state, feedId int32) error {
-	channelIds, err := getAllFeedChannels(s, feedId)
+func deleteAllFeedChannels(ctx context.Context, s *state, feedId int32) error {
+	channelIds, err := getAllFeedChannels(ctx, s, feedId)
 	if err != nil {
 		return fmt.Errorf("in deleteAllFeedChannels(): error retrieving all channelIds in feed: %s", err)
 	}
 
 	for _, channelId := range channelIds {
-		err := deleteFeedChannel(s, feedId, channelId)
+		err := deleteFeedChannel(ctx, s, feedId, channelId)
 		if err != nil {
 			return fmt.Errorf("in deleteAllFeedChannels(): error deleing channel-feed: %s", err)
 		}
@@ -378,9 +487,9 @@ func deleteAllFeedChannels(s *state, feedId int32) error {
 }
 
 // Gets all the channelIds for channels in feed
-func getAllFeedChannels(s *state, feedId int32) ([]string, error) {
+func getAllFeedChannels(ctx context.Context, s *state, feedId int32) ([]string, error) {
 
-	channels, err := s.db.GetAllFeedChannels(context.Background(), feedId)
+	channels, err := s.db.GetAllFeedChannels(ctx, feedId)
 	if err != nil {
 		return []string{}, fmt.Errorf("in getAllFeedChannels(): error getting channel ids for feed with id: %v, :%s", feedId, err)
 	}
@@ -389,13 +498,13 @@ func getAllFeedChannels(s *state, feedId int32) ([]string, error) {
 }
 
 // Retrieves all uploadIds associated with the provided channelIds
-func getAllUploadIds(s *state, channelIds []string) ([]string, error) {
+func getAllUploadIds(ctx context.Context, s *state, channelIds []string) ([]string, error) {
 	uploadIds := []string{}
 
 	for _, channelId := range channelIds {
-		uploadId, err := s.db.GetUploadId(context.Background(), channelId)
+		uploadId, err := s.db.GetUploadId(ctx, channelId)
 		if err != nil {
-			log.Println(fmt.Errorf("in getAllUploadIds(): error retrieiving uploadId: %s", err))
+			logging.FromContext(ctx).Error("in getAllUploadIds(): error retrieving upload id", logging.KeyChannelID, channelId, logging.Err(err))
 			continue
 		}
 		uploadIds = append(uploadIds, uploadId)
@@ -411,13 +520,13 @@ func getAllUploadIds(s *state, channelIds []string) ([]string, error) {
 }
 
 // Retrieves all handles associated with the provided channelIds
-func getAllChannelHandles(s *state, channelIds []string) ([]string, error) {
+func getAllChannelHandles(ctx context.Context, s *state, channelIds []string) ([]string, error) {
 	uploadIds := []string{}
 
 	for _, channelId := range channelIds {
-		uploadId, err := s.db.GetChannelHandle(context.Background(), channelId)
+		uploadId, err := s.db.GetChannelHandle(ctx, channelId)
 		if err != nil {
-			log.Println(fmt.Errorf("in getAllChannelHandles(): error retrieiving handle: %s", err))
+			logging.FromContext(ctx).Error("in getAllChannelHandles(): error retrieving handle", logging.KeyChannelID, channelId, logging.Err(err))
 			continue
 		}
 		uploadIds = append(uploadIds, uploadId)
@@ -427,34 +536,35 @@ func getAllChannelHandles(s *state, channelIds []string) ([]string, error) {
 }
 
 // Retrieves the channelId associated with the given handle
-func getChannelId(s *state, channelHandle string) (string, error) {
-	ctx := context.Background()
+func getChannelId(ctx context.Context, s *state, channelHandle string) (string, error) {
 
 	channelId, err := s.db.GetChannelIdByHandle(ctx, channelHandle)
 	if err != nil {
-		return "", fmt.Errorf("in getChannelId(): error retrieving channelId for channelHandle<%s>: %s", channelHandle, err)
+		return "", fmt.Errorf("in getChannelId(): error retrieving channelId for channelHandle<%s>: %w", channelHandle, err)
 	}
 
 	return channelId, nil
 }
 
 // Adds the channel to feed, calling createFeedChannel
-func addChannelToFeed(s *state, feedId int32, channelHandle string) error {
+func addChannelToFeed(ctx context.Context, s *state, feedId int32, channelHandle string) error {
 	var channelId, uploadId string
+	var details youtube.ChannelDetails
 	var exists bool
-	ctx := context.Background()
 
 	contains, err := s.db.ContainsChannelInDB(ctx, channelHandle)
 	if err != nil {
 		return fmt.Errorf("in addChannelToFeed(): error checking if DB contains channel: %v", err)
 	}
 	if !contains {
-		exists, channelId, uploadId, err = youtube.GetChannelIdUploadId(channelHandle)
+		exists, details, err = youtube.GetChannelDetails(ctx, channelHandle)
 		if err != nil {
-			return fmt.Errorf("in addChannelToFeed(): error retrieving channelId: %s", err)
+			return fmt.Errorf("in addChannelToFeed(): error retrieving channelId: %w", err)
 		} else if !exists {
-			return fmt.Errorf("in addChannelToFeed(): channelHandle did not match any youtube channel")
+			return fmt.Errorf("in addChannelToFeed(): handle<%s>: %w", channelHandle, errChannelNotFound)
 		}
+		channelId = details.ChannelId
+		uploadId = details.UploadId
 	} else {
 		channelIdUploadId, err := s.db.GetChannelIdUploadIdByHandle(ctx, channelHandle)
 		if err != nil {
@@ -464,26 +574,221 @@ func addChannelToFeed(s *state, feedId int32, channelHandle string) error {
 		uploadId = channelIdUploadId.ChannelUploadID
 	}
 
-	err = createFeedChannel(s, feedId, channelId, uploadId, channelHandle)
+	err = createFeedChannel(ctx, s, feedId, channelId, uploadId, channelHandle)
 	if err != nil {
 		return fmt.Errorf("in addChannelToFeed(): error creating feed channel: %s", err)
 	}
 
+	// the metadata refresh fills it in later if this fails
+	if !contains {
+		err = updateChannelMetadata(ctx, s, channelId, details.Metadata)
+		if err != nil {
+			logging.FromContext(ctx).Warn("in addChannelToFeed(): error storing channel metadata", logging.KeyChannelID, channelId, logging.Err(err))
+		}
+	}
+
+	return nil
+}
+
+// Stores the channel's metadata, marking it as refreshed now. A changed handle is recorded
+// as the channel's current handle, the old one remains an alias
+func updateChannelMetadata(ctx context.Context, s *state, channelId string, metadata youtube.ChannelMetadata) error {
+	params := database.UpdateChannelMetadataParams{
+		ChannelID:         channelId,
+		Title:             metadata.Title,
+		Description:       metadata.Description,
+		AvatarDefaultUrl:  metadata.AvatarDefaultURL,
+		AvatarMediumUrl:   metadata.AvatarMediumURL,
+		AvatarHighUrl:     metadata.AvatarHighURL,
+		SubscriberCount:   metadata.SubscriberCount,
+		VideoCount:        metadata.VideoCount,
+		MetadataUpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	err := s.db.UpdateChannelMetadata(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in updateChannelMetadata(): error updating metadata for channel with id %s: %s", channelId, err)
+	}
+
+	if metadata.Handle != "" {
+		err = recordChannelHandle(ctx, s, channelId, metadata.Handle)
+		if err != nil {
+			return fmt.Errorf("in updateChannelMetadata(): %s", err)
+		}
+	}
+
 	return nil
 }
 
 // Updates the name of the specified feed belonging to the specified user
-func updateFeedName(s *state, feedId int32, newFeedName string) error {
+func updateFeedName(ctx context.Context, s *state, feedId int32, newFeedName string) error {
 	params := database.UpdateFeedNameQueryParams{
 		ID:        feedId,
 		Name:      newFeedName,
 		UpdatedAt: time.Now(),
 	}
 
-	err := s.db.UpdateFeedNameQuery(context.Background(), params)
+	err := s.db.UpdateFeedNameQuery(ctx, params)
 	if err != nil {
 		return fmt.Errorf("in updateFeedName(): error updating the feed name: %s", err)
 	}
 
 	return nil
 }
+
+// Checks if a feed with the provided id exists
+func containsFeedId(ctx context.Context, s *state, feedId int32) (bool, error) {
+	exists, err := s.db.ContainsFeedId(ctx, feedId)
+	if err != nil {
+		return false, fmt.Errorf("in containsFeedId(): error checking feed with id %v: %s", feedId, err)
+	}
+
+	return exists, nil
+}
+
+// Retrieves the merge strategy stored for the feed
+func getFeedMergeStrategy(ctx context.Context, s *state, feedId int32) (youtube.MergeStrategy, error) {
+	stored, err := s.db.GetFeedMergeStrategy(ctx, feedId)
+	if err != nil {
+		return "", fmt.Errorf("in getFeedMergeStrategy(): error retrieving merge strategy for feed with id %v: %s", feedId, err)
+	}
+
+	strategy, err := youtube.ParseMergeStrategy(stored)
+	if err != nil {
+		return "", fmt.Errorf("in getFeedMergeStrategy(): invalid stored merge strategy: %s", err)
+	}
+
+	return strategy, nil
+}
+
+// Updates the merge strategy used to order the videos of the specified feed
+func updateFeedMergeStrategy(ctx context.Context, s *state, feedId int32, strategy youtube.MergeStrategy) error {
+	params := database.UpdateFeedMergeStrategyParams{
+		ID:            feedId,
+		MergeStrategy: string(strategy),
+		UpdatedAt:     time.Now(),
+	}
+
+	err := s.db.UpdateFeedMergeStrategy(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in updateFeedMergeStrategy(): error updating merge strategy: %s", err)
+	}
+
+	return nil
+}
+
+// Updates the feed's name and merge strategy together
+func updateFeed(ctx context.Context, s *state, feedId int32, name string, strategy youtube.MergeStrategy) error {
+	params := database.UpdateFeedParams{
+		ID:            feedId,
+		Name:          name,
+		MergeStrategy: string(strategy),
+		UpdatedAt:     time.Now(),
+	}
+
+	err := s.db.UpdateFeed(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in updateFeed(): error updating feed<%v>: %s", feedId, err)
+	}
+
+	return nil
+}
+
+// Retrieves the ids, handle and priority of every channel in the feed
+func getAllFeedChannelPriorities(ctx context.Context, s *state, feedId int32) ([]youtube.FeedChannel, error) {
+	feedChannels := []youtube.FeedChannel{}
+
+	rows, err := s.db.GetAllFeedChannelPriorities(ctx, feedId)
+	if err != nil {
+		return feedChannels, fmt.Errorf("in getAllFeedChannelPriorities(): error retrieving channels for feed with id: %v, :%s", feedId, err)
+	}
+
+	for _, row := range rows {
+		feedChannel := youtube.FeedChannel{
+			ChannelId: row.ChannelID,
+			Handle:    row.ChannelHandle,
+			UploadId:  row.ChannelUploadID,
+			Priority:  row.Priority,
+		}
+		if row.Status == CHANNEL_DEAD {
+			feedChannel.DeadReason = row.StatusReason
+		}
+		feedChannels = append(feedChannels, feedChannel)
+	}
+
+	return feedChannels, nil
+}
+
+// Updates the priority of the channel within the specified feed, errFeedChannelNotFound if the
+// channel is not in the feed
+func updateFeedChannelPriority(ctx context.Context, s *state, feedId int32, channelId string, priority int32) error {
+	if priority < 1 {
+		return fmt.Errorf("in updateFeedChannelPriority(): priority must be at least 1, got %v", priority)
+	}
+
+	params := database.UpdateFeedChannelPriorityParams{
+		FeedID:    feedId,
+		ChannelID: channelId,
+		Priority:  priority,
+	}
+
+	updated, err := s.db.UpdateFeedChannelPriority(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in updateFeedChannelPriority(): error updating priority: %s", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("in updateFeedChannelPriority(): channel with id %s: %w", channelId, errFeedChannelNotFound)
+	}
+
+	return nil
+}
+
+// Retrieves the feed with its channel count, only if it belongs to the specified user
+func getUserFeed(ctx context.Context, s *state, userId, feedId int32) (database.GetUserFeedRow, error) {
+	params := database.GetUserFeedParams{
+		ID:     feedId,
+		UserID: userId,
+	}
+
+	feed, err := s.db.GetUserFeed(ctx, params)
+	if err != nil {
+		return feed, fmt.Errorf("in getUserFeed(): error retrieving feed with id %v for user with id %v: %w", feedId, userId, err)
+	}
+
+	return feed, nil
+}
+
+// Retrieves all feeds, with their channel counts, belonging to the specified user
+func getAllUserFeedDetails(ctx context.Context, s *state, userId int32) ([]database.GetAllUserFeedDetailsRow, error) {
+	feeds, err := s.db.GetAllUserFeedDetails(ctx, userId)
+	if err != nil {
+		return []database.GetAllUserFeedDetailsRow{}, fmt.Errorf("in getAllUserFeedDetails(): error retrieving feeds for user with id %v: %s", userId, err)
+	}
+
+	return feeds, nil
+}
+
+// Retrieves every channel in the feed along with its feed specific details
+func getAllFeedChannelDetails(ctx context.Context, s *state, feedId int32) ([]database.GetAllFeedChannelDetailsRow, error) {
+	channels, err := s.db.GetAllFeedChannelDetails(ctx, feedId)
+	if err != nil {
+		return []database.GetAllFeedChannelDetailsRow{}, fmt.Errorf("in getAllFeedChannelDetails(): error retrieving channels for feed with id %v: %s", feedId, err)
+	}
+
+	return channels, nil
+}
+
+// Retrieves a single channel in the feed along with its feed specific details
+func getFeedChannelDetails(ctx context.Context, s *state, feedId int32, channelId string) (database.GetFeedChannelDetailsRow, error) {
+	params := database.GetFeedChannelDetailsParams{
+		FeedID:    feedId,
+		ChannelID: channelId,
+	}
+
+	channel, err := s.db.GetFeedChannelDetails(ctx, params)
+	if err != nil {
+		return channel, fmt.Errorf("in getFeedChannelDetails(): error retrieving channel<%s> in feed with id %v: %w", channelId, feedId, err)
+	}
+
+	return channel, nil
+}
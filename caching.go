@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+)
+
+// Cache-Control for feed and channel listings, clients must revalidate but may reuse the body on 304
+const CACHE_REVALIDATE = "private, no-cache"
+
+// Cache-Control for video listings, each request fans out YouTube API calls so clients may
+// reuse a response for a minute before revalidating
+const CACHE_VIDEOS = "private, max-age=60"
+
+// Routes whose successful responses carry an ETag and honour If-None-Match, with the
+// Cache-Control they are served with. Keyed by "METHOD path-template"
+var cachedRoutes = map[string]string{
+	http.MethodGet + " " + PREFIX + "/feeds":                                  CACHE_REVALIDATE,
+	http.MethodGet + " " + PREFIX + "/channels":                               CACHE_REVALIDATE,
+	http.MethodGet + " " + PREFIX + "/videos":                                 CACHE_VIDEOS,
+	http.MethodGet + " " + PREFIX_V2 + "/feeds":                               CACHE_REVALIDATE,
+	http.MethodGet + " " + PREFIX_V2 + "/feeds/{feedId}":                      CACHE_REVALIDATE,
+	http.MethodGet + " " + PREFIX_V2 + "/feeds/{feedId}/channels":             CACHE_REVALIDATE,
+	http.MethodGet + " " + PREFIX_V2 + "/feeds/{feedId}/channels/{channelId}": CACHE_REVALIDATE,
+	http.MethodGet + " " + PREFIX_V2 + "/feeds/{feedId}/videos":               CACHE_VIDEOS,
+}
+
+// Video listings whose channels were all retrieved from YouTube within this window are
+// revalidated against the stored videos instead of retrieving them again
+const VIDEOS_FRESH_WINDOW = 5 * time.Minute
+
+// Cached routes whose ETag is derived from stored state rather than the body, so a matching
+// If-None-Match is answered without running the handler. Each returns the ETag and when the
+// state was last brought up to date, keyed like cachedRoutes
+var stateETagRoutes = map[string]func(s *state, r *http.Request) (string, time.Time, error){
+	http.MethodGet + " " + PREFIX_V2 + "/feeds/{feedId}/videos": feedVideosETag,
+}
+
+// Sets the headers shared by every JSON response
+func setJSONHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+}
+
+// Writes an already encoded JSON body
+func writeJSON(w http.ResponseWriter, data []byte, statusCode int) {
+	setJSONHeaders(w)
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+// Returns the cachedRoutes key of the matched route and true if it is one of cachedRoutes
+func cachedRouteKey(r *http.Request) (string, bool) {
+	path, ok := routeTemplate(r)
+	if !ok {
+		return "", false
+	}
+
+	key := r.Method + " " + path
+	_, ok = cachedRoutes[key]
+	return key, ok
+}
+
+// Returns an ETag for a feed's videos listing built from the feed's settings, its channels and
+// the newest stored video, and when the feed's least recently retrieved channel was retrieved
+func feedVideosETag(s *state, r *http.Request) (string, time.Time, error) {
+	userId, _, err := unpackGetRequest(r, s)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("in feedVideosETag(): %s", err)
+	}
+	feedId, err := strconv.ParseInt(mux.Vars(r)["feedId"], 10, 32)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("in feedVideosETag(): invalid feedId: %s", err)
+	}
+
+	params := database.GetFeedVideosStateParams{ID: int32(feedId), UserID: userId}
+	feed, err := s.db.GetFeedVideosState(r.Context(), params)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("in feedVideosETag(): error retrieving state of feed with id %v: %s", feedId, err)
+	}
+
+	validator := fmt.Sprintf("%s|%s|%s|%d|%s", feed.UpdatedAt.UTC().Format(time.RFC3339Nano), feed.Channels,
+		feed.NewestPublishedAt.UTC().Format(time.RFC3339Nano), s.cfg.Feeds.VideoLimit, r.URL.RawQuery)
+	return computeETag([]byte(validator)), feed.CheckedAt, nil
+}
+
+// Returns a strong ETag derived from the body
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// Returns true if the If-None-Match header lists etag or is "*"
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Buffers the response so its ETag can be computed before anything is sent
+type bufferedWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (b *bufferedWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedWriter) Write(data []byte) (int, error) {
+	if b.statusCode == 0 {
+		b.statusCode = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+func (b *bufferedWriter) WriteHeader(statusCode int) {
+	if b.statusCode == 0 {
+		b.statusCode = statusCode
+	}
+}
+
+// Writes a 304 carrying the response's validator and Cache-Control
+func writeNotModified(w http.ResponseWriter, etag, policy string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", policy)
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// Middleware - adds an ETag and Cache-Control to successful responses of cachedRoutes and
+// responds 304 without a body when the client's If-None-Match already matches. Routes in
+// stateETagRoutes are answered before their handler runs while their state is fresh. Other
+// responses, and those the handler marked no-store, are marked no-store so they are never reused
+func (s *state) conditionalGET(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := cachedRouteKey(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		policy := cachedRoutes[key]
+		stateETag := stateETagRoutes[key]
+
+		w.Header().Add("Vary", "Firebase-ID")
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		if stateETag != nil && ifNoneMatch != "" {
+			etag, checkedAt, err := stateETag(s, r)
+			if err == nil && time.Since(checkedAt) < VIDEOS_FRESH_WINDOW && etagMatches(ifNoneMatch, etag) {
+				writeNotModified(w, etag, policy)
+				return
+			}
+		}
+
+		buffered := &bufferedWriter{header: w.Header()}
+		next.ServeHTTP(buffered, r)
+		if buffered.statusCode == 0 {
+			buffered.statusCode = http.StatusOK
+		}
+
+		if buffered.statusCode != http.StatusOK || w.Header().Get("Cache-Control") == "no-store" {
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(buffered.statusCode)
+			w.Write(buffered.body.Bytes())
+			return
+		}
+
+		etag := computeETag(buffered.body.Bytes())
+		if stateETag != nil {
+			// derived again as the handler may have stored new videos
+			if derived, _, err := stateETag(s, r); err == nil {
+				etag = derived
+			}
+		}
+
+		if etagMatches(ifNoneMatch, etag) {
+			writeNotModified(w, etag, policy)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", policy)
+		w.WriteHeader(http.StatusOK)
+		w.Write(buffered.body.Bytes())
+	})
+}
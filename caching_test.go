@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func serveCached(t *testing.T, s *state, path, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Firebase-ID", "firebase-user")
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestConditionalGET(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2), feedDetailsRow(2, "science", 0))
+
+	first := serveCached(t, s, "/api/v2/feeds", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got status %d and ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+	if cacheControl := first.Header().Get("Cache-Control"); cacheControl != CACHE_REVALIDATE {
+		t.Errorf("got Cache-Control %q, want %q", cacheControl, CACHE_REVALIDATE)
+	}
+
+	notModified := serveCached(t, s, "/api/v2/feeds", `"other", `+etag)
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("got status %d with %d bytes, want 304 without a body", notModified.Code, notModified.Body.Len())
+	}
+	if notModified.Header().Get("ETag") != etag {
+		t.Errorf("got ETag %q on 304, want %q", notModified.Header().Get("ETag"), etag)
+	}
+
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 3))
+	changed := serveCached(t, s, "/api/v2/feeds", etag)
+	if changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Errorf("got status %d and ETag %q, want 200 with a new ETag", changed.Code, changed.Header().Get("ETag"))
+	}
+}
+
+func TestConditionalGETVideosSkipsYouTubeWhenFresh(t *testing.T) {
+	var fetches atomic.Int32
+	useFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [{"snippet": {"channelTitle": "Artist", "title": "Song", "publishedAt": "2024-11-01T12:00:00Z", "resourceId": {"videoId": "v1"}, "thumbnails": {"high": {"url": "https://i.ytimg.com/vi/v1/hqdefault.jpg"}}}}]}`)
+	})
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+	db.set("GetFeedMergeStrategy", row("date"))
+	db.set("GetAllFeedChannelPriorities", row("UC1", "@artist", "UU1", "active", "", int64(1)))
+	db.set("GetFeedVideosState", row(testTime, "UC1:1:active", testTime, time.Now()))
+
+	first := serveCached(t, s, "/api/v2/feeds/1/videos", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || fetches.Load() != 1 {
+		t.Fatalf("got status %d, ETag %q and %d fetches, want 200 with an ETag after one fetch", first.Code, etag, fetches.Load())
+	}
+
+	fresh := serveCached(t, s, "/api/v2/feeds/1/videos", etag)
+	if fresh.Code != http.StatusNotModified || fetches.Load() != 1 {
+		t.Errorf("got status %d after %d fetches, want 304 without retrieving the videos again", fresh.Code, fetches.Load())
+	}
+
+	db.set("GetFeedVideosState", row(testTime, "UC1:1:active", testTime, time.Now().Add(-VIDEOS_FRESH_WINDOW-time.Minute)))
+	stale := serveCached(t, s, "/api/v2/feeds/1/videos", etag)
+	if stale.Code != http.StatusNotModified || fetches.Load() != 2 {
+		t.Errorf("got status %d after %d fetches, want the videos retrieved again and 304 as nothing changed", stale.Code, fetches.Load())
+	}
+
+	db.set("GetFeedVideosState", row(testTime, "UC1:1:active", testTime.Add(time.Hour), time.Now()))
+	changed := serveCached(t, s, "/api/v2/feeds/1/videos", etag)
+	if changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Errorf("got status %d and ETag %q, want 200 with a new ETag after a newer video was stored", changed.Code, changed.Header().Get("ETag"))
+	}
+}
+
+func TestConditionalGETSkipsErrorsAndUncachedRoutes(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+
+	missing := serveCached(t, s, "/api/v2/feeds/9", "*")
+	if missing.Code != http.StatusNotFound || missing.Header().Get("ETag") != "" {
+		t.Errorf("got status %d and ETag %q, want 404 without an ETag", missing.Code, missing.Header().Get("ETag"))
+	}
+	if cacheControl := missing.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Errorf("got Cache-Control %q, want no-store", cacheControl)
+	}
+
+	uncached := serveCached(t, s, "/api/v2/feeds/1/recommendations", "*")
+	if uncached.Header().Get("ETag") != "" || uncached.Header().Get("Cache-Control") != "" {
+		t.Errorf("expected no caching headers on an uncached route, got %v", uncached.Header())
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	cases := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`*`, true},
+		{`"xyz"`, false},
+		{``, false},
+	}
+
+	for _, c := range cases {
+		if got := etagMatches(c.ifNoneMatch, `"abc"`); got != c.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", c.ifNoneMatch, got, c.want)
+		}
+	}
+}
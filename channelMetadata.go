@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// Maximum number of channels refreshed per run
+const CHANNEL_REFRESH_LIMIT = 500
+
+// Values of channels.status, dead channels were deleted or terminated on YouTube and are no longer polled
+const (
+	CHANNEL_ACTIVE = "active"
+	CHANNEL_DEAD   = "dead"
+)
+
+// Marks channels reported dead by the youtube package
+type deadChannelReporter struct {
+	s *state
+}
+
+func (r deadChannelReporter) ReportDeadChannel(ctx context.Context, channel youtube.FeedChannel, errorCode string) error {
+	err := markChannelDead(ctx, r.s, channel.ChannelId, errorCode)
+	if err != nil {
+		return fmt.Errorf("in ReportDeadChannel(): %s", err)
+	}
+
+	return nil
+}
+
+// Marks the channel as dead for reason so it is no longer polled
+func markChannelDead(ctx context.Context, s *state, channelId, reason string) error {
+	params := database.MarkChannelDeadParams{
+		ChannelID:       channelId,
+		StatusReason:    reason,
+		StatusChangedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	err := s.db.MarkChannelDead(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in markChannelDead(): error marking channel with id %s dead: %s", channelId, err)
+	}
+
+	if s.events != nil {
+		s.events.publishStatus(ctx, youtube.ChannelStatus{ChannelId: channelId, Status: youtube.ChannelDead, ErrorCode: reason})
+	}
+
+	logging.FromContext(ctx).Info("marked channel dead", logging.KeyChannelID, channelId, "reason", reason)
+	return nil
+}
+
+// Marks a dead channel active again so it is polled
+func markChannelActive(ctx context.Context, s *state, channelId string) error {
+	params := database.MarkChannelActiveParams{
+		ChannelID:       channelId,
+		StatusChangedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	err := s.db.MarkChannelActive(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in markChannelActive(): error marking channel with id %s active: %s", channelId, err)
+	}
+
+	return nil
+}
+
+// Re-resolves a stored channel from YouTube by channel id or @handle, refreshing its metadata
+// and current handle. A dead channel YouTube returns again is marked active, one it no longer
+// returns is marked dead. Returns the channel's id and whether it is active
+func resolveChannel(ctx context.Context, s *state, channelRef string) (string, bool, error) {
+	channelId := channelRef
+	if strings.HasPrefix(channelRef, "@") {
+		exists, details, err := youtube.GetChannelDetails(ctx, channelRef)
+		if err != nil {
+			return "", false, fmt.Errorf("in resolveChannel(): error retrieving channel details: %w", err)
+		}
+		if !exists {
+			return "", false, fmt.Errorf("in resolveChannel(): handle<%s>: %w", channelRef, errChannelNotFound)
+		}
+		channelId = details.ChannelId
+	}
+
+	_, err := s.db.GetUploadId(ctx, channelId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return channelId, false, fmt.Errorf("in resolveChannel(): channel with id %s is not stored", channelId)
+	}
+	if err != nil {
+		return channelId, false, fmt.Errorf("in resolveChannel(): error retrieving channel with id %s: %s", channelId, err)
+	}
+
+	metadata, err := youtube.GetChannelsMetadata(ctx, []string{channelId})
+	if err != nil {
+		return channelId, false, fmt.Errorf("in resolveChannel(): error retrieving channel metadata: %w", err)
+	}
+
+	channelMetadata, ok := metadata[channelId]
+	if !ok {
+		err = markChannelDead(ctx, s, channelId, youtube.ErrorCodeNotFound)
+		if err != nil {
+			return channelId, false, fmt.Errorf("in resolveChannel(): %s", err)
+		}
+		return channelId, false, nil
+	}
+
+	err = updateChannelMetadata(ctx, s, channelId, channelMetadata)
+	if err != nil {
+		return channelId, false, fmt.Errorf("in resolveChannel(): %s", err)
+	}
+	err = markChannelActive(ctx, s, channelId)
+	if err != nil {
+		return channelId, false, fmt.Errorf("in resolveChannel(): %s", err)
+	}
+
+	return channelId, true, nil
+}
+
+// Retrieves the ids of channels whose metadata is older than maxAge, least recently refreshed first
+func getChannelsToRefresh(ctx context.Context, s *state, maxAge time.Duration) ([]string, error) {
+	params := database.GetChannelsToRefreshParams{
+		MetadataUpdatedAt: sql.NullTime{Time: time.Now().Add(-maxAge), Valid: true},
+		Limit:             CHANNEL_REFRESH_LIMIT,
+	}
+
+	channelIds, err := s.db.GetChannelsToRefresh(ctx, params)
+	if err != nil {
+		return []string{}, fmt.Errorf("in getChannelsToRefresh(): error retrieving channels: %s", err)
+	}
+
+	return channelIds, nil
+}
+
+// Refreshes the metadata of channels not refreshed within maxAge, returns the number refreshed.
+// Channels YouTube no longer returns are marked dead
+func refreshChannelMetadata(ctx context.Context, s *state, maxAge time.Duration) (int, error) {
+	channelIds, err := getChannelsToRefresh(ctx, s, maxAge)
+	if err != nil {
+		return 0, fmt.Errorf("in refreshChannelMetadata(): %s", err)
+	}
+	if len(channelIds) == 0 {
+		return 0, nil
+	}
+
+	metadata, err := youtube.GetChannelsMetadata(ctx, channelIds)
+	if err != nil {
+		return 0, fmt.Errorf("in refreshChannelMetadata(): error retrieving channel metadata: %w", err)
+	}
+
+	refreshed := 0
+	for _, channelId := range channelIds {
+		channelMetadata, ok := metadata[channelId]
+		if !ok {
+			// channels.list omits deleted and terminated channels
+			err = markChannelDead(ctx, s, channelId, youtube.ErrorCodeNotFound)
+			if err != nil {
+				return refreshed, fmt.Errorf("in refreshChannelMetadata(): %s", err)
+			}
+			continue
+		}
+
+		err = updateChannelMetadata(ctx, s, channelId, channelMetadata)
+		if err != nil {
+			return refreshed, fmt.Errorf("in refreshChannelMetadata(): %s", err)
+		}
+		refreshed++
+	}
+
+	return refreshed, nil
+}
+
+// Refreshes stale channel metadata every interval, returns once ctx is cancelled
+func refreshChannelMetadataPeriodically(ctx context.Context, s *state, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		refreshed, err := refreshChannelMetadata(ctx, s, maxAge)
+		if errors.Is(err, youtube.ErrQuotaExceeded) {
+			logging.FromContext(ctx).Warn("in refreshChannelMetadataPeriodically(): skipping refresh", logging.Err(err))
+			continue
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("in refreshChannelMetadataPeriodically(): error refreshing metadata", logging.Err(err))
+		}
+		if refreshed > 0 {
+			logging.FromContext(ctx).Info("refreshed channel metadata", "channels", refreshed)
+		}
+	}
+}
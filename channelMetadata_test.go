@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+)
+
+func TestRefreshChannelMetadata(t *testing.T) {
+	s, db := newFakeState(t)
+	db.set("GetChannelsToRefresh", row("UC1"), row("UC2"))
+
+	useFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [{"id": "UC1", "snippet": {"customUrl": "@artistrenamed", "title": "Artist"}, "statistics": {"subscriberCount": "10", "videoCount": "2"}}]}`)
+	})
+
+	refreshed, err := refreshChannelMetadata(context.Background(), s, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if refreshed != 1 {
+		t.Errorf("refreshed %d channels, want 1", refreshed)
+	}
+	if !db.called("UpdateChannelMetadata") {
+		t.Errorf("UpdateChannelMetadata was not called")
+	}
+	if !db.called("UpsertChannelHandle") || !db.called("UpdateChannelHandle") {
+		t.Errorf("renamed handle was not recorded")
+	}
+	if !db.called("MarkChannelDead") {
+		t.Errorf("channel missing from YouTube was not marked dead")
+	}
+}
+
+func TestRefreshChannelMetadataNothingStale(t *testing.T) {
+	s, db := newFakeState(t)
+
+	refreshed, err := refreshChannelMetadata(context.Background(), s, 24*time.Hour)
+	if err != nil || refreshed != 0 {
+		t.Errorf("got %d, %v, want 0 refreshed and no error", refreshed, err)
+	}
+	if db.called("UpdateChannelMetadata") {
+		t.Errorf("UpdateChannelMetadata called with no stale channels")
+	}
+}
+
+func TestFeedChannelHidesCurrentHandleInAnyCase(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+	db.set("GetFeedChannelDetails", feedChannelDetailsRow("UC1", "@Artist"))
+	db.set("GetChannelHandleHistory", row("@artist", testTime, testTime), row("@artistold", testTime, testTime))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/feeds/1/channels/UC1", nil)
+	req.Header.Set("Firebase-ID", "firebase-user")
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, req)
+
+	var channel channelResource
+	err := json.Unmarshal(recorder.Body.Bytes(), &channel)
+	if err != nil {
+		t.Fatalf("error decoding response %q: %v", recorder.Body.String(), err)
+	}
+	if len(channel.PreviousHandles) != 1 || channel.PreviousHandles[0] != "@artistold" {
+		t.Errorf("got previous handles %v, want only @artistold", channel.PreviousHandles)
+	}
+}
+
+func TestChannelHandleLookupIgnoresCase(t *testing.T) {
+	queries := openTestDatabase(t)
+	ctx := context.Background()
+
+	_, err := queries.InsertChannel(ctx, database.InsertChannelParams{
+		ChannelID:       "UC1",
+		ChannelUploadID: "UU1",
+		ChannelHandle:   "@MixedCase",
+		ChannelUrl:      "https://www.youtube.com/channel/UC1",
+	})
+	if err != nil {
+		t.Fatalf("InsertChannel() error: %v", err)
+	}
+	err = queries.UpsertChannelHandle(ctx, database.UpsertChannelHandleParams{Handle: "@MixedCase", ChannelID: "UC1", FirstSeenAt: testTime})
+	if err != nil {
+		t.Fatalf("UpsertChannelHandle() error: %v", err)
+	}
+
+	for _, handle := range []string{"@MixedCase", "@mixedcase", "@MIXEDCASE"} {
+		channelId, err := queries.GetChannelIdByHandle(ctx, handle)
+		if err != nil || channelId != "UC1" {
+			t.Errorf("GetChannelIdByHandle(%s) got %q, %v, want UC1", handle, channelId, err)
+		}
+		contains, err := queries.ContainsChannelInDB(ctx, handle)
+		if err != nil || !contains {
+			t.Errorf("ContainsChannelInDB(%s) got %v, %v, want true", handle, contains, err)
+		}
+	}
+
+	history, err := queries.GetChannelHandleHistory(ctx, "UC1")
+	if err != nil || len(history) != 1 || history[0].Handle != "@mixedcase" {
+		t.Errorf("got handle history %+v, %v, want the handle stored once in lower case", history, err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+)
+
+// A subcommand. usage describes its arguments, commands without usage take none
+type command struct {
+	usage   string
+	summary string
+	run     func(cfg config.Config, args []string) error
+}
+
+// Subcommands, the server is run when none is given
+var commands = map[string]command{
+	"serve": {
+		summary: "runs the API server and background jobs (default)",
+		run: func(cfg config.Config, args []string) error {
+			return runServer(cfg)
+		},
+	},
+	"config": {
+		summary: "prints the effective configuration with secrets redacted",
+		run: func(cfg config.Config, args []string) error {
+			return printConfig(os.Stdout, cfg)
+		},
+	},
+	"migrate": {
+		usage:   "up|down|status|to <version>",
+		summary: "applies or rolls back the embedded schema migrations",
+		run:     runMigrate,
+	},
+	"admin": {
+		usage:   "<action> [arguments]",
+		summary: "inspects and repairs stored data, run \"admin help\" for the actions",
+		run:     runAdmin,
+	},
+}
+
+// Splits the command line into the subcommand name, its arguments and the flags that follow them
+func splitCommand(args []string) (string, []string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "serve", nil, args
+	}
+
+	name, rest := args[0], args[1:]
+	i := 0
+	for i < len(rest) && !strings.HasPrefix(rest[i], "-") {
+		i++
+	}
+
+	return name, rest[:i], rest[i:]
+}
+
+// Runs the named subcommand with its arguments
+func runCommand(name string, args []string, cfg config.Config) error {
+	cmd, ok := commands[name]
+	if !ok {
+		printCommands(os.Stderr)
+		return fmt.Errorf("in runCommand(): unknown command<%s>", name)
+	}
+	if cmd.usage == "" && len(args) > 0 {
+		return fmt.Errorf("in runCommand(): %s takes no arguments, got %v", name, args)
+	}
+
+	return cmd.run(cfg, args)
+}
+
+// Lists the subcommands
+func printCommands(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage: youtube-custom-feeds [command] [arguments] [flags]")
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %-36s %s\n", strings.TrimSpace(name+" "+cmd.usage), cmd.summary)
+	}
+}
+
+// Writes the configuration as JSON with every secret redacted
+func printConfig(w io.Writer, cfg config.Config) error {
+	err := printJSON(w, cfg.Redacted())
+	if err != nil {
+		return fmt.Errorf("in printConfig(): %s", err)
+	}
+
+	return nil
+}
+
+// Writes v as indented JSON
+func printJSON(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("in printJSON(): error marshaling JSON: %s", err)
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
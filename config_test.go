@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+)
+
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.AdminToken = "admin-secret"
+	cfg.Database.Password = "hunter2"
+
+	var buf bytes.Buffer
+	err := printConfig(&buf, cfg)
+	if err != nil {
+		t.Fatalf("printConfig() error: %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "admin-secret") || strings.Contains(output, "hunter2") {
+		t.Errorf("printed config contains a secret:\n%s", output)
+	}
+	if !strings.Contains(output, `"video_limit": 10`) {
+		t.Errorf("printed config is missing settings:\n%s", output)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	cases := []struct {
+		args      []string
+		wantName  string
+		wantArgs  int
+		wantFlags int
+	}{
+		{nil, "serve", 0, 0},
+		{[]string{"-port", "9000"}, "serve", 0, 2},
+		{[]string{"config", "-port", "9000"}, "config", 0, 2},
+		{[]string{"migrate", "to", "5", "-db-url", "postgres://db"}, "migrate", 2, 2},
+	}
+
+	for _, c := range cases {
+		name, args, flags := splitCommand(c.args)
+		if name != c.wantName || len(args) != c.wantArgs || len(flags) != c.wantFlags {
+			t.Errorf("splitCommand(%v) = %s %v %v, want %s with %d args and %d flags", c.args, name, args, flags, c.wantName, c.wantArgs, c.wantFlags)
+		}
+	}
+}
+
+func TestRunCommandRejectsArguments(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"config", []string{"extra"}, "takes no arguments"},
+		{"migrate", nil, "expected up, down, status"},
+		{"migrate", []string{"sideways"}, "expected up, down, status"},
+		{"migrate", []string{"to", "latest"}, "invalid version"},
+	}
+
+	for _, c := range cases {
+		err := runCommand(c.name, c.args, config.Defaults())
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("runCommand(%s, %v) got error %v, want one mentioning %s", c.name, c.args, err, c.want)
+		}
+	}
+}
+
+func TestDisabledFeaturesAreNotRouted(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+	s.cfg.Features = config.FeaturesConfig{}
+
+	for _, path := range []string{"/api/v2/feeds/1/recommendations", "/api/v2/feeds/1/webhooks", "/api/v2/feeds/1/digests", "/api/v2/events"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Firebase-ID", "firebase-user")
+		recorder := httptest.NewRecorder()
+		newRouter(s).ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("got status %d for %s, want %d with the feature disabled", recorder.Code, path, http.StatusNotFound)
+		}
+	}
+}
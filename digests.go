@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/digest"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// Maximum number of digests sent per run. Claimed digests are leased for DIGEST_LEASE so other
+// instances skip them, it must cover a full batch of feed loads and SMTP timeouts
+const (
+	DIGEST_BATCH_LIMIT = 100
+	DIGEST_LEASE       = 15 * time.Minute
+)
+
+const DIGEST_UNSUBSCRIBE_PATH = "/api/v1/digests/unsubscribe"
+
+type digestResource struct {
+	ID         int32      `json:"id"`
+	FeedID     int32      `json:"feedId"`
+	Email      string     `json:"email"`
+	Frequency  string     `json:"frequency"`
+	Hour       int32      `json:"hour"`
+	Weekday    int32      `json:"weekday"`
+	Timezone   string     `json:"timezone"`
+	NextSendAt time.Time  `json:"nextSendAt"`
+	LastSentAt *time.Time `json:"lastSentAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type createDigestV2Params struct {
+	Email     string `json:"email"`
+	Frequency string `json:"frequency"`
+	Hour      int    `json:"hour"`
+	Weekday   int    `json:"weekday"`
+	Timezone  string `json:"timezone"`
+}
+
+func toDigestResource(subscription database.DigestSubscription) digestResource {
+	resource := digestResource{
+		ID:         subscription.ID,
+		FeedID:     subscription.FeedID,
+		Email:      subscription.Email,
+		Frequency:  subscription.Frequency,
+		Hour:       subscription.SendHour,
+		Weekday:    subscription.SendWeekday,
+		Timezone:   subscription.Timezone,
+		NextSendAt: subscription.NextSendAt,
+		CreatedAt:  subscription.CreatedAt,
+	}
+	if subscription.LastSentAt.Valid {
+		resource.LastSentAt = &subscription.LastSentAt.Time
+	}
+
+	return resource
+}
+
+// Returns the link that cancels the subscription without logging in
+func unsubscribeURL(cfg config.DigestConfig, subscriptionId int32) string {
+	token := digest.NewSigner(cfg.SigningKey).Sign(subscriptionId)
+	return strings.TrimSuffix(cfg.BaseURL, "/") + DIGEST_UNSUBSCRIBE_PATH + "?token=" + url.QueryEscape(token)
+}
+
+// Subscribes email to digests of the feed, replacing the schedule of an existing subscription
+func upsertDigestSubscription(ctx context.Context, s *state, feedId int32, email string, schedule digest.Schedule) (database.DigestSubscription, error) {
+	now := time.Now().UTC()
+	params := database.UpsertDigestSubscriptionParams{
+		FeedID:      feedId,
+		Email:       email,
+		Frequency:   string(schedule.Frequency),
+		SendHour:    int32(schedule.Hour),
+		SendWeekday: int32(schedule.Weekday),
+		Timezone:    schedule.Location.String(),
+		NextSendAt:  schedule.Next(now).UTC(),
+		CreatedAt:   now,
+	}
+
+	subscription, err := s.db.UpsertDigestSubscription(ctx, params)
+	if err != nil {
+		return subscription, fmt.Errorf("in upsertDigestSubscription(): error subscribing to feed<%v>: %s", feedId, err)
+	}
+
+	return subscription, nil
+}
+
+// Collects the feed's videos published since the last digest and emails them, returns false if
+// there was nothing to send
+func sendDigest(ctx context.Context, s *state, mailer digest.Mailer, subscription database.ClaimDueDigestSubscriptionsRow, schedule digest.Schedule, now time.Time) (bool, error) {
+	since := now.Add(-schedule.Period())
+	if subscription.LastSentAt.Valid {
+		since = subscription.LastSentAt.Time
+	}
+
+	feedChannels, err := getAllFeedChannelPriorities(ctx, s, subscription.FeedID)
+	if err != nil {
+		return false, fmt.Errorf("in sendDigest(): %s", err)
+	}
+
+	videos, status := youtube.GetFeedVideosByDate(ctx, int64(s.cfg.Feeds.VideoLimit), feedChannels)
+	if status == youtube.FeedFailed {
+		return false, fmt.Errorf("in sendDigest(): every channel in feed<%v> failed: %w", subscription.FeedID, youtube.ErrUnavailable)
+	}
+
+	d := digest.Digest{
+		FeedName:       subscription.FeedName,
+		Frequency:      schedule.Frequency,
+		Since:          since,
+		UnsubscribeURL: unsubscribeURL(s.cfg.Digest, subscription.ID),
+		Location:       schedule.Location,
+	}
+	for _, video := range videos {
+		if video.PublishedAt.After(since) {
+			d.Videos = append(d.Videos, digest.Video{
+				Title:        video.Title,
+				ChannelName:  video.ChannelName,
+				URL:          video.VideoURL,
+				ThumbnailURL: video.ThumbnailURL,
+				PublishedAt:  video.PublishedAt,
+			})
+		}
+	}
+	if len(d.Videos) == 0 {
+		return false, nil
+	}
+
+	msg, err := digest.Render(subscription.Email, d)
+	if err != nil {
+		return false, fmt.Errorf("in sendDigest(): %s", err)
+	}
+
+	err = mailer.Send(msg)
+	if err != nil {
+		return false, fmt.Errorf("in sendDigest(): %s", err)
+	}
+
+	return true, nil
+}
+
+// Claims and sends every digest due at now, returns the number of emails sent. Digests that fail
+// are retried with backoff, digests without new videos are skipped until the next period
+func sendDueDigests(ctx context.Context, s *state, mailer digest.Mailer, now time.Time) (int, error) {
+	params := database.ClaimDueDigestSubscriptionsParams{
+		LeaseUntil: now.Add(DIGEST_LEASE),
+		Now:        now,
+		BatchLimit: DIGEST_BATCH_LIMIT,
+	}
+
+	subscriptions, err := s.db.ClaimDueDigestSubscriptions(ctx, params)
+	if err != nil {
+		return 0, fmt.Errorf("in sendDueDigests(): error claiming due digests: %s", err)
+	}
+
+	logger := logging.FromContext(ctx)
+	sent := 0
+	for _, subscription := range subscriptions {
+		failures := int(subscription.FailedAttempts) + 1
+
+		schedule, err := digest.ParseSchedule(subscription.Frequency, int(subscription.SendHour), int(subscription.SendWeekday), subscription.Timezone)
+		if err != nil {
+			markDigestFailed(ctx, s, subscription.ID, now.Add(digest.RetryDelay(failures)), err)
+			continue
+		}
+
+		ok, err := sendDigest(ctx, s, mailer, subscription, schedule, now)
+		if err != nil {
+			markDigestFailed(ctx, s, subscription.ID, schedule.Retry(now, failures).UTC(), err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+
+		params := database.MarkDigestSentParams{
+			ID:         subscription.ID,
+			LastSentAt: sql.NullTime{Time: now, Valid: true},
+			NextSendAt: schedule.Next(now).UTC(),
+		}
+		err = s.db.MarkDigestSent(ctx, params)
+		if err != nil {
+			logger.Error("in sendDueDigests(): error updating digest", "digest_id", subscription.ID, logging.Err(err))
+		}
+	}
+
+	return sent, nil
+}
+
+// Records that sending the digest failed with sendErr and schedules its retry
+func markDigestFailed(ctx context.Context, s *state, subscriptionId int32, retryAt time.Time, sendErr error) {
+	logger := logging.FromContext(ctx).With("digest_id", subscriptionId)
+	logger.Error("in markDigestFailed(): error sending digest", "retry_at", retryAt, logging.Err(sendErr))
+
+	params := database.MarkDigestFailedParams{
+		ID:         subscriptionId,
+		LastError:  sendErr.Error(),
+		NextSendAt: retryAt,
+	}
+	err := s.db.MarkDigestFailed(ctx, params)
+	if err != nil {
+		logger.Error("in markDigestFailed(): error recording failure", logging.Err(err))
+	}
+}
+
+// Sends due digests every interval, returns once ctx is cancelled
+func sendDigestsPeriodically(ctx context.Context, s *state, mailer digest.Mailer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sent, err := sendDueDigests(ctx, s, mailer, time.Now().UTC())
+		if err != nil {
+			logging.FromContext(ctx).Error("in sendDigestsPeriodically(): error sending digests", logging.Err(err))
+		}
+		if sent > 0 {
+			logging.FromContext(ctx).Info("sent digests", "digests", sent)
+		}
+	}
+}
+
+// GET - lists the digest subscriptions of the feed
+func (s *state) listDigestsV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in listDigestsV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	subscriptions, err := s.db.GetFeedDigestSubscriptions(r.Context(), feed.ID)
+	if err != nil {
+		logRequestError(r, "in listDigestsV2(): error retrieving digests for feed", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	type returnVals struct {
+		Digests []digestResource `json:"digests"`
+	}
+	resBody := returnVals{
+		Digests: []digestResource{},
+	}
+	for _, subscription := range subscriptions {
+		resBody.Digests = append(resBody.Digests, toDigestResource(subscription))
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
+
+// POST - subscribes an email address to digests of the feed
+func (s *state) createDigestV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in createDigestV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	params := createDigestV2Params{Timezone: "UTC"}
+	statusCode, err = unpackV2Body(&params, r)
+	if err != nil {
+		logRequestError(r, "in createDigestV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	address, err := mail.ParseAddress(params.Email)
+	if err != nil || address.Address != params.Email {
+		logRequestError(r, "in createDigestV2(): invalid email", nil, logging.KeyStatus, statusCodes.ErrRequest, "email", params.Email)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	schedule, err := digest.ParseSchedule(params.Frequency, params.Hour, params.Weekday, params.Timezone)
+	if err != nil {
+		logRequestError(r, "in createDigestV2(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	subscription, err := upsertDigestSubscription(r.Context(), s, feed.ID, params.Email, schedule)
+	if err != nil {
+		logRequestError(r, "in createDigestV2(): error subscribing", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	writeResponse(w, toDigestResource(subscription), statusCodes.Created)
+}
+
+// DELETE - cancels a digest subscription of the feed
+func (s *state) deleteDigestV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in deleteDigestV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	digestId, err := strconv.ParseInt(mux.Vars(r)["digestId"], 10, 32)
+	if err != nil {
+		logRequestError(r, "in deleteDigestV2(): invalid digestId", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	params := database.DeleteFeedDigestSubscriptionParams{
+		ID:     int32(digestId),
+		FeedID: feed.ID,
+	}
+	deleted, err := s.db.DeleteFeedDigestSubscription(r.Context(), params)
+	if err != nil {
+		logRequestError(r, "in deleteDigestV2(): error deleting digest", err, "digest_id", digestId)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+	if deleted == 0 {
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrNotFound], statusCodes.ErrNotFound)
+		return
+	}
+
+	message := fmt.Sprintf("Successfully deleted digest with id - %v", digestId)
+	writeResponseMessage(w, message, statusCodes.Success)
+}
+
+// GET - cancels the digest subscription named by the signed "token" from a digest email,
+// no Firebase-ID is required
+func (s *state) unsubscribeDigestGET(w http.ResponseWriter, r *http.Request) {
+	subscriptionId, err := digest.NewSigner(s.cfg.Digest.SigningKey).Verify(r.URL.Query().Get("token"))
+	if errors.Is(err, digest.ErrInvalidToken) {
+		logRequestError(r, "in unsubscribeDigestGET(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	deleted, err := s.db.DeleteDigestSubscription(r.Context(), subscriptionId)
+	if err != nil {
+		logRequestError(r, "in unsubscribeDigestGET(): error deleting digest", err, "digest_id", subscriptionId)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+	if deleted == 0 {
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrNotFound], statusCodes.ErrNotFound)
+		return
+	}
+
+	writeResponseMessage(w, "You have been unsubscribed from this digest", statusCodes.Success)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/digest"
+)
+
+type fakeMailer struct {
+	sent []digest.Message
+}
+
+func (m *fakeMailer) Send(msg digest.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Row returned by ClaimDueDigestSubscriptions
+func dueDigestRow(id int64, lastSentAt driver.Value) []driver.Value {
+	return row(id, int64(1), "viewer@example.com", "daily", int64(8), int64(0), "UTC",
+		time.Date(2024, 11, 2, 8, 0, 0, 0, time.UTC), lastSentAt, testTime, int64(0), "", "music")
+}
+
+var testDigestConfig = config.DigestConfig{SigningKey: "secret", BaseURL: "https://feeds.example.com/"}
+
+// Points the youtube package at a channel with a new and an old song, or failing with playlistStatus
+func useDigestYouTube(t *testing.T, playlistStatus int) {
+	useFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if playlistStatus != http.StatusOK {
+			w.WriteHeader(playlistStatus)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [
+			{"snippet": {"channelTitle": "Artist", "title": "New song", "publishedAt": "2024-11-01T12:00:00Z", "resourceId": {"videoId": "v2"}, "thumbnails": {"high": {"url": "https://i.ytimg.com/vi/v2/hqdefault.jpg"}}}},
+			{"snippet": {"channelTitle": "Artist", "title": "Old song", "publishedAt": "2024-10-20T12:00:00Z", "resourceId": {"videoId": "v1"}, "thumbnails": {"high": {"url": "https://i.ytimg.com/vi/v1/hqdefault.jpg"}}}}
+		]}`)
+	})
+}
+
+func TestSendDueDigests(t *testing.T) {
+	useDigestYouTube(t, http.StatusOK)
+	s, db := newFakeState(t)
+	s.cfg.Digest = testDigestConfig
+	db.set("GetAllFeedChannelPriorities", feedChannelPriorityRow("UC9", "@artist"))
+	db.set("ClaimDueDigestSubscriptions", dueDigestRow(7, time.Date(2024, 11, 1, 8, 0, 0, 0, time.UTC)))
+	mailer := &fakeMailer{}
+
+	sent, err := sendDueDigests(context.Background(), s, mailer, time.Date(2024, 11, 2, 8, 0, 0, 0, time.UTC))
+	if err != nil || sent != 1 {
+		t.Fatalf("got %d, %v, want 1 sent and no error", sent, err)
+	}
+
+	msg := mailer.sent[0]
+	if msg.To != "viewer@example.com" || msg.Subject != "1 new video in music" {
+		t.Errorf("got email to %q with subject %q", msg.To, msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "New song") || strings.Contains(msg.Text, "Old song") {
+		t.Errorf("digest should only list videos published since the last digest:\n%s", msg.Text)
+	}
+
+	wantURL := "https://feeds.example.com" + DIGEST_UNSUBSCRIBE_PATH + "?token="
+	if !strings.HasPrefix(msg.UnsubscribeURL, wantURL) {
+		t.Errorf("got unsubscribe url %q", msg.UnsubscribeURL)
+	}
+	token := strings.TrimPrefix(msg.UnsubscribeURL, wantURL)
+	if id, err := digest.NewSigner("secret").Verify(token); err != nil || id != 7 {
+		t.Errorf("unsubscribe token verified as %d, %v, want 7", id, err)
+	}
+	if !db.called("MarkDigestSent") {
+		t.Errorf("MarkDigestSent was not called")
+	}
+}
+
+func TestSendDueDigestsNothingNew(t *testing.T) {
+	useDigestYouTube(t, http.StatusOK)
+	s, db := newFakeState(t)
+	s.cfg.Digest = testDigestConfig
+	db.set("GetAllFeedChannelPriorities", feedChannelPriorityRow("UC9", "@artist"))
+	db.set("ClaimDueDigestSubscriptions", dueDigestRow(7, time.Date(2024, 11, 1, 13, 0, 0, 0, time.UTC)))
+	mailer := &fakeMailer{}
+
+	sent, err := sendDueDigests(context.Background(), s, mailer, time.Date(2024, 11, 2, 8, 0, 0, 0, time.UTC))
+	if err != nil || sent != 0 || len(mailer.sent) != 0 {
+		t.Fatalf("got %d, %v, want nothing sent and no error", sent, err)
+	}
+	if !db.called("MarkDigestSent") {
+		t.Errorf("digest without new videos should be skipped until the next period")
+	}
+}
+
+func TestSendDueDigestsYouTubeUnavailable(t *testing.T) {
+	useDigestYouTube(t, http.StatusServiceUnavailable)
+	s, db := newFakeState(t)
+	s.cfg.Digest = testDigestConfig
+	// not fetched by other tests, so there are no cached videos to fall back on
+	db.set("GetAllFeedChannelPriorities", feedChannelPriorityRow("UC8", "@band"))
+	db.set("ClaimDueDigestSubscriptions", dueDigestRow(7, nil))
+	mailer := &fakeMailer{}
+
+	sent, err := sendDueDigests(context.Background(), s, mailer, time.Date(2024, 11, 2, 8, 0, 0, 0, time.UTC))
+	if err != nil || sent != 0 {
+		t.Fatalf("got %d, %v, want nothing sent and no error", sent, err)
+	}
+	if db.called("MarkDigestSent") || !db.called("MarkDigestFailed") {
+		t.Errorf("failed digest should be recorded and retried later")
+	}
+}
+
+func TestSendDueDigestsContinuesAfterUpdateError(t *testing.T) {
+	useDigestYouTube(t, http.StatusOK)
+	s, db := newFakeState(t)
+	s.cfg.Digest = testDigestConfig
+	db.set("GetAllFeedChannelPriorities", feedChannelPriorityRow("UC9", "@artist"))
+	lastSentAt := time.Date(2024, 11, 1, 8, 0, 0, 0, time.UTC)
+	db.set("ClaimDueDigestSubscriptions", dueDigestRow(7, lastSentAt), dueDigestRow(8, lastSentAt))
+	db.fail("MarkDigestSent", errors.New("connection reset"))
+	mailer := &fakeMailer{}
+
+	sent, err := sendDueDigests(context.Background(), s, mailer, time.Date(2024, 11, 2, 8, 0, 0, 0, time.UTC))
+	if err != nil || sent != 2 || len(mailer.sent) != 2 {
+		t.Fatalf("got %d, %v, want both digests sent and no error", sent, err)
+	}
+}
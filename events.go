@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/stream"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// Number of recent events kept for Last-Event-ID resumption, and the number of undelivered
+// events a subscriber may have before it is disconnected
+const (
+	STREAM_HISTORY = 1000
+	STREAM_BUFFER  = 64
+)
+
+// Reconnection delay suggested to clients, in milliseconds
+const STREAM_RETRY_MS = 5000
+
+// Interval between heartbeat events, keeps idle connections open through proxies
+var streamHeartbeat = 15 * time.Second
+
+// Postgres notification channel announcing the id of each stored event
+const STREAM_EVENTS_CHANNEL = "stream_events"
+
+// Stored events are kept for STREAM_EVENT_RETENTION so instances can catch up after losing their
+// listener connection, and are pruned every STREAM_EVENT_PRUNE_INTERVAL
+const (
+	STREAM_EVENT_RETENTION      = time.Hour
+	STREAM_EVENT_PRUNE_INTERVAL = time.Minute
+)
+
+// Publishes newly detected videos and channel status changes to the event stream. When db is set
+// events are stored and every instance delivers them to its own subscribers (see
+// listenForStreamEvents), otherwise they only reach subscribers of the instance that detected them
+type eventPublisher struct {
+	hub      *stream.Hub
+	db       *database.Queries
+	mu       sync.Mutex
+	statuses map[string]youtube.ChannelLoadStatus // last known load status by channel id
+}
+
+func newEventPublisher() *eventPublisher {
+	return &eventPublisher{
+		hub:      stream.NewHub(STREAM_HISTORY, STREAM_BUFFER),
+		statuses: map[string]youtube.ChannelLoadStatus{},
+	}
+}
+
+// Publishes an event of eventType about the channel
+func (p *eventPublisher) publish(ctx context.Context, eventType, channelId string, data any) error {
+	if p.db == nil {
+		return p.hub.Publish(eventType, channelId, data)
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("in publish(): error marshaling %s event: %s", eventType, err)
+	}
+
+	params := database.InsertStreamEventParams{
+		Type:      eventType,
+		ChannelID: channelId,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}
+	_, err = p.db.InsertStreamEvent(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in publish(): error storing %s event: %s", eventType, err)
+	}
+
+	return nil
+}
+
+// Publishes a video event
+func (p *eventPublisher) publishVideo(ctx context.Context, channelId string, video youtube.Video) {
+	err := p.publish(ctx, stream.EventVideo, channelId, video)
+	if err != nil {
+		logging.FromContext(ctx).Error("in publishVideo(): error publishing video", logging.KeyChannelID, channelId, logging.Err(err))
+	}
+}
+
+// Publishes a channel status event if the channel's status changed. Channels seen for the first
+// time are only published when they did not load
+func (p *eventPublisher) publishStatus(ctx context.Context, status youtube.ChannelStatus) {
+	if status.ChannelId == "" {
+		return
+	}
+
+	p.mu.Lock()
+	previous, known := p.statuses[status.ChannelId]
+	p.statuses[status.ChannelId] = status.Status
+	p.mu.Unlock()
+
+	unchanged := known && previous == status.Status
+	healthy := status.Status == youtube.ChannelOK || status.Status == youtube.ChannelEmpty
+	if unchanged || (!known && healthy) {
+		return
+	}
+
+	err := p.publish(ctx, stream.EventChannelStatus, status.ChannelId, status)
+	if err != nil {
+		logging.FromContext(ctx).Error("in publishStatus(): error publishing channel status", logging.KeyChannelID, status.ChannelId, logging.Err(err))
+	}
+}
+
+func (p *eventPublisher) ChannelStatuses(ctx context.Context, statuses []youtube.ChannelStatus) {
+	for _, status := range statuses {
+		p.publishStatus(ctx, status)
+	}
+}
+
+// Delivers the events stored by every instance to the subscribers of this one as Postgres
+// announces them, until ctx is done. Events stored while the listener connection was down are
+// delivered once it is re-established
+func listenForStreamEvents(ctx context.Context, s *state, dsn string) {
+	logger := logging.FromContext(ctx)
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("in listenForStreamEvents(): listener connection lost", logging.Err(err))
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(STREAM_EVENTS_CHANNEL)
+	if err != nil {
+		logger.Error("in listenForStreamEvents(): error listening for events", logging.Err(err))
+		return
+	}
+	lastId, err := s.db.GetLatestStreamEventId(ctx)
+	if err != nil {
+		logger.Error("in listenForStreamEvents(): error retrieving latest event id", logging.Err(err))
+		return
+	}
+
+	ticker := time.NewTicker(STREAM_EVENT_PRUNE_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-listener.Notify:
+			// nil after the connection is re-established, notifications sent meanwhile were lost
+			if notification == nil {
+				lastId = deliverStreamEventsAfter(ctx, s, lastId)
+				continue
+			}
+			id, err := strconv.ParseInt(notification.Extra, 10, 64)
+			if err != nil {
+				logger.Error("in listenForStreamEvents(): invalid event id", "payload", notification.Extra)
+				continue
+			}
+			deliverStreamEvent(ctx, s, id)
+			lastId = max(lastId, id)
+		case <-ticker.C:
+			// detects a dead connection the listener would otherwise wait on indefinitely
+			go listener.Ping()
+			err = s.db.DeleteStreamEventsBefore(ctx, time.Now().Add(-STREAM_EVENT_RETENTION))
+			if err != nil {
+				logger.Error("in listenForStreamEvents(): error pruning events", logging.Err(err))
+			}
+		}
+	}
+}
+
+func toStreamEvent(event database.StreamEvent) stream.Event {
+	return stream.Event{ID: uint64(event.ID), Type: event.Type, ChannelID: event.ChannelID, Data: event.Data}
+}
+
+// Delivers the stored event with the id, events already pruned are skipped
+func deliverStreamEvent(ctx context.Context, s *state, id int64) {
+	event, err := s.db.GetStreamEvent(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("in deliverStreamEvent(): error retrieving event", "event_id", id, logging.Err(err))
+		return
+	}
+
+	s.events.hub.Deliver(toStreamEvent(event))
+}
+
+// Delivers every stored event after lastId, returns the id of the last one delivered
+func deliverStreamEventsAfter(ctx context.Context, s *state, lastId int64) int64 {
+	events, err := s.db.GetStreamEventsAfter(ctx, lastId)
+	if err != nil {
+		logging.FromContext(ctx).Error("in deliverStreamEventsAfter(): error retrieving events", "event_id", lastId, logging.Err(err))
+		return lastId
+	}
+
+	for _, event := range events {
+		s.events.hub.Deliver(toStreamEvent(event))
+		lastId = event.ID
+	}
+
+	return lastId
+}
+
+// Body of video and channelStatus events, feedIds are the subscriber's feeds containing the channel
+type streamEventData struct {
+	FeedIDs []int32         `json:"feedIds"`
+	Video   json.RawMessage `json:"video,omitempty"`
+	Channel json.RawMessage `json:"channel,omitempty"`
+}
+
+// Writes a single server-sent event, id is omitted when empty
+func writeEvent(w http.ResponseWriter, id, eventType string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("in writeEvent(): error marshaling %s event: %s", eventType, err)
+	}
+
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, body)
+	if err != nil {
+		return fmt.Errorf("in writeEvent(): %s", err)
+	}
+
+	return nil
+}
+
+func writeStreamEvent(w http.ResponseWriter, event stream.Event, channels stream.Channels) error {
+	data := streamEventData{FeedIDs: channels[event.ChannelID]}
+	switch event.Type {
+	case stream.EventVideo:
+		data.Video = event.Data
+	case stream.EventChannelStatus:
+		data.Channel = event.Data
+	}
+
+	return writeEvent(w, fmt.Sprint(event.ID), event.Type, data)
+}
+
+// Streams events about channels until the client disconnects or falls too far behind. Missed
+// events are replayed from Last-Event-ID, a reset event asks the client to reload when they
+// can no longer be replayed
+func (s *state) serveEvents(w http.ResponseWriter, r *http.Request, channels stream.Channels) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("in serveEvents(): response writer does not support flushing")
+	}
+
+	// Streams stay open past the server's write timeout, recorders used in tests cannot extend it
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("in serveEvents(): error clearing write deadline: %s", err)
+	}
+
+	sub, missed, reset := s.events.hub.Subscribe(channels, r.Header.Get("Last-Event-ID"))
+	defer s.events.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(statusCodes.Success)
+
+	fmt.Fprintf(w, "retry: %d\n\n", STREAM_RETRY_MS)
+	if reset {
+		err = writeEvent(w, "", "reset", struct{}{})
+		if err != nil {
+			return fmt.Errorf("in serveEvents(): %s", err)
+		}
+	}
+	for _, event := range missed {
+		err = writeStreamEvent(w, event, channels)
+		if err != nil {
+			return fmt.Errorf("in serveEvents(): %s", err)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case event, ok := <-sub.Events:
+			if !ok {
+				return nil
+			}
+			err = writeStreamEvent(w, event, channels)
+		case now := <-heartbeat.C:
+			err = writeEvent(w, "", "heartbeat", map[string]time.Time{"time": now.UTC()})
+		}
+		if err != nil {
+			return fmt.Errorf("in serveEvents(): %s", err)
+		}
+		flusher.Flush()
+	}
+}
+
+// Adds the channels of the feed to channels
+func addFeedChannels(ctx context.Context, s *state, channels stream.Channels, feedId int32) error {
+	feedChannels, err := getAllFeedChannelPriorities(ctx, s, feedId)
+	if err != nil {
+		return fmt.Errorf("in addFeedChannels(): %s", err)
+	}
+
+	for _, channel := range feedChannels {
+		channels[channel.ChannelId] = append(channels[channel.ChannelId], feedId)
+	}
+
+	return nil
+}
+
+// GET - streams new videos and channel status changes for the feed as server-sent events. The
+// feed's channels are read when the stream opens, clients reconnect to pick up changes
+func (s *state) feedEventsV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in feedEventsV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	channels := stream.Channels{}
+	err = addFeedChannels(r.Context(), s, channels, feed.ID)
+	if err != nil {
+		logRequestError(r, "in feedEventsV2(): error retrieving feed channels", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	err = s.serveEvents(w, r, channels)
+	if err != nil {
+		logRequestError(r, "in feedEventsV2(): error streaming events", err)
+	}
+}
+
+// GET - streams new videos and channel status changes for every feed of the user
+func (s *state) userEventsV2(w http.ResponseWriter, r *http.Request) {
+	userId, statusCode, err := unpackGetRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in userEventsV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	feeds, err := getAllUserFeedDetails(r.Context(), s, userId)
+	if err != nil {
+		logRequestError(r, "in userEventsV2(): error retrieving feeds", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	channels := stream.Channels{}
+	for _, feed := range feeds {
+		err = addFeedChannels(r.Context(), s, channels, feed.ID)
+		if err != nil {
+			logRequestError(r, "in userEventsV2(): error retrieving feed channels", err, logging.KeyFeedID, feed.ID)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+			return
+		}
+	}
+
+	err = s.serveEvents(w, r, channels)
+	if err != nil {
+		logRequestError(r, "in userEventsV2(): error streaming events", err)
+	}
+}
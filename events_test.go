@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/stream"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// Opens an event stream for path and returns a function reading the next event, the retry
+// preamble is consumed so the subscription is registered when it returns
+func openStream(t *testing.T, s *state, path, lastEventId string) func() sseEvent {
+	server := httptest.NewServer(newRouter(s))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Firebase-ID", "firebase-user")
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("got Content-Type %q, want text/event-stream", contentType)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	next := func() sseEvent {
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				if event.event != "" {
+					return event
+				}
+				continue
+			}
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "id":
+				event.id = value
+			case "event":
+				event.event = value
+			case "data":
+				event.data = value
+			}
+		}
+		t.Fatalf("stream ended: %v", scanner.Err())
+		return event
+	}
+
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "retry: ") {
+		t.Fatalf("expected the stream to start with a retry line")
+	}
+
+	return next
+}
+
+// Registers feed 1 of user 1, following only UC9
+func setStreamFeed(db *fakeDB) {
+	db.authorize()
+	db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 1))
+	db.set("GetAllFeedChannelPriorities", feedChannelPriorityRow("UC9", "@artist"))
+}
+
+var streamVideo = youtube.Video{ChannelName: "Artist", Title: "New song", VideoId: "v2", PublishedAt: testTime}
+
+func TestFeedEventsStreamsVideos(t *testing.T) {
+	s, db := newFakeState(t)
+	setStreamFeed(db)
+	next := openStream(t, s, "/api/v2/feeds/1/events", "")
+
+	s.events.publishVideo(context.Background(), "UC8", youtube.Video{VideoId: "other"}) // not in the feed
+	s.events.publishVideo(context.Background(), "UC9", streamVideo)
+
+	event := next()
+	if event.event != "video" || event.id == "" {
+		t.Fatalf("got event %+v, want a video event with an id", event)
+	}
+
+	var data struct {
+		FeedIDs []int32       `json:"feedIds"`
+		Video   youtube.Video `json:"video"`
+	}
+	err := json.Unmarshal([]byte(event.data), &data)
+	if err != nil {
+		t.Fatalf("error decoding event data: %v", err)
+	}
+	if len(data.FeedIDs) != 1 || data.FeedIDs[0] != 1 || data.Video.VideoId != "v2" {
+		t.Errorf("got %+v, want video v2 for feed 1", data)
+	}
+}
+
+func TestStoreVideosPublishesNewVideos(t *testing.T) {
+	s, db := newFakeState(t)
+	setStreamFeed(db)
+	db.set("UpsertVideos", row("v1", false), row("v2", true))
+	next := openStream(t, s, "/api/v2/feeds/1/events", "")
+
+	store := videoStore{db: s.db, events: s.events}
+	videos := []youtube.Video{{VideoId: "v1", Title: "Old song"}, streamVideo, streamVideo}
+	err := store.StoreVideos(context.Background(), "UC9", videos)
+	if err != nil {
+		t.Fatalf("StoreVideos() error: %v", err)
+	}
+
+	event := next()
+	if event.event != "video" || !strings.Contains(event.data, `"id":"v2"`) {
+		t.Errorf("got event %+v, want only the newly stored v2 published", event)
+	}
+}
+
+func TestUserEventsStreamsChannelStatus(t *testing.T) {
+	s, db := newFakeState(t)
+	setStreamFeed(db)
+	next := openStream(t, s, "/api/v2/events", "")
+
+	s.events.publishStatus(context.Background(), youtube.ChannelStatus{ChannelId: "UC9", Status: youtube.ChannelOK})     // first sighting, healthy
+	s.events.publishStatus(context.Background(), youtube.ChannelStatus{ChannelId: "UC9", Status: youtube.ChannelFailed}) // changed
+	s.events.publishStatus(context.Background(), youtube.ChannelStatus{ChannelId: "UC9", Status: youtube.ChannelFailed}) // unchanged
+	s.events.publishStatus(context.Background(), youtube.ChannelStatus{ChannelId: "UC9", Status: youtube.ChannelOK})     // recovered
+
+	for _, want := range []string{`"status":"failed"`, `"status":"ok"`} {
+		event := next()
+		if event.event != "channelStatus" || !strings.Contains(event.data, want) {
+			t.Errorf("got event %+v, want channelStatus with %s", event, want)
+		}
+	}
+}
+
+func TestEventsResumeFromLastEventId(t *testing.T) {
+	s, db := newFakeState(t)
+	setStreamFeed(db)
+	first := openStream(t, s, "/api/v2/feeds/1/events", "")
+
+	s.events.publishVideo(context.Background(), "UC9", streamVideo)
+	s.events.publishVideo(context.Background(), "UC9", youtube.Video{VideoId: "v3"})
+	seen := first()
+	first()
+
+	next := openStream(t, s, "/api/v2/feeds/1/events", seen.id)
+	event := next()
+	if event.event != "video" || !strings.Contains(event.data, `"id":"v3"`) {
+		t.Errorf("got event %+v, want the missed v3 video replayed", event)
+	}
+
+	next = openStream(t, s, "/api/v2/feeds/1/events", "1")
+	event = next()
+	if event.event != "reset" {
+		t.Errorf("got event %+v, want reset for an unknown Last-Event-ID", event)
+	}
+}
+
+func TestSharedEventsAreDeliveredFromTheDatabase(t *testing.T) {
+	s, db := newFakeState(t)
+	setStreamFeed(db)
+	s.events.db = s.db
+	next := openStream(t, s, "/api/v2/feeds/1/events", "")
+
+	s.events.publishVideo(context.Background(), "UC9", streamVideo)
+	if !db.called("InsertStreamEvent") {
+		t.Fatalf("expected the event to be stored")
+	}
+
+	db.set("GetStreamEventsAfter", row(int64(42), "video", "UC9", []byte(`{"id":"v2"}`), testTime))
+	lastId := deliverStreamEventsAfter(context.Background(), s, 41)
+	if lastId != 42 {
+		t.Errorf("got last id %d, want 42", lastId)
+	}
+
+	event := next()
+	if event.event != "video" || event.id != "42" || !strings.Contains(event.data, `"id":"v2"`) {
+		t.Errorf("got event %+v, want the stored event delivered under its id", event)
+	}
+}
+
+func TestStreamEventsReachListeners(t *testing.T) {
+	queries := openTestDatabase(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	listening := &state{db: queries, events: newEventPublisher()}
+	go listenForStreamEvents(ctx, listening, os.Getenv("TEST_DATABASE_URL"))
+	sub, _, _ := listening.events.hub.Subscribe(stream.Channels{"UC9": {1}}, "")
+
+	publishing := newEventPublisher()
+	publishing.db = queries
+
+	// the listener may not be listening yet, publish until an event arrives
+	for attempt := 0; attempt < 10; attempt++ {
+		publishing.publishVideo(ctx, "UC9", streamVideo)
+		select {
+		case event := <-sub.Events:
+			if event.Type != stream.EventVideo || !strings.Contains(string(event.Data), `"id":"v2"`) {
+				t.Errorf("got event %+v, want the published video", event)
+			}
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	t.Fatalf("no event was delivered to the listening instance")
+}
+
+func TestEventsHeartbeat(t *testing.T) {
+	interval := streamHeartbeat
+	streamHeartbeat = 10 * time.Millisecond
+	t.Cleanup(func() { streamHeartbeat = interval })
+
+	s, db := newFakeState(t)
+	setStreamFeed(db)
+	next := openStream(t, s, "/api/v2/feeds/1/events", "")
+
+	event := next()
+	if event.event != "heartbeat" {
+		t.Errorf("got event %+v, want heartbeat", event)
+	}
+}
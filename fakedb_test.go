@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+)
+
+// In-memory database/sql driver used to drive handlers in tests without Postgres.
+// Results are registered by sqlc query name (the "-- name: X" comment), queries
+// without a registered result return no rows and execs succeed.
+
+type fakeResult struct {
+	rows   [][]driver.Value
+	err    error
+	noRows bool // execs report that no rows were affected
+}
+
+type fakeDB struct {
+	mu      sync.Mutex
+	results map[string]fakeResult
+	calls   []string
+}
+
+// Sets the rows returned by the named query, each row is a slice of column values
+func (db *fakeDB) set(name string, rows ...[]driver.Value) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.results[name] = fakeResult{rows: rows}
+}
+
+// Makes the named query fail with err
+func (db *fakeDB) fail(name string, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.results[name] = fakeResult{err: err}
+}
+
+// Makes the named exec report that no rows were affected
+func (db *fakeDB) affectNone(name string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.results[name] = fakeResult{noRows: true}
+}
+
+// Returns true if the named query was run
+func (db *fakeDB) called(name string) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, call := range db.calls {
+		if call == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *fakeDB) result(query string) (string, fakeResult) {
+	name := strings.TrimSpace(query)
+	if match := queryNameRegex.FindStringSubmatch(query); match != nil {
+		name = match[1]
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls = append(db.calls, name)
+	return name, db.results[name]
+}
+
+// Shorthand for a row of column values
+func row(values ...driver.Value) []driver.Value {
+	return values
+}
+
+var (
+	fakeDBs            sync.Map // dsn -> *fakeDB
+	registerFakeDriver sync.Once
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	db, ok := fakeDBs.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unknown dsn<%s>", dsn)
+	}
+	return &fakeConn{db: db.(*fakeDB)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakedb: prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	_, result := c.db.result(query)
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	width := 0
+	if len(result.rows) > 0 {
+		width = len(result.rows[0])
+	}
+	return &fakeRows{width: width, rows: result.rows}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, result := c.db.result(query)
+	if result.err != nil {
+		return nil, result.err
+	}
+	if result.noRows {
+		return driver.RowsAffected(0), nil
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	width int
+	rows  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	columns := make([]string, r.width)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("column%d", i)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// Creates a state backed by a new fakeDB
+func newFakeState(t *testing.T) (*state, *fakeDB) {
+	registerFakeDriver.Do(func() {
+		sql.Register("fakedb", fakeDriver{})
+	})
+
+	db := &fakeDB{results: map[string]fakeResult{}}
+	dsn := t.Name()
+	fakeDBs.Store(dsn, db)
+
+	sqlDB, err := sql.Open("fakedb", dsn)
+	if err != nil {
+		t.Fatalf("error opening fakedb: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB.Close()
+		fakeDBs.Delete(dsn)
+	})
+
+	m := newMetrics()
+	cfg := config.Defaults()
+	s := &state{
+		db:      database.New(instrumentedDB{db: sqlDB, metrics: m}),
+		conn:    sqlDB,
+		cfg:     &cfg,
+		events:  newEventPublisher(),
+		metrics: m,
+	}
+	return s, db
+}
+
+// Registers the results needed for the Firebase-ID header to resolve to user 1
+func (db *fakeDB) authorize() {
+	db.set("GetUserIdByFirebaseId", row(int64(1)))
+	db.set("ContainsUserById", row(true))
+}
+
+var testTime = time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+
+// Row returned by GetUserFeed and GetAllUserFeedDetails
+func feedDetailsRow(id int64, name string, channelCount int64) []driver.Value {
+	return row(id, testTime, testTime, name, int64(1), "date", channelCount)
+}
+
+// Row returned by GetAllFeedChannelDetails and GetFeedChannelDetails
+func feedChannelDetailsRow(channelId, handle string) []driver.Value {
+	return row(channelId, "UU"+channelId[2:], handle, "https://www.youtube.com/channel/"+channelId,
+		"Title "+handle, "", "https://yt3.ggpht.com/"+channelId+"=s88", "https://yt3.ggpht.com/"+channelId+"=s240", "https://yt3.ggpht.com/"+channelId+"=s800",
+		int64(1200), int64(34), testTime, "active", "", nil, int64(1), testTime)
+}
+
+// Row returned by GetAllFeedChannelDetails and GetFeedChannelDetails for a channel deleted on YouTube
+func deadFeedChannelDetailsRow(channelId, handle string) []driver.Value {
+	channel := feedChannelDetailsRow(channelId, handle)
+	channel[12], channel[13], channel[14] = "dead", "notFound", testTime
+	return channel
+}
+
+// Row returned by GetAllFeedChannelPriorities
+func feedChannelPriorityRow(channelId, handle string) []driver.Value {
+	return row(channelId, handle, "UU"+channelId[2:], "active", "", int64(1))
+}
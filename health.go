@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+const HEALTH_PATH = "/healthz"
+const READY_PATH = "/readyz"
+
+// How long the readiness probe waits for the database
+const READY_DB_TIMEOUT = 2 * time.Second
+
+// Readiness states
+const (
+	READY     = "ready"
+	NOT_READY = "notReady"
+	DRAINING  = "draining"
+)
+
+type readinessResponse struct {
+	Status   string         `json:"status"`
+	Database string         `json:"database"` // "ok" or "unreachable"
+	YouTube  youtube.Health `json:"youtube"`
+}
+
+// Returns true if the request is for one of the probe endpoints
+func isProbeRoute(r *http.Request) bool {
+	path, ok := routeTemplate(r)
+	return ok && (path == HEALTH_PATH || path == READY_PATH)
+}
+
+// GET - liveness probe, succeeds whenever the process is serving requests
+func (s *state) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeResponseMessage(w, "ok", statusCodes.Success)
+}
+
+// GET - readiness probe. The instance is not ready while draining, when the database cannot be
+// reached or when no YouTube API key is configured. An open circuit or exhausted quota is
+// reported but keeps the instance ready, cached feeds can still be served
+func (s *state) handleReady(w http.ResponseWriter, r *http.Request) {
+	resBody := readinessResponse{
+		Status:   READY,
+		Database: "ok",
+		YouTube:  youtube.GetHealth(),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), READY_DB_TIMEOUT)
+	defer cancel()
+	err := s.conn.PingContext(ctx)
+	if err != nil {
+		requestLogger(r).Warn("in handleReady(): database unreachable", logging.Err(err))
+		resBody.Database = "unreachable"
+		resBody.Status = NOT_READY
+	}
+	if !resBody.YouTube.Configured {
+		resBody.Status = NOT_READY
+	}
+	if s.draining.Load() {
+		resBody.Status = DRAINING
+	}
+
+	statusCode := statusCodes.Success
+	if resBody.Status != READY {
+		statusCode = statusCodes.ErrState
+	}
+	writeResponse(w, resBody, statusCode)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+)
+
+// Serves the readiness probe and returns the decoded response
+func serveReady(t *testing.T, s *state) (int, readinessResponse) {
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, READY_PATH, nil))
+
+	var res readinessResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatalf("error decoding readiness response: %v", err)
+	}
+	return recorder.Code, res
+}
+
+func TestReadiness(t *testing.T) {
+	t.Setenv("YOUTUBE_CUSTOM_FEEDS_YT_API_KEY", "test-key")
+	s, _ := newFakeState(t)
+
+	code, res := serveReady(t, s)
+	if code != http.StatusOK || res.Status != READY || res.Database != "ok" || !res.YouTube.Configured {
+		t.Errorf("got %d %+v, want ready", code, res)
+	}
+
+	s.draining.Store(true)
+	code, res = serveReady(t, s)
+	if code != http.StatusServiceUnavailable || res.Status != DRAINING {
+		t.Errorf("got %d %+v, want draining", code, res)
+	}
+}
+
+func TestReadinessChecksDependencies(t *testing.T) {
+	t.Setenv("YOUTUBE_CUSTOM_FEEDS_YT_API_KEY", "")
+	s, _ := newFakeState(t)
+	s.conn.Close()
+
+	code, res := serveReady(t, s)
+	if code != http.StatusServiceUnavailable || res.Status != NOT_READY {
+		t.Errorf("got %d %+v, want not ready", code, res)
+	}
+	if res.Database != "unreachable" || res.YouTube.Configured {
+		t.Errorf("got %+v, want the database unreachable and youtube unconfigured", res)
+	}
+}
+
+func TestProbesAreNotRateLimited(t *testing.T) {
+	s, _ := newFakeState(t)
+	s.limiters = newRateLimiters(config.RateLimitConfig{Enabled: true, PerMinute: 1, Burst: 1})
+
+	router := newRouter(s)
+	for i := 0; i < 5; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, HEALTH_PATH, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("probe %d got status %d, want %d", i, recorder.Code, http.StatusOK)
+		}
+	}
+}
@@ -1,91 +1,431 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 )
 
+// Settings are layered, each overriding the one before: Defaults, the JSON config file named by
+// -config (or CONFIG_FILE), environment variables and finally command line flags
 type Config struct {
-	DBUrl string `json:"db_url"`
+	Database   DatabaseConfig  `json:"database"`
+	AdminToken string          `json:"admin_token"`
+	Server     ServerConfig    `json:"server"`
+	Feeds      FeedsConfig     `json:"feeds"`
+	Features   FeaturesConfig  `json:"features"`
+	RateLimit  RateLimitConfig `json:"rate_limit"`
+	Quota      QuotaConfig     `json:"quota"`
+	YouTube    YouTubeConfig   `json:"youtube"`
+	Channels   ChannelsConfig  `json:"channels"`
+	Recommend  RecommendConfig `json:"recommend"`
+	Digest     DigestConfig    `json:"digest"`
+	Webhooks   WebhooksConfig  `json:"webhooks"`
+	Logging    LoggingConfig   `json:"logging"`
+	Tracing    TracingConfig   `json:"tracing"`
+	Secrets    SecretsConfig   `json:"secrets"`
 }
 
-func Read() (Config, error) {
-	var config Config
+// Postgres connection settings. URL (a postgres:// URL or key=value DSN) is used as is when set,
+// otherwise the DSN is built from the remaining fields. CloudSQLInstance connects through the
+// Cloud SQL unix socket instead of Host and Port. AutoMigrate applies pending schema migrations
+// at startup
+type DatabaseConfig struct {
+	URL                    string `json:"url"`
+	Host                   string `json:"host"`
+	Port                   int    `json:"port"`
+	User                   string `json:"user"`
+	Password               string `json:"password"`
+	Name                   string `json:"name"`
+	SSLMode                string `json:"ssl_mode"` // disable, require, verify-ca or verify-full
+	CloudSQLInstance       string `json:"cloud_sql_instance"`
+	MaxOpenConns           int    `json:"max_open_conns"`
+	MaxIdleConns           int    `json:"max_idle_conns"`
+	ConnMaxLifetimeMinutes int    `json:"conn_max_lifetime_minutes"`
+	AutoMigrate            bool   `json:"auto_migrate"`
+}
+
+// HTTP server settings. Event streams are exempt from WriteTimeoutSeconds, in-flight requests
+// are given ShutdownTimeoutSeconds to finish once a shutdown signal is received. TrustedProxies
+// is the number of proxies in front of the server that append to X-Forwarded-For, 0 ignores
+// the header
+type ServerConfig struct {
+	Port                     int `json:"port"`
+	ReadHeaderTimeoutSeconds int `json:"read_header_timeout_seconds"`
+	ReadTimeoutSeconds       int `json:"read_timeout_seconds"`
+	WriteTimeoutSeconds      int `json:"write_timeout_seconds"`
+	IdleTimeoutSeconds       int `json:"idle_timeout_seconds"`
+	ShutdownTimeoutSeconds   int `json:"shutdown_timeout_seconds"`
+	TrustedProxies           int `json:"trusted_proxies"`
+}
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASS")
-	dbName := os.Getenv("DB_NAME")
-	instanceConnectionName := os.Getenv("INSTANCE_CONNECTION_NAME")
-	// dbHost := os.Getenv("DB_HOST")
-	// dbPort := "5432"
+// Feed video settings. VideoLimit videos are returned per feed, ChannelCap and CapWindowHours
+// are the defaults of the capped order
+type FeedsConfig struct {
+	VideoLimit     int `json:"video_limit"`
+	ChannelCap     int `json:"channel_cap"`
+	CapWindowHours int `json:"cap_window_hours"`
+}
 
-	socketDir := "/cloudsql"
+// Optional features, a disabled feature's routes are not registered and its background jobs
+// do not run
+type FeaturesConfig struct {
+	Recommendations bool `json:"recommendations"`
+	Digests         bool `json:"digests"`
+	Webhooks        bool `json:"webhooks"`
+	Events          bool `json:"events"`
+}
 
-	configString := fmt.Sprintf("host=%s/%s user=%s password=%s dbname=%s sslmode=disable",
-		socketDir, instanceConnectionName, dbUser, dbPassword, dbName)
+// Token bucket budgets applied per user and per client ip. Expensive routes (those that call
+// the YouTube API) have a separate, smaller budget
+type RateLimitConfig struct {
+	Enabled            bool `json:"enabled"`
+	PerMinute          int  `json:"per_minute"`
+	Burst              int  `json:"burst"`
+	ExpensivePerMinute int  `json:"expensive_per_minute"`
+	ExpensiveBurst     int  `json:"expensive_burst"`
+}
 
-	config.DBUrl = configString
+// YouTube Data API daily unit budget
+type QuotaConfig struct {
+	DailyLimit           int `json:"daily_limit"`
+	SoftLimitPercent     int `json:"soft_limit_percent"`
+	FlushIntervalSeconds int `json:"flush_interval_seconds"`
+}
 
-	return config, nil
+// YouTube API client settings. Failed calls are retried with backoff and the circuit breaker
+// opens after BreakerThreshold consecutive failures. Endpoint overrides the API base URL
+type YouTubeConfig struct {
+	Endpoint               string `json:"endpoint"`
+	RetryMaxAttempts       int    `json:"retry_max_attempts"`
+	RetryBaseDelayMs       int    `json:"retry_base_delay_ms"`
+	RetryMaxDelayMs        int    `json:"retry_max_delay_ms"`
+	BreakerThreshold       int    `json:"breaker_threshold"`
+	BreakerCooldownSeconds int    `json:"breaker_cooldown_seconds"`
 }
 
-/*
+// How often stored channel metadata (title, avatar, counts) is refreshed from YouTube
+type ChannelsConfig struct {
+	RefreshIntervalMinutes int `json:"refresh_interval_minutes"`
+	RefreshMaxAgeHours     int `json:"refresh_max_age_hours"`
+}
 
-const configFileName = "/.youtube-custom-feeds-config.json"
+// How often channel co-occurrence is recomputed. Pairs shared by fewer than MinSupport distinct
+// users are never stored so recommendations cannot reveal an individual user's feeds
+type RecommendConfig struct {
+	IntervalMinutes int `json:"interval_minutes"`
+	MinSupport      int `json:"min_support"`
+}
+
+// Email digest settings, digests are only sent when SMTPHost is set. SigningKey signs
+// unsubscribe links, which point at BaseURL
+type DigestConfig struct {
+	SMTPHost             string `json:"smtp_host"`
+	SMTPPort             int    `json:"smtp_port"`
+	SMTPUsername         string `json:"smtp_username"`
+	SMTPPassword         string `json:"smtp_password"`
+	SMTPTimeoutSeconds   int    `json:"smtp_timeout_seconds"`
+	From                 string `json:"from"`
+	SigningKey           string `json:"signing_key"`
+	BaseURL              string `json:"base_url"`
+	CheckIntervalSeconds int    `json:"check_interval_seconds"`
+}
+
+// Webhook delivery settings. Failed deliveries are retried with backoff until MaxAttempts,
+// feeds with webhooks are polled every PollIntervalMinutes so new videos are noticed
+type WebhooksConfig struct {
+	DeliveryIntervalSeconds int `json:"delivery_interval_seconds"`
+	TimeoutSeconds          int `json:"timeout_seconds"`
+	MaxAttempts             int `json:"max_attempts"`
+	PollIntervalMinutes     int `json:"poll_interval_minutes"`
+}
+
+// Log output settings. Format is "json" or "text", Level is one of debug, info, warn or error
+type LoggingConfig struct {
+	Format string `json:"format"`
+	Level  string `json:"level"`
+}
 
-func getConfigFilePath() (string, error) {
-	path, err := os.UserHomeDir()
+// Trace export settings. Exporter is "none", "otlp" (sent to Endpoint, or the OTLP default) or
+// "stdout" for local runs. SamplePercent of root traces are kept
+type TracingConfig struct {
+	Exporter      string `json:"exporter"`
+	Endpoint      string `json:"endpoint"`
+	ServiceName   string `json:"service_name"`
+	SamplePercent int    `json:"sample_percent"`
+}
+
+// Where secrets are read from. Provider is "env", "file" (one file per secret in Dir) or "gcp"
+// (Google Secret Manager in Project). Secrets found override the configured values, the
+// YouTube API key is re-read every ReloadSeconds so a rotated key is used without a restart
+type SecretsConfig struct {
+	Provider      string `json:"provider"`
+	Dir           string `json:"dir"`
+	Project       string `json:"project"`
+	ReloadSeconds int    `json:"reload_seconds"`
+}
+
+// Returns the settings used when nothing overrides them
+func Defaults() Config {
+	return Config{
+		Database: DatabaseConfig{
+			Host:                   "localhost",
+			Port:                   5432,
+			MaxOpenConns:           10,
+			MaxIdleConns:           5,
+			ConnMaxLifetimeMinutes: 30,
+		},
+		Server: ServerConfig{
+			Port:                     8080,
+			ReadHeaderTimeoutSeconds: 5,
+			ReadTimeoutSeconds:       15,
+			WriteTimeoutSeconds:      60,
+			IdleTimeoutSeconds:       120,
+			ShutdownTimeoutSeconds:   10,
+			TrustedProxies:           1,
+		},
+		Feeds: FeedsConfig{
+			VideoLimit:     10,
+			ChannelCap:     2,
+			CapWindowHours: 24,
+		},
+		Features: FeaturesConfig{
+			Recommendations: true,
+			Digests:         true,
+			Webhooks:        true,
+			Events:          true,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:            true,
+			PerMinute:          120,
+			Burst:              30,
+			ExpensivePerMinute: 20,
+			ExpensiveBurst:     5,
+		},
+		Quota: QuotaConfig{
+			DailyLimit:           10000,
+			SoftLimitPercent:     80,
+			FlushIntervalSeconds: 30,
+		},
+		YouTube: YouTubeConfig{
+			RetryMaxAttempts:       3,
+			RetryBaseDelayMs:       200,
+			RetryMaxDelayMs:        2000,
+			BreakerThreshold:       5,
+			BreakerCooldownSeconds: 30,
+		},
+		Channels: ChannelsConfig{
+			RefreshIntervalMinutes: 60,
+			RefreshMaxAgeHours:     24,
+		},
+		Recommend: RecommendConfig{
+			IntervalMinutes: 360,
+			MinSupport:      3,
+		},
+		Digest: DigestConfig{
+			SMTPPort:             587,
+			SMTPTimeoutSeconds:   30,
+			CheckIntervalSeconds: 300,
+		},
+		Webhooks: WebhooksConfig{
+			DeliveryIntervalSeconds: 10,
+			TimeoutSeconds:          10,
+			MaxAttempts:             8,
+			PollIntervalMinutes:     15,
+		},
+		Logging: LoggingConfig{
+			Format: "json",
+			Level:  "info",
+		},
+		Tracing: TracingConfig{
+			Exporter:      "none",
+			ServiceName:   "youtube-custom-feeds",
+			SamplePercent: 100,
+		},
+		Secrets: SecretsConfig{
+			Provider:      ProviderEnv,
+			ReloadSeconds: 300,
+		},
+	}
+}
+
+// Builds the configuration from every layer. args are the command line flags, usage and flag
+// errors are written to output. Settings a secret provider may supply are not validated, call
+// Validate again once ApplySecrets has run
+func Load(args []string, output io.Writer) (Config, error) {
+	cfg := Defaults()
+
+	// flags are parsed once to find the config file and again after the lower layers are applied
+	var configPath string
+	defaults := Defaults()
+	err := newFlagSet(&defaults, &configPath, output).Parse(args)
 	if err != nil {
-		newError := fmt.Sprintf("Error loacating HOME directory in getConfigFilePath(): %s", err)
-		return "", errors.New(newError)
+		return cfg, fmt.Errorf("in Load(): %w", err)
+	}
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_FILE")
 	}
-	path = path + configFileName
 
-	return path, nil
-}
+	if configPath != "" {
+		err = readFile(configPath, &cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("in Load(): %s", err)
+		}
+	}
 
-// Writes Config data to youtube-custom-feeds-config.json
-func write(cfg Config) error {
-	path, err := getConfigFilePath()
+	err = readEnv(&cfg)
 	if err != nil {
-		newErr := fmt.Sprintf("Error in write() - issue getting config file path: %s", err)
-		return errors.New(newErr)
+		return cfg, fmt.Errorf("in Load(): %s", err)
 	}
 
-	data, err := json.Marshal(cfg)
+	flags := newFlagSet(&cfg, &configPath, io.Discard)
+	err = flags.Parse(args)
 	if err != nil {
-		newErr := fmt.Sprintf("Error in write() - issue Marshaling Config: %s", err)
-		return errors.New(newErr)
+		return cfg, fmt.Errorf("in Load(): %s", err)
+	}
+	if flags.NArg() > 0 {
+		return cfg, fmt.Errorf("in Load(): unexpected arguments %v", flags.Args())
 	}
 
-	err = os.WriteFile(path, data, 0666)
+	err = cfg.validate(false)
 	if err != nil {
-		newErr := fmt.Sprintf("Error in write() - issue writing data to youtube-custom-feeds-config.json: %s", err)
-		return errors.New(newErr)
+		return cfg, fmt.Errorf("in Load(): %s", err)
 	}
 
-	return nil
+	return cfg, nil
 }
 
-// Reads the data from youtube-custom-feeds-config.json and
-// stores it in a Config struct.
-func Read() Config {
-	path, err := getConfigFilePath()
+// Returns true if err is the flag package's response to -h or -help
+func IsHelp(err error) bool {
+	return errors.Is(err, flag.ErrHelp)
+}
+
+// Overrides cfg with the settings in the JSON file at path, unknown keys are rejected so typos
+// are not silently ignored
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Error getting file path in Read(): %s", err)
+		return fmt.Errorf("in readFile(): error reading config file: %s", err)
 	}
-	configFile, err := os.Open(path)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(cfg)
 	if err != nil {
-		log.Fatalf("Error in Read() - Issue opening config json: %s", err)
+		return fmt.Errorf("in readFile(): error decoding config file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Returns an error listing every invalid setting
+func (cfg Config) Validate() error {
+	return cfg.validate(true)
+}
+
+// Returns an error listing every invalid setting, the ones a secret provider may supply are only
+// checked once secretsApplied
+func (cfg Config) validate(secretsApplied bool) error {
+	errs := []error{}
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	db := cfg.Database
+	check(oneOf(db.SSLMode, "", "disable", "require", "verify-ca", "verify-full"), "database.ssl_mode<%s> must be disable, require, verify-ca or verify-full", db.SSLMode)
+	check(db.URL != "" || db.CloudSQLInstance != "" || db.Host != "", "database.host is required unless database.url or database.cloud_sql_instance is set")
+	check(db.Port >= 1 && db.Port <= 65535, "database.port must be between 1 and 65535")
+	check(db.MaxOpenConns >= 1, "database.max_open_conns must be at least 1")
+	check(db.MaxIdleConns <= db.MaxOpenConns, "database.max_idle_conns must be at most database.max_open_conns")
+
+	server := cfg.Server
+	check(server.Port >= 1 && server.Port <= 65535, "server.port must be between 1 and 65535")
+	check(server.ReadHeaderTimeoutSeconds >= 1 && server.ReadTimeoutSeconds >= 1 && server.WriteTimeoutSeconds >= 1 && server.IdleTimeoutSeconds >= 1,
+		"server.*_timeout_seconds settings must be at least 1")
+	check(server.ShutdownTimeoutSeconds >= 1, "server.shutdown_timeout_seconds must be at least 1")
+	check(server.TrustedProxies >= 0, "server.trusted_proxies must not be negative")
+
+	rateLimit := cfg.RateLimit
+	check(!rateLimit.Enabled || (rateLimit.PerMinute >= 1 && rateLimit.ExpensivePerMinute >= 1),
+		"rate_limit.per_minute and rate_limit.expensive_per_minute must be at least 1 when rate_limit.enabled is set")
+
+	feeds := cfg.Feeds
+	check(feeds.VideoLimit >= 1 && feeds.VideoLimit <= 50, "feeds.video_limit must be between 1 and 50")
+	check(feeds.ChannelCap >= 1, "feeds.channel_cap must be at least 1")
+	check(feeds.CapWindowHours >= 1, "feeds.cap_window_hours must be at least 1")
+
+	check(cfg.Quota.DailyLimit >= 1, "quota.daily_limit must be at least 1")
+	check(cfg.Quota.SoftLimitPercent >= 0 && cfg.Quota.SoftLimitPercent <= 100, "quota.soft_limit_percent must be between 0 and 100")
+	check(cfg.Quota.FlushIntervalSeconds >= 1, "quota.flush_interval_seconds must be at least 1")
+
+	yt := cfg.YouTube
+	check(yt.RetryMaxAttempts >= 0 && yt.RetryBaseDelayMs >= 0 && yt.RetryMaxDelayMs >= 0 && yt.BreakerThreshold >= 0 && yt.BreakerCooldownSeconds >= 0,
+		"youtube.retry_* and youtube.breaker_* settings must not be negative")
+	check(yt.RetryBaseDelayMs <= yt.RetryMaxDelayMs, "youtube.retry_base_delay_ms must be at most youtube.retry_max_delay_ms")
+	check(cfg.Channels.RefreshIntervalMinutes >= 1, "channels.refresh_interval_minutes must be at least 1")
+	check(cfg.Recommend.IntervalMinutes >= 1, "recommend.interval_minutes must be at least 1")
+	check(cfg.Recommend.MinSupport >= 2, "recommend.min_support must be at least 2")
+
+	digest := cfg.Digest
+	check(digest.CheckIntervalSeconds >= 1, "digest.check_interval_seconds must be at least 1")
+	check(digest.SMTPTimeoutSeconds >= 1, "digest.smtp_timeout_seconds must be at least 1")
+	check(digest.SMTPHost == "" || (digest.From != "" && digest.BaseURL != ""),
+		"digest.from and digest.base_url are required when digest.smtp_host is set")
+	if secretsApplied {
+		check(digest.SMTPHost == "" || digest.SigningKey != "", "digest.signing_key is required when digest.smtp_host is set")
 	}
 
-	var configStruct Config
-	decoder := json.NewDecoder(configFile)
-	if err := decoder.Decode(&configStruct); err != nil {
-		log.Fatalf("Error in Read() - Issue decoding config json: %s", err)
+	webhooks := cfg.Webhooks
+	check(webhooks.DeliveryIntervalSeconds >= 1 && webhooks.TimeoutSeconds >= 1 && webhooks.MaxAttempts >= 1 && webhooks.PollIntervalMinutes >= 1,
+		"webhooks.* settings must be at least 1")
+
+	check(oneOf(cfg.Logging.Format, "json", "text"), "logging.format<%s> must be json or text", cfg.Logging.Format)
+	check(oneOf(cfg.Logging.Level, "debug", "info", "warn", "error"), "logging.level<%s> must be debug, info, warn or error", cfg.Logging.Level)
+	check(oneOf(cfg.Tracing.Exporter, "none", "otlp", "stdout"), "tracing.exporter<%s> must be none, otlp or stdout", cfg.Tracing.Exporter)
+	check(cfg.Tracing.SamplePercent >= 0 && cfg.Tracing.SamplePercent <= 100, "tracing.sample_percent must be between 0 and 100")
+
+	secrets := cfg.Secrets
+	check(oneOf(secrets.Provider, ProviderEnv, ProviderFile, ProviderGoogle), "secrets.provider<%s> must be env, file or gcp", secrets.Provider)
+	check(secrets.Provider != ProviderFile || secrets.Dir != "", "secrets.dir is required when secrets.provider is file")
+	check(secrets.Provider != ProviderGoogle || secrets.Project != "", "secrets.project is required when secrets.provider is gcp")
+	check(secrets.ReloadSeconds >= 1, "secrets.reload_seconds must be at least 1")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("in validate(): invalid configuration:\n%w", errors.Join(errs...))
 	}
 
-	return configStruct
+	return nil
+}
+
+// Returns true if value is one of allowed
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
 }
 
-*/
+// Returns a copy of cfg that is safe to print, with every secret replaced
+func (cfg Config) Redacted() Config {
+	redact := func(secret *string) {
+		if *secret != "" {
+			*secret = REDACTED
+		}
+	}
+
+	cfg.Database.URL = redactDSN(cfg.Database.URL)
+	redact(&cfg.Database.Password)
+	redact(&cfg.AdminToken)
+	redact(&cfg.Digest.SMTPPassword)
+	redact(&cfg.Digest.SigningKey)
+
+	return cfg
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a config file and returns its path
+func writeConfigFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"server": {"port": 9000},
+		"feeds": {"video_limit": 20, "channel_cap": 3},
+		"logging": {"level": "debug"}
+	}`)
+	t.Setenv("FEED_VIDEO_LIMIT", "30")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	cfg, err := Load([]string{"-config", path, "-log-level", "error", "-feature", "webhooks=false"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	if cfg.Server.Port != 9000 || cfg.Feeds.ChannelCap != 3 {
+		t.Errorf("got port %d and channel cap %d, want the file's 9000 and 3", cfg.Server.Port, cfg.Feeds.ChannelCap)
+	}
+	if cfg.Feeds.VideoLimit != 30 {
+		t.Errorf("got video limit %d, want the environment's 30", cfg.Feeds.VideoLimit)
+	}
+	if cfg.Logging.Level != "error" {
+		t.Errorf("got log level %s, want the flag's error", cfg.Logging.Level)
+	}
+	if cfg.Features.Webhooks || !cfg.Features.Digests {
+		t.Errorf("got features %+v, want only webhooks disabled", cfg.Features)
+	}
+	if cfg.Feeds.CapWindowHours != Defaults().Feeds.CapWindowHours {
+		t.Errorf("got cap window %d, want the default", cfg.Feeds.CapWindowHours)
+	}
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+		args []string
+		want string
+	}{
+		{name: "unknown file key", file: `{"feeds": {"videos": 5}}`, want: "unknown field"},
+		{name: "video limit", args: []string{"-video-limit", "100"}, want: "feeds.video_limit"},
+		{name: "ssl mode", args: []string{"-db-sslmode", "prefer"}, want: "database.ssl_mode"},
+		{name: "quota flush interval", file: `{"quota": {"flush_interval_seconds": 0}}`, want: "quota.flush_interval_seconds"},
+		{name: "rate limit", file: `{"rate_limit": {"expensive_per_minute": 0}}`, want: "rate_limit.per_minute"},
+		{name: "shutdown timeout", file: `{"server": {"shutdown_timeout_seconds": 0}}`, want: "server.shutdown_timeout_seconds"},
+		{name: "negative retry", file: `{"youtube": {"retry_max_attempts": -1}}`, want: "youtube.retry_*"},
+		{name: "retry delays", file: `{"youtube": {"retry_base_delay_ms": 5000}}`, want: "youtube.retry_base_delay_ms"},
+		{name: "daily quota", file: `{"quota": {"daily_limit": 0}}`, want: "quota.daily_limit"},
+		{name: "negative soft limit", file: `{"quota": {"soft_limit_percent": -1}}`, want: "quota.soft_limit_percent"},
+		{name: "negative sample percent", file: `{"tracing": {"sample_percent": -5}}`, want: "tracing.sample_percent"},
+		{name: "unknown feature", args: []string{"-feature", "polls=true"}, want: "unknown feature"},
+		{name: "secrets dir", args: []string{"-secrets-provider", "file"}, want: "secrets.dir"},
+		{name: "positional argument", args: []string{"extra"}, want: "unexpected arguments"},
+		{name: "every error", file: `{"server": {"port": 0}, "logging": {"format": "xml"}}`, want: "logging.format"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args := c.args
+			if c.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, c.file)}, args...)
+			}
+
+			_, err := Load(args, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("got error %v, want one mentioning %s", err, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadDefersSecretSettings(t *testing.T) {
+	file := writeConfigFile(t, `{"digest": {"smtp_host": "smtp.example.com", "from": "feeds@example.com", "base_url": "https://feeds.example.com"}}`)
+
+	// the signing key is expected from the secret provider, so Load accepts it missing
+	cfg, err := Load([]string{"-config", file}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "digest.signing_key") {
+		t.Errorf("got error %v, want the missing signing key reported", err)
+	}
+
+	cfg.Digest.SigningKey = "signing-secret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error with the signing key applied: %v", err)
+	}
+}
+
+func TestDSN(t *testing.T) {
+	cases := []struct {
+		name string
+		db   DatabaseConfig
+		want string
+	}{
+		{
+			name: "local",
+			db:   DatabaseConfig{Host: "localhost", Port: 5432, User: "dev", Name: "feeds"},
+			want: "host=localhost port=5432 user=dev dbname=feeds sslmode=disable",
+		},
+		{
+			name: "remote",
+			db:   DatabaseConfig{Host: "db.example.com", Port: 6432, User: "app", Password: "it's secret", Name: "feeds"},
+			want: `host=db.example.com port=6432 user=app password='it\'s secret' dbname=feeds sslmode=require`,
+		},
+		{
+			name: "cloud sql",
+			db:   DatabaseConfig{Host: "localhost", Port: 5432, User: "app", Name: "feeds", CloudSQLInstance: "project:region:instance"},
+			want: "host=/cloudsql/project:region:instance user=app dbname=feeds sslmode=disable",
+		},
+		{
+			name: "url",
+			db:   DatabaseConfig{URL: "postgres://app@db:5432/feeds?sslmode=verify-full", Host: "ignored"},
+			want: "postgres://app@db:5432/feeds?sslmode=verify-full",
+		},
+	}
+
+	for _, c := range cases {
+		if got := c.db.DSN(); got != c.want {
+			t.Errorf("%s: got DSN %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Defaults()
+	cfg.Database.URL = "postgres://app:hunter2@db:5432/feeds"
+	cfg.Database.Password = "hunter2"
+	cfg.AdminToken = "admin-secret"
+	cfg.Digest.SigningKey = "signing-secret"
+
+	redacted := cfg.Redacted()
+	for _, secret := range []string{redacted.Database.Password, redacted.AdminToken, redacted.Digest.SigningKey} {
+		if secret != REDACTED {
+			t.Errorf("got %q, want it redacted", secret)
+		}
+	}
+	if strings.Contains(redacted.Database.URL, "hunter2") || !strings.Contains(redacted.Database.URL, "app:") {
+		t.Errorf("got URL %q, want only the password redacted", redacted.Database.URL)
+	}
+	if redacted.Digest.SMTPPassword != "" {
+		t.Errorf("got SMTP password %q, want unset secrets left empty", redacted.Digest.SMTPPassword)
+	}
+	if cfg.AdminToken != "admin-secret" {
+		t.Errorf("Redacted() modified the original config")
+	}
+
+	if got := redactDSN("host=db password='a b' dbname=feeds"); got != "host=db password="+REDACTED+" dbname=feeds" {
+		t.Errorf("got %q, want the key=value password redacted", got)
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Replaces secrets in printed configuration
+const REDACTED = "[redacted]"
+
+// Directory Cloud Run mounts Cloud SQL unix sockets under
+const CLOUD_SQL_SOCKET_DIR = "/cloudsql"
+
+// Matches the password of a key=value DSN, quoted or not
+var dsnPasswordRegex = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Returns the lib/pq connection string. Without an explicit SSL mode, the Cloud SQL socket and
+// loopback hosts connect without SSL and any other host requires it
+func (db DatabaseConfig) DSN() string {
+	if db.URL != "" {
+		return db.URL
+	}
+
+	host := db.Host
+	sslMode := db.SSLMode
+	if db.CloudSQLInstance != "" {
+		host = CLOUD_SQL_SOCKET_DIR + "/" + db.CloudSQLInstance
+	}
+	if sslMode == "" {
+		sslMode = "require"
+		if db.CloudSQLInstance != "" || isLoopback(db.Host) {
+			sslMode = "disable"
+		}
+	}
+
+	params := []string{"host=" + quoteDSN(host)}
+	if db.CloudSQLInstance == "" {
+		params = append(params, fmt.Sprintf("port=%d", db.Port))
+	}
+	if db.User != "" {
+		params = append(params, "user="+quoteDSN(db.User))
+	}
+	if db.Password != "" {
+		params = append(params, "password="+quoteDSN(db.Password))
+	}
+	if db.Name != "" {
+		params = append(params, "dbname="+quoteDSN(db.Name))
+	}
+	params = append(params, "sslmode="+sslMode)
+
+	return strings.Join(params, " ")
+}
+
+// Returns true if host is localhost or a loopback address
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Quotes a key=value DSN value if it is empty or contains spaces, quotes or backslashes
+func quoteDSN(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
+// Returns dsn with its password replaced, dsn may be a URL or key=value string
+func redactDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return REDACTED
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), REDACTED)
+		}
+		if u.Query().Has("password") {
+			query := u.Query()
+			query.Set("password", REDACTED)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+
+	return dsnPasswordRegex.ReplaceAllString(dsn, "${1}"+REDACTED)
+}
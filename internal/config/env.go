@@ -0,0 +1,371 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Overrides cfg with the settings present in the environment
+func readEnv(cfg *Config) error {
+	var err error
+
+	if cfg.Database, err = readDatabase(cfg.Database); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Server, err = readServer(cfg.Server); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Feeds, err = readFeeds(cfg.Feeds); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Features, err = readFeatures(cfg.Features); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.RateLimit, err = readRateLimit(cfg.RateLimit); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Quota, err = readQuota(cfg.Quota); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.YouTube, err = readYouTube(cfg.YouTube); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Channels, err = readChannels(cfg.Channels); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Recommend, err = readRecommend(cfg.Recommend); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Digest, err = readDigest(cfg.Digest); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	if cfg.Webhooks, err = readWebhooks(cfg.Webhooks); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+	cfg.Logging = readLogging(cfg.Logging)
+	if cfg.Tracing, err = readTracing(cfg.Tracing); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+
+	if cfg.Secrets, err = readSecrets(cfg.Secrets); err != nil {
+		return fmt.Errorf("in readEnv(): %s", err)
+	}
+
+	cfg.AdminToken = getEnvString("ADMIN_TOKEN", cfg.AdminToken)
+
+	return nil
+}
+
+// Reads the database connection settings from the environment
+func readDatabase(db DatabaseConfig) (DatabaseConfig, error) {
+	var err error
+
+	db.URL = getEnvString("DATABASE_URL", db.URL)
+	db.Host = getEnvString("DB_HOST", db.Host)
+	db.User = getEnvString("DB_USER", db.User)
+	db.Password = getEnvString("DB_PASS", db.Password)
+	db.Name = getEnvString("DB_NAME", db.Name)
+	db.SSLMode = strings.ToLower(getEnvString("DB_SSLMODE", db.SSLMode))
+	db.CloudSQLInstance = getEnvString("INSTANCE_CONNECTION_NAME", db.CloudSQLInstance)
+
+	if db.Port, err = getEnvInt("DB_PORT", db.Port); err != nil {
+		return db, err
+	}
+	if db.MaxOpenConns, err = getEnvInt("DB_MAX_OPEN_CONNS", db.MaxOpenConns); err != nil {
+		return db, err
+	}
+	if db.MaxIdleConns, err = getEnvInt("DB_MAX_IDLE_CONNS", db.MaxIdleConns); err != nil {
+		return db, err
+	}
+	if db.ConnMaxLifetimeMinutes, err = getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", db.ConnMaxLifetimeMinutes); err != nil {
+		return db, err
+	}
+	if db.AutoMigrate, err = getEnvBool("DB_AUTO_MIGRATE", db.AutoMigrate); err != nil {
+		return db, err
+	}
+
+	return db, nil
+}
+
+// Reads the HTTP server settings from the environment, PORT is set by Cloud Run
+func readServer(server ServerConfig) (ServerConfig, error) {
+	var err error
+
+	if server.Port, err = getEnvInt("PORT", server.Port); err != nil {
+		return server, err
+	}
+	if server.ReadHeaderTimeoutSeconds, err = getEnvInt("SERVER_READ_HEADER_TIMEOUT_SECONDS", server.ReadHeaderTimeoutSeconds); err != nil {
+		return server, err
+	}
+	if server.ReadTimeoutSeconds, err = getEnvInt("SERVER_READ_TIMEOUT_SECONDS", server.ReadTimeoutSeconds); err != nil {
+		return server, err
+	}
+	if server.WriteTimeoutSeconds, err = getEnvInt("SERVER_WRITE_TIMEOUT_SECONDS", server.WriteTimeoutSeconds); err != nil {
+		return server, err
+	}
+	if server.IdleTimeoutSeconds, err = getEnvInt("SERVER_IDLE_TIMEOUT_SECONDS", server.IdleTimeoutSeconds); err != nil {
+		return server, err
+	}
+	if server.ShutdownTimeoutSeconds, err = getEnvInt("SERVER_SHUTDOWN_TIMEOUT_SECONDS", server.ShutdownTimeoutSeconds); err != nil {
+		return server, err
+	}
+	if server.TrustedProxies, err = getEnvInt("SERVER_TRUSTED_PROXIES", server.TrustedProxies); err != nil {
+		return server, err
+	}
+
+	return server, nil
+}
+
+// Reads the feed video settings from the environment
+func readFeeds(feeds FeedsConfig) (FeedsConfig, error) {
+	var err error
+
+	if feeds.VideoLimit, err = getEnvInt("FEED_VIDEO_LIMIT", feeds.VideoLimit); err != nil {
+		return feeds, err
+	}
+	if feeds.ChannelCap, err = getEnvInt("FEED_CHANNEL_CAP", feeds.ChannelCap); err != nil {
+		return feeds, err
+	}
+	if feeds.CapWindowHours, err = getEnvInt("FEED_CAP_WINDOW_HOURS", feeds.CapWindowHours); err != nil {
+		return feeds, err
+	}
+
+	return feeds, nil
+}
+
+// Reads the feature toggles from the environment
+func readFeatures(features FeaturesConfig) (FeaturesConfig, error) {
+	var err error
+
+	if features.Recommendations, err = getEnvBool("FEATURE_RECOMMENDATIONS", features.Recommendations); err != nil {
+		return features, err
+	}
+	if features.Digests, err = getEnvBool("FEATURE_DIGESTS", features.Digests); err != nil {
+		return features, err
+	}
+	if features.Webhooks, err = getEnvBool("FEATURE_WEBHOOKS", features.Webhooks); err != nil {
+		return features, err
+	}
+	if features.Events, err = getEnvBool("FEATURE_EVENTS", features.Events); err != nil {
+		return features, err
+	}
+
+	return features, nil
+}
+
+// Reads the rate limit configuration from the environment
+func readRateLimit(rateLimit RateLimitConfig) (RateLimitConfig, error) {
+	var err error
+
+	if rateLimit.Enabled, err = getEnvBool("RATE_LIMIT_ENABLED", rateLimit.Enabled); err != nil {
+		return rateLimit, err
+	}
+	if rateLimit.PerMinute, err = getEnvInt("RATE_LIMIT_PER_MINUTE", rateLimit.PerMinute); err != nil {
+		return rateLimit, err
+	}
+	if rateLimit.Burst, err = getEnvInt("RATE_LIMIT_BURST", rateLimit.Burst); err != nil {
+		return rateLimit, err
+	}
+	if rateLimit.ExpensivePerMinute, err = getEnvInt("RATE_LIMIT_EXPENSIVE_PER_MINUTE", rateLimit.ExpensivePerMinute); err != nil {
+		return rateLimit, err
+	}
+	if rateLimit.ExpensiveBurst, err = getEnvInt("RATE_LIMIT_EXPENSIVE_BURST", rateLimit.ExpensiveBurst); err != nil {
+		return rateLimit, err
+	}
+
+	return rateLimit, nil
+}
+
+// Reads the YouTube quota budget from the environment
+func readQuota(quota QuotaConfig) (QuotaConfig, error) {
+	var err error
+
+	if quota.DailyLimit, err = getEnvInt("YOUTUBE_QUOTA_DAILY_LIMIT", quota.DailyLimit); err != nil {
+		return quota, err
+	}
+	if quota.SoftLimitPercent, err = getEnvInt("YOUTUBE_QUOTA_SOFT_LIMIT_PERCENT", quota.SoftLimitPercent); err != nil {
+		return quota, err
+	}
+	if quota.FlushIntervalSeconds, err = getEnvInt("YOUTUBE_QUOTA_FLUSH_SECONDS", quota.FlushIntervalSeconds); err != nil {
+		return quota, err
+	}
+
+	return quota, nil
+}
+
+// Reads the YouTube client settings from the environment
+func readYouTube(youtube YouTubeConfig) (YouTubeConfig, error) {
+	var err error
+
+	youtube.Endpoint = getEnvString("YOUTUBE_API_ENDPOINT", youtube.Endpoint)
+
+	if youtube.RetryMaxAttempts, err = getEnvInt("YOUTUBE_RETRY_MAX_ATTEMPTS", youtube.RetryMaxAttempts); err != nil {
+		return youtube, err
+	}
+	if youtube.RetryBaseDelayMs, err = getEnvInt("YOUTUBE_RETRY_BASE_DELAY_MS", youtube.RetryBaseDelayMs); err != nil {
+		return youtube, err
+	}
+	if youtube.RetryMaxDelayMs, err = getEnvInt("YOUTUBE_RETRY_MAX_DELAY_MS", youtube.RetryMaxDelayMs); err != nil {
+		return youtube, err
+	}
+	if youtube.BreakerThreshold, err = getEnvInt("YOUTUBE_BREAKER_THRESHOLD", youtube.BreakerThreshold); err != nil {
+		return youtube, err
+	}
+	if youtube.BreakerCooldownSeconds, err = getEnvInt("YOUTUBE_BREAKER_COOLDOWN_SECONDS", youtube.BreakerCooldownSeconds); err != nil {
+		return youtube, err
+	}
+
+	return youtube, nil
+}
+
+// Reads the channel metadata refresh settings from the environment
+func readChannels(channels ChannelsConfig) (ChannelsConfig, error) {
+	var err error
+
+	if channels.RefreshIntervalMinutes, err = getEnvInt("CHANNEL_REFRESH_INTERVAL_MINUTES", channels.RefreshIntervalMinutes); err != nil {
+		return channels, err
+	}
+	if channels.RefreshMaxAgeHours, err = getEnvInt("CHANNEL_REFRESH_MAX_AGE_HOURS", channels.RefreshMaxAgeHours); err != nil {
+		return channels, err
+	}
+
+	return channels, nil
+}
+
+// Reads the recommendation settings from the environment
+func readRecommend(recommend RecommendConfig) (RecommendConfig, error) {
+	var err error
+
+	if recommend.IntervalMinutes, err = getEnvInt("RECOMMEND_INTERVAL_MINUTES", recommend.IntervalMinutes); err != nil {
+		return recommend, err
+	}
+	if recommend.MinSupport, err = getEnvInt("RECOMMEND_MIN_SUPPORT", recommend.MinSupport); err != nil {
+		return recommend, err
+	}
+
+	return recommend, nil
+}
+
+// Reads the email digest settings from the environment
+func readDigest(digest DigestConfig) (DigestConfig, error) {
+	var err error
+
+	digest.SMTPHost = getEnvString("SMTP_HOST", digest.SMTPHost)
+	digest.SMTPUsername = getEnvString("SMTP_USERNAME", digest.SMTPUsername)
+	digest.SMTPPassword = getEnvString("SMTP_PASSWORD", digest.SMTPPassword)
+	digest.From = getEnvString("DIGEST_FROM", digest.From)
+	digest.SigningKey = getEnvString("DIGEST_SIGNING_KEY", digest.SigningKey)
+	digest.BaseURL = getEnvString("PUBLIC_BASE_URL", digest.BaseURL)
+
+	if digest.SMTPPort, err = getEnvInt("SMTP_PORT", digest.SMTPPort); err != nil {
+		return digest, err
+	}
+	if digest.SMTPTimeoutSeconds, err = getEnvInt("SMTP_TIMEOUT_SECONDS", digest.SMTPTimeoutSeconds); err != nil {
+		return digest, err
+	}
+	if digest.CheckIntervalSeconds, err = getEnvInt("DIGEST_CHECK_INTERVAL_SECONDS", digest.CheckIntervalSeconds); err != nil {
+		return digest, err
+	}
+
+	return digest, nil
+}
+
+// Reads the webhook delivery settings from the environment
+func readWebhooks(webhooks WebhooksConfig) (WebhooksConfig, error) {
+	var err error
+
+	if webhooks.DeliveryIntervalSeconds, err = getEnvInt("WEBHOOK_DELIVERY_INTERVAL_SECONDS", webhooks.DeliveryIntervalSeconds); err != nil {
+		return webhooks, err
+	}
+	if webhooks.TimeoutSeconds, err = getEnvInt("WEBHOOK_TIMEOUT_SECONDS", webhooks.TimeoutSeconds); err != nil {
+		return webhooks, err
+	}
+	if webhooks.MaxAttempts, err = getEnvInt("WEBHOOK_MAX_ATTEMPTS", webhooks.MaxAttempts); err != nil {
+		return webhooks, err
+	}
+	if webhooks.PollIntervalMinutes, err = getEnvInt("WEBHOOK_POLL_INTERVAL_MINUTES", webhooks.PollIntervalMinutes); err != nil {
+		return webhooks, err
+	}
+
+	return webhooks, nil
+}
+
+// Reads the log output settings from the environment
+func readLogging(logging LoggingConfig) LoggingConfig {
+	logging.Format = strings.ToLower(getEnvString("LOG_FORMAT", logging.Format))
+	logging.Level = strings.ToLower(getEnvString("LOG_LEVEL", logging.Level))
+
+	return logging
+}
+
+// Reads the trace export settings from the environment, using the standard OTEL_* names
+func readTracing(tracing TracingConfig) (TracingConfig, error) {
+	var err error
+
+	tracing.Exporter = strings.ToLower(getEnvString("OTEL_TRACES_EXPORTER", tracing.Exporter))
+	tracing.Endpoint = getEnvString("OTEL_EXPORTER_OTLP_ENDPOINT", tracing.Endpoint)
+	tracing.ServiceName = getEnvString("OTEL_SERVICE_NAME", tracing.ServiceName)
+
+	if tracing.SamplePercent, err = getEnvInt("TRACE_SAMPLE_PERCENT", tracing.SamplePercent); err != nil {
+		return tracing, err
+	}
+
+	return tracing, nil
+}
+
+// Reads the secret provider settings from the environment
+func readSecrets(secrets SecretsConfig) (SecretsConfig, error) {
+	var err error
+
+	secrets.Provider = strings.ToLower(getEnvString("SECRETS_PROVIDER", secrets.Provider))
+	secrets.Dir = getEnvString("SECRETS_DIR", secrets.Dir)
+	secrets.Project = getEnvString("SECRETS_PROJECT", secrets.Project)
+
+	if secrets.ReloadSeconds, err = getEnvInt("SECRETS_RELOAD_SECONDS", secrets.ReloadSeconds); err != nil {
+		return secrets, err
+	}
+
+	return secrets, nil
+}
+
+// Returns the environment variable, or fallback if it is not set
+func getEnvString(name string, fallback string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// Returns the environment variable as an int, or fallback if it is not set
+func getEnvInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("in getEnvInt(): invalid value for %s<%s>", name, value)
+	}
+
+	return i, nil
+}
+
+// Returns the environment variable as a bool, or fallback if it is not set
+func getEnvBool(name string, fallback bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("in getEnvBool(): invalid value for %s<%s>", name, value)
+	}
+
+	return b, nil
+}
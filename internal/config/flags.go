@@ -0,0 +1,74 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Returns the command line flags, each bound to its setting in cfg with the setting's current
+// value as the default so flags that are not given leave it unchanged
+func newFlagSet(cfg *Config, configPath *string, output io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("youtube-custom-feeds", flag.ContinueOnError)
+	flags.SetOutput(output)
+
+	flags.StringVar(configPath, "config", *configPath, "JSON config `file`, overridden by environment variables and flags (env CONFIG_FILE)")
+
+	flags.StringVar(&cfg.Database.URL, "db-url", cfg.Database.URL, "postgres URL or key=value DSN, replaces the other db flags (env DATABASE_URL)")
+	flags.StringVar(&cfg.Database.Host, "db-host", cfg.Database.Host, "database host (env DB_HOST)")
+	flags.IntVar(&cfg.Database.Port, "db-port", cfg.Database.Port, "database port (env DB_PORT)")
+	flags.StringVar(&cfg.Database.User, "db-user", cfg.Database.User, "database user (env DB_USER)")
+	flags.StringVar(&cfg.Database.Name, "db-name", cfg.Database.Name, "database name (env DB_NAME)")
+	flags.StringVar(&cfg.Database.SSLMode, "db-sslmode", cfg.Database.SSLMode, "disable, require, verify-ca or verify-full (env DB_SSLMODE)")
+	flags.IntVar(&cfg.Database.MaxOpenConns, "db-max-open-conns", cfg.Database.MaxOpenConns, "connection pool size (env DB_MAX_OPEN_CONNS)")
+	flags.IntVar(&cfg.Database.MaxIdleConns, "db-max-idle-conns", cfg.Database.MaxIdleConns, "idle connections kept open (env DB_MAX_IDLE_CONNS)")
+	flags.BoolVar(&cfg.Database.AutoMigrate, "db-auto-migrate", cfg.Database.AutoMigrate, "apply pending schema migrations at startup (env DB_AUTO_MIGRATE)")
+
+	flags.IntVar(&cfg.Server.Port, "port", cfg.Server.Port, "port the server listens on (env PORT)")
+	flags.IntVar(&cfg.Feeds.VideoLimit, "video-limit", cfg.Feeds.VideoLimit, "videos returned per feed (env FEED_VIDEO_LIMIT)")
+	flags.StringVar(&cfg.YouTube.Endpoint, "youtube-endpoint", cfg.YouTube.Endpoint, "YouTube API base URL override (env YOUTUBE_API_ENDPOINT)")
+	flags.BoolVar(&cfg.RateLimit.Enabled, "rate-limit", cfg.RateLimit.Enabled, "enable rate limiting (env RATE_LIMIT_ENABLED)")
+
+	flags.StringVar(&cfg.Logging.Format, "log-format", cfg.Logging.Format, "json or text (env LOG_FORMAT)")
+	flags.StringVar(&cfg.Logging.Level, "log-level", cfg.Logging.Level, "debug, info, warn or error (env LOG_LEVEL)")
+	flags.StringVar(&cfg.Tracing.Exporter, "trace-exporter", cfg.Tracing.Exporter, "none, otlp or stdout (env OTEL_TRACES_EXPORTER)")
+
+	flags.StringVar(&cfg.Secrets.Provider, "secrets-provider", cfg.Secrets.Provider, "env, file or gcp (env SECRETS_PROVIDER)")
+	flags.StringVar(&cfg.Secrets.Dir, "secrets-dir", cfg.Secrets.Dir, "directory holding one file per secret for the file provider (env SECRETS_DIR)")
+	flags.StringVar(&cfg.Secrets.Project, "secrets-project", cfg.Secrets.Project, "Google Cloud project for the gcp provider (env SECRETS_PROJECT)")
+
+	flags.Func("feature", "`name=bool` toggles recommendations, digests, webhooks or events, may be repeated (env FEATURE_<NAME>)", func(value string) error {
+		return setFeature(&cfg.Features, value)
+	})
+
+	return flags
+}
+
+// Applies a name=bool feature toggle
+func setFeature(features *FeaturesConfig, toggle string) error {
+	name, value, ok := strings.Cut(toggle, "=")
+	if !ok {
+		return fmt.Errorf("in setFeature(): expected name=bool, got %s", toggle)
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("in setFeature(): invalid value for %s<%s>", name, value)
+	}
+
+	switch strings.ToLower(name) {
+	case "recommendations":
+		features.Recommendations = enabled
+	case "digests":
+		features.Digests = enabled
+	case "webhooks":
+		features.Webhooks = enabled
+	case "events":
+		features.Events = enabled
+	default:
+		return fmt.Errorf("in setFeature(): unknown feature<%s>", name)
+	}
+
+	return nil
+}
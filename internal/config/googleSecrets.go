@@ -1,40 +1,58 @@
 package config
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
-)
 
-const ConfigSecretName = "projects/865842770127/secrets/youtube-custom-feeds-config/versions/latest"
-const ClientIdSecretName = "projects/865842770127/secrets/youtube-custom-feeds-client-id-json/versions/latest"
-const ApiKeySecretName = "projects/865842770127/secrets/youtube-custom-feeds-api-key/versions/latest"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+)
 
-/*
-// Used to retireve secrets from google secret manager
-func GetSecret(secretName string) (string, error) {
-	ctx := context.Background()
+// Reads the latest version of each secret from Google Secret Manager in Project, using the
+// application default credentials
+type GoogleSecrets struct {
+	Project string
+	service *secretmanager.Service
+}
 
-	client, err := secretmanager.NewClient(ctx)
+// Returns a Secret Manager provider for project, opts override the client defaults
+func NewGoogleSecrets(ctx context.Context, project string, opts ...option.ClientOption) (*GoogleSecrets, error) {
+	service, err := secretmanager.NewService(ctx, opts...)
 	if err != nil {
-		return "", fmt.Errorf("in GetSecret(): error creating secretmanager client: %v", err)
+		return nil, fmt.Errorf("in NewGoogleSecrets(): error creating secretmanager service: %s", err)
 	}
-	defer client.Close()
 
-	accessRequest := &secretmanagerpb.AccessSecretVersionRequest{
-		Name: secretName,
-	}
+	return &GoogleSecrets{Project: project, service: service}, nil
+}
 
-	result, err := client.AccessSecretVersion(ctx, accessRequest)
+func (g *GoogleSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	resource := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", g.Project, name)
+
+	result, err := g.service.Projects.Secrets.Versions.Access(resource).Context(ctx).Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return "", ErrSecretNotFound
+	}
 	if err != nil {
-		return "", fmt.Errorf("in GetSecret(): error accessing secret version: %v", err)
+		return "", fmt.Errorf("in GetSecret(): error accessing secret version %s: %s", resource, err)
+	}
+	if result.Payload == nil {
+		return "", ErrSecretNotFound
 	}
 
-	secretData := string(result.Payload.Data)
+	data, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("in GetSecret(): error decoding secret %s: %s", resource, err)
+	}
 
-	return secretData, nil
+	return string(data), nil
 }
-*/
 
 func GetClientId() (string, error) {
 
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Names of the secrets read through a SecretProvider
+const (
+	SecretYouTubeAPIKey    = "youtube-api-key"
+	SecretDBPassword       = "db-password"
+	SecretAdminToken       = "admin-token"
+	SecretSMTPPassword     = "smtp-password"
+	SecretDigestSigningKey = "digest-signing-key"
+)
+
+// Secret providers selectable with SECRETS_PROVIDER
+const (
+	ProviderEnv    = "env"
+	ProviderFile   = "file"
+	ProviderGoogle = "gcp"
+)
+
+// Returned by providers that do not hold the requested secret
+var ErrSecretNotFound = errors.New("secret not found")
+
+// Retrieves secrets by name
+type SecretProvider interface {
+	// Returns the current value of the secret, ErrSecretNotFound if the provider has none
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Environment variables holding each secret for EnvSecrets, kept from before secrets were
+// pluggable
+var secretEnvVars = map[string]string{
+	SecretYouTubeAPIKey:    "YOUTUBE_CUSTOM_FEEDS_YT_API_KEY",
+	SecretDBPassword:       "DB_PASS",
+	SecretAdminToken:       "ADMIN_TOKEN",
+	SecretSMTPPassword:     "SMTP_PASSWORD",
+	SecretDigestSigningKey: "DIGEST_SIGNING_KEY",
+}
+
+// Reads secrets from environment variables, names without a known variable are looked up
+// upper-cased with dashes replaced by underscores
+type EnvSecrets struct{}
+
+func (EnvSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	envVar, ok := secretEnvVars[name]
+	if !ok {
+		envVar = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	}
+
+	value := os.Getenv(envVar)
+	if value == "" {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// Reads each secret from the file of the same name in Dir, such as a mounted secrets volume.
+// Files are read on every call so rotated secrets are picked up
+type FileSecrets struct {
+	Dir string
+}
+
+func (f FileSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("in GetSecret(): invalid secret name<%s>", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("in GetSecret(): error reading secret %s: %s", name, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Returns the provider described by cfg
+func NewSecretProvider(ctx context.Context, cfg SecretsConfig) (SecretProvider, error) {
+	switch cfg.Provider {
+	case ProviderEnv, "":
+		return EnvSecrets{}, nil
+	case ProviderFile:
+		return FileSecrets{Dir: cfg.Dir}, nil
+	case ProviderGoogle:
+		provider, err := NewGoogleSecrets(ctx, cfg.Project)
+		if err != nil {
+			return nil, fmt.Errorf("in NewSecretProvider(): %s", err)
+		}
+		return provider, nil
+	default:
+		return nil, fmt.Errorf("in NewSecretProvider(): unknown provider<%s>", cfg.Provider)
+	}
+}
+
+// Overrides the secrets in cfg with those held by provider, secrets it does not have keep
+// their configured values
+func ApplySecrets(ctx context.Context, cfg *Config, provider SecretProvider) error {
+	targets := map[string]*string{
+		SecretDBPassword:       &cfg.Database.Password,
+		SecretAdminToken:       &cfg.AdminToken,
+		SecretSMTPPassword:     &cfg.Digest.SMTPPassword,
+		SecretDigestSigningKey: &cfg.Digest.SigningKey,
+	}
+
+	for name, target := range targets {
+		value, err := provider.GetSecret(ctx, name)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("in ApplySecrets(): error retrieving %s: %s", name, err)
+		}
+		*target = value
+	}
+
+	return nil
+}
+
+// Reads the secret every interval until ctx is cancelled, calling onChange with its value the
+// first time it is read and whenever it changes. Failed reads keep the last value
+func WatchSecret(ctx context.Context, provider SecretProvider, name string, interval time.Duration, onChange func(value string), onError func(err error)) {
+	var current string
+	var seen bool
+
+	check := func() {
+		value, err := provider.GetSecret(ctx, name)
+		if err != nil {
+			if ctx.Err() == nil {
+				onError(fmt.Errorf("in WatchSecret(): error retrieving %s: %w", name, err))
+			}
+			return
+		}
+		if !seen || value != current {
+			current, seen = value, true
+			onChange(value)
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+// Holds secrets in memory, they can be changed while it is in use to simulate rotation
+type fakeSecrets struct {
+	mu      sync.Mutex
+	secrets map[string]string
+	err     error
+}
+
+func (f *fakeSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return "", f.err
+	}
+	value, ok := f.secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (f *fakeSecrets) set(name string, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.secrets[name] = value
+}
+
+func TestApplySecrets(t *testing.T) {
+	cfg := Defaults()
+	cfg.Database.Password = "from-config"
+	cfg.Digest.SMTPPassword = "smtp-from-config"
+
+	provider := &fakeSecrets{secrets: map[string]string{
+		SecretDBPassword:       "rotated",
+		SecretAdminToken:       "admin-secret",
+		SecretDigestSigningKey: "signing-secret",
+	}}
+
+	err := ApplySecrets(context.Background(), &cfg, provider)
+	if err != nil {
+		t.Fatalf("ApplySecrets() error: %v", err)
+	}
+
+	if cfg.Database.Password != "rotated" || cfg.AdminToken != "admin-secret" || cfg.Digest.SigningKey != "signing-secret" {
+		t.Errorf("got %+v, want the provider's secrets applied", cfg.Redacted())
+	}
+	if cfg.Digest.SMTPPassword != "smtp-from-config" {
+		t.Errorf("got SMTP password %q, want the configured value kept", cfg.Digest.SMTPPassword)
+	}
+
+	provider.err = errors.New("permission denied")
+	err = ApplySecrets(context.Background(), &cfg, provider)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("got error %v, want the provider's error", err)
+	}
+}
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("DB_PASS", "hunter2")
+	t.Setenv("CUSTOM_SECRET", "custom")
+
+	cases := map[string]string{
+		SecretDBPassword: "hunter2",
+		"custom-secret":  "custom",
+	}
+	for name, want := range cases {
+		got, err := EnvSecrets{}.GetSecret(context.Background(), name)
+		if err != nil || got != want {
+			t.Errorf("%s: got %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	_, err := EnvSecrets{}.GetSecret(context.Background(), SecretSMTPPassword)
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("got error %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, SecretYouTubeAPIKey), []byte("yt-key\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := FileSecrets{Dir: dir}
+
+	got, err := provider.GetSecret(context.Background(), SecretYouTubeAPIKey)
+	if err != nil || got != "yt-key" {
+		t.Errorf("got %q, %v, want the file's contents without the trailing newline", got, err)
+	}
+
+	_, err = provider.GetSecret(context.Background(), SecretAdminToken)
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("got error %v for a missing file, want ErrSecretNotFound", err)
+	}
+
+	_, err = provider.GetSecret(context.Background(), "../"+SecretYouTubeAPIKey)
+	if err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("got error %v for a path outside the directory, want it rejected", err)
+	}
+}
+
+func TestGoogleSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/projects/feeds/secrets/youtube-api-key/versions/latest:access":
+			data := base64.StdEncoding.EncodeToString([]byte("yt-key"))
+			w.Write([]byte(`{"name": "projects/feeds/secrets/youtube-api-key/versions/3", "payload": {"data": "` + data + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "secret not found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	provider, err := NewGoogleSecrets(context.Background(), "feeds", option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := provider.GetSecret(context.Background(), SecretYouTubeAPIKey)
+	if err != nil || got != "yt-key" {
+		t.Errorf("got %q, %v, want the decoded payload", got, err)
+	}
+
+	_, err = provider.GetSecret(context.Background(), SecretAdminToken)
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("got error %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestWatchSecretRotation(t *testing.T) {
+	provider := &fakeSecrets{secrets: map[string]string{SecretYouTubeAPIKey: "old-key"}}
+	changes := make(chan string, 10)
+	errs := make(chan error, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchSecret(ctx, provider, SecretYouTubeAPIKey, 10*time.Millisecond,
+			func(value string) { changes <- value },
+			func(err error) { errs <- err })
+		close(done)
+	}()
+
+	receive := func() string {
+		select {
+		case value := <-changes:
+			return value
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the secret")
+			return ""
+		}
+	}
+
+	if got := receive(); got != "old-key" {
+		t.Errorf("got %q, want the initial value", got)
+	}
+
+	provider.mu.Lock()
+	provider.err = errors.New("unavailable")
+	provider.mu.Unlock()
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the read error")
+	}
+
+	provider.mu.Lock()
+	provider.err = nil
+	provider.mu.Unlock()
+	provider.set(SecretYouTubeAPIKey, "new-key")
+	if got := receive(); got != "new-key" {
+		t.Errorf("got %q, want the rotated value", got)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("WatchSecret() did not return once ctx was cancelled")
+	}
+	if len(changes) != 0 {
+		t.Errorf("got %d extra changes, want onChange only called when the value changes", len(changes))
+	}
+}
@@ -0,0 +1,74 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: channel_handles.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const getChannelHandleHistory = `-- name: GetChannelHandleHistory :many
+SELECT handle, first_seen_at, last_seen_at FROM channel_handles
+WHERE channel_id = $1
+ORDER BY last_seen_at DESC
+`
+
+type GetChannelHandleHistoryRow struct {
+	Handle      string
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+func (q *Queries) GetChannelHandleHistory(ctx context.Context, channelID string) ([]GetChannelHandleHistoryRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChannelHandleHistory, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChannelHandleHistoryRow
+	for rows.Next() {
+		var i GetChannelHandleHistoryRow
+		if err := rows.Scan(&i.Handle, &i.FirstSeenAt, &i.LastSeenAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertChannelHandle = `-- name: UpsertChannelHandle :exec
+INSERT INTO channel_handles (handle, channel_id, first_seen_at, last_seen_at)
+VALUES (
+    lower($1),
+    $2,
+    $3,
+    $3
+)
+ON CONFLICT (handle) DO UPDATE
+SET channel_id = EXCLUDED.channel_id,
+    first_seen_at = CASE
+        WHEN channel_handles.channel_id = EXCLUDED.channel_id THEN channel_handles.first_seen_at
+        ELSE EXCLUDED.first_seen_at
+    END,
+    last_seen_at = EXCLUDED.last_seen_at
+`
+
+type UpsertChannelHandleParams struct {
+	Handle      string
+	ChannelID   string
+	FirstSeenAt time.Time
+}
+
+func (q *Queries) UpsertChannelHandle(ctx context.Context, arg UpsertChannelHandleParams) error {
+	_, err := q.db.ExecContext(ctx, upsertChannelHandle, arg.Handle, arg.ChannelID, arg.FirstSeenAt)
+	return err
+}
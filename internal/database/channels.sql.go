@@ -7,17 +7,18 @@ package database
 
 import (
 	"context"
+	"database/sql"
 )
 
 const containsChannelInDB = `-- name: ContainsChannelInDB :one
 SELECT EXISTS (
-    SELECT 1 FROM channels
-    WHERE channel_handle = $1
+    SELECT 1 FROM channel_handles
+    WHERE handle = lower($1)
 )
 `
 
-func (q *Queries) ContainsChannelInDB(ctx context.Context, channelHandle string) (bool, error) {
-	row := q.db.QueryRowContext(ctx, containsChannelInDB, channelHandle)
+func (q *Queries) ContainsChannelInDB(ctx context.Context, handle string) (bool, error) {
+	row := q.db.QueryRowContext(ctx, containsChannelInDB, handle)
 	var exists bool
 	err := row.Scan(&exists)
 	return exists, err
@@ -63,20 +64,21 @@ func (q *Queries) GetChannelHandleUploadId(ctx context.Context, channelID string
 }
 
 const getChannelIdByHandle = `-- name: GetChannelIdByHandle :one
-SELECT channel_id FROM channels
-WHERE channel_handle = $1
+SELECT channel_id FROM channel_handles
+WHERE handle = lower($1)
 `
 
-func (q *Queries) GetChannelIdByHandle(ctx context.Context, channelHandle string) (string, error) {
-	row := q.db.QueryRowContext(ctx, getChannelIdByHandle, channelHandle)
+func (q *Queries) GetChannelIdByHandle(ctx context.Context, handle string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getChannelIdByHandle, handle)
 	var channel_id string
 	err := row.Scan(&channel_id)
 	return channel_id, err
 }
 
 const getChannelIdUploadIdByHandle = `-- name: GetChannelIdUploadIdByHandle :one
-SELECT channel_id, channel_upload_id FROM channels
-WHERE channel_handle = $1
+SELECT channels.channel_id, channels.channel_upload_id FROM channel_handles
+INNER JOIN channels ON channels.channel_id = channel_handles.channel_id
+WHERE channel_handles.handle = lower($1)
 `
 
 type GetChannelIdUploadIdByHandleRow struct {
@@ -84,13 +86,85 @@ type GetChannelIdUploadIdByHandleRow struct {
 	ChannelUploadID string
 }
 
-func (q *Queries) GetChannelIdUploadIdByHandle(ctx context.Context, channelHandle string) (GetChannelIdUploadIdByHandleRow, error) {
-	row := q.db.QueryRowContext(ctx, getChannelIdUploadIdByHandle, channelHandle)
+func (q *Queries) GetChannelIdUploadIdByHandle(ctx context.Context, handle string) (GetChannelIdUploadIdByHandleRow, error) {
+	row := q.db.QueryRowContext(ctx, getChannelIdUploadIdByHandle, handle)
 	var i GetChannelIdUploadIdByHandleRow
 	err := row.Scan(&i.ChannelID, &i.ChannelUploadID)
 	return i, err
 }
 
+const getChannelsToRefresh = `-- name: GetChannelsToRefresh :many
+SELECT channel_id FROM channels
+WHERE status = 'active' AND (metadata_updated_at IS NULL OR metadata_updated_at < $1)
+ORDER BY metadata_updated_at NULLS FIRST
+LIMIT $2
+`
+
+type GetChannelsToRefreshParams struct {
+	MetadataUpdatedAt sql.NullTime
+	Limit             int32
+}
+
+func (q *Queries) GetChannelsToRefresh(ctx context.Context, arg GetChannelsToRefreshParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getChannelsToRefresh, arg.MetadataUpdatedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var channel_id string
+		if err := rows.Scan(&channel_id); err != nil {
+			return nil, err
+		}
+		items = append(items, channel_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrphanedChannels = `-- name: GetOrphanedChannels :many
+SELECT channel_id, channel_handle FROM channels
+WHERE NOT EXISTS (
+    SELECT 1 FROM feeds_channels
+    WHERE feeds_channels.channel_id = channels.channel_id
+)
+ORDER BY channel_id
+`
+
+type GetOrphanedChannelsRow struct {
+	ChannelID     string
+	ChannelHandle string
+}
+
+func (q *Queries) GetOrphanedChannels(ctx context.Context) ([]GetOrphanedChannelsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getOrphanedChannels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrphanedChannelsRow
+	for rows.Next() {
+		var i GetOrphanedChannelsRow
+		if err := rows.Scan(&i.ChannelID, &i.ChannelHandle); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUploadId = `-- name: GetUploadId :one
 SELECT channel_upload_id FROM channels
 WHERE channel_id = $1
@@ -111,7 +185,7 @@ VALUES(
     $3,
     $4
 )
-RETURNING channel_id, channel_upload_id, channel_handle, channel_url
+RETURNING channel_id, channel_upload_id, channel_handle, channel_url, title, description, avatar_default_url, avatar_medium_url, avatar_high_url, subscriber_count, video_count, metadata_updated_at, status, status_reason, status_changed_at
 `
 
 type InsertChannelParams struct {
@@ -134,6 +208,142 @@ func (q *Queries) InsertChannel(ctx context.Context, arg InsertChannelParams) (C
 		&i.ChannelUploadID,
 		&i.ChannelHandle,
 		&i.ChannelUrl,
+		&i.Title,
+		&i.Description,
+		&i.AvatarDefaultUrl,
+		&i.AvatarMediumUrl,
+		&i.AvatarHighUrl,
+		&i.SubscriberCount,
+		&i.VideoCount,
+		&i.MetadataUpdatedAt,
+		&i.Status,
+		&i.StatusReason,
+		&i.StatusChangedAt,
 	)
 	return i, err
 }
+
+const markChannelActive = `-- name: MarkChannelActive :exec
+UPDATE channels
+SET status = 'active',
+    status_reason = '',
+    status_changed_at = $2
+WHERE channel_id = $1 AND status = 'dead'
+`
+
+type MarkChannelActiveParams struct {
+	ChannelID       string
+	StatusChangedAt sql.NullTime
+}
+
+func (q *Queries) MarkChannelActive(ctx context.Context, arg MarkChannelActiveParams) error {
+	_, err := q.db.ExecContext(ctx, markChannelActive, arg.ChannelID, arg.StatusChangedAt)
+	return err
+}
+
+const markChannelDead = `-- name: MarkChannelDead :exec
+UPDATE channels
+SET status = 'dead',
+    status_reason = $2,
+    status_changed_at = $3
+WHERE channel_id = $1 AND status = 'active'
+`
+
+type MarkChannelDeadParams struct {
+	ChannelID       string
+	StatusReason    string
+	StatusChangedAt sql.NullTime
+}
+
+func (q *Queries) MarkChannelDead(ctx context.Context, arg MarkChannelDeadParams) error {
+	_, err := q.db.ExecContext(ctx, markChannelDead, arg.ChannelID, arg.StatusReason, arg.StatusChangedAt)
+	return err
+}
+
+const purgeOrphanedChannels = `-- name: PurgeOrphanedChannels :many
+DELETE FROM channels
+WHERE NOT EXISTS (
+    SELECT 1 FROM feeds_channels
+    WHERE feeds_channels.channel_id = channels.channel_id
+)
+RETURNING channel_id
+`
+
+func (q *Queries) PurgeOrphanedChannels(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, purgeOrphanedChannels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var channel_id string
+		if err := rows.Scan(&channel_id); err != nil {
+			return nil, err
+		}
+		items = append(items, channel_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChannelHandle = `-- name: UpdateChannelHandle :exec
+UPDATE channels
+SET channel_handle = $2
+WHERE channel_id = $1
+`
+
+type UpdateChannelHandleParams struct {
+	ChannelID     string
+	ChannelHandle string
+}
+
+func (q *Queries) UpdateChannelHandle(ctx context.Context, arg UpdateChannelHandleParams) error {
+	_, err := q.db.ExecContext(ctx, updateChannelHandle, arg.ChannelID, arg.ChannelHandle)
+	return err
+}
+
+const updateChannelMetadata = `-- name: UpdateChannelMetadata :exec
+UPDATE channels
+SET title = $2,
+    description = $3,
+    avatar_default_url = $4,
+    avatar_medium_url = $5,
+    avatar_high_url = $6,
+    subscriber_count = $7,
+    video_count = $8,
+    metadata_updated_at = $9
+WHERE channel_id = $1
+`
+
+type UpdateChannelMetadataParams struct {
+	ChannelID         string
+	Title             string
+	Description       string
+	AvatarDefaultUrl  string
+	AvatarMediumUrl   string
+	AvatarHighUrl     string
+	SubscriberCount   int64
+	VideoCount        int64
+	MetadataUpdatedAt sql.NullTime
+}
+
+func (q *Queries) UpdateChannelMetadata(ctx context.Context, arg UpdateChannelMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, updateChannelMetadata,
+		arg.ChannelID,
+		arg.Title,
+		arg.Description,
+		arg.AvatarDefaultUrl,
+		arg.AvatarMediumUrl,
+		arg.AvatarHighUrl,
+		arg.SubscriberCount,
+		arg.VideoCount,
+		arg.MetadataUpdatedAt,
+	)
+	return err
+}
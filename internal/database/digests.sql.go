@@ -0,0 +1,258 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: digests.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const claimDueDigestSubscriptions = `-- name: ClaimDueDigestSubscriptions :many
+WITH claimed AS (
+    UPDATE digest_subscriptions
+    SET next_send_at = $1
+    WHERE digest_subscriptions.id IN (
+        SELECT due.id FROM digest_subscriptions due
+        WHERE due.next_send_at <= $2
+        ORDER BY due.next_send_at
+        LIMIT $3
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING digest_subscriptions.id, digest_subscriptions.feed_id, digest_subscriptions.email, digest_subscriptions.frequency, digest_subscriptions.send_hour, digest_subscriptions.send_weekday, digest_subscriptions.timezone, digest_subscriptions.next_send_at, digest_subscriptions.last_sent_at, digest_subscriptions.created_at, digest_subscriptions.failed_attempts, digest_subscriptions.last_error
+)
+SELECT claimed.id, claimed.feed_id, claimed.email, claimed.frequency, claimed.send_hour, claimed.send_weekday, claimed.timezone, claimed.next_send_at, claimed.last_sent_at, claimed.created_at, claimed.failed_attempts, claimed.last_error, feeds.name AS feed_name
+FROM claimed
+INNER JOIN feeds ON feeds.id = claimed.feed_id
+`
+
+type ClaimDueDigestSubscriptionsParams struct {
+	LeaseUntil time.Time
+	Now        time.Time
+	BatchLimit int32
+}
+
+type ClaimDueDigestSubscriptionsRow struct {
+	ID             int32
+	FeedID         int32
+	Email          string
+	Frequency      string
+	SendHour       int32
+	SendWeekday    int32
+	Timezone       string
+	NextSendAt     time.Time
+	LastSentAt     sql.NullTime
+	CreatedAt      time.Time
+	FailedAttempts int32
+	LastError      string
+	FeedName       string
+}
+
+// Leases due digests until lease_until so concurrent workers skip them
+func (q *Queries) ClaimDueDigestSubscriptions(ctx context.Context, arg ClaimDueDigestSubscriptionsParams) ([]ClaimDueDigestSubscriptionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueDigestSubscriptions, arg.LeaseUntil, arg.Now, arg.BatchLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimDueDigestSubscriptionsRow
+	for rows.Next() {
+		var i ClaimDueDigestSubscriptionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.Email,
+			&i.Frequency,
+			&i.SendHour,
+			&i.SendWeekday,
+			&i.Timezone,
+			&i.NextSendAt,
+			&i.LastSentAt,
+			&i.CreatedAt,
+			&i.FailedAttempts,
+			&i.LastError,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteDigestSubscription = `-- name: DeleteDigestSubscription :execrows
+DELETE FROM digest_subscriptions
+WHERE id = $1
+`
+
+func (q *Queries) DeleteDigestSubscription(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDigestSubscription, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteFeedDigestSubscription = `-- name: DeleteFeedDigestSubscription :execrows
+DELETE FROM digest_subscriptions
+WHERE id = $1 AND feed_id = $2
+`
+
+type DeleteFeedDigestSubscriptionParams struct {
+	ID     int32
+	FeedID int32
+}
+
+func (q *Queries) DeleteFeedDigestSubscription(ctx context.Context, arg DeleteFeedDigestSubscriptionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeedDigestSubscription, arg.ID, arg.FeedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFeedDigestSubscriptions = `-- name: GetFeedDigestSubscriptions :many
+SELECT id, feed_id, email, frequency, send_hour, send_weekday, timezone, next_send_at, last_sent_at, created_at, failed_attempts, last_error FROM digest_subscriptions
+WHERE feed_id = $1
+ORDER BY id
+`
+
+func (q *Queries) GetFeedDigestSubscriptions(ctx context.Context, feedID int32) ([]DigestSubscription, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedDigestSubscriptions, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DigestSubscription
+	for rows.Next() {
+		var i DigestSubscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.Email,
+			&i.Frequency,
+			&i.SendHour,
+			&i.SendWeekday,
+			&i.Timezone,
+			&i.NextSendAt,
+			&i.LastSentAt,
+			&i.CreatedAt,
+			&i.FailedAttempts,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markDigestFailed = `-- name: MarkDigestFailed :exec
+UPDATE digest_subscriptions
+SET failed_attempts = failed_attempts + 1, last_error = $2, next_send_at = $3
+WHERE id = $1
+`
+
+type MarkDigestFailedParams struct {
+	ID         int32
+	LastError  string
+	NextSendAt time.Time
+}
+
+func (q *Queries) MarkDigestFailed(ctx context.Context, arg MarkDigestFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markDigestFailed, arg.ID, arg.LastError, arg.NextSendAt)
+	return err
+}
+
+const markDigestSent = `-- name: MarkDigestSent :exec
+UPDATE digest_subscriptions
+SET last_sent_at = $2, next_send_at = $3, failed_attempts = 0, last_error = ''
+WHERE id = $1
+`
+
+type MarkDigestSentParams struct {
+	ID         int32
+	LastSentAt sql.NullTime
+	NextSendAt time.Time
+}
+
+func (q *Queries) MarkDigestSent(ctx context.Context, arg MarkDigestSentParams) error {
+	_, err := q.db.ExecContext(ctx, markDigestSent, arg.ID, arg.LastSentAt, arg.NextSendAt)
+	return err
+}
+
+const upsertDigestSubscription = `-- name: UpsertDigestSubscription :one
+INSERT INTO digest_subscriptions (feed_id, email, frequency, send_hour, send_weekday, timezone, next_send_at, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+ON CONFLICT (feed_id, email) DO UPDATE
+SET frequency = EXCLUDED.frequency,
+    send_hour = EXCLUDED.send_hour,
+    send_weekday = EXCLUDED.send_weekday,
+    timezone = EXCLUDED.timezone,
+    next_send_at = EXCLUDED.next_send_at
+RETURNING id, feed_id, email, frequency, send_hour, send_weekday, timezone, next_send_at, last_sent_at, created_at, failed_attempts, last_error
+`
+
+type UpsertDigestSubscriptionParams struct {
+	FeedID      int32
+	Email       string
+	Frequency   string
+	SendHour    int32
+	SendWeekday int32
+	Timezone    string
+	NextSendAt  time.Time
+	CreatedAt   time.Time
+}
+
+func (q *Queries) UpsertDigestSubscription(ctx context.Context, arg UpsertDigestSubscriptionParams) (DigestSubscription, error) {
+	row := q.db.QueryRowContext(ctx, upsertDigestSubscription,
+		arg.FeedID,
+		arg.Email,
+		arg.Frequency,
+		arg.SendHour,
+		arg.SendWeekday,
+		arg.Timezone,
+		arg.NextSendAt,
+		arg.CreatedAt,
+	)
+	var i DigestSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.FeedID,
+		&i.Email,
+		&i.Frequency,
+		&i.SendHour,
+		&i.SendWeekday,
+		&i.Timezone,
+		&i.NextSendAt,
+		&i.LastSentAt,
+		&i.CreatedAt,
+		&i.FailedAttempts,
+		&i.LastError,
+	)
+	return i, err
+}
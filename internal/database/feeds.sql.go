@@ -29,6 +29,20 @@ func (q *Queries) ContainsFeed(ctx context.Context, arg ContainsFeedParams) (boo
 	return exists, err
 }
 
+const containsFeedId = `-- name: ContainsFeedId :one
+SELECT EXISTS (
+    SELECT 1 FROM feeds
+    WHERE id = $1
+)
+`
+
+func (q *Queries) ContainsFeedId(ctx context.Context, id int32) (bool, error) {
+	row := q.db.QueryRowContext(ctx, containsFeedId, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds(created_at, updated_at, name, user_id)
 VALUES(
@@ -37,7 +51,7 @@ VALUES(
     $3,
     $4
 )
-RETURNING id, created_at, updated_at, name, user_id
+RETURNING id, created_at, updated_at, name, user_id, merge_strategy
 `
 
 type CreateFeedParams struct {
@@ -61,6 +75,7 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.UpdatedAt,
 		&i.Name,
 		&i.UserID,
+		&i.MergeStrategy,
 	)
 	return i, err
 }
@@ -90,6 +105,55 @@ func (q *Queries) DeleteFeed(ctx context.Context, arg DeleteFeedParams) error {
 	return err
 }
 
+const getAllUserFeedDetails = `-- name: GetAllUserFeedDetails :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.user_id, feeds.merge_strategy, COUNT(feeds_channels.channel_id) AS channel_count FROM feeds
+LEFT JOIN feeds_channels ON feeds_channels.feed_id = feeds.id
+WHERE feeds.user_id = $1
+GROUP BY feeds.id
+ORDER BY feeds.created_at
+`
+
+type GetAllUserFeedDetailsRow struct {
+	ID            int32
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Name          string
+	UserID        int32
+	MergeStrategy string
+	ChannelCount  int64
+}
+
+func (q *Queries) GetAllUserFeedDetails(ctx context.Context, userID int32) ([]GetAllUserFeedDetailsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAllUserFeedDetails, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllUserFeedDetailsRow
+	for rows.Next() {
+		var i GetAllUserFeedDetailsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.UserID,
+			&i.MergeStrategy,
+			&i.ChannelCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllUserFeedNames = `-- name: GetAllUserFeedNames :many
 SELECT name FROM feeds
 WHERE user_id = $1
@@ -168,6 +232,95 @@ func (q *Queries) GetFeedId(ctx context.Context, arg GetFeedIdParams) (int32, er
 	return id, err
 }
 
+const getFeedMergeStrategy = `-- name: GetFeedMergeStrategy :one
+SELECT merge_strategy FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) GetFeedMergeStrategy(ctx context.Context, id int32) (string, error) {
+	row := q.db.QueryRowContext(ctx, getFeedMergeStrategy, id)
+	var merge_strategy string
+	err := row.Scan(&merge_strategy)
+	return merge_strategy, err
+}
+
+const getUserFeed = `-- name: GetUserFeed :one
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.user_id, feeds.merge_strategy, COUNT(feeds_channels.channel_id) AS channel_count FROM feeds
+LEFT JOIN feeds_channels ON feeds_channels.feed_id = feeds.id
+WHERE feeds.id = $1 AND feeds.user_id = $2
+GROUP BY feeds.id
+`
+
+type GetUserFeedParams struct {
+	ID     int32
+	UserID int32
+}
+
+type GetUserFeedRow struct {
+	ID            int32
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Name          string
+	UserID        int32
+	MergeStrategy string
+	ChannelCount  int64
+}
+
+func (q *Queries) GetUserFeed(ctx context.Context, arg GetUserFeedParams) (GetUserFeedRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserFeed, arg.ID, arg.UserID)
+	var i GetUserFeedRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.UserID,
+		&i.MergeStrategy,
+		&i.ChannelCount,
+	)
+	return i, err
+}
+
+const updateFeed = `-- name: UpdateFeed :exec
+UPDATE feeds
+SET name = $2, merge_strategy = $3, updated_at = $4
+WHERE id = $1
+`
+
+type UpdateFeedParams struct {
+	ID            int32
+	Name          string
+	MergeStrategy string
+	UpdatedAt     time.Time
+}
+
+func (q *Queries) UpdateFeed(ctx context.Context, arg UpdateFeedParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeed,
+		arg.ID,
+		arg.Name,
+		arg.MergeStrategy,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const updateFeedMergeStrategy = `-- name: UpdateFeedMergeStrategy :exec
+UPDATE feeds
+SET merge_strategy = $2, updated_at = $3
+WHERE id = $1
+`
+
+type UpdateFeedMergeStrategyParams struct {
+	ID            int32
+	MergeStrategy string
+	UpdatedAt     time.Time
+}
+
+func (q *Queries) UpdateFeedMergeStrategy(ctx context.Context, arg UpdateFeedMergeStrategyParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedMergeStrategy, arg.ID, arg.MergeStrategy, arg.UpdatedAt)
+	return err
+}
+
 const updateFeedNameQuery = `-- name: UpdateFeedNameQuery :exec
 UPDATE feeds
 SET name = $2, updated_at = $3
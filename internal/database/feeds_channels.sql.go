@@ -7,6 +7,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const containsChannel = `-- name: ContainsChannel :one
@@ -67,6 +69,119 @@ func (q *Queries) DeleteFeedChannel(ctx context.Context, arg DeleteFeedChannelPa
 	return err
 }
 
+const getAllFeedChannelDetails = `-- name: GetAllFeedChannelDetails :many
+SELECT channels.channel_id, channels.channel_upload_id, channels.channel_handle, channels.channel_url, channels.title, channels.description, channels.avatar_default_url, channels.avatar_medium_url, channels.avatar_high_url, channels.subscriber_count, channels.video_count, channels.metadata_updated_at, channels.status, channels.status_reason, channels.status_changed_at, feeds_channels.priority, feeds_channels.created_at AS added_at FROM feeds_channels
+INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+WHERE feeds_channels.feed_id = $1
+ORDER BY feeds_channels.created_at
+`
+
+type GetAllFeedChannelDetailsRow struct {
+	ChannelID         string
+	ChannelUploadID   string
+	ChannelHandle     string
+	ChannelUrl        string
+	Title             string
+	Description       string
+	AvatarDefaultUrl  string
+	AvatarMediumUrl   string
+	AvatarHighUrl     string
+	SubscriberCount   int64
+	VideoCount        int64
+	MetadataUpdatedAt sql.NullTime
+	Status            string
+	StatusReason      string
+	StatusChangedAt   sql.NullTime
+	Priority          int32
+	AddedAt           time.Time
+}
+
+func (q *Queries) GetAllFeedChannelDetails(ctx context.Context, feedID int32) ([]GetAllFeedChannelDetailsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAllFeedChannelDetails, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllFeedChannelDetailsRow
+	for rows.Next() {
+		var i GetAllFeedChannelDetailsRow
+		if err := rows.Scan(
+			&i.ChannelID,
+			&i.ChannelUploadID,
+			&i.ChannelHandle,
+			&i.ChannelUrl,
+			&i.Title,
+			&i.Description,
+			&i.AvatarDefaultUrl,
+			&i.AvatarMediumUrl,
+			&i.AvatarHighUrl,
+			&i.SubscriberCount,
+			&i.VideoCount,
+			&i.MetadataUpdatedAt,
+			&i.Status,
+			&i.StatusReason,
+			&i.StatusChangedAt,
+			&i.Priority,
+			&i.AddedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllFeedChannelPriorities = `-- name: GetAllFeedChannelPriorities :many
+SELECT channels.channel_id, channels.channel_handle, channels.channel_upload_id, channels.status, channels.status_reason, feeds_channels.priority FROM feeds_channels
+INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+WHERE feeds_channels.feed_id = $1
+`
+
+type GetAllFeedChannelPrioritiesRow struct {
+	ChannelID       string
+	ChannelHandle   string
+	ChannelUploadID string
+	Status          string
+	StatusReason    string
+	Priority        int32
+}
+
+func (q *Queries) GetAllFeedChannelPriorities(ctx context.Context, feedID int32) ([]GetAllFeedChannelPrioritiesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAllFeedChannelPriorities, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllFeedChannelPrioritiesRow
+	for rows.Next() {
+		var i GetAllFeedChannelPrioritiesRow
+		if err := rows.Scan(
+			&i.ChannelID,
+			&i.ChannelHandle,
+			&i.ChannelUploadID,
+			&i.Status,
+			&i.StatusReason,
+			&i.Priority,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllFeedChannels = `-- name: GetAllFeedChannels :many
 SELECT channel_id FROM feeds_channels
 WHERE feed_id = $1
@@ -95,6 +210,62 @@ func (q *Queries) GetAllFeedChannels(ctx context.Context, feedID int32) ([]strin
 	return items, nil
 }
 
+const getFeedChannelDetails = `-- name: GetFeedChannelDetails :one
+SELECT channels.channel_id, channels.channel_upload_id, channels.channel_handle, channels.channel_url, channels.title, channels.description, channels.avatar_default_url, channels.avatar_medium_url, channels.avatar_high_url, channels.subscriber_count, channels.video_count, channels.metadata_updated_at, channels.status, channels.status_reason, channels.status_changed_at, feeds_channels.priority, feeds_channels.created_at AS added_at FROM feeds_channels
+INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+WHERE feeds_channels.feed_id = $1 AND feeds_channels.channel_id = $2
+`
+
+type GetFeedChannelDetailsParams struct {
+	FeedID    int32
+	ChannelID string
+}
+
+type GetFeedChannelDetailsRow struct {
+	ChannelID         string
+	ChannelUploadID   string
+	ChannelHandle     string
+	ChannelUrl        string
+	Title             string
+	Description       string
+	AvatarDefaultUrl  string
+	AvatarMediumUrl   string
+	AvatarHighUrl     string
+	SubscriberCount   int64
+	VideoCount        int64
+	MetadataUpdatedAt sql.NullTime
+	Status            string
+	StatusReason      string
+	StatusChangedAt   sql.NullTime
+	Priority          int32
+	AddedAt           time.Time
+}
+
+func (q *Queries) GetFeedChannelDetails(ctx context.Context, arg GetFeedChannelDetailsParams) (GetFeedChannelDetailsRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedChannelDetails, arg.FeedID, arg.ChannelID)
+	var i GetFeedChannelDetailsRow
+	err := row.Scan(
+		&i.ChannelID,
+		&i.ChannelUploadID,
+		&i.ChannelHandle,
+		&i.ChannelUrl,
+		&i.Title,
+		&i.Description,
+		&i.AvatarDefaultUrl,
+		&i.AvatarMediumUrl,
+		&i.AvatarHighUrl,
+		&i.SubscriberCount,
+		&i.VideoCount,
+		&i.MetadataUpdatedAt,
+		&i.Status,
+		&i.StatusReason,
+		&i.StatusChangedAt,
+		&i.Priority,
+		&i.AddedAt,
+	)
+	return i, err
+}
+
 const insertFeedChannel = `-- name: InsertFeedChannel :exec
 INSERT INTO feeds_channels (feed_id, channel_id) 
 VALUES(
@@ -112,3 +283,23 @@ func (q *Queries) InsertFeedChannel(ctx context.Context, arg InsertFeedChannelPa
 	_, err := q.db.ExecContext(ctx, insertFeedChannel, arg.FeedID, arg.ChannelID)
 	return err
 }
+
+const updateFeedChannelPriority = `-- name: UpdateFeedChannelPriority :execrows
+UPDATE feeds_channels
+SET priority = $3
+WHERE feed_id = $1 AND channel_id = $2
+`
+
+type UpdateFeedChannelPriorityParams struct {
+	FeedID    int32
+	ChannelID string
+	Priority  int32
+}
+
+func (q *Queries) UpdateFeedChannelPriority(ctx context.Context, arg UpdateFeedChannelPriorityParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateFeedChannelPriority, arg.FeedID, arg.ChannelID, arg.Priority)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -5,27 +5,80 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
 type Channel struct {
-	ChannelID       string
-	ChannelUploadID string
-	ChannelHandle   string
-	ChannelUrl      string
+	ChannelID         string
+	ChannelUploadID   string
+	ChannelHandle     string
+	ChannelUrl        string
+	Title             string
+	Description       string
+	AvatarDefaultUrl  string
+	AvatarMediumUrl   string
+	AvatarHighUrl     string
+	SubscriberCount   int64
+	VideoCount        int64
+	MetadataUpdatedAt sql.NullTime
+	Status            string
+	StatusReason      string
+	StatusChangedAt   sql.NullTime
+}
+
+type ChannelCooccurrence struct {
+	ChannelID        string
+	RelatedChannelID string
+	Support          int32
+	ComputedAt       time.Time
+}
+
+type ChannelHandle struct {
+	Handle      string
+	ChannelID   string
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+type DigestSubscription struct {
+	ID             int32
+	FeedID         int32
+	Email          string
+	Frequency      string
+	SendHour       int32
+	SendWeekday    int32
+	Timezone       string
+	NextSendAt     time.Time
+	LastSentAt     sql.NullTime
+	CreatedAt      time.Time
+	FailedAttempts int32
+	LastError      string
 }
 
 type Feed struct {
-	ID        int32
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
-	UserID    int32
+	ID            int32
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Name          string
+	UserID        int32
+	MergeStrategy string
 }
 
 type FeedsChannel struct {
 	FeedID    int32
 	ChannelID string
+	Priority  int32
+	CreatedAt time.Time
+}
+
+type StreamEvent struct {
+	ID        int64
+	Type      string
+	ChannelID string
+	Data      json.RawMessage
+	CreatedAt time.Time
 }
 
 type User struct {
@@ -34,3 +87,52 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+type Video struct {
+	VideoID      string
+	ChannelID    string
+	ChannelTitle string
+	Title        string
+	Description  string
+	ThumbnailUrl string
+	VideoUrl     string
+	PublishedAt  time.Time
+	StoredAt     time.Time
+	SearchVector interface{}
+}
+
+type Webhook struct {
+	ID        int32
+	FeedID    int32
+	Url       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+type WebhookAttempt struct {
+	ID          int64
+	DeliveryID  int64
+	AttemptedAt time.Time
+	StatusCode  int32
+	Error       string
+	DurationMs  int32
+}
+
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     int32
+	VideoID       string
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastAttemptAt sql.NullTime
+	DeliveredAt   sql.NullTime
+	CreatedAt     time.Time
+}
+
+type YoutubeQuotaUsage struct {
+	Day    time.Time
+	Method string
+	Calls  int64
+	Units  int64
+}
@@ -0,0 +1,112 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: quota.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const addQuotaUsage = `-- name: AddQuotaUsage :exec
+INSERT INTO youtube_quota_usage (day, method, calls, units)
+VALUES(
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (day, method) DO UPDATE
+SET calls = youtube_quota_usage.calls + EXCLUDED.calls,
+    units = youtube_quota_usage.units + EXCLUDED.units
+`
+
+type AddQuotaUsageParams struct {
+	Day    time.Time
+	Method string
+	Calls  int64
+	Units  int64
+}
+
+func (q *Queries) AddQuotaUsage(ctx context.Context, arg AddQuotaUsageParams) error {
+	_, err := q.db.ExecContext(ctx, addQuotaUsage,
+		arg.Day,
+		arg.Method,
+		arg.Calls,
+		arg.Units,
+	)
+	return err
+}
+
+const getQuotaUsageByDay = `-- name: GetQuotaUsageByDay :many
+SELECT method, calls, units FROM youtube_quota_usage
+WHERE day = $1
+ORDER BY method
+`
+
+type GetQuotaUsageByDayRow struct {
+	Method string
+	Calls  int64
+	Units  int64
+}
+
+func (q *Queries) GetQuotaUsageByDay(ctx context.Context, day time.Time) ([]GetQuotaUsageByDayRow, error) {
+	rows, err := q.db.QueryContext(ctx, getQuotaUsageByDay, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetQuotaUsageByDayRow
+	for rows.Next() {
+		var i GetQuotaUsageByDayRow
+		if err := rows.Scan(&i.Method, &i.Calls, &i.Units); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getQuotaUsageHistory = `-- name: GetQuotaUsageHistory :many
+SELECT day, SUM(calls)::BIGINT AS calls, SUM(units)::BIGINT AS units FROM youtube_quota_usage
+GROUP BY day
+ORDER BY day DESC
+LIMIT $1
+`
+
+type GetQuotaUsageHistoryRow struct {
+	Day   time.Time
+	Calls int64
+	Units int64
+}
+
+func (q *Queries) GetQuotaUsageHistory(ctx context.Context, limit int32) ([]GetQuotaUsageHistoryRow, error) {
+	rows, err := q.db.QueryContext(ctx, getQuotaUsageHistory, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetQuotaUsageHistoryRow
+	for rows.Next() {
+		var i GetQuotaUsageHistoryRow
+		if err := rows.Scan(&i.Day, &i.Calls, &i.Units); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,130 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: recommendations.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const deleteStaleChannelCooccurrence = `-- name: DeleteStaleChannelCooccurrence :exec
+DELETE FROM channel_cooccurrence WHERE computed_at < $1
+`
+
+// Removes pairs not stored by the refresh at computed_at
+func (q *Queries) DeleteStaleChannelCooccurrence(ctx context.Context, computedAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteStaleChannelCooccurrence, computedAt)
+	return err
+}
+
+const getFeedRecommendations = `-- name: GetFeedRecommendations :many
+SELECT channels.channel_id, channels.channel_upload_id, channels.channel_handle, channels.channel_url, channels.title, channels.description, channels.avatar_default_url, channels.avatar_medium_url, channels.avatar_high_url, channels.subscriber_count, channels.video_count, channels.metadata_updated_at, channels.status, channels.status_reason, channels.status_changed_at,
+    SUM(channel_cooccurrence.support)::BIGINT AS score,
+    COUNT(*)::BIGINT AS matched_channels
+FROM channel_cooccurrence
+INNER JOIN channels ON channels.channel_id = channel_cooccurrence.related_channel_id
+WHERE channel_cooccurrence.channel_id IN (
+    SELECT fc.channel_id FROM feeds_channels fc WHERE fc.feed_id = $1
+)
+AND channel_cooccurrence.related_channel_id NOT IN (
+    SELECT fc.channel_id FROM feeds_channels fc WHERE fc.feed_id = $1
+)
+AND channels.status = 'active'
+GROUP BY channels.channel_id
+ORDER BY score DESC, channels.subscriber_count DESC
+LIMIT $2
+`
+
+type GetFeedRecommendationsParams struct {
+	FeedID      int32
+	ResultLimit int32
+}
+
+type GetFeedRecommendationsRow struct {
+	ChannelID         string
+	ChannelUploadID   string
+	ChannelHandle     string
+	ChannelUrl        string
+	Title             string
+	Description       string
+	AvatarDefaultUrl  string
+	AvatarMediumUrl   string
+	AvatarHighUrl     string
+	SubscriberCount   int64
+	VideoCount        int64
+	MetadataUpdatedAt sql.NullTime
+	Status            string
+	StatusReason      string
+	StatusChangedAt   sql.NullTime
+	Score             int64
+	MatchedChannels   int64
+}
+
+func (q *Queries) GetFeedRecommendations(ctx context.Context, arg GetFeedRecommendationsParams) ([]GetFeedRecommendationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedRecommendations, arg.FeedID, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeedRecommendationsRow
+	for rows.Next() {
+		var i GetFeedRecommendationsRow
+		if err := rows.Scan(
+			&i.ChannelID,
+			&i.ChannelUploadID,
+			&i.ChannelHandle,
+			&i.ChannelUrl,
+			&i.Title,
+			&i.Description,
+			&i.AvatarDefaultUrl,
+			&i.AvatarMediumUrl,
+			&i.AvatarHighUrl,
+			&i.SubscriberCount,
+			&i.VideoCount,
+			&i.MetadataUpdatedAt,
+			&i.Status,
+			&i.StatusReason,
+			&i.StatusChangedAt,
+			&i.Score,
+			&i.MatchedChannels,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertChannelCooccurrence = `-- name: UpsertChannelCooccurrence :exec
+INSERT INTO channel_cooccurrence (channel_id, related_channel_id, support, computed_at)
+SELECT a.channel_id, b.channel_id, COUNT(DISTINCT feeds.user_id), $1
+FROM feeds_channels a
+INNER JOIN feeds_channels b ON b.feed_id = a.feed_id AND b.channel_id <> a.channel_id
+INNER JOIN feeds ON feeds.id = a.feed_id
+GROUP BY a.channel_id, b.channel_id
+HAVING COUNT(DISTINCT feeds.user_id) >= $2::INTEGER
+ON CONFLICT (channel_id, related_channel_id) DO UPDATE
+SET support = EXCLUDED.support, computed_at = EXCLUDED.computed_at
+`
+
+type UpsertChannelCooccurrenceParams struct {
+	ComputedAt time.Time
+	MinSupport int32
+}
+
+// Stores every pair, support is the number of distinct users with both channels in the same
+// feed and pairs below min_support are not stored
+func (q *Queries) UpsertChannelCooccurrence(ctx context.Context, arg UpsertChannelCooccurrenceParams) error {
+	_, err := q.db.ExecContext(ctx, upsertChannelCooccurrence, arg.ComputedAt, arg.MinSupport)
+	return err
+}
@@ -0,0 +1,112 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: stream_events.sql
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const deleteStreamEventsBefore = `-- name: DeleteStreamEventsBefore :exec
+DELETE FROM stream_events
+WHERE created_at < $1
+`
+
+func (q *Queries) DeleteStreamEventsBefore(ctx context.Context, createdAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteStreamEventsBefore, createdAt)
+	return err
+}
+
+const getLatestStreamEventId = `-- name: GetLatestStreamEventId :one
+SELECT COALESCE(MAX(id), 0)::BIGINT FROM stream_events
+`
+
+func (q *Queries) GetLatestStreamEventId(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLatestStreamEventId)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const getStreamEvent = `-- name: GetStreamEvent :one
+SELECT id, type, channel_id, data, created_at FROM stream_events
+WHERE id = $1
+`
+
+func (q *Queries) GetStreamEvent(ctx context.Context, id int64) (StreamEvent, error) {
+	row := q.db.QueryRowContext(ctx, getStreamEvent, id)
+	var i StreamEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.ChannelID,
+		&i.Data,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getStreamEventsAfter = `-- name: GetStreamEventsAfter :many
+SELECT id, type, channel_id, data, created_at FROM stream_events
+WHERE id > $1
+ORDER BY id
+`
+
+func (q *Queries) GetStreamEventsAfter(ctx context.Context, id int64) ([]StreamEvent, error) {
+	rows, err := q.db.QueryContext(ctx, getStreamEventsAfter, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StreamEvent
+	for rows.Next() {
+		var i StreamEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.ChannelID,
+			&i.Data,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertStreamEvent = `-- name: InsertStreamEvent :one
+INSERT INTO stream_events (type, channel_id, data, created_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id
+`
+
+type InsertStreamEventParams struct {
+	Type      string
+	ChannelID string
+	Data      json.RawMessage
+	CreatedAt time.Time
+}
+
+// Every instance is notified of the new event on the stream_events channel
+func (q *Queries) InsertStreamEvent(ctx context.Context, arg InsertStreamEventParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, insertStreamEvent,
+		arg.Type,
+		arg.ChannelID,
+		arg.Data,
+		arg.CreatedAt,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
@@ -0,0 +1,205 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: videos.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const getFeedVideosState = `-- name: GetFeedVideosState :one
+SELECT feeds.updated_at,
+    COALESCE((
+        SELECT string_agg(channels.channel_id || ':' || feeds_channels.priority || ':' || channels.status, ',' ORDER BY channels.channel_id)
+        FROM feeds_channels
+        INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+        WHERE feeds_channels.feed_id = feeds.id
+    ), '')::TEXT AS channels,
+    COALESCE((
+        SELECT MAX(videos.published_at) FROM videos
+        INNER JOIN feeds_channels ON feeds_channels.channel_id = videos.channel_id
+        WHERE feeds_channels.feed_id = feeds.id
+    ), 'epoch')::TIMESTAMP AS newest_published_at,
+    COALESCE((
+        SELECT MIN(COALESCE((SELECT MAX(videos.stored_at) FROM videos WHERE videos.channel_id = channels.channel_id), 'epoch'))
+        FROM feeds_channels
+        INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+        WHERE feeds_channels.feed_id = feeds.id AND channels.status = 'active'
+    ), 'epoch')::TIMESTAMP AS checked_at
+FROM feeds
+WHERE feeds.id = $1 AND feeds.user_id = $2
+`
+
+type GetFeedVideosStateParams struct {
+	ID     int32
+	UserID int32
+}
+
+type GetFeedVideosStateRow struct {
+	UpdatedAt         time.Time
+	Channels          string
+	NewestPublishedAt time.Time
+	CheckedAt         time.Time
+}
+
+// Summarises what a feed's videos response is built from. channels lists each channel with its
+// priority and status, checked_at is the oldest of the active channels' latest stored_at, when
+// the least recently fetched channel was last retrieved from YouTube
+func (q *Queries) GetFeedVideosState(ctx context.Context, arg GetFeedVideosStateParams) (GetFeedVideosStateRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedVideosState, arg.ID, arg.UserID)
+	var i GetFeedVideosStateRow
+	err := row.Scan(
+		&i.UpdatedAt,
+		&i.Channels,
+		&i.NewestPublishedAt,
+		&i.CheckedAt,
+	)
+	return i, err
+}
+
+const searchUserVideos = `-- name: SearchUserVideos :many
+SELECT videos.video_id, videos.channel_title, videos.title, videos.thumbnail_url, videos.video_url, videos.published_at
+FROM videos
+WHERE videos.search_vector @@ websearch_to_tsquery('english', $1)
+AND EXISTS (
+    SELECT 1 FROM feeds_channels
+    INNER JOIN feeds ON feeds.id = feeds_channels.feed_id
+    WHERE feeds_channels.channel_id = videos.channel_id
+    AND feeds.user_id = $2
+    AND ($3::INTEGER IS NULL OR feeds.id = $3)
+)
+ORDER BY ts_rank(videos.search_vector, websearch_to_tsquery('english', $1))
+    * POWER(0.5, EXTRACT(EPOCH FROM (NOW() - videos.published_at)) / 604800) DESC,
+    videos.published_at DESC
+LIMIT $4
+`
+
+type SearchUserVideosParams struct {
+	Query       string
+	UserID      int32
+	FeedID      sql.NullInt32
+	ResultLimit int32
+}
+
+type SearchUserVideosRow struct {
+	VideoID      string
+	ChannelTitle string
+	Title        string
+	ThumbnailUrl string
+	VideoUrl     string
+	PublishedAt  time.Time
+}
+
+// Ranks matches by relevance, halving the score for every week since publication
+func (q *Queries) SearchUserVideos(ctx context.Context, arg SearchUserVideosParams) ([]SearchUserVideosRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchUserVideos,
+		arg.Query,
+		arg.UserID,
+		arg.FeedID,
+		arg.ResultLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchUserVideosRow
+	for rows.Next() {
+		var i SearchUserVideosRow
+		if err := rows.Scan(
+			&i.VideoID,
+			&i.ChannelTitle,
+			&i.Title,
+			&i.ThumbnailUrl,
+			&i.VideoUrl,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertVideos = `-- name: UpsertVideos :many
+INSERT INTO videos (video_id, channel_id, channel_title, title, description, thumbnail_url, video_url, published_at, stored_at)
+SELECT unnest($1::TEXT[]),
+    $2,
+    unnest($3::TEXT[]),
+    unnest($4::TEXT[]),
+    unnest($5::TEXT[]),
+    unnest($6::TEXT[]),
+    unnest($7::TEXT[]),
+    unnest($8::TIMESTAMP[]),
+    $9
+ON CONFLICT (video_id) DO UPDATE
+SET channel_title = EXCLUDED.channel_title,
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    thumbnail_url = EXCLUDED.thumbnail_url,
+    stored_at = EXCLUDED.stored_at
+RETURNING video_id, (xmax = 0) AS inserted
+`
+
+type UpsertVideosParams struct {
+	VideoIds      []string
+	ChannelID     string
+	ChannelTitles []string
+	Titles        []string
+	Descriptions  []string
+	ThumbnailUrls []string
+	VideoUrls     []string
+	PublishedAts  []time.Time
+	StoredAt      time.Time
+}
+
+type UpsertVideosRow struct {
+	VideoID  string
+	Inserted bool
+}
+
+// Stores a channel's videos in one statement, the arrays hold one element per video and are
+// unnested in step. inserted is true for videos that were not stored before
+func (q *Queries) UpsertVideos(ctx context.Context, arg UpsertVideosParams) ([]UpsertVideosRow, error) {
+	rows, err := q.db.QueryContext(ctx, upsertVideos,
+		pq.Array(arg.VideoIds),
+		arg.ChannelID,
+		pq.Array(arg.ChannelTitles),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.ThumbnailUrls),
+		pq.Array(arg.VideoUrls),
+		pq.Array(arg.PublishedAts),
+		arg.StoredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertVideosRow
+	for rows.Next() {
+		var i UpsertVideosRow
+		if err := rows.Scan(&i.VideoID, &i.Inserted); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,423 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: webhooks.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+WITH claimed AS (
+    UPDATE webhook_deliveries
+    SET next_attempt_at = $1
+    WHERE webhook_deliveries.id IN (
+        SELECT pending.id FROM webhook_deliveries pending
+        WHERE pending.status = 'pending' AND pending.next_attempt_at <= $2
+        ORDER BY pending.next_attempt_at
+        LIMIT $3
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.video_id, webhook_deliveries.attempts
+)
+SELECT claimed.id, claimed.webhook_id, claimed.attempts,
+    webhooks.feed_id, webhooks.url, webhooks.secret,
+    videos.video_id, videos.channel_id, videos.channel_title, videos.title, videos.thumbnail_url, videos.video_url, videos.published_at
+FROM claimed
+INNER JOIN webhooks ON webhooks.id = claimed.webhook_id
+INNER JOIN videos ON videos.video_id = claimed.video_id
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseUntil time.Time
+	Now        time.Time
+	BatchLimit int32
+}
+
+type ClaimWebhookDeliveriesRow struct {
+	ID           int64
+	WebhookID    int32
+	Attempts     int32
+	FeedID       int32
+	Url          string
+	Secret       string
+	VideoID      string
+	ChannelID    string
+	ChannelTitle string
+	Title        string
+	ThumbnailUrl string
+	VideoUrl     string
+	PublishedAt  time.Time
+}
+
+// Leases due deliveries until lease_until so concurrent workers skip them
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimWebhookDeliveries, arg.LeaseUntil, arg.Now, arg.BatchLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.WebhookID,
+			&i.Attempts,
+			&i.FeedID,
+			&i.Url,
+			&i.Secret,
+			&i.VideoID,
+			&i.ChannelID,
+			&i.ChannelTitle,
+			&i.Title,
+			&i.ThumbnailUrl,
+			&i.VideoUrl,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (feed_id, url, secret, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING id, feed_id, url, secret, created_at
+`
+
+type CreateWebhookParams struct {
+	FeedID    int32
+	Url       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, createWebhook,
+		arg.FeedID,
+		arg.Url,
+		arg.Secret,
+		arg.CreatedAt,
+	)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.FeedID,
+		&i.Url,
+		&i.Secret,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteFeedWebhook = `-- name: DeleteFeedWebhook :exec
+DELETE FROM webhooks
+WHERE id = $1 AND feed_id = $2
+`
+
+type DeleteFeedWebhookParams struct {
+	ID     int32
+	FeedID int32
+}
+
+func (q *Queries) DeleteFeedWebhook(ctx context.Context, arg DeleteFeedWebhookParams) error {
+	_, err := q.db.ExecContext(ctx, deleteFeedWebhook, arg.ID, arg.FeedID)
+	return err
+}
+
+const enqueueWebhookDeliveries = `-- name: EnqueueWebhookDeliveries :exec
+INSERT INTO webhook_deliveries (webhook_id, video_id, next_attempt_at, created_at)
+SELECT webhooks.id, videos.video_id, $1, $1
+FROM videos
+INNER JOIN feeds_channels ON feeds_channels.channel_id = videos.channel_id
+INNER JOIN webhooks ON webhooks.feed_id = feeds_channels.feed_id
+WHERE videos.channel_id = $2
+AND videos.video_id = ANY($3::TEXT[])
+AND videos.published_at > webhooks.created_at
+AND videos.published_at > feeds_channels.created_at
+ON CONFLICT (webhook_id, video_id) DO NOTHING
+`
+
+type EnqueueWebhookDeliveriesParams struct {
+	Now       time.Time
+	ChannelID string
+	VideoIds  []string
+}
+
+// Queues a delivery to every webhook of every feed containing the channel, for videos published
+// after both the webhook was registered and the channel was added to the feed
+func (q *Queries) EnqueueWebhookDeliveries(ctx context.Context, arg EnqueueWebhookDeliveriesParams) error {
+	_, err := q.db.ExecContext(ctx, enqueueWebhookDeliveries, arg.Now, arg.ChannelID, pq.Array(arg.VideoIds))
+	return err
+}
+
+const getFeedWebhook = `-- name: GetFeedWebhook :one
+SELECT id, feed_id, url, secret, created_at FROM webhooks
+WHERE id = $1 AND feed_id = $2
+`
+
+type GetFeedWebhookParams struct {
+	ID     int32
+	FeedID int32
+}
+
+func (q *Queries) GetFeedWebhook(ctx context.Context, arg GetFeedWebhookParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, getFeedWebhook, arg.ID, arg.FeedID)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.FeedID,
+		&i.Url,
+		&i.Secret,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getFeedWebhooks = `-- name: GetFeedWebhooks :many
+SELECT id, feed_id, url, secret, created_at FROM webhooks
+WHERE feed_id = $1
+ORDER BY id
+`
+
+func (q *Queries) GetFeedWebhooks(ctx context.Context, feedID int32) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedWebhooks, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.Url,
+			&i.Secret,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookAttempts = `-- name: GetWebhookAttempts :many
+SELECT webhook_attempts.id, webhook_attempts.delivery_id, webhook_attempts.attempted_at, webhook_attempts.status_code, webhook_attempts.error, webhook_attempts.duration_ms FROM webhook_attempts
+INNER JOIN webhook_deliveries ON webhook_deliveries.id = webhook_attempts.delivery_id
+WHERE webhook_deliveries.webhook_id = $1
+AND webhook_attempts.delivery_id = ANY($2::BIGINT[])
+ORDER BY webhook_attempts.attempted_at
+`
+
+type GetWebhookAttemptsParams struct {
+	WebhookID   int32
+	DeliveryIds []int64
+}
+
+func (q *Queries) GetWebhookAttempts(ctx context.Context, arg GetWebhookAttemptsParams) ([]WebhookAttempt, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookAttempts, arg.WebhookID, pq.Array(arg.DeliveryIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookAttempt
+	for rows.Next() {
+		var i WebhookAttempt
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeliveryID,
+			&i.AttemptedAt,
+			&i.StatusCode,
+			&i.Error,
+			&i.DurationMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookDeliveries = `-- name: GetWebhookDeliveries :many
+SELECT webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.video_id, webhook_deliveries.status, webhook_deliveries.attempts, webhook_deliveries.next_attempt_at, webhook_deliveries.last_attempt_at, webhook_deliveries.delivered_at, webhook_deliveries.created_at, videos.title AS video_title
+FROM webhook_deliveries
+INNER JOIN videos ON videos.video_id = webhook_deliveries.video_id
+WHERE webhook_deliveries.webhook_id = $1
+ORDER BY webhook_deliveries.created_at DESC, webhook_deliveries.id DESC
+LIMIT $2
+`
+
+type GetWebhookDeliveriesParams struct {
+	WebhookID int32
+	Limit     int32
+}
+
+type GetWebhookDeliveriesRow struct {
+	ID            int64
+	WebhookID     int32
+	VideoID       string
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastAttemptAt sql.NullTime
+	DeliveredAt   sql.NullTime
+	CreatedAt     time.Time
+	VideoTitle    string
+}
+
+func (q *Queries) GetWebhookDeliveries(ctx context.Context, arg GetWebhookDeliveriesParams) ([]GetWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookDeliveries, arg.WebhookID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWebhookDeliveriesRow
+	for rows.Next() {
+		var i GetWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.WebhookID,
+			&i.VideoID,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.DeliveredAt,
+			&i.CreatedAt,
+			&i.VideoTitle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookFeedIds = `-- name: GetWebhookFeedIds :many
+SELECT DISTINCT feed_id FROM webhooks
+ORDER BY feed_id
+`
+
+func (q *Queries) GetWebhookFeedIds(ctx context.Context) ([]int32, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookFeedIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var feed_id int32
+		if err := rows.Scan(&feed_id); err != nil {
+			return nil, err
+		}
+		items = append(items, feed_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookAttempt = `-- name: RecordWebhookAttempt :exec
+INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+`
+
+type RecordWebhookAttemptParams struct {
+	DeliveryID  int64
+	AttemptedAt time.Time
+	StatusCode  int32
+	Error       string
+	DurationMs  int32
+}
+
+func (q *Queries) RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookAttempt,
+		arg.DeliveryID,
+		arg.AttemptedAt,
+		arg.StatusCode,
+		arg.Error,
+		arg.DurationMs,
+	)
+	return err
+}
+
+const updateWebhookDelivery = `-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = $2,
+    attempts = $3,
+    next_attempt_at = $4,
+    last_attempt_at = $5,
+    delivered_at = $6
+WHERE id = $1
+`
+
+type UpdateWebhookDeliveryParams struct {
+	ID            int64
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastAttemptAt sql.NullTime
+	DeliveredAt   sql.NullTime
+}
+
+func (q *Queries) UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebhookDelivery,
+		arg.ID,
+		arg.Status,
+		arg.Attempts,
+		arg.NextAttemptAt,
+		arg.LastAttemptAt,
+		arg.DeliveredAt,
+	)
+	return err
+}
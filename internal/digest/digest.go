@@ -0,0 +1,81 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(htmltemplate.FuncMap{"date": formatDate}).ParseFS(templateFS, "templates/digest.html.tmpl"))
+	textTemplate = texttemplate.Must(texttemplate.New("digest.txt.tmpl").Funcs(texttemplate.FuncMap{"date": formatDate}).ParseFS(templateFS, "templates/digest.txt.tmpl"))
+)
+
+// A video listed in a digest
+type Video struct {
+	Title        string
+	ChannelName  string
+	URL          string
+	ThumbnailURL string
+	PublishedAt  time.Time
+}
+
+// The contents of a single digest email
+type Digest struct {
+	FeedName       string
+	Frequency      Frequency
+	Since          time.Time
+	Videos         []Video
+	UnsubscribeURL string
+	Location       *time.Location // dates are shown in the subscriber's timezone
+}
+
+// A rendered email
+type Message struct {
+	To             string
+	Subject        string
+	Text           string
+	HTML           string
+	UnsubscribeURL string
+}
+
+func formatDate(t time.Time, location *time.Location) string {
+	if location == nil {
+		location = time.UTC
+	}
+	return t.In(location).Format("Mon 2 Jan 15:04")
+}
+
+// Renders the digest as a plain-text and HTML email to the address to
+func Render(to string, d Digest) (Message, error) {
+	var text, html bytes.Buffer
+
+	err := textTemplate.Execute(&text, d)
+	if err != nil {
+		return Message{}, fmt.Errorf("in Render(): error rendering text template: %s", err)
+	}
+
+	err = htmlTemplate.Execute(&html, d)
+	if err != nil {
+		return Message{}, fmt.Errorf("in Render(): error rendering html template: %s", err)
+	}
+
+	subject := fmt.Sprintf("%d new videos in %s", len(d.Videos), d.FeedName)
+	if len(d.Videos) == 1 {
+		subject = fmt.Sprintf("1 new video in %s", d.FeedName)
+	}
+
+	return Message{
+		To:             to,
+		Subject:        subject,
+		Text:           text.String(),
+		HTML:           html.String(),
+		UnsubscribeURL: d.UnsubscribeURL,
+	}, nil
+}
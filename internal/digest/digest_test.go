@@ -0,0 +1,270 @@
+package digest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	london, _ := time.LoadLocation("Europe/London")
+	// Friday 1 Nov 2024 12:00 UTC
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		schedule Schedule
+		want     time.Time
+	}{
+		{"daily later today", Schedule{Frequency: Daily, Hour: 18, Location: time.UTC}, time.Date(2024, 11, 1, 18, 0, 0, 0, time.UTC)},
+		{"daily tomorrow", Schedule{Frequency: Daily, Hour: 8, Location: time.UTC}, time.Date(2024, 11, 2, 8, 0, 0, 0, time.UTC)},
+		{"daily at the current hour", Schedule{Frequency: Daily, Hour: 12, Location: time.UTC}, time.Date(2024, 11, 2, 12, 0, 0, 0, time.UTC)},
+		{"weekly next monday", Schedule{Frequency: Weekly, Hour: 9, Weekday: time.Monday, Location: time.UTC}, time.Date(2024, 11, 4, 9, 0, 0, 0, time.UTC)},
+		{"weekly later today", Schedule{Frequency: Weekly, Hour: 20, Weekday: time.Friday, Location: time.UTC}, time.Date(2024, 11, 1, 20, 0, 0, 0, time.UTC)},
+		{"weekly next week", Schedule{Frequency: Weekly, Hour: 9, Weekday: time.Friday, Location: time.UTC}, time.Date(2024, 11, 8, 9, 0, 0, 0, time.UTC)},
+		{"daily in timezone", Schedule{Frequency: Daily, Hour: 7, Location: london}, time.Date(2024, 11, 2, 7, 0, 0, 0, london)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.schedule.Next(now)
+			if !got.Equal(c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestScheduleRetry(t *testing.T) {
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	daily := Schedule{Frequency: Daily, Hour: 8, Location: time.UTC}
+
+	if got, want := daily.Retry(now, 1), now.Add(5*time.Minute); !got.Equal(want) {
+		t.Errorf("first retry at %v, want %v", got, want)
+	}
+	if got, want := daily.Retry(now, 3), now.Add(20*time.Minute); !got.Equal(want) {
+		t.Errorf("third retry at %v, want %v", got, want)
+	}
+	// 6 hours later is past tomorrow's send when the digest is due at 3am
+	late := time.Date(2024, 11, 2, 3, 0, 0, 0, time.UTC)
+	if got, want := daily.Retry(late, 20), daily.Next(late); !got.Equal(want) {
+		t.Errorf("retry at %v, want the next send time %v", got, want)
+	}
+	if got := RetryDelay(20); got != 6*time.Hour {
+		t.Errorf("got delay %v, want it capped at 6h", got)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	cases := []struct {
+		frequency string
+		hour      int
+		weekday   int
+		timezone  string
+	}{
+		{"monthly", 8, 0, "UTC"},
+		{"daily", 24, 0, "UTC"},
+		{"weekly", 8, 7, "UTC"},
+		{"daily", 8, 0, "Mars/Olympus"},
+		{"daily", 8, 0, ""},
+	}
+
+	for _, c := range cases {
+		_, err := ParseSchedule(c.frequency, c.hour, c.weekday, c.timezone)
+		if err == nil {
+			t.Errorf("ParseSchedule(%q, %d, %d, %q) should fail", c.frequency, c.hour, c.weekday, c.timezone)
+		}
+	}
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	signer := NewSigner("secret")
+
+	token := signer.Sign(42)
+	id, err := signer.Verify(token)
+	if err != nil || id != 42 {
+		t.Fatalf("got %d, %v, want 42 and no error", id, err)
+	}
+
+	for _, bad := range []string{
+		"",
+		"42",
+		"43" + token[2:],
+		token + "x",
+		NewSigner("other").Sign(42),
+	} {
+		if _, err := signer.Verify(bad); err != ErrInvalidToken {
+			t.Errorf("Verify(%q) = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+
+	if _, err := NewSigner("").Verify(NewSigner("").Sign(42)); err != ErrInvalidToken {
+		t.Errorf("tokens should not verify without a key")
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	msg, err := Render("viewer@example.com", Digest{
+		FeedName:  "music",
+		Frequency: Daily,
+		Videos: []Video{
+			{Title: "<b>Live</b> & loud", ChannelName: "Artist", URL: "https://www.youtube.com/watch?v=abc", PublishedAt: time.Now()},
+		},
+		UnsubscribeURL: "https://example.com/unsubscribe?token=1.abc",
+	})
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+
+	if msg.Subject != "1 new video in music" {
+		t.Errorf("got subject %q", msg.Subject)
+	}
+	if strings.Contains(msg.HTML, "<b>Live</b>") || !strings.Contains(msg.HTML, "&lt;b&gt;Live&lt;/b&gt;") {
+		t.Errorf("video title was not escaped in the html part")
+	}
+	if !strings.Contains(msg.Text, "<b>Live</b> & loud") {
+		t.Errorf("video title missing from the text part")
+	}
+	if !strings.Contains(msg.Text, msg.UnsubscribeURL) || !strings.Contains(msg.HTML, "token=1.abc") {
+		t.Errorf("unsubscribe link missing")
+	}
+}
+
+// Minimal SMTP server accepting a single message
+func startFakeSMTP(t *testing.T) (int, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting fake smtp server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost fake smtp")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 ok")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "DATA"):
+				inData = true
+				reply("354 end with .")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	port, received := startFakeSMTP(t)
+
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: port, From: "digests@example.com", Timeout: 5 * time.Second})
+	err := mailer.Send(Message{
+		To:             "viewer@example.com",
+		Subject:        "2 new videos in music",
+		Text:           "plain body",
+		HTML:           "<p>html body</p>",
+		UnsubscribeURL: "https://example.com/unsubscribe?token=1.abc",
+	})
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	select {
+	case email := <-received:
+		for _, want := range []string{
+			"From: digests@example.com",
+			"To: viewer@example.com",
+			"Subject: 2 new videos in music",
+			"List-Unsubscribe: <https://example.com/unsubscribe?token=1.abc>",
+			"multipart/alternative",
+			"plain body",
+			"<p>html body</p>",
+		} {
+			if !strings.Contains(email, want) {
+				t.Errorf("email missing %q:\n%s", want, email)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake smtp server received no message")
+	}
+}
+
+func TestSMTPMailerSendUnreachable(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: port, From: "digests@example.com", Timeout: 5 * time.Second})
+	if err := mailer.Send(Message{To: "viewer@example.com"}); err == nil {
+		t.Errorf("Send() to closed port %d should fail", port)
+	}
+}
+
+func TestSMTPMailerSendStalledServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	// accepts the connection but never greets
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: port, From: "digests@example.com", Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	err = mailer.Send(Message{To: "viewer@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send() returned after %v, want it bounded by the timeout", elapsed)
+	}
+
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	default:
+	}
+}
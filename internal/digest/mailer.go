@@ -0,0 +1,154 @@
+package digest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// Sends rendered emails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // no authentication when empty
+	Password string
+	From     string
+	Timeout  time.Duration // bounds connecting and the whole conversation with the server
+}
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+// Returns a mailer sending through the SMTP server in cfg. STARTTLS is used when the server offers it
+func NewSMTPMailer(cfg SMTPConfig) Mailer {
+	return smtpMailer{cfg: cfg}
+}
+
+func (m smtpMailer) Send(msg Message) error {
+	body, err := buildMessage(m.cfg.From, msg, time.Now())
+	if err != nil {
+		return fmt.Errorf("in Send(): %s", err)
+	}
+
+	err = m.send(msg.To, body)
+	if err != nil {
+		return fmt.Errorf("in Send(): error sending email to %s: %s", msg.To, err)
+	}
+
+	return nil
+}
+
+// Sends body to the recipient as smtp.SendMail does, failing once m.cfg.Timeout has passed so a
+// stalled server cannot block the caller
+func (m smtpMailer) send(to string, body []byte) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, m.cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(m.cfg.Timeout))
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: m.cfg.Host})
+		if err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(m.cfg.From)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(body)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// Builds a multipart/alternative email with plain-text and HTML parts
+func buildMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		writer, err := parts.CreatePart(header)
+		if err != nil {
+			return nil, fmt.Errorf("in buildMessage(): error creating part: %s", err)
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err = encoder.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("in buildMessage(): error writing part: %s", err)
+		}
+		if err = encoder.Close(); err != nil {
+			return nil, fmt.Errorf("in buildMessage(): error writing part: %s", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("in buildMessage(): error closing message: %s", err)
+	}
+
+	var email bytes.Buffer
+	fmt.Fprintf(&email, "From: %s\r\n", from)
+	fmt.Fprintf(&email, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&email, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&email, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	if msg.UnsubscribeURL != "" {
+		fmt.Fprintf(&email, "List-Unsubscribe: <%s>\r\n", msg.UnsubscribeURL)
+	}
+	fmt.Fprintf(&email, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&email, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	email.Write(body.Bytes())
+
+	return email.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package digest
+
+import (
+	"fmt"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily  Frequency = "daily"
+	Weekly Frequency = "weekly"
+)
+
+// When a subscription's digest is sent. Weekday is only used by weekly digests, Hour is in Location
+type Schedule struct {
+	Frequency Frequency
+	Hour      int
+	Weekday   time.Weekday
+	Location  *time.Location
+}
+
+// Parses and validates a schedule, timezone is an IANA name such as "Europe/London"
+func ParseSchedule(frequency string, hour, weekday int, timezone string) (Schedule, error) {
+	schedule := Schedule{
+		Frequency: Frequency(frequency),
+		Hour:      hour,
+		Weekday:   time.Weekday(weekday),
+	}
+
+	if schedule.Frequency != Daily && schedule.Frequency != Weekly {
+		return schedule, fmt.Errorf("in ParseSchedule(): invalid frequency<%s>, must be %s or %s", frequency, Daily, Weekly)
+	}
+	if hour < 0 || hour > 23 {
+		return schedule, fmt.Errorf("in ParseSchedule(): invalid hour<%d>, must be between 0 and 23", hour)
+	}
+	if weekday < 0 || weekday > 6 {
+		return schedule, fmt.Errorf("in ParseSchedule(): invalid weekday<%d>, must be between 0 (Sunday) and 6", weekday)
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" || timezone == "Local" {
+		return schedule, fmt.Errorf("in ParseSchedule(): invalid timezone<%s>", timezone)
+	}
+	schedule.Location = location
+
+	return schedule, nil
+}
+
+// Returns the length of the period a digest covers
+func (s Schedule) Period() time.Duration {
+	if s.Frequency == Weekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Returns the first send time strictly after t
+func (s Schedule) Next(t time.Time) time.Time {
+	local := t.In(s.Location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, 0, 0, 0, s.Location)
+
+	for !next.After(t) || (s.Frequency == Weekly && next.Weekday() != s.Weekday) {
+		next = time.Date(next.Year(), next.Month(), next.Day()+1, s.Hour, 0, 0, 0, s.Location)
+	}
+
+	return next
+}
+
+// Returns when to retry a digest that has failed failures times in a row at t, after RetryDelay
+// but never later than the next send time. Videos are collected since the last digest that was
+// sent, so the next period's digest includes a skipped one's
+func (s Schedule) Retry(t time.Time, failures int) time.Time {
+	retry := t.Add(RetryDelay(failures))
+	if next := s.Next(t); next.Before(retry) {
+		return next
+	}
+
+	return retry
+}
+
+// Returns the delay before retrying a digest that has failed failures times in a row, 5 minutes
+// doubling each failure up to 6 hours
+func RetryDelay(failures int) time.Duration {
+	delay := 5 * time.Minute
+	for i := 1; i < failures && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+
+	return delay
+}
@@ -0,0 +1,54 @@
+package digest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Returned when an unsubscribe token is malformed or its signature does not match
+var ErrInvalidToken = errors.New("invalid unsubscribe token")
+
+// Signs unsubscribe tokens so a subscription can be cancelled from an email without logging in
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key string) Signer {
+	return Signer{key: []byte(key)}
+}
+
+func (s Signer) mac(subscriptionId int32) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "digest-unsubscribe:%d", subscriptionId)
+	return mac.Sum(nil)
+}
+
+// Returns the unsubscribe token for the subscription
+func (s Signer) Sign(subscriptionId int32) string {
+	return fmt.Sprintf("%d.%s", subscriptionId, base64.RawURLEncoding.EncodeToString(s.mac(subscriptionId)))
+}
+
+// Returns the subscription id the token was signed for. Tokens never verify without a key
+func (s Signer) Verify(token string) (int32, error) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || len(s.key) == 0 {
+		return 0, ErrInvalidToken
+	}
+
+	subscriptionId, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(int32(subscriptionId))) {
+		return 0, ErrInvalidToken
+	}
+
+	return int32(subscriptionId), nil
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys shared by every package so log lines can be filtered consistently
+const (
+	KeyRequestID = "request_id"
+	KeyUserID    = "user_id"
+	KeyRoute     = "route"
+	KeyMethod    = "method"
+	KeyStatus    = "status"
+	KeyLatencyMs = "latency_ms"
+	KeyFeedID    = "feed_id"
+	KeyChannelID = "channel_id"
+	KeyUploadID  = "upload_id"
+	KeyError     = "error"
+	KeyTraceID   = "trace_id"
+	KeySpanID    = "span_id"
+)
+
+type contextKey struct{}
+
+// Returns a logger writing format ("json" or "text") lines at level and above. Unknown levels
+// fall back to info
+func New(w io.Writer, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+
+	if strings.EqualFold(format, "text") {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// Returns the level named by level, info if it is not recognized
+func ParseLevel(level string) slog.Level {
+	var parsed slog.Level
+	err := parsed.UnmarshalText([]byte(level))
+	if err != nil {
+		return slog.LevelInfo
+	}
+
+	return parsed
+}
+
+// Returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Returns the logger carried by ctx, or the default logger if there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+
+	return slog.Default()
+}
+
+// Returns a random 16 byte hex request id
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Returns err as a log attribute
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.String(KeyError, err.Error())
+}
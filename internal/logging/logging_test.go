@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "warn")
+
+	logger.Info("dropped")
+	logger.Warn("kept", KeyChannelID, "UC1", Err(errors.New("boom")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %s", len(lines), buf.String())
+	}
+
+	var entry map[string]any
+	err := json.Unmarshal([]byte(lines[0]), &entry)
+	if err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry["msg"] != "kept" || entry[KeyChannelID] != "UC1" || entry[KeyError] != "boom" {
+		t.Errorf("unexpected log entry: %v", entry)
+	}
+}
+
+func TestNewText(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, "text", "debug").Debug("hello", KeyRoute, "/api/v2/feeds")
+
+	if !strings.Contains(buf.String(), "msg=hello") || !strings.Contains(buf.String(), "route=/api/v2/feeds") {
+		t.Errorf("unexpected text output: %s", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"WARN":  slog.LevelWarn,
+		"error": slog.LevelError,
+		"":      slog.LevelInfo,
+		"loud":  slog.LevelInfo,
+	}
+
+	for level, want := range cases {
+		if got := ParseLevel(level); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", level, got, want)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Errorf("expected the default logger for a context without one")
+	}
+
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	ctx := NewContext(context.Background(), logger)
+	if FromContext(ctx) != logger {
+		t.Errorf("expected the logger carried by the context")
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	first, second := NewRequestID(), NewRequestID()
+	if len(first) != 32 || first == second {
+		t.Errorf("got request ids %q and %q, want distinct 32 character ids", first, second)
+	}
+}
@@ -0,0 +1,148 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Applies the embedded schema migrations. Every change holds a Postgres advisory lock for its
+// duration so instances starting together apply each migration once
+type Migrator struct {
+	provider *goose.Provider
+}
+
+// Returns a Migrator for db using the migrations embedded from sql/schema
+func New(db *sql.DB) (*Migrator, error) {
+	return newMigrator(db, schema.Migrations)
+}
+
+func newMigrator(db *sql.DB, migrations fs.FS) (*Migrator, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("in newMigrator(): error creating session locker: %s", err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations, goose.WithSessionLocker(locker))
+	if err != nil {
+		return nil, fmt.Errorf("in newMigrator(): error loading migrations: %s", err)
+	}
+
+	return &Migrator{provider: provider}, nil
+}
+
+// Returns the version of the newest embedded migration
+func (m *Migrator) Latest() int64 {
+	sources := m.provider.ListSources()
+	return sources[len(sources)-1].Version
+}
+
+// Returns the version of the newest migration applied to the database, 0 if none are
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	version, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("in Version(): %s", err)
+	}
+
+	return version, nil
+}
+
+// Applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	results, err := m.provider.Up(ctx)
+	logResults(ctx, results)
+	if err != nil {
+		return fmt.Errorf("in Up(): %s", err)
+	}
+
+	return nil
+}
+
+// Rolls back the newest applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	result, err := m.provider.Down(ctx)
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		return fmt.Errorf("in Down(): no migrations are applied")
+	}
+	if result != nil {
+		logResults(ctx, []*goose.MigrationResult{result})
+	}
+	if err != nil {
+		return fmt.Errorf("in Down(): %s", err)
+	}
+
+	return nil
+}
+
+// Migrates up or down until version is the newest applied migration, 0 rolls back every
+// migration
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version < 0 || version > m.Latest() {
+		return fmt.Errorf("in To(): version<%d> must be between 0 and %d", version, m.Latest())
+	}
+
+	current, err := m.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("in To(): %s", err)
+	}
+
+	var results []*goose.MigrationResult
+	switch {
+	case version > current:
+		results, err = m.provider.UpTo(ctx, version)
+	case version < current:
+		results, err = m.provider.DownTo(ctx, version)
+	}
+	logResults(ctx, results)
+	if err != nil {
+		return fmt.Errorf("in To(): %s", err)
+	}
+
+	return nil
+}
+
+// Writes each migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context, w io.Writer) error {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("in Status(): %s", err)
+	}
+
+	fmt.Fprintf(w, "%-8s %-40s %-8s %s\n", "VERSION", "MIGRATION", "STATE", "APPLIED AT")
+	for _, status := range statuses {
+		appliedAt := ""
+		if status.State == goose.StateApplied {
+			appliedAt = status.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%-8d %-40s %-8s %s\n", status.Source.Version, filepath.Base(status.Source.Path), status.State, appliedAt)
+	}
+
+	return nil
+}
+
+// Logs each migration that was applied or rolled back, including a failed one
+func logResults(ctx context.Context, results []*goose.MigrationResult) {
+	logger := logging.FromContext(ctx)
+	for _, result := range results {
+		attrs := []any{
+			"version", result.Source.Version,
+			"migration", filepath.Base(result.Source.Path),
+			"direction", result.Direction,
+			"duration_ms", result.Duration.Milliseconds(),
+		}
+		if result.Error != nil {
+			logger.Error("migration failed", append(attrs, logging.Err(result.Error))...)
+			continue
+		}
+		logger.Info("migration applied", attrs...)
+	}
+}
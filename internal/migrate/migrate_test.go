@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/luke-mayer/youtube-custom-feeds/sql/schema"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	// opening does not connect, loading the migrations only reads the embedded files
+	db, err := sql.Open("postgres", "host=localhost dbname=unused sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	files, err := fs.Glob(schema.Migrations, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := migrator.Latest(); got != int64(len(files)) {
+		t.Errorf("got latest version %d, want %d, one per embedded file", got, len(files))
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(schema.Migrations, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "-- +goose Down") {
+			t.Errorf("%s has no down migration", file)
+		}
+	}
+}
+
+// Migrates a scratch database named by TEST_DATABASE_URL all the way up, down and up again.
+// The database must be empty, every table is dropped on the way down
+func TestMigrateUpDown(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	wantVersion := func(want int64) {
+		t.Helper()
+		got, err := migrator.Version(ctx)
+		if err != nil {
+			t.Fatalf("Version() error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("got version %d, want %d", got, want)
+		}
+	}
+
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	wantVersion(migrator.Latest())
+
+	if err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down() error: %v", err)
+	}
+	wantVersion(migrator.Latest() - 1)
+
+	if err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("To(0) error: %v", err)
+	}
+	wantVersion(0)
+
+	var tables int
+	err = db.QueryRowContext(ctx, "SELECT count(*) FROM information_schema.tables WHERE table_schema = 'public' AND table_name <> 'goose_db_version'").Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("got %d tables after migrating down, want none", tables)
+	}
+
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() after migrating down error: %v", err)
+	}
+	wantVersion(migrator.Latest())
+
+	var status bytes.Buffer
+	if err := migrator.Status(ctx, &status); err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if strings.Contains(status.String(), "pending") {
+		t.Errorf("got pending migrations after Up():\n%s", status.String())
+	}
+}
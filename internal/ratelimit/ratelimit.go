@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// How often buckets that have refilled completely are removed
+const cleanupInterval = time.Minute
+
+// Token bucket rate limiter keyed by arbitrary strings (user ids, client ips, etc.,)
+type Limiter struct {
+	mu          sync.Mutex
+	rate        float64 // tokens added per second
+	burst       float64 // max tokens held by a bucket
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Creates a limiter allowing perMinute requests per key on average, with bursts of up to burst requests
+func NewLimiter(perMinute, burst int) *Limiter {
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(max(burst, 1)),
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Takes a token from the bucket of every key. If any bucket is empty no tokens are taken and
+// the time until all buckets have a token is returned
+func (l *Limiter) Allow(keys ...string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	var wait time.Duration
+	for _, key := range keys {
+		b := l.refill(key, now)
+		if b.tokens < 1 {
+			wait = max(wait, l.timeUntilToken(b))
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+
+	for _, key := range keys {
+		l.buckets[key].tokens--
+	}
+
+	return true, 0
+}
+
+// Returns the key's bucket topped up with the tokens accrued since it was last used
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	b.last = now
+
+	return b
+}
+
+func (l *Limiter) timeUntilToken(b *bucket) time.Duration {
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	seconds := (1 - b.tokens) / l.rate
+
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+// Removes buckets that would be full by now, they behave the same as a new bucket
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	current time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.current
+}
+
+func newTestLimiter(perMinute, burst int) (*Limiter, *testClock) {
+	clock := &testClock{current: time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(perMinute, burst)
+	limiter.now = clock.now
+
+	return limiter, clock
+}
+
+func TestAllowBurstThenRefill(t *testing.T) {
+	limiter, clock := newTestLimiter(60, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("user"); !ok {
+			t.Fatalf("request %d should be allowed within the burst", i)
+		}
+	}
+
+	ok, wait := limiter.Allow("user")
+	if ok {
+		t.Fatal("request after the burst should be limited")
+	}
+	if wait != time.Second {
+		t.Errorf("got wait %v, want 1s", wait)
+	}
+
+	clock.current = clock.current.Add(time.Second)
+	if ok, _ := limiter.Allow("user"); !ok {
+		t.Error("request should be allowed after a token is refilled")
+	}
+}
+
+func TestAllowKeysAreIndependent(t *testing.T) {
+	limiter, _ := newTestLimiter(60, 1)
+
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatal("first request for a should be allowed")
+	}
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Error("first request for b should be allowed")
+	}
+}
+
+func TestAllowMultipleKeysTakesNothingWhenLimited(t *testing.T) {
+	limiter, _ := newTestLimiter(60, 1)
+
+	limiter.Allow("ip")
+	if ok, _ := limiter.Allow("user", "ip"); ok {
+		t.Fatal("request should be limited by the ip bucket")
+	}
+	if ok, _ := limiter.Allow("user"); !ok {
+		t.Error("user bucket should not have been drained by the limited request")
+	}
+}
+
+func TestCleanupRemovesFullBuckets(t *testing.T) {
+	limiter, clock := newTestLimiter(60, 2)
+
+	limiter.Allow("user")
+	clock.current = clock.current.Add(2 * cleanupInterval)
+	limiter.Allow("other")
+
+	if _, ok := limiter.buckets["user"]; ok {
+		t.Error("refilled bucket should have been removed")
+	}
+}
@@ -0,0 +1,177 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventVideo         = "video"         // a newly detected video
+	EventChannelStatus = "channelStatus" // a channel's load status changed
+)
+
+// An event about a single channel. IDs increase monotonically, they start from the hub's
+// creation time so ids issued before a restart are never mistaken for newer ones
+type Event struct {
+	ID        uint64
+	Type      string
+	ChannelID string
+	Data      json.RawMessage
+}
+
+// A subscriber's interest, feed ids keyed by the channel ids in those feeds
+type Channels map[string][]int32
+
+type Subscription struct {
+	Events   <-chan Event // closed when the subscriber falls too far behind or the hub drops it
+	Channels Channels
+	events   chan Event
+}
+
+// Fans events out to every subscriber interested in the event's channel. A bounded history of
+// recent events is kept so subscribers can resume with Last-Event-ID after reconnecting
+type Hub struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	historySize int
+	bufferSize  int
+	subscribers map[*Subscription]bool
+	closed      bool
+}
+
+// Creates a hub remembering historySize events, each subscriber may have up to bufferSize
+// undelivered events before it is dropped
+func NewHub(historySize, bufferSize int) *Hub {
+	return &Hub{
+		nextID:      uint64(time.Now().UnixMilli()) * 1000,
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// Publishes an event of eventType about the channel, data is marshaled as the event's payload
+func (h *Hub) Publish(eventType, channelId string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("in Publish(): error marshaling %s event: %s", eventType, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	h.deliverLocked(Event{ID: h.nextID, Type: eventType, ChannelID: channelId, Data: payload})
+
+	return nil
+}
+
+// Delivers an event whose id was assigned elsewhere, used when events are shared between
+// instances so every instance replays them under the same ids. A hub should either publish or
+// deliver its events, not both
+func (h *Hub) Deliver(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID = max(h.nextID, event.ID)
+	h.deliverLocked(event)
+}
+
+func (h *Hub) deliverLocked(event Event) {
+	h.history = append(h.history, event)
+	if len(h.history) > h.historySize {
+		h.history = h.history[len(h.history)-h.historySize:]
+	}
+
+	for sub := range h.subscribers {
+		if _, ok := sub.Channels[event.ChannelID]; !ok {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// lagging subscribers reconnect and resume from their last event
+			h.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribes to events about channels. If lastEventId is set the missed events are returned for
+// replay, reset is true when they are no longer all in the history (or the id is not recognised)
+// and the subscriber should reload instead
+func (h *Hub) Subscribe(channels Channels, lastEventId string) (sub *Subscription, missed []Event, reset bool) {
+	events := make(chan Event, h.bufferSize)
+	sub = &Subscription{Events: events, Channels: channels, events: events}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(events)
+		return sub, nil, false
+	}
+	h.subscribers[sub] = true
+
+	if lastEventId == "" {
+		return sub, nil, false
+	}
+
+	lastID, err := strconv.ParseUint(lastEventId, 10, 64)
+	if err != nil || lastID > h.nextID {
+		return sub, nil, true
+	}
+	if len(h.history) > 0 && h.history[0].ID > lastID+1 {
+		reset = true
+	}
+	if len(h.history) == 0 && lastID < h.nextID {
+		reset = true
+	}
+
+	for _, event := range h.history {
+		if _, ok := channels[event.ChannelID]; ok && event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+
+	return sub, missed, reset
+}
+
+// Stops delivering events to the subscription
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(sub)
+}
+
+func (h *Hub) removeLocked(sub *Subscription) {
+	if h.subscribers[sub] {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Drops every subscriber and closes the events channel of any later subscription, used so open
+// streams end when the server shuts down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscribers {
+		h.removeLocked(sub)
+	}
+}
+
+// Returns the number of connected subscribers
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"strconv"
+	"testing"
+)
+
+func receive(t *testing.T, sub *Subscription) []Event {
+	t.Helper()
+
+	events := []Event{}
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestPublishFansOutByChannel(t *testing.T) {
+	hub := NewHub(10, 10)
+
+	music, _, _ := hub.Subscribe(Channels{"UC1": {1}, "UC2": {1}}, "")
+	news, _, _ := hub.Subscribe(Channels{"UC3": {2}}, "")
+	everything, _, _ := hub.Subscribe(Channels{"UC1": {1, 3}, "UC3": {2}}, "")
+
+	hub.Publish(EventVideo, "UC1", map[string]string{"id": "v1"})
+	hub.Publish(EventVideo, "UC3", map[string]string{"id": "v2"})
+
+	if got := receive(t, music); len(got) != 1 || got[0].ChannelID != "UC1" {
+		t.Errorf("music subscriber got %v, want the UC1 event", got)
+	}
+	if got := receive(t, news); len(got) != 1 || got[0].ChannelID != "UC3" {
+		t.Errorf("news subscriber got %v, want the UC3 event", got)
+	}
+	got := receive(t, everything)
+	if len(got) != 2 || got[0].ID >= got[1].ID {
+		t.Errorf("subscriber to both got %v, want both events in order", got)
+	}
+	if string(got[0].Data) != `{"id":"v1"}` {
+		t.Errorf("got data %s", got[0].Data)
+	}
+}
+
+func TestSubscribeReplaysMissedEvents(t *testing.T) {
+	hub := NewHub(10, 10)
+	channels := Channels{"UC1": {1}}
+
+	first, _, _ := hub.Subscribe(channels, "")
+	hub.Publish(EventVideo, "UC1", "v1")
+	seen := receive(t, first)
+	hub.Unsubscribe(first)
+
+	hub.Publish(EventVideo, "UC1", "v2")
+	hub.Publish(EventVideo, "UC2", "other channel")
+	hub.Publish(EventChannelStatus, "UC1", "failed")
+
+	_, missed, reset := hub.Subscribe(channels, strconv.FormatUint(seen[0].ID, 10))
+	if reset {
+		t.Errorf("resume within the history should not reset")
+	}
+	if len(missed) != 2 || missed[0].Type != EventVideo || missed[1].Type != EventChannelStatus {
+		t.Errorf("got missed events %v, want the UC1 video and status events", missed)
+	}
+}
+
+func TestSubscribeResetsWhenHistoryIsGone(t *testing.T) {
+	hub := NewHub(2, 10)
+	channels := Channels{"UC1": {1}}
+
+	first, _, _ := hub.Subscribe(channels, "")
+	hub.Publish(EventVideo, "UC1", "v1")
+	seen := receive(t, first)
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(EventVideo, "UC1", i)
+	}
+
+	cases := map[string]string{
+		"evicted from history": strconv.FormatUint(seen[0].ID, 10),
+		"previous process":     "5",
+		"from the future":      strconv.FormatUint(seen[0].ID+100, 10),
+		"malformed":            "abc",
+	}
+	for name, lastEventId := range cases {
+		if _, _, reset := hub.Subscribe(channels, lastEventId); !reset {
+			t.Errorf("%s: Last-Event-ID %s should reset", name, lastEventId)
+		}
+	}
+}
+
+func TestDeliverKeepsGivenIds(t *testing.T) {
+	hub := NewHub(10, 10)
+	channels := Channels{"UC1": {1}}
+
+	live, _, _ := hub.Subscribe(channels, "")
+	hub.Deliver(Event{ID: 5, Type: EventVideo, ChannelID: "UC1", Data: []byte(`"v1"`)})
+	hub.Deliver(Event{ID: 6, Type: EventVideo, ChannelID: "UC1", Data: []byte(`"v2"`)})
+
+	if got := receive(t, live); len(got) != 2 || got[0].ID != 5 || got[1].ID != 6 {
+		t.Errorf("got %v, want events 5 and 6", got)
+	}
+
+	_, missed, reset := hub.Subscribe(channels, "5")
+	if reset || len(missed) != 1 || missed[0].ID != 6 {
+		t.Errorf("got missed %v and reset %v, want event 6 replayed", missed, reset)
+	}
+	if _, _, reset := hub.Subscribe(channels, "2"); !reset {
+		t.Errorf("events delivered before the hub started should reset")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	hub := NewHub(10, 1)
+	sub, _, _ := hub.Subscribe(Channels{"UC1": {1}}, "")
+
+	hub.Publish(EventVideo, "UC1", "v1")
+	hub.Publish(EventVideo, "UC1", "v2")
+
+	if hub.Subscribers() != 0 {
+		t.Errorf("lagging subscriber should be removed")
+	}
+	if got := receive(t, sub); len(got) != 1 {
+		t.Errorf("got %d buffered events, want 1 then the closed channel", len(got))
+	}
+
+	hub.Unsubscribe(sub) // already removed, must not panic
+}
+
+// Returns true if the subscription's events channel has been closed
+func isClosed(sub *Subscription) bool {
+	select {
+	case _, ok := <-sub.Events:
+		return !ok
+	default:
+		return false
+	}
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	hub := NewHub(10, 10)
+	sub, _, _ := hub.Subscribe(Channels{"UC1": {1}}, "")
+
+	hub.Close()
+	if !isClosed(sub) || hub.Subscribers() != 0 {
+		t.Errorf("expected Close to drop the subscription")
+	}
+
+	late, _, _ := hub.Subscribe(Channels{"UC1": {1}}, "")
+	if !isClosed(late) {
+		t.Errorf("expected a subscription made after Close to be closed")
+	}
+	hub.Unsubscribe(late)
+}
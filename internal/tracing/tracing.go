@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Where finished spans are sent
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+type Options struct {
+	Exporter    string
+	Endpoint    string // OTLP/HTTP collector URL, the exporter's default (or OTEL_EXPORTER_OTLP_* variables) when empty
+	ServiceName string
+	SampleRatio float64   // fraction of root traces kept, children follow their parent's decision
+	Output      io.Writer // stdout exporter destination, os.Stdout when nil
+}
+
+// Installs the global tracer provider and W3C trace context propagator. The returned function
+// flushes pending spans and stops the exporter, it does nothing when the exporter is none
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporterOpts := []otlptracehttp.Option{}
+		if opts.Endpoint != "" {
+			exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, exporterOpts...)
+	case ExporterStdout:
+		output := opts.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	default:
+		return nil, fmt.Errorf("in Setup(): unknown exporter<%s>", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("in Setup(): error creating %s exporter: %s", opts.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", opts.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("in Setup(): error building resource: %s", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Returns a tracer from the global provider, spans are dropped until Setup installs an exporter
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Returns the trace and span ids of the span carried by ctx
+func IDs(ctx context.Context) (traceId string, spanId string, ok bool) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return "", "", false
+	}
+
+	return spanContext.TraceID().String(), spanContext.SpanID().String(), true
+}
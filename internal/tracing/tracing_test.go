@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSetupStdoutExportsSpans(t *testing.T) {
+	var buf bytes.Buffer
+	shutdown, err := Setup(context.Background(), Options{
+		Exporter:    ExporterStdout,
+		ServiceName: "tracing-test",
+		SampleRatio: 1,
+		Output:      &buf,
+	})
+	if err != nil {
+		t.Fatalf("Setup() error: %v", err)
+	}
+
+	ctx, span := Tracer("test").Start(context.Background(), "work")
+	traceId, spanId, ok := IDs(ctx)
+	if !ok || traceId == "" || spanId == "" {
+		t.Errorf("got ids %q %q %v, want the span's ids", traceId, spanId, ok)
+	}
+	span.End()
+
+	err = shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+	for _, want := range []string{`"Name":"work"`, traceId, "tracing-test"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("exported output does not contain %s", want)
+		}
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Options{Exporter: "zipkin"})
+	if err == nil {
+		t.Errorf("expected an error for an unknown exporter")
+	}
+}
+
+func TestIDsWithoutSpan(t *testing.T) {
+	if _, _, ok := IDs(context.Background()); ok {
+		t.Errorf("expected no ids without a span")
+	}
+}
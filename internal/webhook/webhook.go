@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const EventVideoPublished = "video.published"
+
+// Minimum length of a secret provided when registering a webhook
+const MinSecretLength = 16
+
+// A new video in a feed, the body of a delivery
+type Payload struct {
+	Event      string    `json:"event"`
+	DeliveryID int64     `json:"deliveryId"`
+	WebhookID  int32     `json:"webhookId"`
+	FeedID     int32     `json:"feedId"`
+	Video      VideoJSON `json:"video"`
+}
+
+type VideoJSON struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	ChannelID    string    `json:"channelId"`
+	Channel      string    `json:"channel"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailURL"`
+	PublishedAt  time.Time `json:"publishedAt"`
+}
+
+// Result of a single delivery attempt
+type Attempt struct {
+	StatusCode int // 0 if no response was received
+	Duration   time.Duration
+	Err        error
+}
+
+// Returns a random secret for signing deliveries
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", fmt.Errorf("in NewSecret(): %s", err)
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// Validates a webhook url, only absolute http and https urls are accepted. Hosts that are
+// localhost or a non-public ip address are rejected, names resolving to one are refused when
+// dialed by a client from NewClient
+func ValidateURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("in ValidateURL(): %s", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("in ValidateURL(): url<%s> must be an absolute http or https url", rawURL)
+	}
+
+	host := parsed.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("in ValidateURL(): url<%s> must not point at localhost", rawURL)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err == nil && !isPublic(addr) {
+		return fmt.Errorf("in ValidateURL(): url<%s> must not point at a non-public address", rawURL)
+	}
+
+	return nil
+}
+
+// Validates a secret provided when registering a webhook
+func ValidateSecret(secret string) error {
+	if len(secret) < MinSecretLength {
+		return fmt.Errorf("in ValidateSecret(): secret must be at least %d characters", MinSecretLength)
+	}
+
+	return nil
+}
+
+// Reports whether addr is a public unicast address. Loopback, private, link-local (including
+// the cloud metadata address 169.254.169.254), multicast and unspecified addresses are not
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() &&
+		!cgnat.Contains(addr)
+}
+
+// Carrier-grade NAT range, shared address space that is not reachable from the internet
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// Refuses connections to non-public addresses, checked after the host is resolved so names
+// pointing at internal addresses are refused too
+func dialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("in dialControl(): %s", err)
+	}
+	if !isPublic(addrPort.Addr()) {
+		return fmt.Errorf("in dialControl(): refusing to connect to non-public address %s", addrPort.Addr())
+	}
+
+	return nil
+}
+
+// Returns a client for delivering webhooks. It only connects to public addresses and does not
+// follow redirects, a redirect response counts as a failed delivery
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Returns the signature of body sent at timestamp, "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// POSTs the signed body to the webhook, giving up once ctx is done. Any 2xx response is a success
+func Deliver(ctx context.Context, client *http.Client, webhookURL, secret string, deliveryId int64, body []byte, now time.Time) Attempt {
+	timestamp := now.Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return Attempt{Err: fmt.Errorf("in Deliver(): error creating request: %s", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "youtube-custom-feeds-webhooks")
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(deliveryId, 10))
+	req.Header.Set(HeaderEvent, EventVideoPublished)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	start := time.Now()
+	res, err := client.Do(req)
+	attempt := Attempt{Duration: time.Since(start)}
+	if err != nil {
+		attempt.Err = fmt.Errorf("in Deliver(): %s", err)
+		return attempt
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Err = fmt.Errorf("in Deliver(): unexpected status %d", res.StatusCode)
+	}
+
+	return attempt
+}
+
+// Returned by Backoff once a delivery has used all of its attempts
+var ErrGaveUp = errors.New("webhook delivery gave up")
+
+// Returns the delay before retrying a delivery that has failed attempts times: 30s doubling each
+// attempt up to 6h
+func Backoff(attempts, maxAttempts int) (time.Duration, error) {
+	if attempts >= maxAttempts {
+		return 0, ErrGaveUp
+	}
+
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+
+	return delay, nil
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeliverSignsBody(t *testing.T) {
+	body := []byte(`{"event":"video.published"}`)
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+
+		if timestamp != now.Unix() || r.Header.Get(HeaderDelivery) != "42" || r.Header.Get(HeaderEvent) != EventVideoPublished {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if r.Header.Get(HeaderSignature) != Sign("secret", timestamp, received) {
+			t.Errorf("signature does not match the body")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	attempt := Deliver(context.Background(), server.Client(), server.URL, "secret", 42, body, now)
+	if attempt.Err != nil || attempt.StatusCode != http.StatusNoContent {
+		t.Errorf("got %d, %v, want 204 and no error", attempt.StatusCode, attempt.Err)
+	}
+}
+
+func TestDeliverFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	attempt := Deliver(context.Background(), server.Client(), server.URL, "secret", 1, []byte(`{}`), time.Now())
+	if attempt.Err == nil || attempt.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got %d, %v, want 500 and an error", attempt.StatusCode, attempt.Err)
+	}
+
+	server.Close()
+	attempt = Deliver(context.Background(), server.Client(), server.URL, "secret", 1, []byte(`{}`), time.Now())
+	if attempt.Err == nil || attempt.StatusCode != 0 {
+		t.Errorf("got %d, %v, want no response and an error", attempt.StatusCode, attempt.Err)
+	}
+}
+
+func TestDeliverStopsWhenContextDone(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	attempt := Deliver(ctx, server.Client(), server.URL, "secret", 1, []byte(`{}`), time.Now())
+	if attempt.Err == nil || attempt.Duration > 5*time.Second {
+		t.Errorf("got %v after %v, want the request cancelled with ctx", attempt.Err, attempt.Duration)
+	}
+}
+
+func TestSignDependsOnSecretAndTimestamp(t *testing.T) {
+	body := []byte(`{}`)
+	signature := Sign("secret", 1, body)
+
+	if signature == Sign("other", 1, body) || signature == Sign("secret", 2, body) {
+		t.Errorf("signature should change with the secret and timestamp")
+	}
+	if len(signature) != len("sha256=")+64 {
+		t.Errorf("got signature %q", signature)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{12, 6 * time.Hour},
+	}
+
+	for _, c := range cases {
+		got, err := Backoff(c.attempts, 20)
+		if err != nil || got != c.want {
+			t.Errorf("Backoff(%d) = %v, %v, want %v", c.attempts, got, err, c.want)
+		}
+	}
+
+	if _, err := Backoff(8, 8); err != ErrGaveUp {
+		t.Errorf("Backoff() after the last attempt = %v, want ErrGaveUp", err)
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for _, valid := range []string{"https://example.com/hook", "http://example.com:8080/hook", "https://8.8.8.8/hook"} {
+		if err := ValidateURL(valid); err != nil {
+			t.Errorf("ValidateURL(%q) = %v", valid, err)
+		}
+	}
+	invalid := []string{
+		"", "example.com/hook", "ftp://example.com", "https://",
+		"http://localhost:8080/hook", "http://127.0.0.1/hook", "http://10.0.0.5/hook", "http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://0.0.0.0/hook", "http://[fd00::1]/hook",
+	}
+	for _, rawURL := range invalid {
+		if err := ValidateURL(rawURL); err == nil {
+			t.Errorf("ValidateURL(%q) should fail", rawURL)
+		}
+	}
+}
+
+func TestValidateSecret(t *testing.T) {
+	if err := ValidateSecret("hunter2"); err == nil {
+		t.Errorf("ValidateSecret() accepted a short secret")
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSecret(secret); err != nil {
+		t.Errorf("ValidateSecret() rejected a generated secret: %v", err)
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("delivery reached a loopback server")
+	}))
+	defer server.Close()
+
+	attempt := Deliver(context.Background(), NewClient(time.Second), server.URL, "secret", 1, []byte(`{}`), time.Now())
+	if attempt.Err == nil || attempt.StatusCode != 0 {
+		t.Errorf("got attempt %+v, want the connection refused", attempt)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("redirect was followed")
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	client := NewClient(time.Second)
+	// the test servers listen on loopback, only the redirect policy is under test
+	client.Transport = server.Client().Transport
+
+	attempt := Deliver(context.Background(), client, server.URL, "secret", 1, []byte(`{}`), time.Now())
+	if attempt.StatusCode != http.StatusTemporaryRedirect || attempt.Err == nil {
+		t.Errorf("got attempt %+v, want the redirect reported as a failure", attempt)
+	}
+}
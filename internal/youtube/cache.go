@@ -0,0 +1,78 @@
+package youtube
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Most recent videos successfully retrieved for each channel, served instead of calling
+// the API when the quota budget is running low or the API is unavailable
+type videoCache struct {
+	mu      sync.RWMutex
+	entries map[string]cachedVideos // keyed by uploadId
+}
+
+type cachedVideos struct {
+	videos    []Video
+	fetchedAt time.Time
+}
+
+var channelCache = &videoCache{entries: map[string]cachedVideos{}}
+
+// Returns the cached videos for the channel and when they were retrieved
+func (c *videoCache) get(uploadId string) ([]Video, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[uploadId]
+	getMetrics().CacheLookup(ok)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	return slices.Clone(entry.videos), entry.fetchedAt, true
+}
+
+func (c *videoCache) set(uploadId string, videos []Video) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[uploadId] = cachedVideos{
+		videos:    slices.Clone(videos),
+		fetchedAt: time.Now(),
+	}
+}
+
+// How long a channel confirmed to exist by checkDeadChannel is not checked again
+const aliveChannelTTL = 6 * time.Hour
+
+// Channels whose uploads could not be retrieved but which channels.list recently returned, so
+// loading a channel without uploads does not call channels.list every time
+type aliveChannelCache struct {
+	mu        sync.Mutex
+	checkedAt map[string]time.Time // keyed by channelId
+}
+
+var aliveChannels = &aliveChannelCache{checkedAt: map[string]time.Time{}}
+
+// Returns whether the channel was confirmed to exist within the last aliveChannelTTL
+func (c *aliveChannelCache) confirmed(channelId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	checkedAt, ok := c.checkedAt[channelId]
+	if ok && time.Since(checkedAt) >= aliveChannelTTL {
+		delete(c.checkedAt, channelId)
+		return false
+	}
+
+	return ok
+}
+
+func (c *aliveChannelCache) confirm(channelId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkedAt[channelId] = time.Now()
+}
@@ -0,0 +1,22 @@
+package youtube
+
+// Whether the client can currently make API calls
+type Health struct {
+	Configured  bool        `json:"configured"` // an API key or endpoint override is set
+	CircuitOpen bool        `json:"circuitOpen"`
+	Quota       QuotaStatus `json:"quota"`
+}
+
+// Returns true if API calls are currently being made
+func (h Health) OK() bool {
+	return h.Configured && !h.CircuitOpen && h.Quota != QuotaExhausted
+}
+
+// Returns the current health of the client
+func GetHealth() Health {
+	return Health{
+		Configured:  getApiKey() != "" || apiEndpoint != "",
+		CircuitOpen: CircuitOpen(),
+		Quota:       GetQuotaStatus(),
+	}
+}
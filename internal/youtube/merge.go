@@ -0,0 +1,175 @@
+package youtube
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Determines how the videos of each channel in a feed are merged into one list
+type MergeStrategy string
+
+const (
+	MergeByDate     MergeStrategy = "date"       // newest first, regardless of channel
+	MergeCapped     MergeStrategy = "capped"     // newest first, limited videos per channel within a time window
+	MergeRoundRobin MergeStrategy = "roundrobin" // one video from each channel in turn
+	MergeWeighted   MergeStrategy = "weighted"   // round robin, each channel taking as many videos per turn as its priority
+)
+
+// Options used when merging channel videos into a feed
+type MergeOptions struct {
+	Strategy MergeStrategy
+	Cap      int           // MergeCapped: max videos per channel within Window
+	Window   time.Duration // MergeCapped: length of the time window
+}
+
+// A channel in a feed along with its priority (used by MergeWeighted)
+type FeedChannel struct {
+	ChannelId  string
+	Handle     string
+	UploadId   string
+	Priority   int32
+	DeadReason string // set for channels known to be deleted or terminated, these are not polled
+}
+
+// Converts a string into a MergeStrategy, returns error if it is not a known strategy
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	strategy := MergeStrategy(s)
+	switch strategy {
+	case MergeByDate, MergeCapped, MergeRoundRobin, MergeWeighted:
+		return strategy, nil
+	}
+
+	return "", fmt.Errorf("in ParseMergeStrategy(): unknown merge strategy<%s>", s)
+}
+
+// Merges the videos of each channel into a single slice according to the provided options.
+// channelVideos and priorities are keyed by uploadId.
+func mergeVideos(channelVideos map[string][]Video, priorities map[string]int32, opts MergeOptions) []Video {
+	switch opts.Strategy {
+	case MergeCapped:
+		return mergeCapped(channelVideos, opts.Cap, opts.Window)
+	case MergeRoundRobin:
+		return mergeRoundRobin(channelVideos, nil)
+	case MergeWeighted:
+		return mergeRoundRobin(channelVideos, priorities)
+	default:
+		return mergeByDate(channelVideos)
+	}
+}
+
+// Merges all videos in descending order by publication date
+func mergeByDate(channelVideos map[string][]Video) []Video {
+	allVideos := []Video{}
+	for _, videos := range channelVideos {
+		allVideos = append(allVideos, videos...)
+	}
+	sortByDate(allVideos)
+
+	return allVideos
+}
+
+// Merges videos by date, but once a channel has perWindow videos within window any further videos
+// from that channel in the same window are moved to the end of the feed (still sorted by date)
+func mergeCapped(channelVideos map[string][]Video, perWindow int, window time.Duration) []Video {
+	if perWindow < 1 || window <= 0 {
+		return mergeByDate(channelVideos)
+	}
+
+	type channelVideo struct {
+		uploadId string
+		video    Video
+	}
+
+	sorted := []channelVideo{}
+	for uploadId, videos := range channelVideos {
+		for _, v := range videos {
+			sorted = append(sorted, channelVideo{uploadId: uploadId, video: v})
+		}
+	}
+	slices.SortStableFunc(sorted, func(a, b channelVideo) int {
+		return a.video.PublishedAt.Compare(b.video.PublishedAt) * -1
+	})
+
+	accepted := []Video{}
+	overflow := []Video{}
+	acceptedTimes := map[string][]time.Time{} // accepted publication times per channel
+
+	for _, cv := range sorted {
+		times := acceptedTimes[cv.uploadId]
+		inWindow := 0
+		for _, t := range times {
+			if t.Sub(cv.video.PublishedAt) < window {
+				inWindow++
+			}
+		}
+
+		if inWindow >= perWindow {
+			overflow = append(overflow, cv.video)
+			continue
+		}
+
+		acceptedTimes[cv.uploadId] = append(times, cv.video.PublishedAt)
+		accepted = append(accepted, cv.video)
+	}
+
+	return append(accepted, overflow...)
+}
+
+// Merges videos by taking turns between channels. Each turn a channel contributes its priority
+// worth of videos (or one video if priorities is nil). Within a round, channels with the most
+// recent next video go first.
+func mergeRoundRobin(channelVideos map[string][]Video, priorities map[string]int32) []Video {
+	queues := map[string][]Video{}
+	uploadIds := []string{}
+	total := 0
+	for uploadId, videos := range channelVideos {
+		if len(videos) == 0 {
+			continue
+		}
+		queue := slices.Clone(videos)
+		sortByDate(queue)
+		queues[uploadId] = queue
+		uploadIds = append(uploadIds, uploadId)
+		total += len(queue)
+	}
+
+	merged := make([]Video, 0, total)
+	for len(merged) < total {
+		slices.SortFunc(uploadIds, func(a, b string) int {
+			if c := compareNextVideo(queues[a], queues[b]); c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		})
+
+		for _, uploadId := range uploadIds {
+			take := 1
+			if priorities != nil {
+				take = max(int(priorities[uploadId]), 1)
+			}
+			take = min(take, len(queues[uploadId]))
+
+			merged = append(merged, queues[uploadId][:take]...)
+			queues[uploadId] = queues[uploadId][take:]
+		}
+	}
+
+	return merged
+}
+
+// Orders two channel queues so the one with the more recent next video comes first,
+// empty queues are placed last
+func compareNextVideo(a, b []Video) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	return a[0].PublishedAt.Compare(b[0].PublishedAt) * -1
+}
@@ -0,0 +1,110 @@
+package youtube
+
+import (
+	"log"
+	"testing"
+	"time"
+)
+
+// Builds videos for a channel, published hoursAgo hours before base
+func testChannelVideos(channel string, base time.Time, hoursAgo ...int) []Video {
+	videos := []Video{}
+	for i, h := range hoursAgo {
+		videos = append(videos, Video{
+			ChannelName: channel,
+			VideoId:     channel + string(rune('a'+i)),
+			PublishedAt: base.Add(-time.Duration(h) * time.Hour),
+		})
+	}
+
+	return videos
+}
+
+func videoIds(videos []Video) []string {
+	ids := []string{}
+	for _, v := range videos {
+		ids = append(ids, v.VideoId)
+	}
+
+	return ids
+}
+
+func sameIds(got []Video, want []string) bool {
+	ids := videoIds(got)
+	if len(ids) != len(want) {
+		return false
+	}
+	for i := range ids {
+		if ids[i] != want[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func testFeed() map[string][]Video {
+	base := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	return map[string][]Video{
+		"prolific": testChannelVideos("P", base, 1, 2, 3, 4, 5),
+		"weekly":   testChannelVideos("W", base, 6, 30),
+		"rare":     testChannelVideos("R", base, 100),
+	}
+}
+
+func TestMergeByDate(t *testing.T) {
+	videos := mergeVideos(testFeed(), nil, MergeOptions{Strategy: MergeByDate})
+
+	want := []string{"Pa", "Pb", "Pc", "Pd", "Pe", "Wa", "Wb", "Ra"}
+	if !sameIds(videos, want) {
+		log.Printf("in TestMergeByDate: got %v, want %v", videoIds(videos), want)
+		t.Fail()
+	}
+}
+
+func TestMergeCapped(t *testing.T) {
+	opts := MergeOptions{Strategy: MergeCapped, Cap: 2, Window: 24 * time.Hour}
+	videos := mergeVideos(testFeed(), nil, opts)
+
+	want := []string{"Pa", "Pb", "Wa", "Wb", "Ra", "Pc", "Pd", "Pe"}
+	if !sameIds(videos, want) {
+		log.Printf("in TestMergeCapped: got %v, want %v", videoIds(videos), want)
+		t.Fail()
+	}
+}
+
+func TestMergeRoundRobin(t *testing.T) {
+	videos := mergeVideos(testFeed(), nil, MergeOptions{Strategy: MergeRoundRobin})
+
+	want := []string{"Pa", "Wa", "Ra", "Pb", "Wb", "Pc", "Pd", "Pe"}
+	if !sameIds(videos, want) {
+		log.Printf("in TestMergeRoundRobin: got %v, want %v", videoIds(videos), want)
+		t.Fail()
+	}
+}
+
+func TestMergeWeighted(t *testing.T) {
+	priorities := map[string]int32{"prolific": 1, "weekly": 2, "rare": 1}
+	videos := mergeVideos(testFeed(), priorities, MergeOptions{Strategy: MergeWeighted})
+
+	want := []string{"Pa", "Wa", "Wb", "Ra", "Pb", "Pc", "Pd", "Pe"}
+	if !sameIds(videos, want) {
+		log.Printf("in TestMergeWeighted: got %v, want %v", videoIds(videos), want)
+		t.Fail()
+	}
+}
+
+func TestParseMergeStrategy(t *testing.T) {
+	for _, s := range []string{"date", "capped", "roundrobin", "weighted"} {
+		if _, err := ParseMergeStrategy(s); err != nil {
+			log.Printf("in TestParseMergeStrategy: unexpected error for %s: %v", s, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := ParseMergeStrategy("random"); err == nil {
+		log.Println("in TestParseMergeStrategy: expected error for unknown strategy")
+		t.Fail()
+	}
+}
@@ -0,0 +1,51 @@
+package youtube
+
+import (
+	"sync"
+	"time"
+)
+
+// Result reported for API calls that succeeded, failed calls report their ErrorKind
+const ResultOK = "ok"
+
+// Result reported for API calls refused because the circuit breaker is open
+const ResultCircuitOpen = "circuitOpen"
+
+// Receives measurements of the YouTube client
+type Metrics interface {
+	// Called after every API call attempt, including retries
+	APICall(method, result string, duration time.Duration)
+	// Called with the number of channels whose videos are retrieved together
+	FeedFanout(channels int)
+	// Called whenever cached videos are looked up for a channel
+	CacheLookup(hit bool)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) APICall(method, result string, duration time.Duration) {}
+func (noopMetrics) FeedFanout(channels int)                               {}
+func (noopMetrics) CacheLookup(hit bool)                                  {}
+
+var (
+	metricsMu sync.RWMutex
+	metrics   Metrics = noopMetrics{}
+)
+
+// Sets the receiver of client measurements, nil disables them
+func SetMetrics(m Metrics) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if m == nil {
+		m = noopMetrics{}
+	}
+	metrics = m
+}
+
+func getMetrics() Metrics {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+
+	return metrics
+}
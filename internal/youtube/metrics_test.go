@@ -0,0 +1,77 @@
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recordedMetrics struct {
+	mu      sync.Mutex
+	calls   []string // "method result"
+	fanouts []int
+	hits    int
+	misses  int
+}
+
+func (m *recordedMetrics) APICall(method, result string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, method+" "+result)
+}
+
+func (m *recordedMetrics) FeedFanout(channels int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fanouts = append(m.fanouts, channels)
+}
+
+func (m *recordedMetrics) CacheLookup(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func TestMetricsReported(t *testing.T) {
+	var calls atomic.Int32
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			writeAPIError(w, http.StatusInternalServerError, "backendError")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, playlistItemsResponse)
+	})
+
+	m := &recordedMetrics{}
+	SetMetrics(m)
+	t.Cleanup(func() { SetMetrics(nil) })
+
+	getChannelsVideos(context.Background(), 3, []FeedChannel{{UploadId: "UUmetrics"}})
+
+	want := []string{MethodPlaylistItemsList + " " + string(ErrorRetryable), MethodPlaylistItemsList + " " + ResultOK}
+	if fmt.Sprint(m.calls) != fmt.Sprint(want) {
+		log.Printf("in TestMetricsReported: got calls %v, want %v", m.calls, want)
+		t.Fail()
+	}
+	if len(m.fanouts) != 1 || m.fanouts[0] != 1 {
+		log.Printf("in TestMetricsReported: got fanouts %v, want [1]", m.fanouts)
+		t.Fail()
+	}
+
+	channelCache.get("UUmetrics")
+	channelCache.get("UUmetricsMissing")
+	if m.hits != 1 || m.misses != 1 {
+		log.Printf("in TestMetricsReported: got %d hits and %d misses, want 1 each", m.hits, m.misses)
+		t.Fail()
+	}
+}
@@ -0,0 +1,275 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	_ "time/tzdata" // the container image has no zoneinfo
+)
+
+// YouTube Data API unit cost of each call made by this package
+const (
+	CostChannelsList      = 1
+	CostPlaylistItemsList = 1
+	CostVideosList        = 1
+	CostSearchList        = 100
+)
+
+// API method names used when recording quota usage
+const (
+	MethodChannelsList      = "channels.list"
+	MethodPlaylistItemsList = "playlistItems.list"
+	MethodVideosList        = "videos.list"
+	MethodSearchList        = "search.list"
+)
+
+// Returned instead of calling the API when the daily budget does not allow the call
+var ErrQuotaExceeded = errors.New("youtube API daily quota budget exceeded")
+
+type QuotaStatus string
+
+const (
+	QuotaOK        QuotaStatus = "ok"        // all calls allowed
+	QuotaDegraded  QuotaStatus = "degraded"  // past the soft limit: cached videos served, channel lookups refused
+	QuotaExhausted QuotaStatus = "exhausted" // past the daily limit: no calls made
+)
+
+// Calls and units used by a single API method
+type MethodUsage struct {
+	Calls int64 `json:"calls"`
+	Units int64 `json:"units"`
+}
+
+// Quota usage for the current quota day
+type QuotaUsage struct {
+	Day       string                 `json:"day"`
+	Units     int64                  `json:"units"`
+	Limit     int64                  `json:"limit"`
+	SoftLimit int64                  `json:"softLimit"`
+	Status    QuotaStatus            `json:"status"`
+	Methods   map[string]MethodUsage `json:"methods"`
+}
+
+// Persists daily quota usage so totals survive restarts and are shared between instances
+type QuotaStore interface {
+	AddQuotaUsage(ctx context.Context, day time.Time, method string, usage MethodUsage) error
+	GetQuotaUsage(ctx context.Context, day time.Time) (map[string]MethodUsage, error)
+}
+
+// The quota resets at midnight Pacific Time
+var quotaLocation = loadQuotaLocation()
+
+func loadQuotaLocation() *time.Location {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Returns midnight (Pacific Time) of the quota day containing t
+func quotaDay(t time.Time) time.Time {
+	year, month, day := t.In(quotaLocation).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, quotaLocation)
+}
+
+type pendingKey struct {
+	day    time.Time
+	method string
+}
+
+type quotaTracker struct {
+	mu         sync.Mutex
+	store      QuotaStore
+	dailyLimit int64 // 0 disables enforcement
+	softLimit  int64
+	day        time.Time
+	totals     map[string]MethodUsage // usage for day, as last read from the store plus local calls since
+	pending    map[pendingKey]MethodUsage
+	now        func() time.Time
+}
+
+var quota = newQuotaTracker()
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{
+		totals:  map[string]MethodUsage{},
+		pending: map[pendingKey]MethodUsage{},
+		now:     time.Now,
+	}
+}
+
+// Sets the daily unit budget. Once softPercent of dailyLimit is used cached data is served and
+// channel lookups are refused, once dailyLimit is used no calls are made. A dailyLimit of 0
+// disables enforcement (usage is still recorded)
+func SetQuotaBudget(dailyLimit int64, softPercent int) {
+	quota.mu.Lock()
+	defer quota.mu.Unlock()
+
+	quota.dailyLimit = dailyLimit
+	quota.softLimit = dailyLimit * int64(softPercent) / 100
+}
+
+// Sets the store used to persist daily usage
+func SetQuotaStore(store QuotaStore) {
+	quota.mu.Lock()
+	defer quota.mu.Unlock()
+
+	quota.store = store
+}
+
+// Writes usage recorded since the last flush to the store and reloads the day's totals,
+// picking up calls made by other instances
+func FlushQuota(ctx context.Context) error {
+	return quota.flush(ctx)
+}
+
+// Returns the usage for the current quota day
+func GetQuotaUsage() QuotaUsage {
+	return quota.usage()
+}
+
+// Returns the current quota status
+func GetQuotaStatus() QuotaStatus {
+	return quota.status()
+}
+
+// Resets the totals if the quota day has changed, must hold mu
+func (q *quotaTracker) rollover() time.Time {
+	day := quotaDay(q.now())
+	if !day.Equal(q.day) {
+		q.day = day
+		q.totals = map[string]MethodUsage{}
+	}
+	return day
+}
+
+// Records a call made to the API
+func (q *quotaTracker) record(method string, units int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day := q.rollover()
+
+	total := q.totals[method]
+	total.Calls++
+	total.Units += units
+	q.totals[method] = total
+
+	key := pendingKey{day: day, method: method}
+	pending := q.pending[key]
+	pending.Calls++
+	pending.Units += units
+	q.pending[key] = pending
+}
+
+func (q *quotaTracker) flush(ctx context.Context) error {
+	q.mu.Lock()
+	store := q.store
+	if store == nil {
+		q.mu.Unlock()
+		return nil
+	}
+	pending := q.pending
+	q.pending = map[pendingKey]MethodUsage{}
+	q.mu.Unlock()
+
+	var flushErr error
+	for key, usage := range pending {
+		err := store.AddQuotaUsage(ctx, key.day, key.method, usage)
+		if err != nil {
+			flushErr = fmt.Errorf("in flush(): error persisting quota usage for %s: %v", key.method, err)
+			q.mu.Lock()
+			restored := q.pending[key]
+			restored.Calls += usage.Calls
+			restored.Units += usage.Units
+			q.pending[key] = restored
+			q.mu.Unlock()
+		}
+	}
+	if flushErr != nil {
+		return flushErr
+	}
+
+	q.mu.Lock()
+	day := q.rollover()
+	q.mu.Unlock()
+
+	stored, err := store.GetQuotaUsage(ctx, day)
+	if err != nil {
+		return fmt.Errorf("in flush(): error loading quota usage: %v", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.rollover().Equal(day) {
+		// calls recorded while loading are not in the store yet
+		for key, usage := range q.pending {
+			if key.day.Equal(day) {
+				total := stored[key.method]
+				total.Calls += usage.Calls
+				total.Units += usage.Units
+				stored[key.method] = total
+			}
+		}
+		q.totals = stored
+	}
+
+	return nil
+}
+
+// Sums the units used today, must hold mu
+func (q *quotaTracker) units() int64 {
+	q.rollover()
+
+	var units int64
+	for _, usage := range q.totals {
+		units += usage.Units
+	}
+	return units
+}
+
+func (q *quotaTracker) status() QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.statusLocked()
+}
+
+func (q *quotaTracker) statusLocked() QuotaStatus {
+	if q.dailyLimit <= 0 {
+		return QuotaOK
+	}
+
+	units := q.units()
+	switch {
+	case units >= q.dailyLimit:
+		return QuotaExhausted
+	case units >= q.softLimit:
+		return QuotaDegraded
+	default:
+		return QuotaOK
+	}
+}
+
+func (q *quotaTracker) usage() QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day := q.rollover()
+	methods := map[string]MethodUsage{}
+	for method, usage := range q.totals {
+		methods[method] = usage
+	}
+
+	return QuotaUsage{
+		Day:       day.Format(time.DateOnly),
+		Units:     q.units(),
+		Limit:     q.dailyLimit,
+		SoftLimit: q.softLimit,
+		Status:    q.statusLocked(),
+		Methods:   methods,
+	}
+}
@@ -0,0 +1,145 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+)
+
+// In-memory QuotaStore, usage keyed by quota day
+type testQuotaStore struct {
+	days map[string]map[string]MethodUsage
+	err  error
+}
+
+func (s *testQuotaStore) AddQuotaUsage(ctx context.Context, day time.Time, method string, usage MethodUsage) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	key := day.Format(time.DateOnly)
+	if s.days[key] == nil {
+		s.days[key] = map[string]MethodUsage{}
+	}
+	total := s.days[key][method]
+	total.Calls += usage.Calls
+	total.Units += usage.Units
+	s.days[key][method] = total
+
+	return nil
+}
+
+func (s *testQuotaStore) GetQuotaUsage(ctx context.Context, day time.Time) (map[string]MethodUsage, error) {
+	usage := map[string]MethodUsage{}
+	for method, u := range s.days[day.Format(time.DateOnly)] {
+		usage[method] = u
+	}
+
+	return usage, nil
+}
+
+func newTestQuotaTracker(dailyLimit int64, softPercent int) (*quotaTracker, *testQuotaStore, *time.Time) {
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, quotaLocation)
+	store := &testQuotaStore{days: map[string]map[string]MethodUsage{}}
+
+	tracker := newQuotaTracker()
+	tracker.now = func() time.Time { return now }
+	tracker.store = store
+	tracker.dailyLimit = dailyLimit
+	tracker.softLimit = dailyLimit * int64(softPercent) / 100
+
+	return tracker, store, &now
+}
+
+func TestQuotaStatusTransitions(t *testing.T) {
+	tracker, _, _ := newTestQuotaTracker(10, 80)
+
+	for i := 0; i < 7; i++ {
+		tracker.record(MethodPlaylistItemsList, CostPlaylistItemsList)
+	}
+	if status := tracker.status(); status != QuotaOK {
+		log.Printf("in TestQuotaStatusTransitions: got %s after 7 units, want %s", status, QuotaOK)
+		t.Fail()
+	}
+
+	tracker.record(MethodChannelsList, CostChannelsList)
+	if status := tracker.status(); status != QuotaDegraded {
+		log.Printf("in TestQuotaStatusTransitions: got %s after 8 units, want %s", status, QuotaDegraded)
+		t.Fail()
+	}
+
+	tracker.record(MethodPlaylistItemsList, CostPlaylistItemsList)
+	tracker.record(MethodPlaylistItemsList, CostPlaylistItemsList)
+	if status := tracker.status(); status != QuotaExhausted {
+		log.Printf("in TestQuotaStatusTransitions: got %s after 10 units, want %s", status, QuotaExhausted)
+		t.Fail()
+	}
+}
+
+func TestQuotaFlushSharesUsageBetweenInstances(t *testing.T) {
+	tracker, store, now := newTestQuotaTracker(100, 80)
+	other := newQuotaTracker()
+	other.now = tracker.now
+	other.store = store
+
+	tracker.record(MethodPlaylistItemsList, CostPlaylistItemsList)
+	other.record(MethodChannelsList, CostChannelsList)
+	other.record(MethodChannelsList, CostChannelsList)
+
+	if err := other.flush(context.Background()); err != nil {
+		t.Fatalf("unexpected flush error: %v", err)
+	}
+	if err := tracker.flush(context.Background()); err != nil {
+		t.Fatalf("unexpected flush error: %v", err)
+	}
+
+	usage := tracker.usage()
+	if usage.Units != 3 || usage.Methods[MethodChannelsList].Calls != 2 {
+		log.Printf("in TestQuotaFlushSharesUsageBetweenInstances: got %+v", usage)
+		t.Fail()
+	}
+
+	stored := store.days[now.Format(time.DateOnly)]
+	if stored[MethodPlaylistItemsList].Units != 1 || stored[MethodChannelsList].Units != 2 {
+		log.Printf("in TestQuotaFlushSharesUsageBetweenInstances: stored %+v", stored)
+		t.Fail()
+	}
+}
+
+func TestQuotaFlushKeepsUsageOnStoreError(t *testing.T) {
+	tracker, store, _ := newTestQuotaTracker(100, 80)
+	store.err = errors.New("database unavailable")
+
+	tracker.record(MethodPlaylistItemsList, CostPlaylistItemsList)
+	if err := tracker.flush(context.Background()); err == nil {
+		t.Fatal("expected flush error")
+	}
+
+	store.err = nil
+	if err := tracker.flush(context.Background()); err != nil {
+		t.Fatalf("unexpected flush error: %v", err)
+	}
+	if usage := tracker.usage(); usage.Units != 1 {
+		log.Printf("in TestQuotaFlushKeepsUsageOnStoreError: got %v units, want 1", usage.Units)
+		t.Fail()
+	}
+}
+
+func TestQuotaResetsAtPacificMidnight(t *testing.T) {
+	tracker, _, now := newTestQuotaTracker(10, 80)
+
+	for i := 0; i < 10; i++ {
+		tracker.record(MethodPlaylistItemsList, CostPlaylistItemsList)
+	}
+	if status := tracker.status(); status != QuotaExhausted {
+		t.Fatalf("got %s, want %s", status, QuotaExhausted)
+	}
+
+	*now = time.Date(2024, 11, 2, 0, 0, 1, 0, quotaLocation)
+	if status := tracker.status(); status != QuotaOK {
+		log.Printf("in TestQuotaResetsAtPacificMidnight: got %s after midnight, want %s", status, QuotaOK)
+		t.Fail()
+	}
+}
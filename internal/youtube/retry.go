@@ -0,0 +1,307 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"google.golang.org/api/googleapi"
+)
+
+// Returned (wrapped) when the API reports the requested resource does not exist
+var ErrNotFound = errors.New("youtube API resource not found")
+
+// Returned (wrapped) when the API refuses the request for reasons other than quota
+var ErrForbidden = errors.New("youtube API request forbidden")
+
+// Returned (wrapped) when the API could not be reached after retrying, or the circuit is open
+var ErrUnavailable = errors.New("youtube API unavailable")
+
+// Returned (wrapped in ErrUnavailable) when calls are short-circuited while the API is unhealthy
+var ErrCircuitOpen = errors.New("youtube API circuit breaker open")
+
+type ErrorKind string
+
+const (
+	ErrorRetryable ErrorKind = "retryable" // 5xx, rate limiting and network errors
+	ErrorQuota     ErrorKind = "quota"     // daily quota used up on YouTube's side
+	ErrorNotFound  ErrorKind = "notFound"
+	ErrorForbidden ErrorKind = "forbidden"
+	ErrorOther     ErrorKind = "other" // bad requests and anything unrecognised, not retried
+)
+
+// googleapi error reasons
+var (
+	quotaReasons     = []string{"quotaExceeded", "dailyLimitExceeded"}
+	rateLimitReasons = []string{"rateLimitExceeded", "userRateLimitExceeded"}
+)
+
+// Classifies an error returned by a YouTube API call
+func ClassifyError(err error) ErrorKind {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case hasReason(apiErr, quotaReasons):
+			return ErrorQuota
+		case hasReason(apiErr, rateLimitReasons):
+			return ErrorRetryable
+		case apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500:
+			return ErrorRetryable
+		case apiErr.Code == http.StatusNotFound:
+			return ErrorNotFound
+		case apiErr.Code == http.StatusForbidden:
+			return ErrorForbidden
+		default:
+			return ErrorOther
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorRetryable
+	}
+
+	return ErrorOther
+}
+
+func hasReason(apiErr *googleapi.Error, reasons []string) bool {
+	for _, item := range apiErr.Errors {
+		for _, reason := range reasons {
+			if item.Reason == reason {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Wraps err with the sentinel error matching its kind
+func wrapAPIError(kind ErrorKind, err error) error {
+	switch kind {
+	case ErrorQuota:
+		return fmt.Errorf("%w: %w", ErrQuotaExceeded, err)
+	case ErrorNotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case ErrorForbidden:
+		return fmt.Errorf("%w: %w", ErrForbidden, err)
+	case ErrorRetryable:
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
+
+// How failed calls are retried. Delays grow exponentially from BaseDelay up to MaxDelay,
+// each delay is drawn uniformly from [0, delay)
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// Returns the jittered delay before retry attempt (starting at 1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// Opens after threshold consecutive retryable failures. While open calls fail immediately, after
+// cooldown a single probe call is let through which closes the circuit on success
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int // 0 disables the breaker
+	cooldown  time.Duration
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Returns true if a call may be made
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return true
+	}
+
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Records the outcome of an allowed call, healthy is false for retryable failures only. Returns
+// true and the number of consecutive failures if the call opened the circuit
+func (b *circuitBreaker) result(healthy bool) (bool, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if healthy {
+		b.state = circuitClosed
+		b.failures = 0
+		return false, 0
+	}
+
+	b.failures++
+	opened := false
+	if b.state == circuitHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		opened = b.state != circuitOpen
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+
+	return opened, b.failures
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == circuitOpen
+}
+
+var (
+	retryMu     sync.RWMutex
+	retryPolicy = defaultRetryPolicy
+	breaker     = newCircuitBreaker(5, 30*time.Second)
+)
+
+// Sets how failed calls are retried, MaxAttempts below 1 is treated as 1
+func SetRetryPolicy(policy RetryPolicy) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	retryPolicy = policy
+}
+
+// Replaces the circuit breaker, a threshold of 0 disables it
+func SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	breaker = newCircuitBreaker(threshold, cooldown)
+}
+
+// Returns true while calls to the API are being short-circuited
+func CircuitOpen() bool {
+	retryMu.RLock()
+	defer retryMu.RUnlock()
+
+	return breaker.isOpen()
+}
+
+// Makes an API call through the circuit breaker, retrying retryable failures with backoff.
+// Every attempt is recorded against the quota as method. Gives up with ctx's error once ctx is
+// done, call must pass ctx on to the request
+func callAPI(ctx context.Context, method string, cost int64, call func() error) error {
+	retryMu.RLock()
+	policy := retryPolicy
+	b := breaker
+	retryMu.RUnlock()
+
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(policy.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("in callAPI(): %s: %w", method, ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		if !b.allow() {
+			getMetrics().APICall(method, ResultCircuitOpen, 0)
+			return fmt.Errorf("in callAPI(): %s: %w: %w", method, ErrUnavailable, ErrCircuitOpen)
+		}
+
+		start := time.Now()
+		err = call()
+		duration := time.Since(start)
+		quota.record(method, cost)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("in callAPI(): %s: %w", method, ctx.Err())
+		}
+
+		kind := ErrorOther
+		result := ResultOK
+		if err != nil {
+			kind = ClassifyError(err)
+			result = string(kind)
+		}
+		opened, failures := b.result(err == nil || kind != ErrorRetryable)
+		if opened {
+			logging.FromContext(ctx).Warn("in callAPI(): opening circuit", "method", method, "consecutive_failures", failures)
+		}
+		getMetrics().APICall(method, result, duration)
+
+		if err == nil {
+			return nil
+		}
+		if kind != ErrorRetryable {
+			return fmt.Errorf("in callAPI(): %s: %w", method, wrapAPIError(kind, err))
+		}
+		logging.FromContext(ctx).Warn("in callAPI(): attempt failed", "method", method, "attempt", attempt, "max_attempts", policy.MaxAttempts, logging.Err(err))
+	}
+
+	return fmt.Errorf("in callAPI(): %s: giving up after %d attempts: %w", method, policy.MaxAttempts, wrapAPIError(ErrorRetryable, err))
+}
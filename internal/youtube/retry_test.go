@@ -0,0 +1,254 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const playlistItemsResponse = `{
+	"items": [{
+		"snippet": {
+			"channelTitle": "Fake Channel",
+			"title": "Fake Video",
+			"publishedAt": "2024-11-01T12:00:00Z",
+			"resourceId": {"videoId": "fakeVideo1"},
+			"thumbnails": {"high": {"url": "https://i.ytimg.com/vi/fakeVideo1/hqdefault.jpg"}}
+		}
+	}]
+}`
+
+// Writes a googleapi style error body
+func writeAPIError(w http.ResponseWriter, code int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": "%s", "errors": [{"reason": "%s"}]}}`, code, reason, reason)
+}
+
+// Points the client at a local server answering with handler, using a fast retry policy
+// and the given breaker threshold
+func newFakeYouTube(t *testing.T, breakerThreshold int, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Setenv("YOUTUBE_CUSTOM_FEEDS_YT_API_KEY", "test-key")
+	SetAPIEndpoint(server.URL + "/")
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond})
+	SetCircuitBreaker(breakerThreshold, time.Hour)
+
+	t.Cleanup(func() {
+		server.Close()
+		SetAPIEndpoint("")
+		SetRetryPolicy(defaultRetryPolicy)
+		SetCircuitBreaker(5, 30*time.Second)
+		aliveChannels = &aliveChannelCache{checkedAt: map[string]time.Time{}}
+	})
+}
+
+func TestClassifyError(t *testing.T) {
+	var calls atomic.Int32
+	responses := []struct {
+		code   int
+		reason string
+		want   ErrorKind
+	}{
+		{http.StatusServiceUnavailable, "backendError", ErrorRetryable},
+		{http.StatusForbidden, "rateLimitExceeded", ErrorRetryable},
+		{http.StatusForbidden, "quotaExceeded", ErrorQuota},
+		{http.StatusNotFound, "playlistNotFound", ErrorNotFound},
+		{http.StatusForbidden, "forbidden", ErrorForbidden},
+		{http.StatusBadRequest, "invalidParameter", ErrorOther},
+	}
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		response := responses[calls.Load()]
+		writeAPIError(w, response.code, response.reason)
+	})
+
+	service, err := getService()
+	if err != nil {
+		t.Fatalf("in TestClassifyError: error creating service: %v", err)
+	}
+
+	for _, response := range responses {
+		_, err := service.PlaylistItems.List([]string{"snippet"}).PlaylistId("UUclassify").Do()
+		calls.Add(1)
+		if kind := ClassifyError(err); kind != response.want {
+			log.Printf("in TestClassifyError: %d %s classified as %s, want %s", response.code, response.reason, kind, response.want)
+			t.Fail()
+		}
+	}
+}
+
+func TestRetryTransientFailure(t *testing.T) {
+	var calls atomic.Int32
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			writeAPIError(w, http.StatusInternalServerError, "backendError")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, playlistItemsResponse)
+	})
+
+	fetch := getChannelVideos(context.Background(), 3, "UUretryTransient")
+	videos, err := fetch.videos, fetch.err
+	if err != nil {
+		log.Printf("in TestRetryTransientFailure: unexpected error: %v", err)
+		t.Fail()
+	}
+	if len(videos) != 1 || videos[0].VideoId != "fakeVideo1" {
+		log.Printf("in TestRetryTransientFailure: got videos %v", videos)
+		t.Fail()
+	}
+	if calls.Load() != 3 {
+		log.Printf("in TestRetryTransientFailure: got %d calls, want 3", calls.Load())
+		t.Fail()
+	}
+}
+
+func TestRetryStopsOnPermanentFailure(t *testing.T) {
+	var calls atomic.Int32
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeAPIError(w, http.StatusNotFound, "playlistNotFound")
+	})
+
+	err := getChannelVideos(context.Background(), 3, "UUretryPermanent").err
+	if !errors.Is(err, ErrNotFound) {
+		log.Printf("in TestRetryStopsOnPermanentFailure: got error %v, want ErrNotFound", err)
+		t.Fail()
+	}
+	if calls.Load() != 1 {
+		log.Printf("in TestRetryStopsOnPermanentFailure: got %d calls, want 1", calls.Load())
+		t.Fail()
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	var calls atomic.Int32
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeAPIError(w, http.StatusInternalServerError, "backendError")
+	})
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := getChannelVideos(ctx, 3, "UUretryCancelled").err
+	if !errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("in TestRetryStopsWhenContextDone: got error %v, want context.DeadlineExceeded", err)
+		t.Fail()
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		log.Printf("in TestRetryStopsWhenContextDone: returned after %v, want the backoff cut short", elapsed)
+		t.Fail()
+	}
+	if calls.Load() != 1 {
+		log.Printf("in TestRetryStopsWhenContextDone: got %d calls, want 1", calls.Load())
+		t.Fail()
+	}
+}
+
+func TestQuotaErrorFromAPI(t *testing.T) {
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusForbidden, "quotaExceeded")
+	})
+
+	_, _, _, err := GetChannelIdUploadId(context.Background(), "@quota")
+	if !errors.Is(err, ErrQuotaExceeded) {
+		log.Printf("in TestQuotaErrorFromAPI: got error %v, want ErrQuotaExceeded", err)
+		t.Fail()
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	var calls atomic.Int32
+	newFakeYouTube(t, 3, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeAPIError(w, http.StatusServiceUnavailable, "backendError")
+	})
+
+	err := getChannelVideos(context.Background(), 3, "UUbreakerOpens").err
+	if !errors.Is(err, ErrUnavailable) {
+		log.Printf("in TestCircuitBreakerOpens: got error %v, want ErrUnavailable", err)
+		t.Fail()
+	}
+	if !CircuitOpen() {
+		log.Println("in TestCircuitBreakerOpens: circuit still closed after 3 failures")
+		t.Fail()
+	}
+	if health := GetHealth(); health.OK() || !health.Configured || !health.CircuitOpen {
+		log.Printf("in TestCircuitBreakerOpens: got health %+v, want configured with the circuit open", health)
+		t.Fail()
+	}
+
+	err = getChannelVideos(context.Background(), 3, "UUbreakerOpens").err
+	if !errors.Is(err, ErrCircuitOpen) {
+		log.Printf("in TestCircuitBreakerOpens: got error %v, want ErrCircuitOpen", err)
+		t.Fail()
+	}
+	if calls.Load() != 3 {
+		log.Printf("in TestCircuitBreakerOpens: got %d calls, want 3", calls.Load())
+		t.Fail()
+	}
+}
+
+func TestCircuitBreakerRecovers(t *testing.T) {
+	breaker := newCircuitBreaker(2, time.Minute)
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return now }
+
+	breaker.allow()
+	breaker.result(false)
+	breaker.allow()
+	breaker.result(false)
+	if breaker.allow() {
+		log.Println("in TestCircuitBreakerRecovers: call allowed while open")
+		t.Fail()
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.allow() {
+		log.Println("in TestCircuitBreakerRecovers: probe not allowed after cooldown")
+		t.Fail()
+	}
+	if breaker.allow() {
+		log.Println("in TestCircuitBreakerRecovers: second call allowed while probing")
+		t.Fail()
+	}
+
+	breaker.result(true)
+	if !breaker.allow() || breaker.isOpen() {
+		log.Println("in TestCircuitBreakerRecovers: circuit not closed after successful probe")
+		t.Fail()
+	}
+}
+
+func TestServesCacheWhileUnavailable(t *testing.T) {
+	var failing atomic.Bool
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			writeAPIError(w, http.StatusServiceUnavailable, "backendError")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, playlistItemsResponse)
+	})
+
+	if err := getChannelVideos(context.Background(), 3, "UUservesCache").err; err != nil {
+		t.Fatalf("in TestServesCacheWhileUnavailable: unexpected error: %v", err)
+	}
+
+	failing.Store(true)
+	fetch := getChannelVideos(context.Background(), 3, "UUservesCache")
+	if len(fetch.videos) != 1 || fetch.cachedAt.IsZero() || !errors.Is(fetch.err, ErrUnavailable) {
+		log.Printf("in TestServesCacheWhileUnavailable: got %v, cachedAt %v, %v, want stale cached videos", fetch.videos, fetch.cachedAt, fetch.err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,215 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+)
+
+type ChannelLoadStatus string
+
+const (
+	ChannelOK     ChannelLoadStatus = "ok"
+	ChannelEmpty  ChannelLoadStatus = "empty"  // retrieved, but the channel has no uploads
+	ChannelStale  ChannelLoadStatus = "stale"  // served from the cache, ErrorCode says why
+	ChannelFailed ChannelLoadStatus = "failed" // no videos could be retrieved, ErrorCode says why
+	ChannelDead   ChannelLoadStatus = "dead"   // deleted or terminated on YouTube and no longer polled
+)
+
+// Error codes reported for failed and stale channels
+const (
+	ErrorCodeQuota       = "quotaExceeded"
+	ErrorCodeUnavailable = "unavailable"
+	ErrorCodeNotFound    = "notFound"
+	ErrorCodeForbidden   = "forbidden"
+	ErrorCodeUnknown     = "unknown"
+)
+
+type FeedStatus string
+
+const (
+	FeedOK      FeedStatus = "ok"      // every channel loaded
+	FeedPartial FeedStatus = "partial" // some channels failed or were served from the cache
+	FeedEmpty   FeedStatus = "empty"   // every channel loaded but none have uploads
+	FeedFailed  FeedStatus = "failed"  // every channel failed
+)
+
+// How retrieving a single channel's videos went
+type ChannelStatus struct {
+	ChannelId  string            `json:"channelId"`
+	Handle     string            `json:"handle"`
+	UploadId   string            `json:"uploadId"`
+	Status     ChannelLoadStatus `json:"status"`
+	VideoCount int               `json:"videoCount"`
+	ErrorCode  string            `json:"errorCode,omitempty"`
+	CachedAt   *time.Time        `json:"cachedAt,omitempty"`
+}
+
+// Result of retrieving a single channel's videos
+type channelFetch struct {
+	videos   []Video
+	cachedAt time.Time // set when videos were served from the cache
+	err      error     // why the fetch failed, or why cached videos were served
+}
+
+// Returns the error code reported to clients for err
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		return ErrorCodeQuota
+	case errors.Is(err, ErrUnavailable):
+		return ErrorCodeUnavailable
+	case errors.Is(err, ErrNotFound):
+		return ErrorCodeNotFound
+	case errors.Is(err, ErrForbidden):
+		return ErrorCodeForbidden
+	default:
+		return ErrorCodeUnknown
+	}
+}
+
+// Builds the status reported for channel from the result of retrieving its videos
+func newChannelStatus(channel FeedChannel, fetch channelFetch) ChannelStatus {
+	status := ChannelStatus{
+		ChannelId:  channel.ChannelId,
+		Handle:     channel.Handle,
+		UploadId:   channel.UploadId,
+		VideoCount: len(fetch.videos),
+	}
+
+	switch {
+	case channel.DeadReason != "":
+		status.Status = ChannelDead
+		status.ErrorCode = channel.DeadReason
+	case !fetch.cachedAt.IsZero():
+		cachedAt := fetch.cachedAt
+		status.Status = ChannelStale
+		status.ErrorCode = ErrorCode(fetch.err)
+		status.CachedAt = &cachedAt
+	case fetch.err != nil:
+		status.Status = ChannelFailed
+		status.ErrorCode = ErrorCode(fetch.err)
+	case len(fetch.videos) == 0:
+		status.Status = ChannelEmpty
+	default:
+		status.Status = ChannelOK
+	}
+
+	return status
+}
+
+// Summarises the channel statuses into the status of the feed as a whole. Dead channels are not
+// polled so they make the feed partial but never failed
+func feedStatus(statuses []ChannelStatus) FeedStatus {
+	polled, failed, degraded, videos := 0, 0, 0, 0
+	for _, status := range statuses {
+		switch status.Status {
+		case ChannelFailed:
+			failed++
+			degraded++
+		case ChannelStale, ChannelDead:
+			degraded++
+		}
+		if status.Status != ChannelDead {
+			polled++
+		}
+		videos += status.VideoCount
+	}
+
+	switch {
+	case polled > 0 && failed == polled:
+		return FeedFailed
+	case degraded > 0:
+		return FeedPartial
+	case videos == 0:
+		return FeedEmpty
+	default:
+		return FeedOK
+	}
+}
+
+// Notified when a channel is found to have been deleted or terminated on YouTube
+type DeadChannelReporter interface {
+	ReportDeadChannel(ctx context.Context, channel FeedChannel, errorCode string) error
+}
+
+var (
+	deadChannelMu       sync.RWMutex
+	deadChannelReporter DeadChannelReporter
+)
+
+// Sets the reporter notified of dead channels
+func SetDeadChannelReporter(reporter DeadChannelReporter) {
+	deadChannelMu.Lock()
+	defer deadChannelMu.Unlock()
+
+	deadChannelReporter = reporter
+}
+
+// Checks a channel whose uploads could not be retrieved (not found or forbidden). The channel is
+// dead if channels.list no longer returns it, channels without uploads also have no upload
+// playlist so these are reported as empty instead. Channels confirmed to exist are not checked
+// again until aliveChannelTTL has passed
+func checkDeadChannel(ctx context.Context, channel FeedChannel, fetch channelFetch) (dead bool, empty bool) {
+	code := ErrorCode(fetch.err)
+	if channel.ChannelId == "" || (code != ErrorCodeNotFound && code != ErrorCodeForbidden) {
+		return false, false
+	}
+	if aliveChannels.confirmed(channel.ChannelId) {
+		return false, code == ErrorCodeNotFound
+	}
+
+	metadata, err := GetChannelsMetadata(ctx, []string{channel.ChannelId})
+	if err != nil {
+		logging.FromContext(ctx).Warn("in checkDeadChannel(): unable to confirm channel is dead", logging.KeyChannelID, channel.ChannelId, logging.Err(err))
+		return false, false
+	}
+	if _, ok := metadata[channel.ChannelId]; ok {
+		aliveChannels.confirm(channel.ChannelId)
+		return false, code == ErrorCodeNotFound
+	}
+
+	deadChannelMu.RLock()
+	reporter := deadChannelReporter
+	deadChannelMu.RUnlock()
+
+	if reporter != nil {
+		err = reporter.ReportDeadChannel(context.WithoutCancel(ctx), channel, code)
+		if err != nil {
+			logging.FromContext(ctx).Error("in checkDeadChannel(): error reporting dead channel", logging.KeyChannelID, channel.ChannelId, logging.Err(err))
+		}
+	}
+
+	return true, false
+}
+
+// Notified of the status of every channel after its videos are retrieved
+type ChannelStatusListener interface {
+	ChannelStatuses(ctx context.Context, statuses []ChannelStatus)
+}
+
+var (
+	statusListenerMu sync.RWMutex
+	statusListener   ChannelStatusListener
+)
+
+// Sets the listener notified of channel statuses
+func SetChannelStatusListener(listener ChannelStatusListener) {
+	statusListenerMu.Lock()
+	defer statusListenerMu.Unlock()
+
+	statusListener = listener
+}
+
+func reportChannelStatuses(ctx context.Context, statuses []ChannelStatus) {
+	statusListenerMu.RLock()
+	listener := statusListener
+	statusListenerMu.RUnlock()
+
+	if listener != nil && len(statuses) > 0 {
+		listener.ChannelStatuses(context.WithoutCancel(ctx), statuses)
+	}
+}
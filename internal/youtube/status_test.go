@@ -0,0 +1,203 @@
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFeedStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []ChannelStatus
+		want     FeedStatus
+	}{
+		{"no channels", []ChannelStatus{}, FeedEmpty},
+		{"all empty", []ChannelStatus{{Status: ChannelEmpty}, {Status: ChannelEmpty}}, FeedEmpty},
+		{"all ok", []ChannelStatus{{Status: ChannelOK, VideoCount: 3}, {Status: ChannelEmpty}}, FeedOK},
+		{"one failed", []ChannelStatus{{Status: ChannelOK, VideoCount: 3}, {Status: ChannelFailed}}, FeedPartial},
+		{"one stale", []ChannelStatus{{Status: ChannelOK, VideoCount: 3}, {Status: ChannelStale, VideoCount: 2}}, FeedPartial},
+		{"all failed", []ChannelStatus{{Status: ChannelFailed}, {Status: ChannelFailed}}, FeedFailed},
+		{"failed and dead", []ChannelStatus{{Status: ChannelFailed}, {Status: ChannelDead}}, FeedFailed},
+		{"all dead", []ChannelStatus{{Status: ChannelDead}}, FeedPartial},
+	}
+
+	for _, test := range tests {
+		if got := feedStatus(test.statuses); got != test.want {
+			log.Printf("in TestFeedStatus: %s: got %s, want %s", test.name, got, test.want)
+			t.Fail()
+		}
+	}
+}
+
+func TestGetFeedVideosJSONReportsChannels(t *testing.T) {
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("playlistId") {
+		case "UUstatusOk":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, playlistItemsResponse)
+		case "UUstatusEmpty":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"items": []}`)
+		default:
+			writeAPIError(w, http.StatusNotFound, "playlistNotFound")
+		}
+	})
+
+	channels := []FeedChannel{
+		{ChannelId: "UCstatusOk", Handle: "@ok", UploadId: "UUstatusOk", Priority: 1},
+		{ChannelId: "UCstatusEmpty", Handle: "@empty", UploadId: "UUstatusEmpty", Priority: 1},
+		{ChannelId: "UCstatusGone", Handle: "@gone", UploadId: "UUstatusGone", Priority: 1},
+	}
+
+	videosJSON, status, err := GetFeedVideosJSON(context.Background(), 3, channels, MergeOptions{Strategy: MergeByDate})
+	if err != nil {
+		t.Fatalf("in TestGetFeedVideosJSONReportsChannels: unexpected error: %v", err)
+	}
+	if status != FeedPartial {
+		log.Printf("in TestGetFeedVideosJSONReportsChannels: got feed status %s, want %s", status, FeedPartial)
+		t.Fail()
+	}
+
+	var response struct {
+		Status   FeedStatus      `json:"status"`
+		Videos   []Video         `json:"videos"`
+		Channels []ChannelStatus `json:"channels"`
+	}
+	if err := json.Unmarshal(videosJSON, &response); err != nil {
+		t.Fatalf("in TestGetFeedVideosJSONReportsChannels: error unmarshaling response: %v", err)
+	}
+
+	if len(response.Videos) != 1 {
+		log.Printf("in TestGetFeedVideosJSONReportsChannels: got %d videos, want 1", len(response.Videos))
+		t.Fail()
+	}
+
+	want := []ChannelStatus{
+		{ChannelId: "UCstatusOk", Handle: "@ok", UploadId: "UUstatusOk", Status: ChannelOK, VideoCount: 1},
+		{ChannelId: "UCstatusEmpty", Handle: "@empty", UploadId: "UUstatusEmpty", Status: ChannelEmpty},
+		{ChannelId: "UCstatusGone", Handle: "@gone", UploadId: "UUstatusGone", Status: ChannelFailed, ErrorCode: ErrorCodeNotFound},
+	}
+	if len(response.Channels) != len(want) {
+		t.Fatalf("in TestGetFeedVideosJSONReportsChannels: got %d channel statuses, want %d", len(response.Channels), len(want))
+	}
+	for i, channel := range response.Channels {
+		if channel != want[i] {
+			log.Printf("in TestGetFeedVideosJSONReportsChannels: got channel status %+v, want %+v", channel, want[i])
+			t.Fail()
+		}
+	}
+}
+
+// In-memory DeadChannelReporter
+type testDeadChannelReporter struct {
+	mu       sync.Mutex
+	reported map[string]string // channelId -> errorCode
+}
+
+func (r *testDeadChannelReporter) ReportDeadChannel(ctx context.Context, channel FeedChannel, errorCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reported[channel.ChannelId] = errorCode
+	return nil
+}
+
+func TestDeadChannelDetection(t *testing.T) {
+	reporter := &testDeadChannelReporter{reported: map[string]string{}}
+	SetDeadChannelReporter(reporter)
+	t.Cleanup(func() {
+		SetDeadChannelReporter(nil)
+	})
+
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/channels") {
+			// only the channel without uploads still exists
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Query().Get("id") == "UCnoUploads" {
+				fmt.Fprint(w, `{"items": [{"id": "UCnoUploads"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"items": []}`)
+			return
+		}
+		if r.URL.Query().Get("playlistId") == "UUterminated" {
+			writeAPIError(w, http.StatusForbidden, "playlistItemsNotAccessible")
+			return
+		}
+		writeAPIError(w, http.StatusNotFound, "playlistNotFound")
+	})
+
+	channels := []FeedChannel{
+		{ChannelId: "UCdeleted", UploadId: "UUdeleted"},
+		{ChannelId: "UCterminated", UploadId: "UUterminated"},
+		{ChannelId: "UCnoUploads", UploadId: "UUnoUploads"},
+		{ChannelId: "UCknownDead", UploadId: "UUknownDead", DeadReason: ErrorCodeNotFound},
+	}
+
+	_, statuses := getChannelsVideos(context.Background(), 3, channels)
+
+	want := []ChannelStatus{
+		{ChannelId: "UCdeleted", UploadId: "UUdeleted", Status: ChannelDead, ErrorCode: ErrorCodeNotFound},
+		{ChannelId: "UCterminated", UploadId: "UUterminated", Status: ChannelDead, ErrorCode: ErrorCodeForbidden},
+		{ChannelId: "UCnoUploads", UploadId: "UUnoUploads", Status: ChannelEmpty},
+		{ChannelId: "UCknownDead", UploadId: "UUknownDead", Status: ChannelDead, ErrorCode: ErrorCodeNotFound},
+	}
+	for i, status := range statuses {
+		if status != want[i] {
+			log.Printf("in TestDeadChannelDetection: got channel status %+v, want %+v", status, want[i])
+			t.Fail()
+		}
+	}
+
+	if len(reporter.reported) != 2 || reporter.reported["UCdeleted"] != ErrorCodeNotFound || reporter.reported["UCterminated"] != ErrorCodeForbidden {
+		log.Printf("in TestDeadChannelDetection: got reported %v", reporter.reported)
+		t.Fail()
+	}
+	if channels[0].DeadReason != "" {
+		log.Println("in TestDeadChannelDetection: caller's channels were modified")
+		t.Fail()
+	}
+}
+
+func TestDeadChannelCheckIsCached(t *testing.T) {
+	var channelCalls atomic.Int32
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/channels") {
+			channelCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"items": [{"id": "UCstillEmpty"}]}`)
+			return
+		}
+		writeAPIError(w, http.StatusNotFound, "playlistNotFound")
+	})
+
+	channels := []FeedChannel{{ChannelId: "UCstillEmpty", UploadId: "UUstillEmpty"}}
+	load := func() {
+		t.Helper()
+		_, statuses := getChannelsVideos(context.Background(), 3, channels)
+		if len(statuses) != 1 || statuses[0].Status != ChannelEmpty {
+			t.Fatalf("got statuses %+v, want the channel reported empty", statuses)
+		}
+	}
+
+	load()
+	load()
+	if got := channelCalls.Load(); got != 1 {
+		t.Errorf("got %d channels.list calls for two loads, want 1", got)
+	}
+
+	// once the confirmation expires the channel is checked again
+	aliveChannels.checkedAt["UCstillEmpty"] = time.Now().Add(-aliveChannelTTL)
+	load()
+	if got := channelCalls.Load(); got != 2 {
+		t.Errorf("got %d channels.list calls after the confirmation expired, want 2", got)
+	}
+}
@@ -0,0 +1,43 @@
+package youtube
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+)
+
+// Persists videos retrieved from the API so they can be searched
+type VideoStore interface {
+	StoreVideos(ctx context.Context, channelId string, videos []Video) error
+}
+
+var (
+	videoStoreMu sync.RWMutex
+	videoStore   VideoStore
+)
+
+// Sets the store videos are persisted to after being retrieved
+func SetVideoStore(store VideoStore) {
+	videoStoreMu.Lock()
+	defer videoStoreMu.Unlock()
+
+	videoStore = store
+}
+
+// Persists videos freshly retrieved for channel, failures are only logged. The store is not
+// cancelled with ctx so videos retrieved for a request that was abandoned are still kept
+func storeVideos(ctx context.Context, channel FeedChannel, videos []Video) {
+	videoStoreMu.RLock()
+	store := videoStore
+	videoStoreMu.RUnlock()
+
+	if store == nil || channel.ChannelId == "" || len(videos) == 0 {
+		return
+	}
+
+	err := store.StoreVideos(context.WithoutCancel(ctx), channel.ChannelId, videos)
+	if err != nil {
+		logging.FromContext(ctx).Error("in storeVideos(): error storing videos", logging.KeyChannelID, channel.ChannelId, logging.Err(err))
+	}
+}
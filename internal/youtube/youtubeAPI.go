@@ -8,32 +8,73 @@ import (
 	"os"
 
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
 )
 
-type video struct {
+type Video struct {
 	ChannelName  string    `json:"channel"`
 	Title        string    `json:"title"`
 	VideoId      string    `json:"id"`
 	ThumbnailURL string    `json:"thumbnailURL"`
 	PublishedAt  time.Time `json:"publishedAt"`
 	VideoURL     string    `json:"videoURL"`
+	Description  string    `json:"-"` // stored for search only
+}
+
+var tracer = otel.Tracer("github.com/luke-mayer/youtube-custom-feeds/internal/youtube")
+
+var (
+	apiKeyMu sync.RWMutex
+	apiKey   string
+)
+
+// Sets the API key used for subsequent calls, replacing a rotated key without a restart. ""
+// falls back to the YOUTUBE_CUSTOM_FEEDS_YT_API_KEY environment variable
+func SetAPIKey(key string) {
+	apiKeyMu.Lock()
+	defer apiKeyMu.Unlock()
+
+	apiKey = key
 }
 
 func getApiKey() string {
+	apiKeyMu.RLock()
+	defer apiKeyMu.RUnlock()
+
+	if apiKey != "" {
+		return apiKey
+	}
 	return os.Getenv("YOUTUBE_CUSTOM_FEEDS_YT_API_KEY")
 }
 
+// Overrides the API base URL when set, used to point the client at a local fake
+var apiEndpoint string
+
+// Sets the base URL the client calls instead of the YouTube API, "" restores the default
+func SetAPIEndpoint(endpoint string) {
+	apiEndpoint = endpoint
+}
+
 func getService() (*youtube.Service, error) {
 	ctx := context.Background()
-	apiKey := getApiKey()
 
-	service, err := youtube.NewService(ctx, option.WithAPIKey(apiKey))
+	opts := []option.ClientOption{option.WithAPIKey(getApiKey())}
+	if apiEndpoint != "" {
+		opts = append(opts, option.WithEndpoint(apiEndpoint))
+	}
+
+	service, err := youtube.NewService(ctx, opts...)
 	if err != nil {
 		newErr := fmt.Sprintf("in getService(): error creating YouTube client:\n%v", err)
 		return nil, errors.New(newErr)
@@ -42,34 +83,202 @@ func getService() (*youtube.Service, error) {
 	return service, nil
 }
 
-func GetChannelIdUploadId(channelHandle string) (exisits bool, channelId string, uploadId string, err error) {
+// Channel details shown to users, refreshed periodically
+type ChannelMetadata struct {
+	Handle           string // current handle, empty if the channel has none
+	Title            string
+	Description      string
+	AvatarDefaultURL string
+	AvatarMediumURL  string
+	AvatarHighURL    string
+	SubscriberCount  int64
+	VideoCount       int64
+}
+
+// Ids and metadata of a channel retrieved by handle
+type ChannelDetails struct {
+	ChannelId string
+	UploadId  string
+	Metadata  ChannelMetadata
+}
+
+// channels.list accepts at most this many ids per call
+const MAX_CHANNEL_IDS = 50
+
+func GetChannelIdUploadId(ctx context.Context, channelHandle string) (exisits bool, channelId string, uploadId string, err error) {
+	exists, details, err := GetChannelDetails(ctx, channelHandle)
+	return exists, details.ChannelId, details.UploadId, err
+}
+
+// Retrieves the ids and metadata of the channel with the given handle
+func GetChannelDetails(ctx context.Context, channelHandle string) (exists bool, details ChannelDetails, err error) {
+	if status := quota.status(); status != QuotaOK {
+		return false, details, fmt.Errorf("in GetChannelDetails(): refusing channel lookup, quota status %s: %w", status, ErrQuotaExceeded)
+	}
+
 	service, err := getService()
 	if err != nil {
-		newErr := fmt.Errorf("in GetChannelUploadId(): error getting youtube service: %s", err)
-		return false, "", "", newErr
+		newErr := fmt.Errorf("in GetChannelDetails(): error getting youtube service: %s", err)
+		return false, details, newErr
 	}
 
-	call := service.Channels.List([]string{"id", "contentDetails"}).ForHandle(channelHandle)
-	response, err := call.Do()
+	var response *youtube.ChannelListResponse
+	call := service.Channels.List([]string{"id", "contentDetails", "snippet", "statistics"}).ForHandle(channelHandle)
+	err = callAPI(ctx, MethodChannelsList, CostChannelsList, func() (err error) {
+		response, err = call.Context(ctx).Do()
+		return err
+	})
 	if err != nil {
-		newErr := fmt.Sprintf("in GetChannelUploadId(): error retrieving channel details by handle:\n%v", err)
-		return false, "", "", errors.New(newErr)
+		return false, details, fmt.Errorf("in GetChannelDetails(): error retrieving channel details by handle: %w", err)
 	}
 
 	if len(response.Items) == 0 {
-		log.Printf("in GetChannelUploadId(): no channel found with handle: %s", channelHandle)
-		return false, "", "", nil
+		logging.FromContext(ctx).Info("in GetChannelDetails(): no channel found", "handle", channelHandle)
+		return false, details, nil
 	}
 
 	channel := response.Items[0]
-	channelId = channel.Id
-	uploadId = channel.ContentDetails.RelatedPlaylists.Uploads
+	details.ChannelId = channel.Id
+	if channel.ContentDetails != nil && channel.ContentDetails.RelatedPlaylists != nil {
+		details.UploadId = channel.ContentDetails.RelatedPlaylists.Uploads
+	}
+	details.Metadata = channelToMetadata(channel)
+	if details.Metadata.Handle == "" {
+		details.Metadata.Handle = channelHandle
+	}
+
+	if len(details.UploadId) < 5 {
+		logging.FromContext(ctx).Warn("in GetChannelDetails(): unexpected uploadId", "handle", channelHandle, logging.KeyUploadID, details.UploadId)
+	}
+
+	return true, details, nil
+}
+
+// Retrieves the current metadata of each channel, keyed by channelId. Channels that no longer
+// exist are missing from the result
+func GetChannelsMetadata(ctx context.Context, channelIds []string) (map[string]ChannelMetadata, error) {
+	metadata := map[string]ChannelMetadata{}
+
+	if status := quota.status(); status != QuotaOK {
+		return metadata, fmt.Errorf("in GetChannelsMetadata(): refusing metadata refresh, quota status %s: %w", status, ErrQuotaExceeded)
+	}
+
+	service, err := getService()
+	if err != nil {
+		return metadata, fmt.Errorf("in GetChannelsMetadata(): error getting youtube service: %s", err)
+	}
+
+	for start := 0; start < len(channelIds); start += MAX_CHANNEL_IDS {
+		batch := channelIds[start:min(start+MAX_CHANNEL_IDS, len(channelIds))]
+
+		var response *youtube.ChannelListResponse
+		call := service.Channels.List([]string{"id", "snippet", "statistics"}).Id(batch...).MaxResults(MAX_CHANNEL_IDS)
+		err = callAPI(ctx, MethodChannelsList, CostChannelsList, func() (err error) {
+			response, err = call.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return metadata, fmt.Errorf("in GetChannelsMetadata(): error retrieving channel metadata: %w", err)
+		}
+
+		for _, channel := range response.Items {
+			metadata[channel.Id] = channelToMetadata(channel)
+		}
+	}
+
+	return metadata, nil
+}
+
+// A channel returned by SearchChannels
+type ChannelCandidate struct {
+	ChannelId string
+	Metadata  ChannelMetadata
+}
+
+// Searches YouTube for channels matching query, most relevant first. The search resource is
+// expensive (100 units) so searches are refused once the quota soft limit is reached
+func SearchChannels(ctx context.Context, query string, limit int64) ([]ChannelCandidate, error) {
+	candidates := []ChannelCandidate{}
+
+	if status := quota.status(); status != QuotaOK {
+		return candidates, fmt.Errorf("in SearchChannels(): refusing channel search, quota status %s: %w", status, ErrQuotaExceeded)
+	}
+
+	service, err := getService()
+	if err != nil {
+		return candidates, fmt.Errorf("in SearchChannels(): error getting youtube service: %s", err)
+	}
+
+	var response *youtube.SearchListResponse
+	call := service.Search.List([]string{"id"}).Q(query).Type("channel").MaxResults(limit)
+	err = callAPI(ctx, MethodSearchList, CostSearchList, func() (err error) {
+		response, err = call.Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return candidates, fmt.Errorf("in SearchChannels(): error searching channels: %w", err)
+	}
+
+	channelIds := []string{}
+	for _, item := range response.Items {
+		if item.Id != nil && item.Id.ChannelId != "" {
+			channelIds = append(channelIds, item.Id.ChannelId)
+		}
+	}
+	if len(channelIds) == 0 {
+		return candidates, nil
+	}
+
+	// search results have no handle or statistics
+	metadata, err := GetChannelsMetadata(ctx, channelIds)
+	if err != nil {
+		return candidates, fmt.Errorf("in SearchChannels(): %w", err)
+	}
+
+	for _, channelId := range channelIds {
+		channelMetadata, ok := metadata[channelId]
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, ChannelCandidate{
+			ChannelId: channelId,
+			Metadata:  channelMetadata,
+		})
+	}
+
+	return candidates, nil
+}
+
+// Extracts the metadata from a channels.list item, missing parts are left empty
+func channelToMetadata(channel *youtube.Channel) ChannelMetadata {
+	metadata := ChannelMetadata{}
+
+	if snippet := channel.Snippet; snippet != nil {
+		// customUrl is the handle for channels that have one, legacy custom urls have no @
+		if strings.HasPrefix(snippet.CustomUrl, "@") {
+			metadata.Handle = snippet.CustomUrl
+		}
+		metadata.Title = snippet.Title
+		metadata.Description = snippet.Description
+		if thumbnails := snippet.Thumbnails; thumbnails != nil {
+			if thumbnails.Default != nil {
+				metadata.AvatarDefaultURL = thumbnails.Default.Url
+			}
+			if thumbnails.Medium != nil {
+				metadata.AvatarMediumURL = thumbnails.Medium.Url
+			}
+			if thumbnails.High != nil {
+				metadata.AvatarHighURL = thumbnails.High.Url
+			}
+		}
+	}
 
-	if len(uploadId) < 5 {
-		log.Printf("ChannelHandle<%s> uploadId<%s>\n", channelHandle, uploadId)
+	if statistics := channel.Statistics; statistics != nil {
+		metadata.SubscriberCount = int64(statistics.SubscriberCount)
+		metadata.VideoCount = int64(statistics.VideoCount)
 	}
 
-	return true, channelId, uploadId, nil
+	return metadata
 }
 
 // Might be unecessary
@@ -78,8 +287,8 @@ func GetChannelURL(channelId string) string {
 	return channelURL
 }
 
-func responseToVideos(response *youtube.PlaylistItemListResponse) []video {
-	recentVideos := []video{}
+func responseToVideos(response *youtube.PlaylistItemListResponse) []Video {
+	recentVideos := []Video{}
 	for _, item := range response.Items {
 		id := item.Snippet.ResourceId.VideoId
 		url := fmt.Sprintf("https://www.youtube.com/watch?v=%s", id)
@@ -90,13 +299,14 @@ func responseToVideos(response *youtube.PlaylistItemListResponse) []video {
 			log.Printf("in responseToVideos(): error parsing publishedAt to time.Time for video with id: %s, error message: %s", id, err)
 		}
 
-		youtubeVideo := video{
+		youtubeVideo := Video{
 			ChannelName:  item.Snippet.ChannelTitle,
 			Title:        item.Snippet.Title,
 			VideoId:      id,
 			ThumbnailURL: item.Snippet.Thumbnails.High.Url,
 			PublishedAt:  publishedAt,
 			VideoURL:     url,
+			Description:  item.Snippet.Description,
 		}
 		recentVideos = append(recentVideos, youtubeVideo)
 	}
@@ -104,78 +314,132 @@ func responseToVideos(response *youtube.PlaylistItemListResponse) []video {
 	return recentVideos
 }
 
-func getChannelVideos(limit int64, uploadId string) ([]video, error) {
+func getChannelVideos(ctx context.Context, limit int64, uploadId string) channelFetch {
+	if status := quota.status(); status != QuotaOK {
+		err := fmt.Errorf("in getChannelVideos(): uploadId<%v>: %w", uploadId, ErrQuotaExceeded)
+		if cached, cachedAt, ok := channelCache.get(uploadId); ok {
+			return channelFetch{videos: cached, cachedAt: cachedAt, err: err}
+		}
+		if status == QuotaExhausted {
+			return channelFetch{videos: []Video{}, err: err}
+		}
+	}
+
 	service, err := getService()
 	if err != nil {
-		return []video{}, fmt.Errorf("in getChannelVideos(): error retrieving youtube service: %v", err)
+		return channelFetch{videos: []Video{}, err: fmt.Errorf("in getChannelVideos(): error retrieving youtube service: %v", err)}
 	}
 
+	var response *youtube.PlaylistItemListResponse
 	call := service.PlaylistItems.List([]string{"snippet"}).PlaylistId(uploadId).MaxResults(limit)
-	response, err := call.Do()
+	err = callAPI(ctx, MethodPlaylistItemsList, CostPlaylistItemsList, func() (err error) {
+		response, err = call.Context(ctx).Do()
+		return err
+	})
 	if err != nil {
-		return []video{}, fmt.Errorf("in getChannelVideos(): error retrieving videos from youtube API: uploadId<%v>: %v", uploadId, err)
+		err = fmt.Errorf("in getChannelVideos(): error retrieving videos from youtube API: uploadId<%v>: %w", uploadId, err)
+		// keeps the channel in the feed while YouTube is unhealthy
+		if errors.Is(err, ErrUnavailable) {
+			if cached, cachedAt, ok := channelCache.get(uploadId); ok {
+				logging.FromContext(ctx).Warn("in getChannelVideos(): serving cached videos", logging.KeyUploadID, uploadId, logging.Err(err))
+				return channelFetch{videos: cached, cachedAt: cachedAt, err: err}
+			}
+		}
+		return channelFetch{videos: []Video{}, err: err}
 	}
 
 	channelVideos := responseToVideos(response)
+	channelCache.set(uploadId, channelVideos)
 
-	return channelVideos, nil
+	return channelFetch{videos: channelVideos}
 }
 
-func getFeedVideos(limit int64, uploadIds []string) ([]video, []error) {
-	var waitGroupChannels, waitGroupFinished sync.WaitGroup
-	videoSliceChannel := make(chan []video, len(uploadIds))
-	errorsChannel := make(chan error, len(uploadIds))
-	allVideos := []video{}
-	allErrors := []error{}
-
-	for _, uploadId := range uploadIds {
-		waitGroupChannels.Add(1)
-
-		go func(id string) {
-			defer waitGroupChannels.Done()
+// Retrieves videos for every channel concurrently, returned keyed by uploadId along with
+// the status of each channel (in the order given). Logs go to the logger carried by ctx
+func getChannelsVideos(ctx context.Context, limit int64, channels []FeedChannel) (map[string][]Video, []ChannelStatus) {
+	ctx, span := tracer.Start(ctx, "youtube.getChannelsVideos", trace.WithAttributes(attribute.Int("youtube.channels", len(channels))))
+	defer span.End()
+
+	var waitGroup sync.WaitGroup
+	fetches := make([]channelFetch, len(channels))
+	channels = slices.Clone(channels) // DeadReason is set on channels found to be dead
+	getMetrics().FeedFanout(len(channels))
+
+	for i, channel := range channels {
+		if channel.DeadReason != "" {
+			fetches[i] = channelFetch{videos: []Video{}}
+			continue
+		}
 
-			videos, err := getChannelVideos(limit, uploadId)
-			if err != nil {
-				newErr := fmt.Errorf("in getFeedVideos(): error retrieving videos for channel with uploadId: %s, : %v", uploadId, err)
-				log.Printf("%v\n", newErr)
-				errorsChannel <- newErr
+		waitGroup.Add(1)
+
+		go func(i int, channel FeedChannel) {
+			defer waitGroup.Done()
+
+			ctx, span := tracer.Start(ctx, "youtube.getChannelVideos", trace.WithAttributes(
+				attribute.String("youtube.channel_id", channel.ChannelId),
+				attribute.String("youtube.upload_id", channel.UploadId),
+			))
+			defer span.End()
+
+			fetches[i] = getChannelVideos(ctx, limit, channel.UploadId)
+			span.SetAttributes(
+				attribute.Int("youtube.videos", len(fetches[i].videos)),
+				attribute.Bool("youtube.cached", !fetches[i].cachedAt.IsZero()),
+			)
+			if fetches[i].err == nil {
+				storeVideos(ctx, channel, fetches[i].videos)
+				return
+			}
+			span.RecordError(fetches[i].err)
+			span.SetStatus(codes.Error, ErrorCode(fetches[i].err))
+			logging.FromContext(ctx).Warn("in getChannelsVideos(): error retrieving videos",
+				logging.KeyChannelID, channel.ChannelId, logging.KeyUploadID, channel.UploadId, logging.Err(fetches[i].err))
+
+			dead, empty := checkDeadChannel(ctx, channel, fetches[i])
+			switch {
+			case dead:
+				channels[i].DeadReason = ErrorCode(fetches[i].err)
+			case empty:
+				fetches[i] = channelFetch{videos: []Video{}}
 			}
+		}(i, channel)
+	}
+
+	waitGroup.Wait()
 
-			videoSliceChannel <- videos
-		}(uploadId)
+	channelVideos := map[string][]Video{}
+	statuses := []ChannelStatus{}
+	for i, channel := range channels {
+		channelVideos[channel.UploadId] = append(channelVideos[channel.UploadId], fetches[i].videos...)
+		statuses = append(statuses, newChannelStatus(channel, fetches[i]))
 	}
+	reportChannelStatuses(ctx, statuses)
 
-	// Closes channel after all the videos are retrieved
-	go func() {
-		waitGroupChannels.Wait()
-		close(videoSliceChannel)
-		close(errorsChannel)
-	}()
+	return channelVideos, statuses
+}
 
-	waitGroupFinished.Add(1)
-	go func() {
-		for videos := range videoSliceChannel {
-			allVideos = append(allVideos, videos...)
-		}
-		waitGroupFinished.Done()
-	}()
+// Retrieves videos for every channel, sorted by date
+func getFeedVideos(limit int64, uploadIds []string) ([]Video, []error) {
+	channels := []FeedChannel{}
+	for _, uploadId := range uploadIds {
+		channels = append(channels, FeedChannel{UploadId: uploadId})
+	}
 
-	waitGroupFinished.Add(1)
-	go func() {
-		for err := range errorsChannel {
-			allErrors = append(allErrors, err)
-		}
-		waitGroupFinished.Done()
-	}()
+	channelVideos, statuses := getChannelsVideos(context.Background(), limit, channels)
 
-	waitGroupFinished.Wait()
-	sortByDate(allVideos)
+	errs := []error{}
+	for _, status := range statuses {
+		if status.Status == ChannelFailed {
+			errs = append(errs, fmt.Errorf("in getFeedVideos(): uploadId<%s>: %s", status.UploadId, status.ErrorCode))
+		}
+	}
 
-	return allVideos, allErrors
+	return mergeByDate(channelVideos), errs
 }
 
 // Returns a slice of videos as strings
-func videosAsStrings(videos []video) []string {
+func videosAsStrings(videos []Video) []string {
 	videoStrings := []string{}
 
 	for _, v := range videos {
@@ -192,14 +456,18 @@ func videosAsStrings(videos []video) []string {
 	return videoStrings
 }
 
-// Returns slice of JSON representation of videos
-func videosAsJSON(videos []video) ([]byte, error) {
+// Returns JSON representation of videos along with the status of each channel
+func videosAsJSON(videos []Video, status FeedStatus, channels []ChannelStatus) ([]byte, error) {
 	type videoStruct struct {
-		Videos []video `json:"videos"`
+		Status   FeedStatus      `json:"status"`
+		Videos   []Video         `json:"videos"`
+		Channels []ChannelStatus `json:"channels"`
 	}
 
 	vidStruct := videoStruct{
-		Videos: videos,
+		Status:   status,
+		Videos:   videos,
+		Channels: channels,
 	}
 
 	videosJSON, err := json.Marshal(vidStruct)
@@ -211,36 +479,58 @@ func videosAsJSON(videos []video) ([]byte, error) {
 	return videosJSON, nil
 }
 
-// Retrieves videos for the feed in JSON format
-func GetFeedVideosJSON(limit int64, uploadIds []string) ([]byte, error) {
-	videos, errs := getFeedVideos(limit, uploadIds)
-	if len(errs) > 0 {
-		log.Println("in getFeedVideosJSON(): errors:")
-		for _, err := range errs {
-			log.Println(err)
-		}
+// Retrieves videos for the feed merged according to opts, along with the status of each channel
+// and of the feed. Channels that could not be loaded are reported in the statuses rather than
+// failing the feed, the returned FeedStatus is FeedFailed only when every channel failed
+func GetFeedVideos(ctx context.Context, limit int64, channels []FeedChannel, opts MergeOptions) ([]Video, []ChannelStatus, FeedStatus) {
+	priorities := map[string]int32{}
+	for _, channel := range channels {
+		priorities[channel.UploadId] = channel.Priority
 	}
-	if len(videos) < 1 {
-		return []byte{}, fmt.Errorf("in GetFeedVideosJSON(): error, no videos retrieved")
+
+	channelVideos, statuses := getChannelsVideos(ctx, limit, channels)
+
+	videos := mergeVideos(channelVideos, priorities, opts)
+	if videos == nil {
+		videos = []Video{}
 	}
 
-	videosJSON, err := videosAsJSON(videos)
+	return videos, statuses, feedStatus(statuses)
+}
+
+// Retrieves videos for the feed in JSON format, as GetFeedVideos
+func GetFeedVideosJSON(ctx context.Context, limit int64, channels []FeedChannel, opts MergeOptions) ([]byte, FeedStatus, error) {
+	videos, statuses, status := GetFeedVideos(ctx, limit, channels, opts)
+
+	videosJSON, err := videosAsJSON(videos, status, statuses)
 	if err != nil {
-		return []byte{}, fmt.Errorf("in GetFeedVideosJSON(): error marshaling videos as JSON: %v", err)
+		return []byte{}, status, fmt.Errorf("in GetFeedVideosJSON(): error marshaling videos as JSON: %v", err)
 	}
 
-	return videosJSON, nil
+	return videosJSON, status, nil
+}
+
+// Retrieves videos for every channel in the feed sorted by date, along with the feed's status
+func GetFeedVideosByDate(ctx context.Context, limit int64, channels []FeedChannel) ([]Video, FeedStatus) {
+	channelVideos, statuses := getChannelsVideos(ctx, limit, channels)
+
+	videos := mergeByDate(channelVideos)
+	if videos == nil {
+		videos = []Video{}
+	}
+
+	return videos, feedStatus(statuses)
 }
 
 // Prints videos - mainly for testing purposes
-func printVideos(videos []video) {
+func printVideos(videos []Video) {
 	fmt.Println()
 	fmt.Print(videosAsStrings(videos))
 }
 
 // sorts a slice of videos in descending order by publication date and time
-func sortByDate(videos []video) {
-	slices.SortFunc(videos, func(a, b video) int {
+func sortByDate(videos []Video) {
+	slices.SortFunc(videos, func(a, b Video) int {
 		return a.PublishedAt.Compare(b.PublishedAt) * -1
 	})
 }
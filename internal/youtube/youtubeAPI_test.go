@@ -1,12 +1,18 @@
 package youtube
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
 func TestGetFeedVideos(t *testing.T) {
-	var allVideos []video
+	var allVideos []Video
 	uploadIds := []string{}
 	channelHandles := []string{
 		"@theonlyzanny", "@ThePrimeTimeagen", "@ColbertLateShow",
@@ -19,7 +25,7 @@ func TestGetFeedVideos(t *testing.T) {
 	*/
 
 	for _, handle := range channelHandles {
-		exists, _, uploadId, err := GetChannelIdUploadId(handle)
+		exists, _, uploadId, err := GetChannelIdUploadId(context.Background(), handle)
 		log.Println(uploadId)
 		if err != nil {
 			log.Printf("in TestGetFeedVideos: error getting channelId uploadId: %v", err)
@@ -47,3 +53,175 @@ func TestGetFeedVideos(t *testing.T) {
 
 	printVideos(allVideos)
 }
+
+const channelsResponse = `{
+	"items": [{
+		"id": "UCfake",
+		"contentDetails": {"relatedPlaylists": {"uploads": "UUfake"}},
+		"snippet": {
+			"customUrl": "@fakerenamed",
+			"title": "Fake Channel",
+			"description": "Videos about fakes",
+			"thumbnails": {
+				"default": {"url": "https://yt3.ggpht.com/fake=s88"},
+				"medium": {"url": "https://yt3.ggpht.com/fake=s240"},
+				"high": {"url": "https://yt3.ggpht.com/fake=s800"}
+			}
+		},
+		"statistics": {"subscriberCount": "1200", "videoCount": "34"}
+	}]
+}`
+
+func TestGetChannelDetails(t *testing.T) {
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, channelsResponse)
+	})
+
+	exists, details, err := GetChannelDetails(context.Background(), "@fake")
+	if err != nil || !exists {
+		t.Fatalf("in TestGetChannelDetails: got exists<%v> err<%v>", exists, err)
+	}
+
+	want := ChannelDetails{
+		ChannelId: "UCfake",
+		UploadId:  "UUfake",
+		Metadata: ChannelMetadata{
+			Handle:           "@fakerenamed",
+			Title:            "Fake Channel",
+			Description:      "Videos about fakes",
+			AvatarDefaultURL: "https://yt3.ggpht.com/fake=s88",
+			AvatarMediumURL:  "https://yt3.ggpht.com/fake=s240",
+			AvatarHighURL:    "https://yt3.ggpht.com/fake=s800",
+			SubscriberCount:  1200,
+			VideoCount:       34,
+		},
+	}
+	if details != want {
+		log.Printf("in TestGetChannelDetails: got %+v, want %+v", details, want)
+		t.Fail()
+	}
+}
+
+func TestGetChannelsMetadataBatches(t *testing.T) {
+	var calls atomic.Int32
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		items := []string{}
+		for _, id := range strings.Split(strings.Join(r.URL.Query()["id"], ","), ",") {
+			items = append(items, fmt.Sprintf(`{"id": "%s", "snippet": {"title": "title %s"}}`, id, id))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+	})
+
+	channelIds := []string{}
+	for i := 0; i < MAX_CHANNEL_IDS+10; i++ {
+		channelIds = append(channelIds, fmt.Sprintf("UC%d", i))
+	}
+
+	metadata, err := GetChannelsMetadata(context.Background(), channelIds)
+	if err != nil {
+		t.Fatalf("in TestGetChannelsMetadataBatches: unexpected error: %v", err)
+	}
+	if len(metadata) != len(channelIds) {
+		log.Printf("in TestGetChannelsMetadataBatches: got metadata for %d channels, want %d", len(metadata), len(channelIds))
+		t.Fail()
+	}
+	if metadata["UC55"].Title != "title UC55" {
+		log.Printf("in TestGetChannelsMetadataBatches: got title<%s> for UC55", metadata["UC55"].Title)
+		t.Fail()
+	}
+	if calls.Load() != 2 {
+		log.Printf("in TestGetChannelsMetadataBatches: got %d calls, want 2", calls.Load())
+		t.Fail()
+	}
+}
+
+// In-memory VideoStore, videos keyed by channelId
+type testVideoStore struct {
+	mu     sync.Mutex
+	videos map[string][]Video
+}
+
+func (s *testVideoStore) StoreVideos(ctx context.Context, channelId string, videos []Video) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.videos[channelId] = append(s.videos[channelId], videos...)
+	return nil
+}
+
+func TestStoresRetrievedVideos(t *testing.T) {
+	store := &testVideoStore{videos: map[string][]Video{}}
+	SetVideoStore(store)
+	t.Cleanup(func() {
+		SetVideoStore(nil)
+	})
+
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, strings.Replace(playlistItemsResponse, `"title": "Fake Video",`, `"title": "Fake Video", "description": "All about fakes",`, 1))
+	})
+
+	getChannelsVideos(context.Background(), 3, []FeedChannel{{ChannelId: "UCstored", UploadId: "UUstored"}})
+
+	stored := store.videos["UCstored"]
+	if len(stored) != 1 || stored[0].Description != "All about fakes" {
+		log.Printf("in TestStoresRetrievedVideos: got stored videos %+v", stored)
+		t.Fail()
+	}
+}
+
+func TestSearchChannels(t *testing.T) {
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/search") {
+			if r.URL.Query().Get("type") != "channel" {
+				writeAPIError(w, http.StatusBadRequest, "invalidParameter")
+				return
+			}
+			fmt.Fprint(w, `{"items": [{"id": {"kind": "youtube#channel", "channelId": "UCsecond"}}, {"id": {"kind": "youtube#channel", "channelId": "UCfirst"}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"items": [
+			{"id": "UCfirst", "snippet": {"customUrl": "@first", "title": "First"}, "statistics": {"subscriberCount": "10"}},
+			{"id": "UCsecond", "snippet": {"customUrl": "@second", "title": "Second"}, "statistics": {"subscriberCount": "20"}}
+		]}`)
+	})
+
+	candidates, err := SearchChannels(context.Background(), "some creator", 5)
+	if err != nil {
+		t.Fatalf("in TestSearchChannels: unexpected error: %v", err)
+	}
+
+	if len(candidates) != 2 || candidates[0].ChannelId != "UCsecond" || candidates[0].Metadata.Handle != "@second" || candidates[1].Metadata.SubscriberCount != 10 {
+		log.Printf("in TestSearchChannels: got candidates %+v", candidates)
+		t.Fail()
+	}
+}
+
+func TestSetAPIKeyRotation(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	newFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.URL.Query().Get("key"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, playlistItemsResponse)
+	})
+	t.Cleanup(func() { SetAPIKey("") })
+
+	getChannelVideos(context.Background(), 3, "UUkeyEnv")
+	SetAPIKey("rotated-key")
+	getChannelVideos(context.Background(), 3, "UUkeyRotated")
+	SetAPIKey("")
+	getChannelVideos(context.Background(), 3, "UUkeyCleared")
+
+	want := []string{"test-key", "rotated-key", "test-key"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		log.Printf("in TestSetAPIKeyRotation: got keys %v, want %v", keys, want)
+		t.Fail()
+	}
+}
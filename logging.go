@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header carrying the request id, taken from the client or load balancer when present and
+// echoed on every response
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// Request ids accepted from clients, anything else is replaced so logs cannot be forged
+var requestIdRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestInfoKey struct{}
+
+// Details resolved while a request is served, reported in the access log
+type requestInfo struct {
+	userId atomic.Int32
+}
+
+// Records the user making the request for the access log and the request's span
+func setRequestUser(r *http.Request, userId int32) {
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("enduser.id", int(userId)))
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.userId.Store(userId)
+	}
+}
+
+// Returns the logger for the request, carrying its request id and route
+func requestLogger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context())
+}
+
+// Logs an error for the request. msg names where it happened, err may be nil when the request
+// was rejected without one and attrs are key-value pairs adding detail
+func logRequestError(r *http.Request, msg string, err error, attrs ...any) {
+	if err != nil {
+		attrs = append(attrs, logging.Err(err))
+	}
+	requestLogger(r).Error(msg, attrs...)
+}
+
+// Returns a context for background jobs whose logs carry the job name, cancelled with ctx
+func jobContext(ctx context.Context, job string) context.Context {
+	return logging.NewContext(ctx, slog.Default().With("job", job))
+}
+
+// Records the status code and size of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.statusCode == 0 {
+		sr.statusCode = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(data []byte) (int, error) {
+	if sr.statusCode == 0 {
+		sr.statusCode = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(data)
+	sr.bytes += n
+	return n, err
+}
+
+// Keeps streaming responses working through the recorder
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Middleware - assigns every request an id, carries a logger tagged with it through the request
+// context and writes an access log line once the response is sent
+func (s *state) requestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestId := r.Header.Get(REQUEST_ID_HEADER)
+		if !requestIdRegex.MatchString(requestId) {
+			requestId = logging.NewRequestID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestId)
+
+		route, ok := routeTemplate(r)
+		if !ok {
+			route = r.URL.Path
+		}
+
+		logger := slog.Default().With(
+			logging.KeyRequestID, requestId,
+			logging.KeyMethod, r.Method,
+			logging.KeyRoute, route,
+		)
+		if traceId, spanId, ok := tracing.IDs(r.Context()); ok {
+			logger = logger.With(logging.KeyTraceID, traceId, logging.KeySpanID, spanId)
+		}
+		info := &requestInfo{}
+		ctx := logging.NewContext(r.Context(), logger)
+		ctx = context.WithValue(ctx, requestInfoKey{}, info)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		if recorder.statusCode == 0 {
+			recorder.statusCode = http.StatusOK
+		}
+
+		attrs := []any{
+			logging.KeyStatus, recorder.statusCode,
+			logging.KeyLatencyMs, time.Since(start).Milliseconds(),
+			"bytes", recorder.bytes,
+			"client_ip", clientIP(r, s.cfg.Server.TrustedProxies),
+		}
+		if userId := info.userId.Load(); userId != 0 {
+			attrs = append(attrs, logging.KeyUserID, userId)
+		}
+
+		level := slog.LevelInfo
+		if recorder.statusCode >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if isProbeRoute(r) {
+			level = slog.LevelDebug // probes arrive every few seconds
+		}
+		logger.Log(ctx, level, "request completed", attrs...)
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+)
+
+// Captures everything logged through the default logger as JSON entries
+func captureLogs(t *testing.T) func() []map[string]any {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, "json", "debug"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return func() []map[string]any {
+		entries := []map[string]any{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var entry map[string]any
+			if json.Unmarshal([]byte(line), &entry) == nil {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+}
+
+// Returns the access log entry
+func accessLog(t *testing.T, entries []map[string]any) map[string]any {
+	for _, entry := range entries {
+		if entry["msg"] == "request completed" {
+			return entry
+		}
+	}
+
+	t.Fatalf("no access log entry in %v", entries)
+	return nil
+}
+
+func TestRequestLoggingAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/feeds", nil)
+	req.Header.Set("Firebase-ID", "firebase-user")
+	req.Header.Set(REQUEST_ID_HEADER, "lb-1234")
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, req)
+
+	if got := recorder.Header().Get(REQUEST_ID_HEADER); got != "lb-1234" {
+		t.Errorf("got %s %q, want the client's id echoed", REQUEST_ID_HEADER, got)
+	}
+
+	entry := accessLog(t, logs())
+	want := map[string]any{
+		logging.KeyRequestID: "lb-1234",
+		logging.KeyMethod:    http.MethodGet,
+		logging.KeyRoute:     PREFIX_V2 + "/feeds",
+		logging.KeyStatus:    float64(http.StatusOK),
+		logging.KeyUserID:    float64(1),
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("got %s %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry[logging.KeyLatencyMs]; !ok {
+		t.Errorf("access log has no %s", logging.KeyLatencyMs)
+	}
+}
+
+func TestRequestLoggingCorrelatesErrors(t *testing.T) {
+	logs := captureLogs(t)
+	s, db := newFakeState(t)
+	db.authorize()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/feeds/9", nil)
+	req.Header.Set("Firebase-ID", "firebase-user")
+	req.Header.Set(REQUEST_ID_HEADER, "not a valid id\n")
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, req)
+
+	requestId := recorder.Header().Get(REQUEST_ID_HEADER)
+	if requestId == "" || requestId == "not a valid id\n" {
+		t.Fatalf("got %s %q, want a generated id", REQUEST_ID_HEADER, requestId)
+	}
+
+	entries := logs()
+	if len(entries) < 2 {
+		t.Fatalf("got %d log entries, want the handler error and the access log", len(entries))
+	}
+	for _, entry := range entries {
+		if entry[logging.KeyRequestID] != requestId {
+			t.Errorf("entry %v is not tagged with request id %s", entry, requestId)
+		}
+	}
+	if status := accessLog(t, entries)[logging.KeyStatus]; status != float64(http.StatusNotFound) {
+		t.Errorf("got status %v, want %d", status, http.StatusNotFound)
+	}
+
+	// the handler's error and status are attributes rather than part of the message
+	handlerError := entries[0]
+	if handlerError[logging.KeyError] == nil || handlerError[logging.KeyStatus] != float64(http.StatusNotFound) {
+		t.Errorf("got handler error entry %v, want the error and status as attributes", handlerError)
+	}
+}
@@ -2,21 +2,38 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/digest"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/tracing"
 	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
 )
 
-const PORT = ":8080"
 const PREFIX = "/api/v1"
-const VIDEO_LIMIT = 10
+const PREFIX_V2 = "/api/v2"
+const PREFIX_ADMIN = "/api/admin"
+const OPENAPI_PATH = "/api/openapi.yaml"
 
 type StatusCodes struct {
 	Success       int
+	Created       int
 	ErrRequest    int
 	ErrDecoding   int
 	ErrFirebaseId int
@@ -26,10 +43,17 @@ type StatusCodes struct {
 	ErrMarshaling int
 	ErrFeed       int
 	ErrFeedExists int
+	ErrNotFound   int
+	ErrConflict   int
+	ErrRateLimit  int
+	ErrForbidden  int
+	ErrQuota      int
+	ErrUpstream   int
 }
 
 var statusCodes = StatusCodes{
 	Success:       200,
+	Created:       201,
 	ErrRequest:    400,
 	ErrDecoding:   400,
 	ErrFirebaseId: 400,
@@ -39,10 +63,17 @@ var statusCodes = StatusCodes{
 	ErrMarshaling: 500,
 	ErrFeed:       500,
 	ErrFeedExists: 500,
+	ErrNotFound:   404,
+	ErrConflict:   409,
+	ErrRateLimit:  429,
+	ErrForbidden:  403,
+	ErrQuota:      503,
+	ErrUpstream:   502,
 }
 
 var statusCodeMessages = map[int]string{
 	statusCodes.Success:       "successful completion",
+	statusCodes.Created:       "successfully created",
 	statusCodes.ErrRequest:    "error: invalid request",
 	statusCodes.ErrDecoding:   "error: decoding parameters",
 	statusCodes.ErrFirebaseId: "error: firebase id issue",
@@ -52,10 +83,16 @@ var statusCodeMessages = map[int]string{
 	statusCodes.ErrMarshaling: "error: marshaling JSON",
 	statusCodes.ErrFeed:       "error: creating feed",
 	statusCodes.ErrFeedExists: "error: feed with provided name already exists for specified user",
+	statusCodes.ErrNotFound:   "error: resource not found",
+	statusCodes.ErrConflict:   "error: resource already exists",
+	statusCodes.ErrRateLimit:  "error: too many requests",
+	statusCodes.ErrForbidden:  "error: forbidden",
+	statusCodes.ErrQuota:      "error: youtube quota budget exhausted, try again later",
+	statusCodes.ErrUpstream:   "error: youtube is unavailable, try again later",
 }
 
 type parameters interface {
-	firebaseIdParams | feedParams | feedChannelParams | updateFeedParams
+	firebaseIdParams | feedParams | feedChannelParams | updateFeedParams | feedOrderParams | channelPriorityParams
 	getFirebaseId() string
 }
 
@@ -80,6 +117,19 @@ type updateFeedParams struct {
 	NewFeedName string `json:"newFeedName"`
 }
 
+type feedOrderParams struct {
+	FirebaseId string `json:"firebaseId"`
+	FeedName   string `json:"feedName"`
+	Order      string `json:"order"`
+}
+
+type channelPriorityParams struct {
+	FirebaseId    string `json:"firebaseId"`
+	FeedName      string `json:"feedName"`
+	ChannelHandle string `json:"channelHandle"`
+	Priority      int32  `json:"priority"`
+}
+
 func (p firebaseIdParams) getFirebaseId() string {
 	return p.FirebaseId
 }
@@ -96,6 +146,14 @@ func (p updateFeedParams) getFirebaseId() string {
 	return p.FirebaseId
 }
 
+func (p feedOrderParams) getFirebaseId() string {
+	return p.FirebaseId
+}
+
+func (p channelPriorityParams) getFirebaseId() string {
+	return p.FirebaseId
+}
+
 // Used to unpack parameters from request and initialize the state and userId, returns statusCode if error
 func unpackRequest[T parameters](params *T, r *http.Request, s *state) (int32, int, error) {
 	decoder := json.NewDecoder(r.Body)
@@ -111,11 +169,12 @@ func unpackRequest[T parameters](params *T, r *http.Request, s *state) (int32, i
 		return 0, statusCodes.ErrFirebaseId, newErr
 	}
 
-	userId, err := getUserId(s, firebaseId)
+	userId, err := getUserId(r.Context(), s, firebaseId)
 	if err != nil {
 		newErr := fmt.Errorf("in unpackRequest(): error retrieving userId: %s", err)
 		return 0, statusCodes.ErrUserId, newErr
 	}
+	setRequestUser(r, userId)
 
 	return userId, statusCodes.Success, nil
 }
@@ -128,15 +187,56 @@ func unpackGetRequest(r *http.Request, s *state) (int32, int, error) {
 		return 0, statusCodes.ErrFirebaseId, newErr
 	}
 
-	userId, err := getUserId(s, firebaseId)
+	userId, err := getUserId(r.Context(), s, firebaseId)
 	if err != nil {
 		newErr := fmt.Errorf("in unpackGetRequest(): error retrieving userId: %s", err)
 		return 0, statusCodes.ErrUserId, newErr
 	}
+	setRequestUser(r, userId)
 
 	return userId, statusCodes.Success, nil
 }
 
+// Builds the merge options for a videos request. The feed's stored order is used unless the
+// request provides an "order" query parameter, "cap" and "window" (hours) tune the capped order
+func getMergeOptions(r *http.Request, s *state, feedId int32) (youtube.MergeOptions, int, error) {
+	query := r.URL.Query()
+	opts := youtube.MergeOptions{
+		Cap:    s.cfg.Feeds.ChannelCap,
+		Window: time.Duration(s.cfg.Feeds.CapWindowHours) * time.Hour,
+	}
+
+	var err error
+	if order := query.Get("order"); order != "" {
+		opts.Strategy, err = youtube.ParseMergeStrategy(order)
+		if err != nil {
+			return opts, statusCodes.ErrRequest, fmt.Errorf("in getMergeOptions(): %s", err)
+		}
+	} else {
+		opts.Strategy, err = getFeedMergeStrategy(r.Context(), s, feedId)
+		if err != nil {
+			return opts, statusCodes.ErrServer, fmt.Errorf("in getMergeOptions(): %s", err)
+		}
+	}
+
+	if capParam := query.Get("cap"); capParam != "" {
+		opts.Cap, err = strconv.Atoi(capParam)
+		if err != nil || opts.Cap < 1 {
+			return opts, statusCodes.ErrRequest, fmt.Errorf("in getMergeOptions(): invalid cap<%s>", capParam)
+		}
+	}
+
+	if windowParam := query.Get("window"); windowParam != "" {
+		hours, err := strconv.Atoi(windowParam)
+		if err != nil || hours < 1 {
+			return opts, statusCodes.ErrRequest, fmt.Errorf("in getMergeOptions(): invalid window<%s>", windowParam)
+		}
+		opts.Window = time.Duration(hours) * time.Hour
+	}
+
+	return opts, statusCodes.Success, nil
+}
+
 // Used to write messages (such as errors) to response
 func writeResponseMessage(w http.ResponseWriter, message string, statusCode int) {
 	type returnVals struct {
@@ -153,17 +253,12 @@ func writeResponseMessage(w http.ResponseWriter, message string, statusCode int)
 func writeResponse[T any](w http.ResponseWriter, resBody T, statusCode int) {
 	data, err := json.Marshal(resBody)
 	if err != nil {
-		log.Printf("in writeResponseData(): error marshaling JSON: %s", err)
+		slog.Error("in writeResponse(): error marshaling JSON", logging.Err(err))
 		w.WriteHeader(statusCodes.ErrMarshaling)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "*")
-	w.WriteHeader(statusCode)
-	w.Write(data)
+	writeJSON(w, data, statusCode)
 }
 
 /*
@@ -197,15 +292,14 @@ func (s *state) login(w http.ResponseWriter, r *http.Request) {
 
 	firebaseId := r.Header.Get("Firebase-ID")
 	if firebaseId == "" {
-		log.Println("in login(): error retireving firebaseId")
+		logRequestError(r, "in login(): error retireving firebaseId", nil, logging.KeyStatus, statusCodes.ErrFirebaseId)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFirebaseId], statusCodes.ErrFirebaseId)
 		return
 	}
 
-	exists, err := s.db.ContainsUserByFirebaseId(context.Background(), firebaseId)
+	exists, err := s.db.ContainsUserByFirebaseId(r.Context(), firebaseId)
 	if err != nil {
-		errMessage := fmt.Sprintf("in login(): %s: %s", statusCodeMessages[statusCodes.ErrServer], err)
-		log.Println(errMessage)
+		logRequestError(r, "in login(): error checking for user", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
@@ -213,10 +307,9 @@ func (s *state) login(w http.ResponseWriter, r *http.Request) {
 	message := statusCodeMessages[statusCodes.Success]
 
 	if !exists {
-		err := registerUser(s, firebaseId)
+		err := registerUser(r.Context(), s, firebaseId)
 		if err != nil {
-			errMessage := fmt.Sprintf("in login(): %s: %s", statusCodeMessages[statusCodes.ErrServer], err)
-			log.Println(errMessage)
+			logRequestError(r, "in login(): error registering user", err)
 			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 			return
 		}
@@ -232,14 +325,14 @@ func (s *state) createFeedPOST(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackRequest(&params, r, s)
 	if err != nil {
-		log.Printf("in createFeedPOST(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in createFeedPOST(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	contains, _, err := createFeed(s, userId, params.FeedName)
+	contains, _, err := createFeed(r.Context(), s, userId, params.FeedName)
 	if err != nil {
-		log.Printf("in createFeedPOST(): error creating feed: %s", err)
+		logRequestError(r, "in createFeedPOST(): error creating feed", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
 		return
 	}
@@ -259,21 +352,36 @@ func (s *state) addChannelPOST(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackRequest(&params, r, s)
 	if err != nil {
-		log.Printf("in addChannelPOST(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in addChannelPOST(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	feedId, err := getUserFeedId(s, userId, params.FeedName)
+	feedId, err := getUserFeedId(r.Context(), s, userId, params.FeedName)
 	if err != nil {
-		log.Printf("in addChannelPOST(): error retrieving feedId: %s", err)
+		logRequestError(r, "in addChannelPOST(): error retrieving feedId", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
 		return
 	}
 
-	err = addChannelToFeed(s, feedId, params.ChannelHandle)
+	err = addChannelToFeed(r.Context(), s, feedId, params.ChannelHandle)
+	if errors.Is(err, youtube.ErrQuotaExceeded) {
+		logRequestError(r, "in addChannelPOST(): request failed", err, logging.KeyStatus, statusCodes.ErrQuota)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrQuota], statusCodes.ErrQuota)
+		return
+	}
+	if errors.Is(err, errChannelNotFound) {
+		logRequestError(r, "in addChannelPOST(): request failed", err, logging.KeyStatus, statusCodes.ErrNotFound)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrNotFound], statusCodes.ErrNotFound)
+		return
+	}
+	if errors.Is(err, youtube.ErrUnavailable) {
+		logRequestError(r, "in addChannelPOST(): request failed", err, logging.KeyStatus, statusCodes.ErrUpstream)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrUpstream], statusCodes.ErrUpstream)
+		return
+	}
 	if err != nil {
-		log.Printf("in addChannelPOST(): error adding channel to feed: %s", err)
+		logRequestError(r, "in addChannelPOST(): error adding channel to feed", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
@@ -287,14 +395,14 @@ func (s *state) getFeedsGET(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackGetRequest(r, s)
 	if err != nil {
-		log.Printf("in getFeedsGET(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in getFeedsGET(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	feedNames, err := getAllUserFeedNames(s, userId)
+	feedNames, err := getAllUserFeedNames(r.Context(), s, userId)
 	if err != nil {
-		log.Printf("in getFeedsGET(): error retrieving feedNames: %s", err)
+		logRequestError(r, "in getFeedsGET(): error retrieving feedNames", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
@@ -317,42 +425,54 @@ func (s *state) getChannelsGET(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackGetRequest(r, s)
 	if err != nil {
-		log.Printf("in getChannelsGET(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in getChannelsGET(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
 	feedName := r.URL.Query().Get("feedName")
 
-	feedId, err := getUserFeedId(s, userId, feedName)
+	feedId, err := getUserFeedId(r.Context(), s, userId, feedName)
 	if err != nil {
-		log.Printf("in getChannelsGET(): error retrieving feedId: %s", err)
+		logRequestError(r, "in getChannelsGET(): error retrieving feedId", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
 		return
 	}
 
-	channelIds, err := getAllFeedChannels(s, feedId)
+	channelIds, err := getAllFeedChannels(r.Context(), s, feedId)
 	if err != nil {
-		log.Printf("in getChannelsGET(): error retrieving feed channel Ids: %s", err)
+		logRequestError(r, "in getChannelsGET(): error retrieving feed channel Ids", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
 
-	channelHandles, err := getAllChannelHandles(s, channelIds)
+	channelHandles, err := getAllChannelHandles(r.Context(), s, channelIds)
 	if err != nil {
-		log.Printf("in getChannelsGET(): error retrieving handles: %s", err)
+		logRequestError(r, "in getChannelsGET(): error retrieving handles", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	channels, err := getAllFeedChannelDetails(r.Context(), s, feedId)
+	if err != nil {
+		logRequestError(r, "in getChannelsGET(): error retrieving channel details", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
 
 	message := "Successfully retrieved channel handles"
 	type returnVals struct {
-		Message        string   `json:"message"`
-		ChannelHandles []string `json:"channelHandles"`
+		Message        string            `json:"message"`
+		ChannelHandles []string          `json:"channelHandles"`
+		Channels       []channelResource `json:"channels"`
 	}
 	resBody := returnVals{
 		Message:        message,
 		ChannelHandles: channelHandles,
+		Channels:       []channelResource{},
+	}
+	for _, channel := range channels {
+		resBody.Channels = append(resBody.Channels, toChannelResource(database.GetFeedChannelDetailsRow(channel)))
 	}
 
 	writeResponse(w, resBody, statusCodes.Success)
@@ -363,47 +483,48 @@ func (s *state) getVideosGET(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackGetRequest(r, s)
 	if err != nil {
-		log.Printf("in getVideosGET(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in getVideosGET(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
 	feedName := r.URL.Query().Get("feedName")
 
-	feedId, err := getUserFeedId(s, userId, feedName)
+	feedId, err := getUserFeedId(r.Context(), s, userId, feedName)
 	if err != nil {
-		log.Printf("in getVideosGET(): error retrieving feedId: %s", err)
+		logRequestError(r, "in getVideosGET(): error retrieving feedId", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
 		return
 	}
 
-	channelIds, err := getAllFeedChannels(s, feedId)
+	feedChannels, err := getAllFeedChannelPriorities(r.Context(), s, feedId)
 	if err != nil {
-		log.Printf("in getVideosGET(): error retrieving feed channel Ids: %s", err)
+		logRequestError(r, "in getVideosGET(): error retrieving feed channels", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
 
-	uploadIds, err := getAllUploadIds(s, channelIds)
+	mergeOptions, statusCode, err := getMergeOptions(r, s, feedId)
 	if err != nil {
-		log.Printf("in getVideosGET(): error retrieving feed upload Ids: %s", err)
-		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		logRequestError(r, "in getVideosGET(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	videos, err := youtube.GetFeedVideosJSON(VIDEO_LIMIT, uploadIds)
+	videos, feedStatus, err := youtube.GetFeedVideosJSON(r.Context(), int64(s.cfg.Feeds.VideoLimit), feedChannels, mergeOptions)
 	if err != nil {
-		log.Printf("in getVideosGET(): error retrieving videos as JSON: %s", err)
+		logRequestError(r, "in getVideosGET(): error retrieving videos as JSON", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "*")
-	w.WriteHeader(statusCodes.Success)
-	w.Write(videos)
+	statusCode = statusCodes.Success
+	if feedStatus == youtube.FeedFailed {
+		logRequestError(r, "in getVideosGET(): every channel in feed failed", nil, logging.KeyStatus, statusCodes.ErrUpstream, logging.KeyFeedID, feedId)
+		statusCode = statusCodes.ErrUpstream
+	}
+
+	writeJSON(w, videos, statusCode)
 }
 
 // PATCH - updates the provided feedName with the the provided newFeedName
@@ -412,21 +533,21 @@ func (s *state) renameFeedPATCH(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackRequest(&params, r, s)
 	if err != nil {
-		log.Printf("in renameFeedPATCH(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in renameFeedPATCH(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	feedId, err := getUserFeedId(s, userId, params.FeedName)
+	feedId, err := getUserFeedId(r.Context(), s, userId, params.FeedName)
 	if err != nil {
-		log.Printf("in renameFeedPATCH(): error retrieving feedId: %s", err)
+		logRequestError(r, "in renameFeedPATCH(): error retrieving feedId", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
 		return
 	}
 
-	err = updateFeedName(s, feedId, params.NewFeedName)
+	err = updateFeedName(r.Context(), s, feedId, params.NewFeedName)
 	if err != nil {
-		log.Printf("in renameFeedPATCH(): error updating feed name: %s", err)
+		logRequestError(r, "in renameFeedPATCH(): error updating feed name", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
 		return
 	}
@@ -435,6 +556,92 @@ func (s *state) renameFeedPATCH(w http.ResponseWriter, r *http.Request) {
 	writeResponseMessage(w, message, statusCodes.Success)
 }
 
+// PATCH - updates how the videos of the provided feed are ordered
+func (s *state) feedOrderPATCH(w http.ResponseWriter, r *http.Request) {
+	params := feedOrderParams{}
+
+	userId, statusCode, err := unpackRequest(&params, r, s)
+	if err != nil {
+		logRequestError(r, "in feedOrderPATCH(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	strategy, err := youtube.ParseMergeStrategy(params.Order)
+	if err != nil {
+		logRequestError(r, "in feedOrderPATCH(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	feedId, err := getUserFeedId(r.Context(), s, userId, params.FeedName)
+	if err != nil {
+		logRequestError(r, "in feedOrderPATCH(): error retrieving feedId", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
+		return
+	}
+
+	err = updateFeedMergeStrategy(r.Context(), s, feedId, strategy)
+	if err != nil {
+		logRequestError(r, "in feedOrderPATCH(): error updating feed order", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	message := fmt.Sprintf("Feed - %s - order successfully updated to - %s", params.FeedName, strategy)
+	writeResponseMessage(w, message, statusCodes.Success)
+}
+
+// PATCH - updates the priority of the provided channel within the provided feed
+func (s *state) channelPriorityPATCH(w http.ResponseWriter, r *http.Request) {
+	params := channelPriorityParams{}
+
+	userId, statusCode, err := unpackRequest(&params, r, s)
+	if err != nil {
+		logRequestError(r, "in channelPriorityPATCH(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	if params.Priority < 1 {
+		logRequestError(r, "in channelPriorityPATCH(): priority must be at least 1", nil, logging.KeyStatus, statusCodes.ErrRequest, "priority", params.Priority)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	feedId, err := getUserFeedId(r.Context(), s, userId, params.FeedName)
+	if err != nil {
+		logRequestError(r, "in channelPriorityPATCH(): error retrieving feedId", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
+		return
+	}
+
+	channelId, err := getChannelId(r.Context(), s, params.ChannelHandle)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrNotFound], statusCodes.ErrNotFound)
+		return
+	}
+	if err != nil {
+		logRequestError(r, "in channelPriorityPATCH(): error retrieving channelId", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	err = updateFeedChannelPriority(r.Context(), s, feedId, channelId, params.Priority)
+	if errors.Is(err, errFeedChannelNotFound) {
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrNotFound], statusCodes.ErrNotFound)
+		return
+	}
+	if err != nil {
+		logRequestError(r, "in channelPriorityPATCH(): error updating channel priority", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	message := fmt.Sprintf("Channel - %s - priority successfully updated to - %v", params.ChannelHandle, params.Priority)
+	writeResponseMessage(w, message, statusCodes.Success)
+}
+
 // DELETE - deletes the provided feed for the specific user
 //
 //	deletes all related feed-channels as a side effect
@@ -443,14 +650,14 @@ func (s *state) deleteFeedDELETE(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackGetRequest(r, s)
 	if err != nil {
-		log.Printf("in deleteFeedDELETE(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in deleteFeedDELETE(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	err = deleteFeed(s, userId, feedName)
+	err = deleteFeed(r.Context(), s, userId, feedName)
 	if err != nil {
-		log.Printf("in deleteFeedDELETE(): error deleting feed<%s>: %s", feedName, err)
+		logRequestError(r, "in deleteFeedDELETE(): error deleting feed", err, "feed_name", feedName)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
@@ -466,28 +673,28 @@ func (s *state) deleteChannelDELETE(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackGetRequest(r, s)
 	if err != nil {
-		log.Printf("in deleteChannelDELETE(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in deleteChannelDELETE(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	feedId, err := getUserFeedId(s, userId, feedName)
+	feedId, err := getUserFeedId(r.Context(), s, userId, feedName)
 	if err != nil {
-		log.Printf("in deleteChannelDELETE(): error retrieving feedId: %s", err)
+		logRequestError(r, "in deleteChannelDELETE(): error retrieving feedId", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
 		return
 	}
 
-	channelId, err := getChannelId(s, channelHandle)
+	channelId, err := getChannelId(r.Context(), s, channelHandle)
 	if err != nil {
-		log.Printf("in deleteChannelDELETE(): error retrieving channelId: %s", err)
+		logRequestError(r, "in deleteChannelDELETE(): error retrieving channelId", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
 
-	err = deleteFeedChannel(s, feedId, channelId)
+	err = deleteFeedChannel(r.Context(), s, feedId, channelId)
 	if err != nil {
-		log.Printf("in deleteChannelDELETE(): error deleting channel: %s", err)
+		logRequestError(r, "in deleteChannelDELETE(): error deleting channel", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
@@ -501,14 +708,14 @@ func (s *state) deleteUserDELETE(w http.ResponseWriter, r *http.Request) {
 
 	userId, statusCode, err := unpackGetRequest(r, s)
 	if err != nil {
-		log.Printf("in deleteUserDELETE(): %s: %s", statusCodeMessages[statusCode], err)
+		logRequestError(r, "in deleteUserDELETE(): request failed", err, logging.KeyStatus, statusCode)
 		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
 		return
 	}
 
-	err = deleteUser(s, userId)
+	err = deleteUser(r.Context(), s, userId)
 	if err != nil {
-		log.Printf("in deleteUserDELETE(): error deleting user from database: %s", err)
+		logRequestError(r, "in deleteUserDELETE(): error deleting user from database", err)
 		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
 		return
 	}
@@ -521,30 +728,281 @@ func (s *state) deleteUserDELETE(w http.ResponseWriter, r *http.Request) {
 func handleOPTIONS(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*") // Replace with specific domain later probably
 	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match")
 	w.WriteHeader(http.StatusOK)
 }
 
-func main() {
-	s, err := getState()
-	if err != nil {
-		newErr := fmt.Sprintf("Error initializing state: %s", err)
-		log.Fatal(newErr)
-	}
-
+// Builds the router with every API route registered
+func newRouter(s *state) *mux.Router {
 	router := mux.NewRouter()
+	router.Use(s.trace)
+	router.Use(s.requestLogging)
+	router.Use(s.instrument)
+	router.Use(s.rateLimit)
+	router.Use(s.conditionalGET)
+	router.HandleFunc(OPENAPI_PATH, handleOpenAPI).Methods(http.MethodGet)
+	router.HandleFunc(METRICS_PATH, s.handleMetrics).Methods(http.MethodGet)
+	router.HandleFunc(HEALTH_PATH, s.handleHealth).Methods(http.MethodGet)
+	router.HandleFunc(READY_PATH, s.handleReady).Methods(http.MethodGet)
+
 	api := router.PathPrefix(PREFIX).Subrouter()
 	api.HandleFunc("/login", s.login).Methods(http.MethodPost)
 	api.HandleFunc("/feed", s.createFeedPOST).Methods(http.MethodPost)
 	api.HandleFunc("/channel", s.addChannelPOST).Methods(http.MethodPost)
 	api.HandleFunc("/feeds", s.getFeedsGET).Methods(http.MethodGet)
 	api.HandleFunc("/channels", s.getChannelsGET).Methods(http.MethodGet)
+	api.HandleFunc("/channels/search", s.searchChannelsGET).Methods(http.MethodGet)
 	api.HandleFunc("/videos", s.getVideosGET).Methods(http.MethodGet)
+	api.HandleFunc("/search", s.searchGET).Methods(http.MethodGet)
 	api.HandleFunc("/feed", s.renameFeedPATCH).Methods(http.MethodPatch)
+	api.HandleFunc("/feed/order", s.feedOrderPATCH).Methods(http.MethodPatch)
+	api.HandleFunc("/channel/priority", s.channelPriorityPATCH).Methods(http.MethodPatch)
 	api.HandleFunc("/feed", s.deleteFeedDELETE).Methods(http.MethodDelete)
 	api.HandleFunc("/channel", s.deleteChannelDELETE).Methods(http.MethodDelete)
 	api.HandleFunc("/user", s.deleteUserDELETE).Methods(http.MethodDelete)
 	api.HandleFunc("/login", handleOPTIONS).Methods(http.MethodOptions)
+	if s.cfg.Features.Digests {
+		api.HandleFunc("/digests/unsubscribe", s.unsubscribeDigestGET).Methods(http.MethodGet)
+	}
+
+	apiV2 := router.PathPrefix(PREFIX_V2).Subrouter()
+	apiV2.HandleFunc("/feeds", s.listFeedsV2).Methods(http.MethodGet)
+	apiV2.HandleFunc("/feeds", s.createFeedV2).Methods(http.MethodPost)
+	apiV2.HandleFunc("/feeds/{feedId}", s.getFeedV2).Methods(http.MethodGet)
+	apiV2.HandleFunc("/feeds/{feedId}", s.updateFeedV2).Methods(http.MethodPatch)
+	apiV2.HandleFunc("/feeds/{feedId}", s.deleteFeedV2).Methods(http.MethodDelete)
+	apiV2.HandleFunc("/feeds/{feedId}/channels", s.listFeedChannelsV2).Methods(http.MethodGet)
+	apiV2.HandleFunc("/feeds/{feedId}/channels", s.addFeedChannelV2).Methods(http.MethodPost)
+	apiV2.HandleFunc("/feeds/{feedId}/channels/{channelId}", s.getFeedChannelV2).Methods(http.MethodGet)
+	apiV2.HandleFunc("/feeds/{feedId}/channels/{channelId}", s.updateFeedChannelV2).Methods(http.MethodPatch)
+	apiV2.HandleFunc("/feeds/{feedId}/channels/{channelId}", s.deleteFeedChannelV2).Methods(http.MethodDelete)
+	apiV2.HandleFunc("/feeds/{feedId}/videos", s.getFeedVideosV2).Methods(http.MethodGet)
+	if s.cfg.Features.Recommendations {
+		apiV2.HandleFunc("/feeds/{feedId}/recommendations", s.getFeedRecommendationsV2).Methods(http.MethodGet)
+	}
+	if s.cfg.Features.Digests {
+		apiV2.HandleFunc("/feeds/{feedId}/digests", s.listDigestsV2).Methods(http.MethodGet)
+		apiV2.HandleFunc("/feeds/{feedId}/digests", s.createDigestV2).Methods(http.MethodPost)
+		apiV2.HandleFunc("/feeds/{feedId}/digests/{digestId}", s.deleteDigestV2).Methods(http.MethodDelete)
+	}
+	if s.cfg.Features.Events {
+		apiV2.HandleFunc("/events", s.userEventsV2).Methods(http.MethodGet)
+		apiV2.HandleFunc("/feeds/{feedId}/events", s.feedEventsV2).Methods(http.MethodGet)
+	}
+	if s.cfg.Features.Webhooks {
+		apiV2.HandleFunc("/feeds/{feedId}/webhooks", s.listWebhooksV2).Methods(http.MethodGet)
+		apiV2.HandleFunc("/feeds/{feedId}/webhooks", s.createWebhookV2).Methods(http.MethodPost)
+		apiV2.HandleFunc("/feeds/{feedId}/webhooks/{webhookId}", s.deleteWebhookV2).Methods(http.MethodDelete)
+		apiV2.HandleFunc("/feeds/{feedId}/webhooks/{webhookId}/deliveries", s.listWebhookDeliveriesV2).Methods(http.MethodGet)
+	}
+
+	admin := router.PathPrefix(PREFIX_ADMIN).Subrouter()
+	admin.HandleFunc("/quota", s.getQuotaGET).Methods(http.MethodGet)
+
+	return router
+}
+
+// Applies the endpoint, retry and circuit breaker settings to the youtube package
+func configureYouTubeClient(cfg config.YouTubeConfig) {
+	youtube.SetAPIEndpoint(cfg.Endpoint)
+	youtube.SetRetryPolicy(youtube.RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.RetryMaxDelayMs) * time.Millisecond,
+	})
+	youtube.SetCircuitBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerCooldownSeconds)*time.Second)
+}
+
+// Creates the configured secret provider, applies the secrets it holds to cfg and validates the result
+func loadSecrets(cfg *config.Config) (config.SecretProvider, error) {
+	secrets, err := config.NewSecretProvider(context.Background(), cfg.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("in loadSecrets(): error creating secret provider: %s", err)
+	}
+	err = config.ApplySecrets(context.Background(), cfg, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("in loadSecrets(): %s", err)
+	}
+
+	// settings the provider supplies were not validated when the config was loaded
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("in loadSecrets(): %s", err)
+	}
+
+	return secrets, nil
+}
+
+// Keeps the YouTube API key in sync with the secret provider until ctx is cancelled so a rotated
+// key is used without a restart. key is the value already in use
+func reloadAPIKeyPeriodically(ctx context.Context, secrets config.SecretProvider, key string, interval time.Duration) {
+	logger := logging.FromContext(ctx)
+
+	config.WatchSecret(ctx, secrets, config.SecretYouTubeAPIKey, interval,
+		func(value string) {
+			if value != key {
+				key = value
+				youtube.SetAPIKey(value)
+				logger.Info("YouTube API key reloaded")
+			}
+		},
+		func(err error) {
+			if !errors.Is(err, config.ErrSecretNotFound) {
+				logger.Error("error reloading YouTube API key", logging.Err(err))
+			}
+		})
+}
+
+func main() {
+	name, args, flags := splitCommand(os.Args[1:])
+	cfg, err := config.Load(flags, os.Stderr)
+	if config.IsHelp(err) {
+		printCommands(os.Stderr)
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error loading config: %s", err)
+	}
+
+	// log.Printf output is routed through the default logger as well
+	slog.SetDefault(logging.New(os.Stdout, cfg.Logging.Format, cfg.Logging.Level))
+
+	err = runCommand(name, args, cfg)
+	if err != nil {
+		slog.Error("command failed", "command", name, logging.Err(err))
+		os.Exit(1)
+	}
+}
+
+// Runs the API server and background jobs until an interrupt or SIGTERM, then shuts down
+// gracefully
+func runServer(cfg config.Config) error {
+	secrets, err := loadSecrets(&cfg)
+	if err != nil {
+		return fmt.Errorf("in runServer(): %s", err)
+	}
+
+	s, err := getState(cfg)
+	if err != nil {
+		return fmt.Errorf("in runServer(): error initializing state: %s", err)
+	}
+
+	if s.cfg.Database.AutoMigrate {
+		err = applyMigrations(jobContext(context.Background(), "migrate"), s)
+		if err != nil {
+			return fmt.Errorf("in runServer(): %s", err)
+		}
+	}
 
-	log.Fatal(http.ListenAndServe(PORT, router))
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    s.cfg.Tracing.Exporter,
+		Endpoint:    s.cfg.Tracing.Endpoint,
+		ServiceName: s.cfg.Tracing.ServiceName,
+		SampleRatio: float64(s.cfg.Tracing.SamplePercent) / 100,
+	})
+	if err != nil {
+		return fmt.Errorf("in runServer(): error initializing tracing: %s", err)
+	}
+
+	configureYouTubeClient(s.cfg.YouTube)
+
+	// without a stored key the YOUTUBE_CUSTOM_FEEDS_YT_API_KEY environment variable is used
+	apiKey, err := secrets.GetSecret(context.Background(), config.SecretYouTubeAPIKey)
+	if err != nil && !errors.Is(err, config.ErrSecretNotFound) {
+		return fmt.Errorf("in runServer(): error loading YouTube API key: %s", err)
+	}
+	youtube.SetAPIKey(apiKey)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = initQuota(jobContext(ctx, "quota"), s)
+	if err != nil {
+		slog.Warn("error initializing quota, starting with empty usage", logging.Err(err))
+	}
+	var workers sync.WaitGroup
+	startWorker(&workers, func() {
+		reloadAPIKeyPeriodically(jobContext(ctx, "secrets"), secrets, apiKey, time.Duration(s.cfg.Secrets.ReloadSeconds)*time.Second)
+	})
+	startWorker(&workers, func() {
+		flushQuotaPeriodically(jobContext(ctx, "quota"), time.Duration(s.cfg.Quota.FlushIntervalSeconds)*time.Second)
+	})
+	if s.cfg.Features.Events {
+		// events are shared through Postgres so streams on every instance receive them
+		s.events.db = s.db
+		startWorker(&workers, func() {
+			listenForStreamEvents(jobContext(ctx, "events"), s, s.cfg.Database.DSN())
+		})
+	}
+	youtube.SetDeadChannelReporter(deadChannelReporter{s: s})
+	youtube.SetVideoStore(videoStore{db: s.db, events: s.events, webhooks: s.cfg.Features.Webhooks})
+	youtube.SetChannelStatusListener(s.events)
+	youtube.SetMetrics(s.metrics)
+	startWorker(&workers, func() {
+		refreshChannelMetadataPeriodically(jobContext(ctx, "channel-metadata"), s,
+			time.Duration(s.cfg.Channels.RefreshIntervalMinutes)*time.Minute,
+			time.Duration(s.cfg.Channels.RefreshMaxAgeHours)*time.Hour)
+	})
+	if s.cfg.Features.Recommendations {
+		startWorker(&workers, func() {
+			refreshChannelCooccurrencePeriodically(jobContext(ctx, "recommendations"), s,
+				time.Duration(s.cfg.Recommend.IntervalMinutes)*time.Minute,
+				s.cfg.Recommend.MinSupport)
+		})
+	}
+	if s.cfg.Features.Webhooks {
+		startWorker(&workers, func() {
+			deliverWebhooksPeriodically(jobContext(ctx, "webhook-delivery"), s, time.Duration(s.cfg.Webhooks.DeliveryIntervalSeconds)*time.Second)
+		})
+		startWorker(&workers, func() {
+			pollWebhookFeedsPeriodically(jobContext(ctx, "webhook-poll"), s, time.Duration(s.cfg.Webhooks.PollIntervalMinutes)*time.Minute)
+		})
+	}
+	if !s.cfg.Features.Digests {
+		slog.Info("digests feature disabled, email digests will not be sent")
+	} else if s.cfg.Digest.SMTPHost != "" {
+		mailer := digest.NewSMTPMailer(digest.SMTPConfig{
+			Host:     s.cfg.Digest.SMTPHost,
+			Port:     s.cfg.Digest.SMTPPort,
+			Username: s.cfg.Digest.SMTPUsername,
+			Password: s.cfg.Digest.SMTPPassword,
+			From:     s.cfg.Digest.From,
+			Timeout:  time.Duration(s.cfg.Digest.SMTPTimeoutSeconds) * time.Second,
+		})
+		startWorker(&workers, func() {
+			sendDigestsPeriodically(jobContext(ctx, "digests"), s, mailer, time.Duration(s.cfg.Digest.CheckIntervalSeconds)*time.Second)
+		})
+	} else {
+		slog.Info("SMTP_HOST not set, email digests will not be sent")
+	}
+
+	server := newServer(s, newRouter(s))
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		stop()
+		workers.Wait()
+		return fmt.Errorf("in runServer(): error listening on %s: %s", server.Addr, err)
+	}
+
+	slog.Info("listening", "addr", server.Addr)
+	serveErr := serve(ctx, s, server, listener)
+
+	// Workers return once their current run ends, its queries are cancelled with ctx
+	stop()
+	workers.Wait()
+
+	err = youtube.FlushQuota(context.Background())
+	if err != nil {
+		slog.Error("in runServer(): error flushing quota usage", logging.Err(err))
+	}
+	err = shutdownTracing(context.Background())
+	if err != nil {
+		slog.Error("in runServer(): error flushing traces", logging.Err(err))
+	}
+	slog.Info("shutdown complete")
+
+	if serveErr != nil {
+		return fmt.Errorf("in runServer(): %s", serveErr)
+	}
+	return nil
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const METRICS_PATH = "/metrics"
+
+const METRICS_NAMESPACE = "ycf"
+
+// Matches the "-- name: X" comment sqlc puts at the start of every query
+var queryNameRegex = regexp.MustCompile(`-- name: (\w+)`)
+
+// Prometheus collectors for the API, the YouTube client and the database, registered on their
+// own registry so each state can be scraped (and tested) independently
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	youtubeCalls    *prometheus.CounterVec
+	youtubeDuration *prometheus.HistogramVec
+	feedFanout      prometheus.Histogram
+	cacheLookups    *prometheus.CounterVec
+	dbDuration      *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route template, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		youtubeCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "youtube_api_calls_total",
+			Help:      "YouTube API call attempts, by API method and result (ok or the error kind).",
+		}, []string{"method", "result"}),
+		youtubeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "youtube_api_call_duration_seconds",
+			Help:      "Latency of YouTube API call attempts, by API method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		feedFanout: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "youtube_feed_fanout_channels",
+			Help:      "Number of channels whose videos are retrieved for a single feed.",
+			Buckets:   []float64{1, 2, 5, 10, 20, 50, 100},
+		}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "cache_lookups_total",
+			Help:      "Cache lookups, by cache and result (hit or miss).",
+		}, []string{"cache", "result"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query latency, by sqlc query name and result.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"query", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration,
+		m.youtubeCalls, m.youtubeDuration, m.feedFanout,
+		m.cacheLookups, m.dbDuration,
+	)
+
+	return m
+}
+
+// Records a cache lookup, the hit ratio is hits over all lookups of the cache
+func (m *metrics) cacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// Implements youtube.Metrics
+func (m *metrics) APICall(method, result string, duration time.Duration) {
+	m.youtubeCalls.WithLabelValues(method, result).Inc()
+	if duration > 0 {
+		m.youtubeDuration.WithLabelValues(method).Observe(duration.Seconds())
+	}
+}
+
+func (m *metrics) FeedFanout(channels int) {
+	m.feedFanout.Observe(float64(channels))
+}
+
+func (m *metrics) CacheLookup(hit bool) {
+	m.cacheLookup("youtube_videos", hit)
+}
+
+// Middleware - counts requests and measures their latency by route template, so ids in paths
+// do not create new series. Streaming routes are counted but their duration is not observed
+func (s *state) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := routeTemplate(r)
+		if !ok || s.metrics == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.statusCode == 0 {
+			recorder.statusCode = http.StatusOK
+		}
+		status := strconv.Itoa(recorder.statusCode)
+
+		s.metrics.requests.WithLabelValues(route, r.Method, status).Inc()
+		if recorder.Header().Get("Content-Type") != "text/event-stream" {
+			s.metrics.requestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+		}
+		if r.Method == http.MethodGet && recorder.Header().Get("ETag") != "" {
+			s.metrics.cacheLookup("http_etag", recorder.statusCode == http.StatusNotModified)
+		}
+	})
+}
+
+// GET - Prometheus metrics
+func (s *state) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// Times and traces every query run through sqlc, labelled with the query's name
+type instrumentedDB struct {
+	db      *sql.DB
+	metrics *metrics
+}
+
+func queryName(query string) string {
+	match := queryNameRegex.FindStringSubmatch(query)
+	if match == nil {
+		return "unknown"
+	}
+	return match[1]
+}
+
+func (i instrumentedDB) observe(query string, start time.Time, err error) {
+	result := "ok"
+	if err != nil && err != sql.ErrNoRows {
+		result = "error"
+	}
+	i.metrics.dbDuration.WithLabelValues(queryName(query), result).Observe(time.Since(start).Seconds())
+}
+
+func (i instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	result, err := i.db.ExecContext(ctx, query, args...)
+	i.observe(query, start, err)
+	endQuerySpan(span, err)
+	return result, err
+}
+
+func (i instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return i.db.PrepareContext(ctx, query)
+}
+
+func (i instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	i.observe(query, start, err)
+	endQuerySpan(span, err)
+	return rows, err
+}
+
+func (i instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	i.observe(query, start, row.Err())
+	endQuerySpan(span, row.Err())
+	return row
+}
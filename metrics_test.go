@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// Returns the metrics exposed by the state in the text exposition format
+func scrapeMetrics(t *testing.T, s *state) string {
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, METRICS_PATH, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d from %s, want 200", recorder.Code, METRICS_PATH)
+	}
+
+	body, err := io.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsRecordsRequestsAndQueries(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2))
+
+	for _, ifNoneMatch := range []string{"", "*"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/feeds", nil)
+		req.Header.Set("Firebase-ID", "firebase-user")
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		newRouter(s).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	scraped := scrapeMetrics(t, s)
+	want := []string{
+		`ycf_http_requests_total{method="GET",route="/api/v2/feeds",status="200"} 1`,
+		`ycf_http_requests_total{method="GET",route="/api/v2/feeds",status="304"} 1`,
+		`ycf_http_request_duration_seconds_count{method="GET",route="/api/v2/feeds",status="200"} 1`,
+		`ycf_db_query_duration_seconds_count{query="GetAllUserFeedDetails",result="ok"} 2`,
+		`ycf_cache_lookups_total{cache="http_etag",result="hit"} 1`,
+		`ycf_cache_lookups_total{cache="http_etag",result="miss"} 1`,
+	}
+	for _, line := range want {
+		if !strings.Contains(scraped, line) {
+			t.Errorf("metrics do not contain %s", line)
+		}
+	}
+}
+
+func TestMetricsRecordsYouTubeClient(t *testing.T) {
+	s, _ := newFakeState(t)
+	var m youtube.Metrics = s.metrics
+
+	m.APICall("playlistItems.list", youtube.ResultOK, 120*time.Millisecond)
+	m.APICall("playlistItems.list", string(youtube.ErrorRetryable), 2*time.Second)
+	m.APICall("playlistItems.list", youtube.ResultCircuitOpen, 0)
+	m.FeedFanout(12)
+	m.CacheLookup(true)
+	m.CacheLookup(false)
+
+	scraped := scrapeMetrics(t, s)
+	want := []string{
+		`ycf_youtube_api_calls_total{method="playlistItems.list",result="ok"} 1`,
+		`ycf_youtube_api_calls_total{method="playlistItems.list",result="retryable"} 1`,
+		`ycf_youtube_api_calls_total{method="playlistItems.list",result="circuitOpen"} 1`,
+		`ycf_youtube_api_call_duration_seconds_count{method="playlistItems.list"} 2`,
+		`ycf_youtube_feed_fanout_channels_bucket{le="20"} 1`,
+		`ycf_cache_lookups_total{cache="youtube_videos",result="hit"} 1`,
+		`ycf_cache_lookups_total{cache="youtube_videos",result="miss"} 1`,
+	}
+	for _, line := range want {
+		if !strings.Contains(scraped, line) {
+			t.Errorf("metrics do not contain %s", line)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/ratelimit"
+)
+
+// Routes that fan out YouTube API calls, limited by the expensive budget.
+// Keyed by "METHOD path-template"
+var expensiveRoutes = map[string]bool{
+	http.MethodGet + " " + PREFIX + "/videos":                      true,
+	http.MethodPost + " " + PREFIX + "/channel":                    true,
+	http.MethodGet + " " + PREFIX + "/channels/search":             true,
+	http.MethodGet + " " + PREFIX_V2 + "/feeds/{feedId}/videos":    true,
+	http.MethodPost + " " + PREFIX_V2 + "/feeds/{feedId}/channels": true,
+}
+
+type rateLimiters struct {
+	cheap     *ratelimit.Limiter
+	expensive *ratelimit.Limiter
+}
+
+// Creates the limiters described by the config, returns nil if rate limiting is disabled
+func newRateLimiters(cfg config.RateLimitConfig) *rateLimiters {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &rateLimiters{
+		cheap:     ratelimit.NewLimiter(cfg.PerMinute, cfg.Burst),
+		expensive: ratelimit.NewLimiter(cfg.ExpensivePerMinute, cfg.ExpensiveBurst),
+	}
+}
+
+// Returns the path template of the matched route
+func routeTemplate(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+
+	return path, true
+}
+
+// Returns true if the matched route is one of expensiveRoutes
+func isExpensiveRoute(r *http.Request) bool {
+	path, ok := routeTemplate(r)
+	if !ok {
+		return false
+	}
+
+	return expensiveRoutes[r.Method+" "+path]
+}
+
+// Returns the ip of the client. Each of the trustedProxies proxies in front of the server appends
+// the address it received the request from to X-Forwarded-For, so the entry trustedProxies from
+// the right is the client and anything left of it may be forged. Falls back to the connection's
+// address when the header is missing or has fewer entries
+func clientIP(r *http.Request, trustedProxies int) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustedProxies > 0 && len(forwarded) > 0 {
+		entries := strings.Split(strings.Join(forwarded, ","), ",")
+		if len(entries) >= trustedProxies {
+			ip := strings.TrimSpace(entries[len(entries)-trustedProxies])
+			if net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// Middleware - limits requests per user and per client ip, responding 429 with Retry-After
+// once either budget is exhausted. Users are keyed by the Firebase-ID header so limited
+// requests never reach the database
+func (s *state) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.limiters == nil || r.Method == http.MethodOptions || isProbeRoute(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limiter := s.limiters.cheap
+		if isExpensiveRoute(r) {
+			limiter = s.limiters.expensive
+		}
+
+		keys := []string{"ip:" + clientIP(r, s.cfg.Server.TrustedProxies)}
+		if firebaseId := r.Header.Get("Firebase-ID"); firebaseId != "" {
+			keys = append(keys, "user:"+firebaseId)
+		}
+
+		allowed, wait := limiter.Allow(keys...)
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			logRequestError(r, "in rateLimit(): rate limited", nil, logging.KeyStatus, statusCodes.ErrRateLimit, "keys", keys, "retry_after_seconds", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRateLimit], statusCodes.ErrRateLimit)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	cases := []struct {
+		name           string
+		forwarded      []string
+		trustedProxies int
+		want           string
+	}{
+		{name: "no header", want: "192.0.2.1"},
+		{name: "one proxy", forwarded: []string{"203.0.113.7"}, trustedProxies: 1, want: "203.0.113.7"},
+		{name: "forged entry", forwarded: []string{"1.2.3.4, 203.0.113.7"}, trustedProxies: 1, want: "203.0.113.7"},
+		{name: "two proxies", forwarded: []string{"1.2.3.4, 203.0.113.7", "198.51.100.2"}, trustedProxies: 2, want: "203.0.113.7"},
+		{name: "header ignored", forwarded: []string{"203.0.113.7"}, trustedProxies: 0, want: "192.0.2.1"},
+		{name: "too few entries", forwarded: []string{"203.0.113.7"}, trustedProxies: 2, want: "192.0.2.1"},
+		{name: "not an ip", forwarded: []string{"unknown"}, trustedProxies: 1, want: "192.0.2.1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v2/feeds", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			for _, value := range c.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := clientIP(r, c.trustedProxies); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/migrate"
+)
+
+// Applies every pending schema migration, waiting for any other instance that is migrating
+func applyMigrations(ctx context.Context, s *state) error {
+	migrator, err := migrate.New(s.conn)
+	if err != nil {
+		return fmt.Errorf("in applyMigrations(): %s", err)
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("in applyMigrations(): %s", err)
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("in applyMigrations(): %s", err)
+	}
+	logging.FromContext(ctx).Info("schema up to date", "version", version)
+
+	return nil
+}
+
+// Runs the migrate subcommand: up, down, status or to <version>
+func runMigrate(cfg config.Config, args []string) error {
+	var version int64
+	switch {
+	case len(args) == 1 && (args[0] == "up" || args[0] == "down" || args[0] == "status"):
+	case len(args) == 2 && args[0] == "to":
+		var err error
+		version, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("in runMigrate(): invalid version<%s>", args[1])
+		}
+	default:
+		return fmt.Errorf("in runMigrate(): expected up, down, status or to <version>, got %v", args)
+	}
+
+	_, err := loadSecrets(&cfg)
+	if err != nil {
+		return fmt.Errorf("in runMigrate(): %s", err)
+	}
+	s, err := getState(cfg)
+	if err != nil {
+		return fmt.Errorf("in runMigrate(): error initializing state: %s", err)
+	}
+	defer s.conn.Close()
+
+	ctx := jobContext(context.Background(), "migrate")
+	migrator, err := migrate.New(s.conn)
+	if err != nil {
+		return fmt.Errorf("in runMigrate(): %s", err)
+	}
+
+	switch args[0] {
+	case "up":
+		err = applyMigrations(ctx, s)
+	case "down":
+		err = migrator.Down(ctx)
+	case "status":
+		err = migrator.Status(ctx, os.Stdout)
+	case "to":
+		err = migrator.To(ctx, version)
+	}
+	if err != nil {
+		return fmt.Errorf("in runMigrate(): %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI 3 description of every route registered in newRouter.
+// Must be kept in sync with the router, openapi_test.go fails when they drift.
+//
+//go:embed api/openapi.yaml
+var openAPISpec []byte
+
+// GET - serves the OpenAPI specification
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(statusCodes.Success)
+	w.Write(openAPISpec)
+}
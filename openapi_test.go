@@ -0,0 +1,944 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/digest"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+func loadSpec(t *testing.T) (*openapi3.T, routers.Router) {
+	t.Helper()
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openAPISpec)
+	if err != nil {
+		t.Fatalf("error loading openapi spec: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid openapi spec: %v", err)
+	}
+
+	specRouter, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("error creating spec router: %v", err)
+	}
+
+	return doc, specRouter
+}
+
+// Every route registered in newRouter must be described by the spec and vice versa
+func TestOpenAPICoversRouter(t *testing.T) {
+	doc, _ := loadSpec(t)
+	s, _ := newFakeState(t)
+
+	registered := []string{}
+	err := newRouter(s).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // subrouter prefixes have no methods
+		}
+		for _, method := range methods {
+			registered = append(registered, method+" "+path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error walking router: %v", err)
+	}
+
+	documented := []string{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	for _, route := range registered {
+		if !slices.Contains(documented, route) {
+			t.Errorf("route %s is registered but not documented in api/openapi.yaml", route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(registered, route) {
+			t.Errorf("route %s is documented in api/openapi.yaml but not registered", route)
+		}
+	}
+}
+
+type contractCase struct {
+	name       string
+	method     string
+	path       string
+	body       string
+	headers    map[string]string
+	noAuth     bool             // omits the Firebase-ID header
+	invalid    bool             // request is expected to violate the spec, only the response is validated
+	prepare    func(*testing.T) // sets up the youtube package, undone with t.Cleanup
+	setup      func(*fakeDB)    // registers query results
+	configure  func(*state)     // adjusts the state before the request is served
+	wantStatus int
+}
+
+func runContractCase(t *testing.T, specRouter routers.Router, c contractCase) {
+	if c.prepare != nil {
+		c.prepare(t)
+	}
+	s, db := newFakeState(t)
+	if !c.noAuth {
+		db.authorize()
+	}
+	if c.setup != nil {
+		c.setup(db)
+	}
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if c.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if !c.noAuth {
+			req.Header.Set("Firebase-ID", "firebase-user")
+		}
+		for name, value := range c.headers {
+			req.Header.Set(name, value)
+		}
+		return req
+	}
+
+	route, pathParams, err := specRouter.FindRoute(newRequest())
+	if err != nil {
+		t.Fatalf("%s %s is not described by the spec: %v", c.method, c.path, err)
+	}
+
+	requestInput := &openapi3filter.RequestValidationInput{
+		Request:    newRequest(),
+		PathParams: pathParams,
+		Route:      route,
+	}
+	err = openapi3filter.ValidateRequest(context.Background(), requestInput)
+	if c.invalid && err == nil {
+		t.Errorf("expected request to violate the spec")
+	}
+	if !c.invalid && err != nil {
+		t.Errorf("request does not match the spec: %v", err)
+	}
+
+	if c.configure != nil {
+		c.configure(s)
+	}
+
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, newRequest())
+
+	if recorder.Code != c.wantStatus {
+		t.Errorf("got status %d, want %d, body: %s", recorder.Code, c.wantStatus, recorder.Body.String())
+	}
+
+	responseInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: requestInput,
+		Status:                 recorder.Code,
+		Header:                 recorder.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(recorder.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	err = openapi3filter.ValidateResponse(context.Background(), responseInput)
+	if err != nil {
+		t.Errorf("response does not match the spec: %v, body: %s", err, recorder.Body.String())
+	}
+}
+
+// Points the youtube package at a local server answering with handler, calls are not retried
+func useFakeYouTube(t *testing.T, breakerThreshold int, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Setenv("YOUTUBE_CUSTOM_FEEDS_YT_API_KEY", "test-key")
+	configureYouTubeClient(config.YouTubeConfig{Endpoint: server.URL + "/", RetryMaxAttempts: 1, BreakerThreshold: breakerThreshold, BreakerCooldownSeconds: 3600})
+	t.Cleanup(func() {
+		server.Close()
+		configureYouTubeClient(config.YouTubeConfig{RetryMaxAttempts: 3, RetryBaseDelayMs: 200, RetryMaxDelayMs: 2000, BreakerThreshold: 5, BreakerCooldownSeconds: 30})
+	})
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	_, specRouter := loadSpec(t)
+
+	withAdminToken := func(s *state) {
+		s.cfg.AdminToken = "admin-secret"
+	}
+
+	recommendation := func(channelId, handle string) []driver.Value {
+		channel := feedChannelDetailsRow(channelId, handle)
+		return append(channel[:15], int64(7), int64(2))
+	}
+
+	digestRow := row(int64(7), int64(1), "viewer@example.com", "weekly", int64(8), int64(1), "Europe/London",
+		testTime, nil, testTime, int64(0), "")
+	token := digest.NewSigner("secret").Sign(7)
+
+	webhookRow := row(int64(3), int64(1), "https://example.com/hook", "secret", testTime)
+	deliveryRow := row(int64(10), int64(3), "v2", "pending", int64(1), testTime, testTime, nil, testTime, "New song")
+	attemptRow := row(int64(1), int64(10), testTime, int64(500), "in Deliver(): unexpected status 500", int64(42))
+
+	// channel lookups are refused once the quota soft limit is reached
+	quotaExhausted := func(t *testing.T) {
+		youtube.SetQuotaBudget(1, 0)
+		t.Cleanup(func() {
+			youtube.SetQuotaBudget(0, 0)
+		})
+	}
+
+	// channel lookups fail fast while the YouTube circuit breaker is open
+	youtubeUnavailable := func(t *testing.T) {
+		useFakeYouTube(t, 1, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+	}
+
+	// only UU1 has uploads, channels that fail to load are reported alongside its videos
+	youtubeWithFeedVideos := func(t *testing.T) {
+		useFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("playlistId") != "UU1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"items": [{"snippet": {"channelTitle": "Artist", "title": "Song", "publishedAt": "2024-11-01T12:00:00Z", "resourceId": {"videoId": "v1"}, "thumbnails": {"high": {"url": "https://i.ytimg.com/vi/v1/hqdefault.jpg"}}}}]}`)
+		})
+	}
+
+	// searches find UC1 and UC2, @typo is not a channel
+	youtubeWithChannels := func(t *testing.T) {
+		useFakeYouTube(t, 0, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if strings.HasSuffix(r.URL.Path, "/search") {
+				fmt.Fprint(w, `{"items": [{"id": {"channelId": "UC1"}}, {"id": {"channelId": "UC2"}}]}`)
+				return
+			}
+			if r.URL.Query().Get("forHandle") == "@typo" {
+				fmt.Fprint(w, `{"items": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"items": [
+				{"id": "UC1", "snippet": {"customUrl": "@artist", "title": "Artist", "thumbnails": {"default": {"url": "https://yt3.ggpht.com/UC1=s88"}}}, "statistics": {"subscriberCount": "1200", "videoCount": "34"}},
+				{"id": "UC2", "snippet": {"title": "Band"}, "statistics": {"subscriberCount": "5"}}
+			]}`)
+		})
+	}
+
+	cases := []contractCase{
+		{
+			name: "openapi spec", method: http.MethodGet, path: OPENAPI_PATH, noAuth: true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "metrics", method: http.MethodGet, path: METRICS_PATH, noAuth: true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "health", method: http.MethodGet, path: HEALTH_PATH, noAuth: true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "readiness while draining", method: http.MethodGet, path: READY_PATH, noAuth: true,
+			configure:  func(s *state) { s.draining.Store(true) },
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "login existing user", method: http.MethodPost, path: "/api/v1/login",
+			setup: func(db *fakeDB) {
+				db.set("ContainsUserByFirebaseId", row(true))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "login new user", method: http.MethodPost, path: "/api/v1/login",
+			setup: func(db *fakeDB) {
+				db.set("ContainsUserByFirebaseId", row(false))
+				db.set("CreateUser", row(int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "login without firebase id", method: http.MethodPost, path: "/api/v1/login",
+			noAuth: true, invalid: true, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "login preflight", method: http.MethodOptions, path: "/api/v1/login",
+			noAuth: true, wantStatus: http.StatusOK,
+		},
+		{
+			name: "create feed", method: http.MethodPost, path: "/api/v1/feed",
+			body: `{"feedName": "music"}`,
+			setup: func(db *fakeDB) {
+				db.set("ContainsFeed", row(false))
+				db.set("CreateFeed", row(int64(1), testTime, testTime, "music", int64(1), "date"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "create existing feed", method: http.MethodPost, path: "/api/v1/feed",
+			body: `{"feedName": "music"}`,
+			setup: func(db *fakeDB) {
+				db.set("ContainsFeed", row(true))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "create feed with malformed body", method: http.MethodPost, path: "/api/v1/feed",
+			body: `{"feedName": `, invalid: true, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "rename feed", method: http.MethodPatch, path: "/api/v1/feed",
+			body: `{"feedName": "music", "newFeedName": "songs"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "update feed order", method: http.MethodPatch, path: "/api/v1/feed/order",
+			body: `{"feedName": "music", "order": "roundrobin"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "update feed with unknown order", method: http.MethodPatch, path: "/api/v1/feed/order",
+			body: `{"feedName": "music", "order": "random"}`, invalid: true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "delete feed", method: http.MethodDelete, path: "/api/v1/feed?feedName=music",
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "add channel", method: http.MethodPost, path: "/api/v1/channel",
+			body: `{"feedName": "music", "channelHandle": "@artist"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("ContainsChannelInDB", row(true))
+				db.set("GetChannelIdUploadIdByHandle", row("UC1", "UU1"))
+				db.set("ContainsFeedChannel", row(false))
+				db.set("ContainsChannel", row(true))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "update channel priority", method: http.MethodPatch, path: "/api/v1/channel/priority",
+			body: `{"feedName": "music", "channelHandle": "@artist", "priority": 3}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetChannelIdByHandle", row("UC1"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "update priority of channel not in feed", method: http.MethodPatch, path: "/api/v1/channel/priority",
+			body: `{"feedName": "music", "channelHandle": "@artist", "priority": 3}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetChannelIdByHandle", row("UC1"))
+				db.affectNone("UpdateFeedChannelPriority")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "update channel with invalid priority", method: http.MethodPatch, path: "/api/v1/channel/priority",
+			body: `{"feedName": "music", "channelHandle": "@artist", "priority": 0}`, invalid: true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "delete channel", method: http.MethodDelete, path: "/api/v1/channel?feedName=music&channelHandle=@artist",
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetChannelIdByHandle", row("UC1"))
+				db.set("ContainsChannel", row(true))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "get feeds", method: http.MethodGet, path: "/api/v1/feeds",
+			setup: func(db *fakeDB) {
+				db.set("GetAllUserFeedNames", row("music"), row("science"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "get feeds without feeds", method: http.MethodGet, path: "/api/v1/feeds",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "get feeds for unknown user", method: http.MethodGet, path: "/api/v1/feeds",
+			setup: func(db *fakeDB) {
+				db.set("GetUserIdByFirebaseId")
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "get channels", method: http.MethodGet, path: "/api/v1/channels?feedName=music",
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetAllFeedChannels", row("UC1"), row("UC2"))
+				db.set("GetChannelHandle", row("@artist"))
+				db.set("GetAllFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"), deadFeedChannelDetailsRow("UC2", "@band"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "get videos with unknown order", method: http.MethodGet, path: "/api/v1/videos?feedName=music&order=random",
+			invalid: true,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "get videos for empty feed", method: http.MethodGet, path: "/api/v1/videos?feedName=music",
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetFeedMergeStrategy", row("date"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "search videos", method: http.MethodGet, path: "/api/v1/search?q=guitar+lesson",
+			setup: func(db *fakeDB) {
+				db.set("SearchUserVideos", row("v1", "Artist", "Guitar lesson", "https://i.ytimg.com/vi/v1/hqdefault.jpg", "https://www.youtube.com/watch?v=v1", testTime))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "search videos in feed", method: http.MethodGet, path: "/api/v1/search?q=guitar&feedName=music&limit=5",
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "search without query", method: http.MethodGet, path: "/api/v1/search?q=",
+			invalid: true, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "search with limit too large", method: http.MethodGet, path: "/api/v1/search?q=guitar&limit=1000",
+			invalid: true, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "search channels without query", method: http.MethodGet, path: "/api/v1/channels/search",
+			invalid: true, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "delete user", method: http.MethodDelete, path: "/api/v1/user",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "rate limited", method: http.MethodGet, path: "/api/v1/videos?feedName=music",
+			configure: func(s *state) {
+				s.limiters = newRateLimiters(config.RateLimitConfig{Enabled: true, ExpensivePerMinute: 1, ExpensiveBurst: 1})
+				s.limiters.expensive.Allow("user:firebase-user")
+			},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "list feeds", method: http.MethodGet, path: "/api/v2/feeds",
+			setup: func(db *fakeDB) {
+				db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2), feedDetailsRow(2, "science", 0))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "create feed", method: http.MethodPost, path: "/api/v2/feeds",
+			body: `{"name": "music"}`,
+			setup: func(db *fakeDB) {
+				db.set("ContainsFeed", row(false))
+				db.set("CreateFeed", row(int64(1), testTime, testTime, "music", int64(1), "date"))
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "create existing feed", method: http.MethodPost, path: "/api/v2/feeds",
+			body: `{"name": "music"}`,
+			setup: func(db *fakeDB) {
+				db.set("ContainsFeed", row(true))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "create feed without name", method: http.MethodPost, path: "/api/v2/feeds",
+			body: `{}`, invalid: true, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "get feed", method: http.MethodGet, path: "/api/v2/feeds/1",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "get missing feed", method: http.MethodGet, path: "/api/v2/feeds/7",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "get feed with invalid id", method: http.MethodGet, path: "/api/v2/feeds/music",
+			invalid: true, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "update feed", method: http.MethodPatch, path: "/api/v2/feeds/1",
+			body: `{"name": "songs", "order": "weighted"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("ContainsFeed", row(false))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "rename feed to existing name", method: http.MethodPatch, path: "/api/v2/feeds/1",
+			body: `{"name": "science", "order": "weighted"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("ContainsFeed", row(true))
+				// the order is not applied when the rename is rejected
+				db.fail("UpdateFeed", errors.New("feed updated"))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "delete feed", method: http.MethodDelete, path: "/api/v2/feeds/1",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+				db.set("GetFeedId", row(int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "list feed channels", method: http.MethodGet, path: "/api/v2/feeds/1/channels",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetAllFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"), feedChannelDetailsRow("UC2", "@band"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "add feed channel", method: http.MethodPost, path: "/api/v2/feeds/1/channels",
+			body: `{"handle": "@artist"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+				db.set("ContainsChannelInDB", row(true))
+				db.set("GetChannelIdUploadIdByHandle", row("UC1", "UU1"))
+				db.set("ContainsFeedChannel", row(true))
+				db.set("GetChannelIdByHandle", row("UC1"))
+				db.set("GetFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"))
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "get feed channel", method: http.MethodGet, path: "/api/v2/feeds/1/channels/UC1",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+				db.set("GetFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"))
+				db.set("GetChannelHandleHistory", row("@artist", testTime, testTime), row("@artistold", testTime, testTime))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "get missing feed channel", method: http.MethodGet, path: "/api/v2/feeds/1/channels/UC9",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "update feed channel", method: http.MethodPatch, path: "/api/v2/feeds/1/channels/UC1",
+			body: `{"priority": 2}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+				db.set("GetFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "update feed channel removed concurrently", method: http.MethodPatch, path: "/api/v2/feeds/1/channels/UC1",
+			body: `{"priority": 2}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+				db.set("GetFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"))
+				db.affectNone("UpdateFeedChannelPriority")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "delete feed channel", method: http.MethodDelete, path: "/api/v2/feeds/1/channels/UC1",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+				db.set("GetFeedChannelDetails", feedChannelDetailsRow("UC1", "@artist"))
+				db.set("ContainsChannel", row(false))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "get videos for empty feed", method: http.MethodGet, path: "/api/v2/feeds/1/videos",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "quota usage", method: http.MethodGet, path: "/api/admin/quota",
+			headers: map[string]string{"Admin-Token": "admin-secret"}, noAuth: true,
+			configure: withAdminToken,
+			setup: func(db *fakeDB) {
+				db.set("GetQuotaUsageHistory", row(testTime, int64(40), int64(40)), row(testTime.AddDate(0, 0, -1), int64(12), int64(12)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "quota usage with wrong token", method: http.MethodGet, path: "/api/admin/quota",
+			headers: map[string]string{"Admin-Token": "guess"}, noAuth: true,
+			configure: withAdminToken, wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "quota usage with admin disabled", method: http.MethodGet, path: "/api/admin/quota",
+			headers: map[string]string{"Admin-Token": "admin-secret"}, noAuth: true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "add channel v1 quota exhausted", method: http.MethodPost, path: "/api/v1/channel",
+			prepare: quotaExhausted,
+			body:    `{"feedName": "music", "channelHandle": "@new"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("ContainsChannelInDB", row(false))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "add channel v2 quota exhausted", method: http.MethodPost, path: "/api/v2/feeds/1/channels",
+			prepare: quotaExhausted,
+			body:    `{"handle": "@new"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+				db.set("ContainsChannelInDB", row(false))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "search channels quota exhausted", method: http.MethodGet, path: "/api/v1/channels/search?q=artist",
+			prepare:    quotaExhausted,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "add channel v1 youtube unavailable", method: http.MethodPost, path: "/api/v1/channel",
+			prepare: youtubeUnavailable,
+			body:    `{"feedName": "music", "channelHandle": "@new"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("ContainsChannelInDB", row(false))
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "add channel v2 youtube unavailable", method: http.MethodPost, path: "/api/v2/feeds/1/channels",
+			prepare: youtubeUnavailable,
+			body:    `{"handle": "@new"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+				db.set("ContainsChannelInDB", row(false))
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "partial feed v1", method: http.MethodGet, path: "/api/v1/videos?feedName=music",
+			prepare: youtubeWithFeedVideos,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetFeedMergeStrategy", row("date"))
+				db.set("GetAllFeedChannelPriorities", row("UC1", "@artist", "UU1", "active", "", int64(1)), row("UC2", "@gone", "UU2", "active", "", int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "failed feed v1", method: http.MethodGet, path: "/api/v1/videos?feedName=music",
+			prepare: youtubeWithFeedVideos,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetFeedMergeStrategy", row("date"))
+				db.set("GetAllFeedChannelPriorities", row("UC2", "@gone", "UU2", "active", "", int64(1)))
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "partial feed v2", method: http.MethodGet, path: "/api/v2/feeds/1/videos",
+			prepare: youtubeWithFeedVideos,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedMergeStrategy", row("date"))
+				db.set("GetAllFeedChannelPriorities", row("UC1", "@artist", "UU1", "active", "", int64(1)), row("UC2", "@gone", "UU2", "active", "", int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "feed with dead channel v2", method: http.MethodGet, path: "/api/v2/feeds/1/videos",
+			prepare: youtubeWithFeedVideos,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedMergeStrategy", row("date"))
+				db.set("GetAllFeedChannelPriorities", row("UC1", "@artist", "UU1", "active", "", int64(1)), row("UC3", "@deleted", "UU3", "dead", "notFound", int64(1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "failed feed v2", method: http.MethodGet, path: "/api/v2/feeds/1/videos",
+			prepare: youtubeWithFeedVideos,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 1))
+				db.set("GetFeedMergeStrategy", row("date"))
+				db.set("GetAllFeedChannelPriorities", row("UC2", "@gone", "UU2", "active", "", int64(1)))
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "search channels", method: http.MethodGet, path: "/api/v1/channels/search?q=artist",
+			prepare:    youtubeWithChannels,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "search channels marking feed", method: http.MethodGet, path: "/api/v1/channels/search?q=artist&feedName=music&limit=2",
+			prepare: youtubeWithChannels,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("GetAllFeedChannels", row("UC1"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "add unknown channel v1", method: http.MethodPost, path: "/api/v1/channel",
+			prepare: youtubeWithChannels,
+			body:    `{"feedName": "music", "channelHandle": "@typo"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetFeedId", row(int64(1)))
+				db.set("ContainsChannelInDB", row(false))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "add unknown channel v2", method: http.MethodPost, path: "/api/v2/feeds/1/channels",
+			prepare: youtubeWithChannels,
+			body:    `{"handle": "@typo"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+				db.set("ContainsChannelInDB", row(false))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "recommendations", method: http.MethodGet, path: "/api/v2/feeds/1/recommendations?limit=5",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedRecommendations", recommendation("UC3", "@band"), recommendation("UC4", "@singer"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "recommendations for empty feed", method: http.MethodGet, path: "/api/v2/feeds/1/recommendations",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 0))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "recommendations for unknown feed", method: http.MethodGet, path: "/api/v2/feeds/9/recommendations",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "list digests", method: http.MethodGet, path: "/api/v2/feeds/1/digests",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedDigestSubscriptions", digestRow)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "create digest", method: http.MethodPost, path: "/api/v2/feeds/1/digests",
+			body: `{"email": "viewer@example.com", "frequency": "weekly", "hour": 8, "weekday": 1, "timezone": "Europe/London"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("UpsertDigestSubscription", digestRow)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "create digest invalid email", method: http.MethodPost, path: "/api/v2/feeds/1/digests",
+			body: `{"email": "Viewer <viewer@example.com>", "frequency": "daily", "hour": 8}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "create digest invalid timezone", method: http.MethodPost, path: "/api/v2/feeds/1/digests",
+			body: `{"email": "viewer@example.com", "frequency": "daily", "hour": 8, "timezone": "Mars/Olympus"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "delete digest", method: http.MethodDelete, path: "/api/v2/feeds/1/digests/7",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "unsubscribe", method: http.MethodGet, path: "/api/v1/digests/unsubscribe?token=" + token,
+			noAuth:     true,
+			configure:  func(s *state) { s.cfg.Digest.SigningKey = "secret" },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "unsubscribe forged token", method: http.MethodGet, path: "/api/v1/digests/unsubscribe?token=7.forged",
+			noAuth:     true,
+			configure:  func(s *state) { s.cfg.Digest.SigningKey = "secret" },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "list webhooks", method: http.MethodGet, path: "/api/v2/feeds/1/webhooks",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedWebhooks", webhookRow)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "create webhook", method: http.MethodPost, path: "/api/v2/feeds/1/webhooks",
+			body: `{"url": "https://example.com/other"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedWebhooks", webhookRow)
+				db.set("CreateWebhook", webhookRow)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "create duplicate webhook", method: http.MethodPost, path: "/api/v2/feeds/1/webhooks",
+			body: `{"url": "https://example.com/hook"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedWebhooks", webhookRow)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "create webhook invalid url", method: http.MethodPost, path: "/api/v2/feeds/1/webhooks",
+			body: `{"url": "ftp://example.com/hook"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "create webhook internal url", method: http.MethodPost, path: "/api/v2/feeds/1/webhooks",
+			body: `{"url": "http://169.254.169.254/latest/meta-data"}`,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "create webhook short secret", method: http.MethodPost, path: "/api/v2/feeds/1/webhooks",
+			body: `{"url": "https://example.com/other", "secret": "hunter2"}`, invalid: true,
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "delete webhook", method: http.MethodDelete, path: "/api/v2/feeds/1/webhooks/3",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedWebhook", webhookRow)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "delete unknown webhook", method: http.MethodDelete, path: "/api/v2/feeds/1/webhooks/9",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "list webhook deliveries", method: http.MethodGet, path: "/api/v2/feeds/1/webhooks/3/deliveries?limit=5",
+			setup: func(db *fakeDB) {
+				db.set("GetUserFeed", feedDetailsRow(1, "music", 2))
+				db.set("GetFeedWebhook", webhookRow)
+				db.set("GetWebhookDeliveries", deliveryRow)
+				db.set("GetWebhookAttempts", attemptRow)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "feed events unknown feed", method: http.MethodGet, path: "/api/v2/feeds/9/events",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "user events missing Firebase-ID", method: http.MethodGet, path: "/api/v2/events",
+			noAuth: true, invalid: true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "user events channel lookup fails", method: http.MethodGet, path: "/api/v2/events",
+			setup: func(db *fakeDB) {
+				db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2))
+				db.fail("GetAllFeedChannelPriorities", errors.New("connection reset"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "list feeds not modified", method: http.MethodGet, path: "/api/v2/feeds",
+			headers: map[string]string{"If-None-Match": "*"},
+			setup: func(db *fakeDB) {
+				db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2))
+			},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name: "v1 feeds not modified", method: http.MethodGet, path: "/api/v1/feeds",
+			headers: map[string]string{"If-None-Match": "*"},
+			setup: func(db *fakeDB) {
+				db.set("GetAllUserFeedNames", row("music"))
+			},
+			wantStatus: http.StatusNotModified,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			runContractCase(t, specRouter, c)
+		})
+	}
+}
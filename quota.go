@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// Number of days of quota history returned by the admin endpoint
+const QUOTA_HISTORY_DAYS = 14
+
+// Persists YouTube quota usage in the youtube_quota_usage table
+type quotaStore struct {
+	db *database.Queries
+}
+
+// Quota days are stored as plain dates
+func quotaDate(day time.Time) time.Time {
+	year, month, date := day.Date()
+	return time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+}
+
+func (q quotaStore) AddQuotaUsage(ctx context.Context, day time.Time, method string, usage youtube.MethodUsage) error {
+	params := database.AddQuotaUsageParams{
+		Day:    quotaDate(day),
+		Method: method,
+		Calls:  usage.Calls,
+		Units:  usage.Units,
+	}
+
+	err := q.db.AddQuotaUsage(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in AddQuotaUsage(): error adding quota usage: %s", err)
+	}
+
+	return nil
+}
+
+func (q quotaStore) GetQuotaUsage(ctx context.Context, day time.Time) (map[string]youtube.MethodUsage, error) {
+	usage := map[string]youtube.MethodUsage{}
+
+	rows, err := q.db.GetQuotaUsageByDay(ctx, quotaDate(day))
+	if err != nil {
+		return usage, fmt.Errorf("in GetQuotaUsage(): error retrieving quota usage: %s", err)
+	}
+
+	for _, row := range rows {
+		usage[row.Method] = youtube.MethodUsage{
+			Calls: row.Calls,
+			Units: row.Units,
+		}
+	}
+
+	return usage, nil
+}
+
+// Configures the youtube package's quota budget and store, loading today's usage
+func initQuota(ctx context.Context, s *state) error {
+	youtube.SetQuotaBudget(int64(s.cfg.Quota.DailyLimit), s.cfg.Quota.SoftLimitPercent)
+	youtube.SetQuotaStore(quotaStore{db: s.db})
+
+	err := youtube.FlushQuota(ctx)
+	if err != nil {
+		return fmt.Errorf("in initQuota(): error loading quota usage: %s", err)
+	}
+
+	return nil
+}
+
+// Persists quota usage every interval, returns once ctx is cancelled
+func flushQuotaPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := youtube.FlushQuota(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error("in flushQuotaPeriodically(): error flushing quota usage", logging.Err(err))
+		}
+	}
+}
+
+// Retrieves total quota usage for each of the most recent days
+func getQuotaHistory(ctx context.Context, s *state, days int32) ([]database.GetQuotaUsageHistoryRow, error) {
+	history, err := s.db.GetQuotaUsageHistory(ctx, days)
+	if err != nil {
+		return []database.GetQuotaUsageHistoryRow{}, fmt.Errorf("in getQuotaHistory(): error retrieving quota history: %s", err)
+	}
+
+	return history, nil
+}
+
+// Checks the Admin-Token header against the configured admin token, returns statusCode if error
+func unpackAdminRequest(r *http.Request, s *state) (int, error) {
+	if s.cfg.AdminToken == "" {
+		return statusCodes.ErrForbidden, fmt.Errorf("in unpackAdminRequest(): admin endpoints are disabled, ADMIN_TOKEN is not set")
+	}
+
+	token := r.Header.Get("Admin-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+		return statusCodes.ErrForbidden, fmt.Errorf("in unpackAdminRequest(): invalid admin token")
+	}
+
+	return statusCodes.Success, nil
+}
+
+// Today's YouTube quota usage along with recent daily totals
+type quotaReport struct {
+	Today   youtube.QuotaUsage `json:"today"`
+	History []dayUsage         `json:"history"`
+}
+
+type dayUsage struct {
+	Day   string `json:"day"`
+	Calls int64  `json:"calls"`
+	Units int64  `json:"units"`
+}
+
+// Retrieves today's quota usage and the totals of the last days days
+func getQuotaReport(ctx context.Context, s *state, days int32) (quotaReport, error) {
+	history, err := getQuotaHistory(ctx, s, days)
+	if err != nil {
+		return quotaReport{}, fmt.Errorf("in getQuotaReport(): %s", err)
+	}
+
+	report := quotaReport{
+		Today:   youtube.GetQuotaUsage(),
+		History: []dayUsage{},
+	}
+	for _, day := range history {
+		report.History = append(report.History, dayUsage{
+			Day:   day.Day.Format(time.DateOnly),
+			Calls: day.Calls,
+			Units: day.Units,
+		})
+	}
+
+	return report, nil
+}
+
+// GET - retrieves today's YouTube quota usage along with recent daily totals
+func (s *state) getQuotaGET(w http.ResponseWriter, r *http.Request) {
+	statusCode, err := unpackAdminRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in getQuotaGET(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	resBody, err := getQuotaReport(r.Context(), s, QUOTA_HISTORY_DAYS)
+	if err != nil {
+		logRequestError(r, "in getQuotaGET(): error retrieving quota report", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+)
+
+// Default and maximum number of recommendations returned
+const (
+	RECOMMEND_LIMIT     = 10
+	RECOMMEND_LIMIT_MAX = 50
+)
+
+// A channel recommended for a feed. Score sums the support of the pairs it forms with the
+// feed's channels, MatchedChannels is how many of the feed's channels it was paired with
+type recommendationResource struct {
+	ID              string     `json:"id"`
+	Handle          string     `json:"handle"`
+	URL             string     `json:"url"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	Avatars         avatarURLs `json:"avatars"`
+	SubscriberCount int64      `json:"subscriberCount"`
+	VideoCount      int64      `json:"videoCount"`
+	Score           int64      `json:"score"`
+	MatchedChannels int64      `json:"matchedChannels"`
+}
+
+func toRecommendationResource(channel database.GetFeedRecommendationsRow) recommendationResource {
+	return recommendationResource{
+		ID:          channel.ChannelID,
+		Handle:      channel.ChannelHandle,
+		URL:         channel.ChannelUrl,
+		Title:       channel.Title,
+		Description: channel.Description,
+		Avatars: avatarURLs{
+			Default: channel.AvatarDefaultUrl,
+			Medium:  channel.AvatarMediumUrl,
+			High:    channel.AvatarHighUrl,
+		},
+		SubscriberCount: channel.SubscriberCount,
+		VideoCount:      channel.VideoCount,
+		Score:           channel.Score,
+		MatchedChannels: channel.MatchedChannels,
+	}
+}
+
+// Recomputes how often each pair of channels shares a feed across all users. Pairs shared by
+// fewer than minSupport distinct users are dropped. Pairs are upserted and the ones left from the
+// previous refresh deleted after, so readers never see an empty table
+func refreshChannelCooccurrence(ctx context.Context, s *state, minSupport int) error {
+	// truncated to the column's precision so the refreshed rows compare equal to computedAt
+	computedAt := time.Now().Truncate(time.Microsecond)
+	params := database.UpsertChannelCooccurrenceParams{
+		ComputedAt: computedAt,
+		MinSupport: int32(minSupport),
+	}
+
+	err := s.db.UpsertChannelCooccurrence(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in refreshChannelCooccurrence(): error recomputing co-occurrence: %s", err)
+	}
+
+	err = s.db.DeleteStaleChannelCooccurrence(ctx, computedAt)
+	if err != nil {
+		return fmt.Errorf("in refreshChannelCooccurrence(): error deleting stale co-occurrence: %s", err)
+	}
+
+	return nil
+}
+
+// Recomputes channel co-occurrence now and then every interval, returns once ctx is cancelled.
+// Refreshing on start means a new instance recommends channels without waiting a full interval
+func refreshChannelCooccurrencePeriodically(ctx context.Context, s *state, interval time.Duration, minSupport int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := refreshChannelCooccurrence(ctx, s, minSupport)
+		if err != nil {
+			logging.FromContext(ctx).Error("in refreshChannelCooccurrencePeriodically(): error refreshing co-occurrence", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Retrieves up to limit channels recommended for the feed, best first
+func getFeedRecommendations(ctx context.Context, s *state, feedId, limit int32) ([]database.GetFeedRecommendationsRow, error) {
+	params := database.GetFeedRecommendationsParams{
+		FeedID:      feedId,
+		ResultLimit: limit,
+	}
+
+	channels, err := s.db.GetFeedRecommendations(ctx, params)
+	if err != nil {
+		return []database.GetFeedRecommendationsRow{}, fmt.Errorf("in getFeedRecommendations(): error retrieving recommendations for feed<%v>: %s", feedId, err)
+	}
+
+	return channels, nil
+}
+
+// GET - recommends channels that frequently share feeds with the feed's channels
+func (s *state) getFeedRecommendationsV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in getFeedRecommendationsV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	limit, statusCode, err := getSearchLimit(r, RECOMMEND_LIMIT, RECOMMEND_LIMIT_MAX)
+	if err != nil {
+		logRequestError(r, "in getFeedRecommendationsV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	type returnVals struct {
+		FeedID   int32                    `json:"feedId"`
+		Channels []recommendationResource `json:"channels"`
+	}
+	resBody := returnVals{
+		FeedID:   feed.ID,
+		Channels: []recommendationResource{},
+	}
+
+	if feed.ChannelCount == 0 {
+		writeResponse(w, resBody, statusCodes.Success)
+		return
+	}
+
+	channels, err := getFeedRecommendations(r.Context(), s, feed.ID, limit)
+	if err != nil {
+		logRequestError(r, "in getFeedRecommendationsV2(): error retrieving recommendations", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	for _, channel := range channels {
+		resBody.Channels = append(resBody.Channels, toRecommendationResource(channel))
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
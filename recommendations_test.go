@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+)
+
+func TestCooccurrenceRefreshesOnStart(t *testing.T) {
+	s, db := newFakeState(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		refreshChannelCooccurrencePeriodically(ctx, s, time.Hour, 2)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !db.called("DeleteStaleChannelCooccurrence") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if !db.called("UpsertChannelCooccurrence") || !db.called("DeleteStaleChannelCooccurrence") {
+		t.Errorf("co-occurrence was not refreshed before the first interval passed")
+	}
+}
+
+// Pairs seen in fewer than min_support users' feeds are never recommended, so a recommendation
+// cannot reveal what a single other user follows
+func TestRecommendationsRequireMinSupport(t *testing.T) {
+	queries := openTestDatabase(t)
+	ctx := context.Background()
+
+	for _, channelId := range []string{"UCA", "UCB", "UCC", "UCD"} {
+		_, err := queries.InsertChannel(ctx, database.InsertChannelParams{
+			ChannelID:       channelId,
+			ChannelUploadID: "UU" + channelId[2:],
+			ChannelHandle:   "@" + channelId,
+			ChannelUrl:      "https://www.youtube.com/channel/" + channelId,
+		})
+		if err != nil {
+			t.Fatalf("InsertChannel() error: %v", err)
+		}
+	}
+
+	// A and B are followed together by two users, A with C and A with D by one each
+	feedChannels := map[string][]string{
+		"first":  {"UCA", "UCB", "UCC"},
+		"second": {"UCA", "UCB"},
+		"third":  {"UCA", "UCD"},
+	}
+	feedIds := map[string]int32{}
+	for user, channels := range feedChannels {
+		userId, err := queries.CreateUser(ctx, database.CreateUserParams{FbUserID: user, CreatedAt: testTime, UpdatedAt: testTime})
+		if err != nil {
+			t.Fatalf("CreateUser() error: %v", err)
+		}
+		feed, err := queries.CreateFeed(ctx, database.CreateFeedParams{CreatedAt: testTime, UpdatedAt: testTime, Name: "music", UserID: userId})
+		if err != nil {
+			t.Fatalf("CreateFeed() error: %v", err)
+		}
+		feedIds[user] = feed.ID
+		for _, channelId := range channels {
+			err = queries.InsertFeedChannel(ctx, database.InsertFeedChannelParams{FeedID: feed.ID, ChannelID: channelId})
+			if err != nil {
+				t.Fatalf("InsertFeedChannel() error: %v", err)
+			}
+		}
+	}
+
+	s := &state{db: queries}
+	err := refreshChannelCooccurrence(ctx, s, 2)
+	if err != nil {
+		t.Fatalf("refreshChannelCooccurrence() error: %v", err)
+	}
+
+	recommended := func(user string) []string {
+		t.Helper()
+		rows, err := queries.GetFeedRecommendations(ctx, database.GetFeedRecommendationsParams{FeedID: feedIds[user], ResultLimit: 10})
+		if err != nil {
+			t.Fatalf("GetFeedRecommendations() error: %v", err)
+		}
+		channelIds := []string{}
+		for _, row := range rows {
+			channelIds = append(channelIds, row.ChannelID)
+		}
+		return channelIds
+	}
+
+	if got := recommended("third"); len(got) != 1 || got[0] != "UCB" {
+		t.Errorf("third user got recommendations %v, want only UCB, UCC is followed with UCA by a single user", got)
+	}
+	if got := recommended("second"); len(got) != 0 {
+		t.Errorf("second user got recommendations %v, want none, UCC and UCD each appear in a single feed", got)
+	}
+}
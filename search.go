@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// Default and maximum number of search results
+const (
+	SEARCH_LIMIT     = 25
+	SEARCH_LIMIT_MAX = 100
+)
+
+// Default and maximum number of channel search results, each search costs 100 quota units
+// regardless of the number of results
+const (
+	CHANNEL_SEARCH_LIMIT     = 10
+	CHANNEL_SEARCH_LIMIT_MAX = 25
+)
+
+// Persists videos retrieved by the youtube package in the videos table, publishing new ones to
+// the event stream and queueing webhook deliveries for them
+type videoStore struct {
+	db       *database.Queries
+	events   *eventPublisher
+	webhooks bool // queue webhook deliveries for new videos
+}
+
+// Stores the channel's videos with a single upsert, one retrieval stores up to a page of videos
+// per channel so a row at a time would add a round trip per video to the request
+func (v videoStore) StoreVideos(ctx context.Context, channelId string, videos []youtube.Video) error {
+	params := database.UpsertVideosParams{
+		ChannelID: channelId,
+		StoredAt:  time.Now(),
+	}
+	byId := map[string]youtube.Video{}
+	for _, video := range videos {
+		// a row may only be upserted once per statement
+		if _, ok := byId[video.VideoId]; ok {
+			continue
+		}
+		byId[video.VideoId] = video
+
+		params.VideoIds = append(params.VideoIds, video.VideoId)
+		params.ChannelTitles = append(params.ChannelTitles, video.ChannelName)
+		params.Titles = append(params.Titles, video.Title)
+		params.Descriptions = append(params.Descriptions, video.Description)
+		params.ThumbnailUrls = append(params.ThumbnailUrls, video.ThumbnailURL)
+		params.VideoUrls = append(params.VideoUrls, video.VideoURL)
+		params.PublishedAts = append(params.PublishedAts, video.PublishedAt)
+	}
+
+	stored, err := v.db.UpsertVideos(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in StoreVideos(): error storing %d videos for channel with id %s: %s", len(params.VideoIds), channelId, err)
+	}
+	inserted := map[string]bool{}
+	for _, video := range stored {
+		inserted[video.VideoID] = video.Inserted
+	}
+	for _, videoId := range params.VideoIds {
+		if inserted[videoId] {
+			v.events.publishVideo(ctx, channelId, byId[videoId])
+		}
+	}
+
+	if v.webhooks {
+		err := enqueueWebhookDeliveries(ctx, v.db, channelId, videos)
+		if err != nil {
+			return fmt.Errorf("in StoreVideos(): %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Searches the stored videos of every channel in the user's feeds, or only those in feedId if it
+// is not nil, most relevant and recent first
+func searchUserVideos(ctx context.Context, s *state, userId int32, query string, feedId *int32, limit int32) ([]youtube.Video, error) {
+	videos := []youtube.Video{}
+
+	params := database.SearchUserVideosParams{
+		Query:       query,
+		UserID:      userId,
+		ResultLimit: limit,
+	}
+	if feedId != nil {
+		params.FeedID = sql.NullInt32{Int32: *feedId, Valid: true}
+	}
+
+	rows, err := s.db.SearchUserVideos(ctx, params)
+	if err != nil {
+		return videos, fmt.Errorf("in searchUserVideos(): error searching videos: %s", err)
+	}
+
+	for _, row := range rows {
+		videos = append(videos, youtube.Video{
+			ChannelName:  row.ChannelTitle,
+			Title:        row.Title,
+			VideoId:      row.VideoID,
+			ThumbnailURL: row.ThumbnailUrl,
+			PublishedAt:  row.PublishedAt,
+			VideoURL:     row.VideoUrl,
+		})
+	}
+
+	return videos, nil
+}
+
+// Reads the "limit" query parameter, returns statusCode if error
+func getSearchLimit(r *http.Request, fallback, max int32) (int32, int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, statusCodes.Success, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > int(max) {
+		return 0, statusCodes.ErrRequest, fmt.Errorf("in getSearchLimit(): invalid limit<%s>, must be between 1 and %d", value, max)
+	}
+
+	return int32(limit), statusCodes.Success, nil
+}
+
+// GET - searches the titles and descriptions of videos from the channels in the user's feeds,
+// optionally only those in the feed named by "feedName"
+func (s *state) searchGET(w http.ResponseWriter, r *http.Request) {
+	userId, statusCode, err := unpackGetRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in searchGET(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		logRequestError(r, "in searchGET(): missing search query", nil, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	limit, statusCode, err := getSearchLimit(r, SEARCH_LIMIT, SEARCH_LIMIT_MAX)
+	if err != nil {
+		logRequestError(r, "in searchGET(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	var feedId *int32
+	if feedName := r.URL.Query().Get("feedName"); feedName != "" {
+		id, err := getUserFeedId(r.Context(), s, userId, feedName)
+		if err != nil {
+			logRequestError(r, "in searchGET(): error retrieving feedId", err)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
+			return
+		}
+		feedId = &id
+	}
+
+	videos, err := searchUserVideos(r.Context(), s, userId, query, feedId, limit)
+	if err != nil {
+		logRequestError(r, "in searchGET(): error searching videos", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	type returnVals struct {
+		Query  string          `json:"query"`
+		Count  int             `json:"count"`
+		Videos []youtube.Video `json:"videos"`
+	}
+	resBody := returnVals{
+		Query:  query,
+		Count:  len(videos),
+		Videos: videos,
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
+
+// GET - searches YouTube for channels matching "q" so users can find a creator's handle. When
+// "feedName" is provided candidates already in that feed are marked
+func (s *state) searchChannelsGET(w http.ResponseWriter, r *http.Request) {
+	userId, statusCode, err := unpackGetRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in searchChannelsGET(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		logRequestError(r, "in searchChannelsGET(): missing search query", nil, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+
+	limit, statusCode, err := getSearchLimit(r, CHANNEL_SEARCH_LIMIT, CHANNEL_SEARCH_LIMIT_MAX)
+	if err != nil {
+		logRequestError(r, "in searchChannelsGET(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	inFeed := map[string]bool{}
+	if feedName := r.URL.Query().Get("feedName"); feedName != "" {
+		feedId, err := getUserFeedId(r.Context(), s, userId, feedName)
+		if err != nil {
+			logRequestError(r, "in searchChannelsGET(): error retrieving feedId", err)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrFeed], statusCodes.ErrFeed)
+			return
+		}
+
+		channelIds, err := getAllFeedChannels(r.Context(), s, feedId)
+		if err != nil {
+			logRequestError(r, "in searchChannelsGET(): error retrieving feed channel Ids", err)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+			return
+		}
+		for _, channelId := range channelIds {
+			inFeed[channelId] = true
+		}
+	}
+
+	candidates, err := youtube.SearchChannels(r.Context(), query, int64(limit))
+	if errors.Is(err, youtube.ErrQuotaExceeded) {
+		logRequestError(r, "in searchChannelsGET(): request failed", err, logging.KeyStatus, statusCodes.ErrQuota)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrQuota], statusCodes.ErrQuota)
+		return
+	}
+	if errors.Is(err, youtube.ErrUnavailable) {
+		logRequestError(r, "in searchChannelsGET(): request failed", err, logging.KeyStatus, statusCodes.ErrUpstream)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrUpstream], statusCodes.ErrUpstream)
+		return
+	}
+	if err != nil {
+		logRequestError(r, "in searchChannelsGET(): error searching channels", err)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	type channelCandidate struct {
+		ID              string     `json:"id"`
+		Handle          string     `json:"handle"`
+		URL             string     `json:"url"`
+		Title           string     `json:"title"`
+		Description     string     `json:"description"`
+		Avatars         avatarURLs `json:"avatars"`
+		SubscriberCount int64      `json:"subscriberCount"`
+		VideoCount      int64      `json:"videoCount"`
+		InFeed          bool       `json:"inFeed"`
+	}
+	type returnVals struct {
+		Query    string             `json:"query"`
+		Channels []channelCandidate `json:"channels"`
+	}
+	resBody := returnVals{
+		Query:    query,
+		Channels: []channelCandidate{},
+	}
+	for _, candidate := range candidates {
+		resBody.Channels = append(resBody.Channels, channelCandidate{
+			ID:          candidate.ChannelId,
+			Handle:      candidate.Metadata.Handle,
+			URL:         youtube.GetChannelURL(candidate.ChannelId),
+			Title:       candidate.Metadata.Title,
+			Description: candidate.Metadata.Description,
+			Avatars: avatarURLs{
+				Default: candidate.Metadata.AvatarDefaultURL,
+				Medium:  candidate.Metadata.AvatarMediumURL,
+				High:    candidate.Metadata.AvatarHighURL,
+			},
+			SubscriberCount: candidate.Metadata.SubscriberCount,
+			VideoCount:      candidate.Metadata.VideoCount,
+			InFeed:          inFeed[candidate.ChannelId],
+		})
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Returns the HTTP server for handler with the configured timeouts. Open event streams are
+// ended when the server shuts down so their connections can drain
+func newServer(s *state, handler http.Handler) *http.Server {
+	cfg := s.cfg.Server
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+	}
+	server.RegisterOnShutdown(s.events.hub.Close)
+
+	return server
+}
+
+// Serves on listener until ctx is cancelled, then reports the instance as draining, stops
+// accepting connections and waits up to the shutdown timeout for in-flight requests
+func serve(ctx context.Context, s *state, server *http.Server, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("in serve(): %s", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining requests")
+	s.draining.Store(true)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Server.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		server.Close()
+		return fmt.Errorf("in serve(): error draining requests: %s", err)
+	}
+
+	err = <-errs
+	if !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("in serve(): %s", err)
+	}
+
+	return nil
+}
+
+// Runs job in its own goroutine, tracked by workers so shutdown can wait for it to return
+func startWorker(workers *sync.WaitGroup, job func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		job()
+	}()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+)
+
+func TestServeDrainsOnShutdown(t *testing.T) {
+	interval := streamHeartbeat
+	streamHeartbeat = 100 * time.Millisecond
+	t.Cleanup(func() { streamHeartbeat = interval })
+
+	s, db := newFakeState(t)
+	setStreamFeed(db)
+	s.cfg.Server = config.ServerConfig{
+		ReadHeaderTimeoutSeconds: 5,
+		ReadTimeoutSeconds:       5,
+		WriteTimeoutSeconds:      1,
+		IdleTimeoutSeconds:       5,
+		ShutdownTimeoutSeconds:   5,
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, s, newServer(s, newRouter(s)), listener)
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/api/v2/feeds/1/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Firebase-ID", "firebase-user")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	// heartbeats keep arriving after the write timeout has passed
+	deadline := time.After(1500 * time.Millisecond)
+	for waiting := true; waiting; {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				t.Fatal("stream ended before shutdown")
+			}
+		case <-deadline:
+			waiting = false
+		}
+	}
+	select {
+	case _, ok := <-lines:
+		if !ok {
+			t.Fatal("stream ended before shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat after the write timeout")
+	}
+
+	cancel()
+	for range lines {
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve() did not return after the stream was closed")
+	}
+	if !s.draining.Load() {
+		t.Errorf("expected the instance to report draining")
+	}
+}
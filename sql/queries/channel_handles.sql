@@ -0,0 +1,20 @@
+-- name: UpsertChannelHandle :exec
+INSERT INTO channel_handles (handle, channel_id, first_seen_at, last_seen_at)
+VALUES (
+    lower(sqlc.arg(handle)),
+    sqlc.arg(channel_id),
+    sqlc.arg(first_seen_at),
+    sqlc.arg(first_seen_at)
+)
+ON CONFLICT (handle) DO UPDATE
+SET channel_id = EXCLUDED.channel_id,
+    first_seen_at = CASE
+        WHEN channel_handles.channel_id = EXCLUDED.channel_id THEN channel_handles.first_seen_at
+        ELSE EXCLUDED.first_seen_at
+    END,
+    last_seen_at = EXCLUDED.last_seen_at;
+
+-- name: GetChannelHandleHistory :many
+SELECT handle, first_seen_at, last_seen_at FROM channel_handles
+WHERE channel_id = $1
+ORDER BY last_seen_at DESC;
@@ -17,16 +17,17 @@ SELECT channel_handle FROM channels
 WHERE channel_id = $1;
 
 -- name: GetChannelIdByHandle :one
-SELECT channel_id FROM channels
-WHERE channel_handle = $1;
+SELECT channel_id FROM channel_handles
+WHERE handle = lower(sqlc.arg(handle));
 
 -- name: DeleteChannel :exec
 DELETE FROM channels
 WHERE channel_id = $1;
 
 -- name: GetChannelIdUploadIdByHandle :one
-SELECT channel_id, channel_upload_id FROM channels
-WHERE channel_handle = $1;
+SELECT channels.channel_id, channels.channel_upload_id FROM channel_handles
+INNER JOIN channels ON channels.channel_id = channel_handles.channel_id
+WHERE channel_handles.handle = lower(sqlc.arg(handle));
 
 -- name: GetUploadId :one
 SELECT channel_upload_id FROM channels
@@ -34,6 +35,59 @@ WHERE channel_id = $1;
 
 -- name: ContainsChannelInDB :one
 SELECT EXISTS (
-    SELECT 1 FROM channels
-    WHERE channel_handle = $1
+    SELECT 1 FROM channel_handles
+    WHERE handle = lower(sqlc.arg(handle))
 );
+
+-- name: UpdateChannelMetadata :exec
+UPDATE channels
+SET title = $2,
+    description = $3,
+    avatar_default_url = $4,
+    avatar_medium_url = $5,
+    avatar_high_url = $6,
+    subscriber_count = $7,
+    video_count = $8,
+    metadata_updated_at = $9
+WHERE channel_id = $1;
+
+-- name: GetChannelsToRefresh :many
+SELECT channel_id FROM channels
+WHERE status = 'active' AND (metadata_updated_at IS NULL OR metadata_updated_at < $1)
+ORDER BY metadata_updated_at NULLS FIRST
+LIMIT $2;
+
+-- name: UpdateChannelHandle :exec
+UPDATE channels
+SET channel_handle = $2
+WHERE channel_id = $1;
+
+-- name: MarkChannelDead :exec
+UPDATE channels
+SET status = 'dead',
+    status_reason = $2,
+    status_changed_at = $3
+WHERE channel_id = $1 AND status = 'active';
+
+-- name: MarkChannelActive :exec
+UPDATE channels
+SET status = 'active',
+    status_reason = '',
+    status_changed_at = $2
+WHERE channel_id = $1 AND status = 'dead';
+
+-- name: GetOrphanedChannels :many
+SELECT channel_id, channel_handle FROM channels
+WHERE NOT EXISTS (
+    SELECT 1 FROM feeds_channels
+    WHERE feeds_channels.channel_id = channels.channel_id
+)
+ORDER BY channel_id;
+
+-- name: PurgeOrphanedChannels :many
+DELETE FROM channels
+WHERE NOT EXISTS (
+    SELECT 1 FROM feeds_channels
+    WHERE feeds_channels.channel_id = channels.channel_id
+)
+RETURNING channel_id;
@@ -0,0 +1,60 @@
+-- name: UpsertDigestSubscription :one
+INSERT INTO digest_subscriptions (feed_id, email, frequency, send_hour, send_weekday, timezone, next_send_at, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+ON CONFLICT (feed_id, email) DO UPDATE
+SET frequency = EXCLUDED.frequency,
+    send_hour = EXCLUDED.send_hour,
+    send_weekday = EXCLUDED.send_weekday,
+    timezone = EXCLUDED.timezone,
+    next_send_at = EXCLUDED.next_send_at
+RETURNING *;
+
+-- name: GetFeedDigestSubscriptions :many
+SELECT * FROM digest_subscriptions
+WHERE feed_id = $1
+ORDER BY id;
+
+-- name: DeleteFeedDigestSubscription :execrows
+DELETE FROM digest_subscriptions
+WHERE id = $1 AND feed_id = $2;
+
+-- name: DeleteDigestSubscription :execrows
+DELETE FROM digest_subscriptions
+WHERE id = $1;
+
+-- name: ClaimDueDigestSubscriptions :many
+-- Leases due digests until lease_until so concurrent workers skip them
+WITH claimed AS (
+    UPDATE digest_subscriptions
+    SET next_send_at = sqlc.arg(lease_until)
+    WHERE digest_subscriptions.id IN (
+        SELECT due.id FROM digest_subscriptions due
+        WHERE due.next_send_at <= sqlc.arg(now)
+        ORDER BY due.next_send_at
+        LIMIT sqlc.arg(batch_limit)
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING digest_subscriptions.*
+)
+SELECT claimed.*, feeds.name AS feed_name
+FROM claimed
+INNER JOIN feeds ON feeds.id = claimed.feed_id;
+
+-- name: MarkDigestSent :exec
+UPDATE digest_subscriptions
+SET last_sent_at = $2, next_send_at = $3, failed_attempts = 0, last_error = ''
+WHERE id = $1;
+
+-- name: MarkDigestFailed :exec
+UPDATE digest_subscriptions
+SET failed_attempts = failed_attempts + 1, last_error = $2, next_send_at = $3
+WHERE id = $1;
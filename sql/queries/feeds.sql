@@ -34,7 +34,41 @@ SELECT EXISTS (
     WHERE user_id = $1 AND name = $2
 );
 
+-- name: ContainsFeedId :one
+SELECT EXISTS (
+    SELECT 1 FROM feeds
+    WHERE id = $1
+);
+
 -- name: UpdateFeedNameQuery :exec
 UPDATE feeds
 SET name = $2, updated_at = $3
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetFeedMergeStrategy :one
+SELECT merge_strategy FROM feeds
+WHERE id = $1;
+
+-- name: UpdateFeedMergeStrategy :exec
+UPDATE feeds
+SET merge_strategy = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: UpdateFeed :exec
+UPDATE feeds
+SET name = $2, merge_strategy = $3, updated_at = $4
+WHERE id = $1;
+
+
+-- name: GetUserFeed :one
+SELECT feeds.*, COUNT(feeds_channels.channel_id) AS channel_count FROM feeds
+LEFT JOIN feeds_channels ON feeds_channels.feed_id = feeds.id
+WHERE feeds.id = $1 AND feeds.user_id = $2
+GROUP BY feeds.id;
+
+-- name: GetAllUserFeedDetails :many
+SELECT feeds.*, COUNT(feeds_channels.channel_id) AS channel_count FROM feeds
+LEFT JOIN feeds_channels ON feeds_channels.feed_id = feeds.id
+WHERE feeds.user_id = $1
+GROUP BY feeds.id
+ORDER BY feeds.created_at;
@@ -27,4 +27,26 @@ WHERE feed_id = $1;
 
 -- name: DeleteAllFeedChannels :exec
 DELETE FROM feeds_channels
-WHERE feed_id = $1;
\ No newline at end of file
+WHERE feed_id = $1;
+
+-- name: GetAllFeedChannelPriorities :many
+SELECT channels.channel_id, channels.channel_handle, channels.channel_upload_id, channels.status, channels.status_reason, feeds_channels.priority FROM feeds_channels
+INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+WHERE feeds_channels.feed_id = $1;
+
+-- name: UpdateFeedChannelPriority :execrows
+UPDATE feeds_channels
+SET priority = $3
+WHERE feed_id = $1 AND channel_id = $2;
+
+
+-- name: GetAllFeedChannelDetails :many
+SELECT channels.*, feeds_channels.priority, feeds_channels.created_at AS added_at FROM feeds_channels
+INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+WHERE feeds_channels.feed_id = $1
+ORDER BY feeds_channels.created_at;
+
+-- name: GetFeedChannelDetails :one
+SELECT channels.*, feeds_channels.priority, feeds_channels.created_at AS added_at FROM feeds_channels
+INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+WHERE feeds_channels.feed_id = $1 AND feeds_channels.channel_id = $2;
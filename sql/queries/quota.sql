@@ -0,0 +1,22 @@
+-- name: AddQuotaUsage :exec
+INSERT INTO youtube_quota_usage (day, method, calls, units)
+VALUES(
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (day, method) DO UPDATE
+SET calls = youtube_quota_usage.calls + EXCLUDED.calls,
+    units = youtube_quota_usage.units + EXCLUDED.units;
+
+-- name: GetQuotaUsageByDay :many
+SELECT method, calls, units FROM youtube_quota_usage
+WHERE day = $1
+ORDER BY method;
+
+-- name: GetQuotaUsageHistory :many
+SELECT day, SUM(calls)::BIGINT AS calls, SUM(units)::BIGINT AS units FROM youtube_quota_usage
+GROUP BY day
+ORDER BY day DESC
+LIMIT $1;
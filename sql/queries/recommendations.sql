@@ -0,0 +1,33 @@
+-- name: UpsertChannelCooccurrence :exec
+-- Stores every pair, support is the number of distinct users with both channels in the same
+-- feed and pairs below min_support are not stored
+INSERT INTO channel_cooccurrence (channel_id, related_channel_id, support, computed_at)
+SELECT a.channel_id, b.channel_id, COUNT(DISTINCT feeds.user_id), sqlc.arg(computed_at)
+FROM feeds_channels a
+INNER JOIN feeds_channels b ON b.feed_id = a.feed_id AND b.channel_id <> a.channel_id
+INNER JOIN feeds ON feeds.id = a.feed_id
+GROUP BY a.channel_id, b.channel_id
+HAVING COUNT(DISTINCT feeds.user_id) >= sqlc.arg(min_support)::INTEGER
+ON CONFLICT (channel_id, related_channel_id) DO UPDATE
+SET support = EXCLUDED.support, computed_at = EXCLUDED.computed_at;
+
+-- name: DeleteStaleChannelCooccurrence :exec
+-- Removes pairs not stored by the refresh at computed_at
+DELETE FROM channel_cooccurrence WHERE computed_at < sqlc.arg(computed_at);
+
+-- name: GetFeedRecommendations :many
+SELECT channels.*,
+    SUM(channel_cooccurrence.support)::BIGINT AS score,
+    COUNT(*)::BIGINT AS matched_channels
+FROM channel_cooccurrence
+INNER JOIN channels ON channels.channel_id = channel_cooccurrence.related_channel_id
+WHERE channel_cooccurrence.channel_id IN (
+    SELECT fc.channel_id FROM feeds_channels fc WHERE fc.feed_id = sqlc.arg(feed_id)
+)
+AND channel_cooccurrence.related_channel_id NOT IN (
+    SELECT fc.channel_id FROM feeds_channels fc WHERE fc.feed_id = sqlc.arg(feed_id)
+)
+AND channels.status = 'active'
+GROUP BY channels.channel_id
+ORDER BY score DESC, channels.subscriber_count DESC
+LIMIT sqlc.arg(result_limit);
@@ -0,0 +1,21 @@
+-- name: InsertStreamEvent :one
+-- Every instance is notified of the new event on the stream_events channel
+INSERT INTO stream_events (type, channel_id, data, created_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id;
+
+-- name: GetStreamEvent :one
+SELECT * FROM stream_events
+WHERE id = $1;
+
+-- name: GetStreamEventsAfter :many
+SELECT * FROM stream_events
+WHERE id > $1
+ORDER BY id;
+
+-- name: GetLatestStreamEventId :one
+SELECT COALESCE(MAX(id), 0)::BIGINT FROM stream_events;
+
+-- name: DeleteStreamEventsBefore :exec
+DELETE FROM stream_events
+WHERE created_at < $1;
@@ -0,0 +1,62 @@
+-- name: UpsertVideos :many
+-- Stores a channel's videos in one statement, the arrays hold one element per video and are
+-- unnested in step. inserted is true for videos that were not stored before
+INSERT INTO videos (video_id, channel_id, channel_title, title, description, thumbnail_url, video_url, published_at, stored_at)
+SELECT unnest(sqlc.arg(video_ids)::TEXT[]),
+    sqlc.arg(channel_id),
+    unnest(sqlc.arg(channel_titles)::TEXT[]),
+    unnest(sqlc.arg(titles)::TEXT[]),
+    unnest(sqlc.arg(descriptions)::TEXT[]),
+    unnest(sqlc.arg(thumbnail_urls)::TEXT[]),
+    unnest(sqlc.arg(video_urls)::TEXT[]),
+    unnest(sqlc.arg(published_ats)::TIMESTAMP[]),
+    sqlc.arg(stored_at)
+ON CONFLICT (video_id) DO UPDATE
+SET channel_title = EXCLUDED.channel_title,
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    thumbnail_url = EXCLUDED.thumbnail_url,
+    stored_at = EXCLUDED.stored_at
+RETURNING video_id, (xmax = 0) AS inserted;
+
+-- name: SearchUserVideos :many
+-- Ranks matches by relevance, halving the score for every week since publication
+SELECT videos.video_id, videos.channel_title, videos.title, videos.thumbnail_url, videos.video_url, videos.published_at
+FROM videos
+WHERE videos.search_vector @@ websearch_to_tsquery('english', sqlc.arg(query))
+AND EXISTS (
+    SELECT 1 FROM feeds_channels
+    INNER JOIN feeds ON feeds.id = feeds_channels.feed_id
+    WHERE feeds_channels.channel_id = videos.channel_id
+    AND feeds.user_id = sqlc.arg(user_id)
+    AND (sqlc.narg(feed_id)::INTEGER IS NULL OR feeds.id = sqlc.narg(feed_id))
+)
+ORDER BY ts_rank(videos.search_vector, websearch_to_tsquery('english', sqlc.arg(query)))
+    * POWER(0.5, EXTRACT(EPOCH FROM (NOW() - videos.published_at)) / 604800) DESC,
+    videos.published_at DESC
+LIMIT sqlc.arg(result_limit);
+
+-- name: GetFeedVideosState :one
+-- Summarises what a feed's videos response is built from. channels lists each channel with its
+-- priority and status, checked_at is the oldest of the active channels' latest stored_at, when
+-- the least recently fetched channel was last retrieved from YouTube
+SELECT feeds.updated_at,
+    COALESCE((
+        SELECT string_agg(channels.channel_id || ':' || feeds_channels.priority || ':' || channels.status, ',' ORDER BY channels.channel_id)
+        FROM feeds_channels
+        INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+        WHERE feeds_channels.feed_id = feeds.id
+    ), '')::TEXT AS channels,
+    COALESCE((
+        SELECT MAX(videos.published_at) FROM videos
+        INNER JOIN feeds_channels ON feeds_channels.channel_id = videos.channel_id
+        WHERE feeds_channels.feed_id = feeds.id
+    ), 'epoch')::TIMESTAMP AS newest_published_at,
+    COALESCE((
+        SELECT MIN(COALESCE((SELECT MAX(videos.stored_at) FROM videos WHERE videos.channel_id = channels.channel_id), 'epoch'))
+        FROM feeds_channels
+        INNER JOIN channels ON channels.channel_id = feeds_channels.channel_id
+        WHERE feeds_channels.feed_id = feeds.id AND channels.status = 'active'
+    ), 'epoch')::TIMESTAMP AS checked_at
+FROM feeds
+WHERE feeds.id = $1 AND feeds.user_id = $2;
@@ -0,0 +1,95 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (feed_id, url, secret, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetFeedWebhooks :many
+SELECT * FROM webhooks
+WHERE feed_id = $1
+ORDER BY id;
+
+-- name: GetFeedWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1 AND feed_id = $2;
+
+-- name: DeleteFeedWebhook :exec
+DELETE FROM webhooks
+WHERE id = $1 AND feed_id = $2;
+
+-- name: EnqueueWebhookDeliveries :exec
+-- Queues a delivery to every webhook of every feed containing the channel, for videos published
+-- after both the webhook was registered and the channel was added to the feed
+INSERT INTO webhook_deliveries (webhook_id, video_id, next_attempt_at, created_at)
+SELECT webhooks.id, videos.video_id, sqlc.arg(now), sqlc.arg(now)
+FROM videos
+INNER JOIN feeds_channels ON feeds_channels.channel_id = videos.channel_id
+INNER JOIN webhooks ON webhooks.feed_id = feeds_channels.feed_id
+WHERE videos.channel_id = sqlc.arg(channel_id)
+AND videos.video_id = ANY(sqlc.arg(video_ids)::TEXT[])
+AND videos.published_at > webhooks.created_at
+AND videos.published_at > feeds_channels.created_at
+ON CONFLICT (webhook_id, video_id) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+-- Leases due deliveries until lease_until so concurrent workers skip them
+WITH claimed AS (
+    UPDATE webhook_deliveries
+    SET next_attempt_at = sqlc.arg(lease_until)
+    WHERE webhook_deliveries.id IN (
+        SELECT pending.id FROM webhook_deliveries pending
+        WHERE pending.status = 'pending' AND pending.next_attempt_at <= sqlc.arg(now)
+        ORDER BY pending.next_attempt_at
+        LIMIT sqlc.arg(batch_limit)
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.video_id, webhook_deliveries.attempts
+)
+SELECT claimed.id, claimed.webhook_id, claimed.attempts,
+    webhooks.feed_id, webhooks.url, webhooks.secret,
+    videos.video_id, videos.channel_id, videos.channel_title, videos.title, videos.thumbnail_url, videos.video_url, videos.published_at
+FROM claimed
+INNER JOIN webhooks ON webhooks.id = claimed.webhook_id
+INNER JOIN videos ON videos.video_id = claimed.video_id;
+
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = $2,
+    attempts = $3,
+    next_attempt_at = $4,
+    last_attempt_at = $5,
+    delivered_at = $6
+WHERE id = $1;
+
+-- name: RecordWebhookAttempt :exec
+INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: GetWebhookDeliveries :many
+SELECT webhook_deliveries.*, videos.title AS video_title
+FROM webhook_deliveries
+INNER JOIN videos ON videos.video_id = webhook_deliveries.video_id
+WHERE webhook_deliveries.webhook_id = $1
+ORDER BY webhook_deliveries.created_at DESC, webhook_deliveries.id DESC
+LIMIT $2;
+
+-- name: GetWebhookAttempts :many
+SELECT webhook_attempts.* FROM webhook_attempts
+INNER JOIN webhook_deliveries ON webhook_deliveries.id = webhook_attempts.delivery_id
+WHERE webhook_deliveries.webhook_id = $1
+AND webhook_attempts.delivery_id = ANY(sqlc.arg(delivery_ids)::BIGINT[])
+ORDER BY webhook_attempts.attempted_at;
+
+-- name: GetWebhookFeedIds :many
+SELECT DISTINCT feed_id FROM webhooks
+ORDER BY feed_id;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN merge_strategy TEXT NOT NULL DEFAULT 'date';
+
+ALTER TABLE feeds_channels
+ADD COLUMN priority INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE feeds_channels
+DROP COLUMN priority;
+
+ALTER TABLE feeds
+DROP COLUMN merge_strategy;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds_channels
+ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- +goose Down
+ALTER TABLE feeds_channels
+DROP COLUMN created_at;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE youtube_quota_usage (
+    day DATE NOT NULL,
+    method TEXT NOT NULL,
+    calls BIGINT NOT NULL DEFAULT 0,
+    units BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, method)
+);
+
+-- +goose Down
+DROP TABLE youtube_quota_usage;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE channels
+ADD COLUMN title TEXT NOT NULL DEFAULT '',
+ADD COLUMN description TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_default_url TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_medium_url TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_high_url TEXT NOT NULL DEFAULT '',
+ADD COLUMN subscriber_count BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN video_count BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN metadata_updated_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE channels
+DROP COLUMN metadata_updated_at,
+DROP COLUMN video_count,
+DROP COLUMN subscriber_count,
+DROP COLUMN avatar_high_url,
+DROP COLUMN avatar_medium_url,
+DROP COLUMN avatar_default_url,
+DROP COLUMN description,
+DROP COLUMN title;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE channel_handles (
+    handle VARCHAR(255) PRIMARY KEY,
+    channel_id VARCHAR(255) NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE
+);
+
+CREATE INDEX channel_handles_channel_id_idx ON channel_handles (channel_id);
+
+INSERT INTO channel_handles (handle, channel_id)
+SELECT channel_handle, channel_id FROM channels;
+
+-- a released handle can be claimed by another channel before the old owner is re-resolved
+ALTER TABLE channels
+DROP CONSTRAINT channels_channel_handle_key;
+
+-- +goose Down
+ALTER TABLE channels
+ADD CONSTRAINT channels_channel_handle_key UNIQUE (channel_handle);
+
+DROP TABLE channel_handles;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE channels
+ADD COLUMN status TEXT NOT NULL DEFAULT 'active',
+ADD COLUMN status_reason TEXT NOT NULL DEFAULT '',
+ADD COLUMN status_changed_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE channels
+DROP COLUMN status_changed_at,
+DROP COLUMN status_reason,
+DROP COLUMN status;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE videos (
+    video_id VARCHAR(255) PRIMARY KEY,
+    channel_id VARCHAR(255) NOT NULL,
+    channel_title TEXT NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    thumbnail_url TEXT NOT NULL,
+    video_url TEXT NOT NULL,
+    published_at TIMESTAMP NOT NULL,
+    stored_at TIMESTAMP NOT NULL,
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') ||
+        setweight(to_tsvector('english', description), 'B')
+    ) STORED,
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE
+);
+
+CREATE INDEX videos_search_vector_idx ON videos USING GIN (search_vector);
+
+CREATE INDEX videos_channel_id_published_at_idx ON videos (channel_id, published_at DESC);
+
+-- +goose Down
+DROP TABLE videos;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE channel_cooccurrence (
+    channel_id VARCHAR(255) NOT NULL,
+    related_channel_id VARCHAR(255) NOT NULL,
+    support INTEGER NOT NULL,
+    computed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (channel_id, related_channel_id),
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE,
+    FOREIGN KEY (related_channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE channel_cooccurrence;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE digest_subscriptions (
+    id SERIAL PRIMARY KEY,
+    feed_id INTEGER NOT NULL,
+    email TEXT NOT NULL,
+    frequency TEXT NOT NULL,
+    send_hour INTEGER NOT NULL,
+    send_weekday INTEGER NOT NULL DEFAULT 0,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    next_send_at TIMESTAMP NOT NULL,
+    last_sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE,
+    UNIQUE (feed_id, email)
+);
+
+CREATE INDEX digest_subscriptions_next_send_at_idx ON digest_subscriptions (next_send_at);
+
+-- +goose Down
+DROP TABLE digest_subscriptions;
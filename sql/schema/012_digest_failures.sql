@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE digest_subscriptions
+ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE digest_subscriptions
+DROP COLUMN last_error,
+DROP COLUMN failed_attempts;
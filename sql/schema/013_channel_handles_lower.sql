@@ -0,0 +1,25 @@
+-- +goose Up
+-- handles are case-insensitive on YouTube, each one is stored once in lower case. Where several
+-- spellings were stored the most recently seen decides the channel
+INSERT INTO channel_handles (handle, channel_id, first_seen_at, last_seen_at)
+SELECT DISTINCT ON (lower(handle)) lower(handle), channel_id, first_seen_at, last_seen_at
+FROM channel_handles
+WHERE handle <> lower(handle)
+ORDER BY lower(handle), last_seen_at DESC
+ON CONFLICT (handle) DO UPDATE
+SET channel_id = CASE
+        WHEN EXCLUDED.last_seen_at > channel_handles.last_seen_at THEN EXCLUDED.channel_id
+        ELSE channel_handles.channel_id
+    END,
+    first_seen_at = LEAST(channel_handles.first_seen_at, EXCLUDED.first_seen_at),
+    last_seen_at = GREATEST(channel_handles.last_seen_at, EXCLUDED.last_seen_at);
+
+DELETE FROM channel_handles
+WHERE handle <> lower(handle);
+
+ALTER TABLE channel_handles
+ADD CONSTRAINT channel_handles_handle_lower CHECK (handle = lower(handle));
+
+-- +goose Down
+ALTER TABLE channel_handles
+DROP CONSTRAINT channel_handles_handle_lower;
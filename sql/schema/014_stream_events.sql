@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE stream_events (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    channel_id VARCHAR(255) NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX stream_events_created_at_idx ON stream_events (created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION notify_stream_event() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('stream_events', NEW.id::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER stream_events_notify
+AFTER INSERT ON stream_events
+FOR EACH ROW EXECUTE FUNCTION notify_stream_event();
+
+-- +goose Down
+DROP TABLE stream_events;
+
+DROP FUNCTION notify_stream_event();
@@ -0,0 +1,8 @@
+package schema
+
+import "embed"
+
+// The goose migrations, embedded so the binary can apply them itself
+//
+//go:embed *.sql
+var Migrations embed.FS
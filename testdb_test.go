@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/migrate"
+)
+
+// Opens the scratch database named by TEST_DATABASE_URL with every migration freshly applied,
+// skipping the test when it is not set. The database must be dedicated to tests, every table is
+// dropped first
+func openTestDatabase(t *testing.T) *database.Queries {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	ctx := context.Background()
+	migrator, err := migrate.New(conn)
+	if err != nil {
+		t.Fatalf("migrate.New() error: %v", err)
+	}
+	if err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("error dropping tables: %v", err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("error applying migrations: %v", err)
+	}
+
+	return database.New(conn)
+}
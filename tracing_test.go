@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The global provider only delegates package tracers once, so every test shares one recorder and
+// picks out its spans by trace id
+var (
+	installRecorder sync.Once
+	spanRecorder    = tracetest.NewSpanRecorder()
+)
+
+// Serves a request continuing traceId and returns the spans recorded for it
+func serveTraced(t *testing.T, s *state, path, traceId string) (*httptest.ResponseRecorder, []sdktrace.ReadOnlySpan) {
+	installRecorder.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Firebase-ID", "firebase-user")
+	req.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	newRouter(s).ServeHTTP(recorder, req)
+
+	spans := []sdktrace.ReadOnlySpan{}
+	for _, span := range spanRecorder.Ended() {
+		if span.SpanContext().TraceID().String() == traceId {
+			spans = append(spans, span)
+		}
+	}
+	return recorder, spans
+}
+
+// Returns the recorded span called name
+func findSpan(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+
+	t.Fatalf("no span %q in %d recorded spans", name, len(spans))
+	return nil
+}
+
+// Returns the value of the attribute key on span
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTraceRequestAndQueries(t *testing.T) {
+	logs := captureLogs(t)
+	s, db := newFakeState(t)
+	db.authorize()
+	db.set("GetAllUserFeedDetails", feedDetailsRow(1, "music", 2))
+
+	traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	recorder, spans := serveTraced(t, s, "/api/v2/feeds", traceId)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	server := findSpan(t, spans, "GET "+PREFIX_V2+"/feeds")
+	if server.SpanKind() != trace.SpanKindServer || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("got kind %v and parent %v, want a server span continuing the caller's trace", server.SpanKind(), server.Parent().SpanID())
+	}
+	if status := spanAttribute(server, "http.response.status_code").AsInt64(); status != http.StatusOK {
+		t.Errorf("got http.response.status_code %d, want %d", status, http.StatusOK)
+	}
+	if user := spanAttribute(server, "enduser.id").AsInt64(); user != 1 {
+		t.Errorf("got enduser.id %d, want 1", user)
+	}
+
+	query := findSpan(t, spans, "db GetAllUserFeedDetails")
+	if query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("query span is not a child of the request span")
+	}
+	if operation := spanAttribute(query, "db.operation.name").AsString(); operation != "GetAllUserFeedDetails" {
+		t.Errorf("got db.operation.name %q, want GetAllUserFeedDetails", operation)
+	}
+
+	entry := accessLog(t, logs())
+	if entry[logging.KeyTraceID] != traceId || entry[logging.KeySpanID] != server.SpanContext().SpanID().String() {
+		t.Errorf("got trace_id %v and span_id %v, want the request span's ids", entry[logging.KeyTraceID], entry[logging.KeySpanID])
+	}
+}
+
+func TestTraceMarksFailedQueries(t *testing.T) {
+	s, db := newFakeState(t)
+	db.authorize()
+	db.fail("GetAllUserFeedDetails", errors.New("connection reset"))
+
+	recorder, spans := serveTraced(t, s, "/api/v2/feeds", "5bf92f3577b34da6a3ce929d0e0e4736")
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+
+	if query := findSpan(t, spans, "db GetAllUserFeedDetails"); query.Status().Code != codes.Error {
+		t.Errorf("got query span status %v, want error", query.Status())
+	}
+	if server := findSpan(t, spans, "GET "+PREFIX_V2+"/feeds"); server.Status().Code != codes.Error {
+		t.Errorf("got request span status %v, want error", server.Status())
+	}
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/database"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/logging"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/webhook"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/youtube"
+)
+
+// Maximum number of deliveries attempted per run. Claimed deliveries are leased for
+// WEBHOOK_LEASE so other instances skip them, it must cover a full batch of timeouts
+const (
+	WEBHOOK_BATCH_LIMIT = 50
+	WEBHOOK_LEASE       = 15 * time.Minute
+)
+
+// Default and maximum number of deliveries listed
+const (
+	WEBHOOK_DELIVERY_LIMIT     = 20
+	WEBHOOK_DELIVERY_LIMIT_MAX = 100
+)
+
+// Values of webhook_deliveries.status
+const (
+	DELIVERY_PENDING   = "pending"
+	DELIVERY_DELIVERED = "delivered"
+	DELIVERY_FAILED    = "failed" // gave up after the maximum number of attempts
+)
+
+type webhookResource struct {
+	ID        int32     `json:"id"`
+	FeedID    int32     `json:"feedId"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the webhook is created
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type deliveryResource struct {
+	ID            int64             `json:"id"`
+	VideoID       string            `json:"videoId"`
+	VideoTitle    string            `json:"videoTitle"`
+	Status        string            `json:"status"`
+	Attempts      int32             `json:"attempts"`
+	NextAttemptAt *time.Time        `json:"nextAttemptAt"`
+	LastAttemptAt *time.Time        `json:"lastAttemptAt"`
+	DeliveredAt   *time.Time        `json:"deliveredAt"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	AttemptLog    []attemptResource `json:"attemptLog"`
+}
+
+type attemptResource struct {
+	AttemptedAt time.Time `json:"attemptedAt"`
+	StatusCode  int32     `json:"statusCode"`
+	Error       string    `json:"error"`
+	DurationMs  int32     `json:"durationMs"`
+}
+
+type createWebhookV2Params struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+func toWebhookResource(hook database.Webhook) webhookResource {
+	return webhookResource{
+		ID:        hook.ID,
+		FeedID:    hook.FeedID,
+		URL:       hook.Url,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+func toDeliveryResource(delivery database.GetWebhookDeliveriesRow) deliveryResource {
+	resource := deliveryResource{
+		ID:         delivery.ID,
+		VideoID:    delivery.VideoID,
+		VideoTitle: delivery.VideoTitle,
+		Status:     delivery.Status,
+		Attempts:   delivery.Attempts,
+		CreatedAt:  delivery.CreatedAt,
+		AttemptLog: []attemptResource{},
+	}
+	if delivery.Status == DELIVERY_PENDING {
+		resource.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastAttemptAt.Valid {
+		resource.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.DeliveredAt.Valid {
+		resource.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+
+	return resource
+}
+
+// Queues webhook deliveries for newly stored videos of the channel
+func enqueueWebhookDeliveries(ctx context.Context, db *database.Queries, channelId string, videos []youtube.Video) error {
+	videoIds := []string{}
+	for _, video := range videos {
+		videoIds = append(videoIds, video.VideoId)
+	}
+
+	params := database.EnqueueWebhookDeliveriesParams{
+		Now:       time.Now().UTC(),
+		ChannelID: channelId,
+		VideoIds:  videoIds,
+	}
+
+	err := db.EnqueueWebhookDeliveries(ctx, params)
+	if err != nil {
+		return fmt.Errorf("in enqueueWebhookDeliveries(): error queueing deliveries for channel with id %s: %s", channelId, err)
+	}
+
+	return nil
+}
+
+// Attempts a single claimed delivery and records the outcome, returns true if it was delivered
+func attemptWebhookDelivery(ctx context.Context, s *state, client *http.Client, delivery database.ClaimWebhookDeliveriesRow, now time.Time) (bool, error) {
+	payload := webhook.Payload{
+		Event:      webhook.EventVideoPublished,
+		DeliveryID: delivery.ID,
+		WebhookID:  delivery.WebhookID,
+		FeedID:     delivery.FeedID,
+		Video: webhook.VideoJSON{
+			ID:           delivery.VideoID,
+			Title:        delivery.Title,
+			ChannelID:    delivery.ChannelID,
+			Channel:      delivery.ChannelTitle,
+			URL:          delivery.VideoUrl,
+			ThumbnailURL: delivery.ThumbnailUrl,
+			PublishedAt:  delivery.PublishedAt,
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("in attemptWebhookDelivery(): error marshaling payload: %s", err)
+	}
+
+	attempt := webhook.Deliver(ctx, client, delivery.Url, delivery.Secret, delivery.ID, body, now)
+	if ctx.Err() != nil {
+		// cut short by shutdown rather than the endpoint, retried once the lease expires
+		return false, fmt.Errorf("in attemptWebhookDelivery(): delivery<%v>: %w", delivery.ID, ctx.Err())
+	}
+
+	attemptParams := database.RecordWebhookAttemptParams{
+		DeliveryID:  delivery.ID,
+		AttemptedAt: now,
+		StatusCode:  int32(attempt.StatusCode),
+		DurationMs:  int32(attempt.Duration.Milliseconds()),
+	}
+	if attempt.Err != nil {
+		attemptParams.Error = attempt.Err.Error()
+	}
+	err = s.db.RecordWebhookAttempt(ctx, attemptParams)
+	if err != nil {
+		return false, fmt.Errorf("in attemptWebhookDelivery(): error recording attempt for delivery<%v>: %s", delivery.ID, err)
+	}
+
+	attempts := delivery.Attempts + 1
+	params := database.UpdateWebhookDeliveryParams{
+		ID:            delivery.ID,
+		Status:        DELIVERY_DELIVERED,
+		Attempts:      attempts,
+		NextAttemptAt: now,
+		LastAttemptAt: sql.NullTime{Time: now, Valid: true},
+	}
+	if attempt.Err == nil {
+		params.DeliveredAt = sql.NullTime{Time: now, Valid: true}
+	} else {
+		delay, err := webhook.Backoff(int(attempts), s.cfg.Webhooks.MaxAttempts)
+		if errors.Is(err, webhook.ErrGaveUp) {
+			params.Status = DELIVERY_FAILED
+			logging.FromContext(ctx).Warn("in attemptWebhookDelivery(): giving up on delivery", "delivery_id", delivery.ID, "attempts", attempts, logging.Err(attempt.Err))
+		} else {
+			params.Status = DELIVERY_PENDING
+			params.NextAttemptAt = now.Add(delay)
+		}
+	}
+
+	err = s.db.UpdateWebhookDelivery(ctx, params)
+	if err != nil {
+		return false, fmt.Errorf("in attemptWebhookDelivery(): error updating delivery<%v>: %s", delivery.ID, err)
+	}
+
+	return attempt.Err == nil, nil
+}
+
+// Claims and attempts due deliveries, returns the number delivered. A delivery that cannot be
+// attempted or recorded is logged and left leased, the rest of the batch is still attempted
+func deliverWebhooks(ctx context.Context, s *state, client *http.Client, now time.Time) (int, error) {
+	params := database.ClaimWebhookDeliveriesParams{
+		LeaseUntil: now.Add(WEBHOOK_LEASE),
+		Now:        now,
+		BatchLimit: WEBHOOK_BATCH_LIMIT,
+	}
+
+	deliveries, err := s.db.ClaimWebhookDeliveries(ctx, params)
+	if err != nil {
+		return 0, fmt.Errorf("in deliverWebhooks(): error claiming deliveries: %s", err)
+	}
+
+	delivered := 0
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return delivered, fmt.Errorf("in deliverWebhooks(): %w", ctx.Err())
+		}
+
+		ok, err := attemptWebhookDelivery(ctx, s, client, delivery, time.Now().UTC())
+		if err != nil {
+			logging.FromContext(ctx).Error("in deliverWebhooks(): error attempting delivery", "delivery_id", delivery.ID, logging.Err(err))
+			continue
+		}
+		if ok {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// Attempts due deliveries every interval, returns once ctx is cancelled
+func deliverWebhooksPeriodically(ctx context.Context, s *state, interval time.Duration) {
+	client := webhook.NewClient(time.Duration(s.cfg.Webhooks.TimeoutSeconds) * time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		delivered, err := deliverWebhooks(ctx, s, client, time.Now().UTC())
+		if err != nil {
+			logging.FromContext(ctx).Error("in deliverWebhooksPeriodically(): error delivering webhooks", logging.Err(err))
+		}
+		if delivered > 0 {
+			logging.FromContext(ctx).Info("delivered webhooks", "deliveries", delivered)
+		}
+	}
+}
+
+// Retrieves the videos of every channel in a feed with webhooks so new videos are stored, and
+// deliveries queued, even when nobody opens the feed. Returns the number of channels polled
+func pollWebhookFeeds(ctx context.Context, s *state) (int, error) {
+	if status := youtube.GetQuotaStatus(); status != youtube.QuotaOK {
+		return 0, fmt.Errorf("in pollWebhookFeeds(): quota %s: %w", status, youtube.ErrQuotaExceeded)
+	}
+
+	feedIds, err := s.db.GetWebhookFeedIds(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("in pollWebhookFeeds(): error retrieving feeds: %s", err)
+	}
+
+	seen := map[string]bool{}
+	channels := []youtube.FeedChannel{}
+	for _, feedId := range feedIds {
+		feedChannels, err := getAllFeedChannelPriorities(ctx, s, feedId)
+		if err != nil {
+			return 0, fmt.Errorf("in pollWebhookFeeds(): %s", err)
+		}
+		for _, channel := range feedChannels {
+			if !seen[channel.ChannelId] {
+				seen[channel.ChannelId] = true
+				channels = append(channels, channel)
+			}
+		}
+	}
+	if len(channels) == 0 {
+		return 0, nil
+	}
+
+	youtube.GetFeedVideosByDate(ctx, int64(s.cfg.Feeds.VideoLimit), channels)
+
+	return len(channels), nil
+}
+
+// Polls feeds with webhooks every interval, returns once ctx is cancelled
+func pollWebhookFeedsPeriodically(ctx context.Context, s *state, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := pollWebhookFeeds(ctx, s)
+		if errors.Is(err, youtube.ErrQuotaExceeded) {
+			logging.FromContext(ctx).Warn("in pollWebhookFeedsPeriodically(): skipping poll", logging.Err(err))
+			continue
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("in pollWebhookFeedsPeriodically(): error polling feeds", logging.Err(err))
+		}
+	}
+}
+
+// Resolves the {webhookId} path variable, ensuring the webhook belongs to the feed. Returns
+// statusCode if error
+func unpackWebhookRequest(r *http.Request, s *state, feedId int32) (database.Webhook, int, error) {
+	webhookId, err := strconv.ParseInt(mux.Vars(r)["webhookId"], 10, 32)
+	if err != nil {
+		return database.Webhook{}, statusCodes.ErrRequest, fmt.Errorf("in unpackWebhookRequest(): invalid webhookId: %s", err)
+	}
+
+	params := database.GetFeedWebhookParams{
+		ID:     int32(webhookId),
+		FeedID: feedId,
+	}
+	hook, err := s.db.GetFeedWebhook(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hook, statusCodes.ErrNotFound, fmt.Errorf("in unpackWebhookRequest(): webhook<%v> not found in feed<%v>", webhookId, feedId)
+	}
+	if err != nil {
+		return hook, statusCodes.ErrServer, fmt.Errorf("in unpackWebhookRequest(): error retrieving webhook<%v>: %s", webhookId, err)
+	}
+
+	return hook, statusCodes.Success, nil
+}
+
+// GET - lists the webhooks of the feed
+func (s *state) listWebhooksV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in listWebhooksV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	hooks, err := s.db.GetFeedWebhooks(r.Context(), feed.ID)
+	if err != nil {
+		logRequestError(r, "in listWebhooksV2(): error retrieving webhooks for feed", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	type returnVals struct {
+		Webhooks []webhookResource `json:"webhooks"`
+	}
+	resBody := returnVals{
+		Webhooks: []webhookResource{},
+	}
+	for _, hook := range hooks {
+		resBody.Webhooks = append(resBody.Webhooks, toWebhookResource(hook))
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
+
+// POST - registers a webhook notified of the feed's new videos. A secret is generated unless
+// one is provided, it is only returned in this response
+func (s *state) createWebhookV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in createWebhookV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	params := createWebhookV2Params{}
+	statusCode, err = unpackV2Body(&params, r)
+	if err != nil {
+		logRequestError(r, "in createWebhookV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	err = webhook.ValidateURL(params.URL)
+	if err != nil {
+		logRequestError(r, "in createWebhookV2(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+		return
+	}
+	if params.Secret != "" {
+		err = webhook.ValidateSecret(params.Secret)
+		if err != nil {
+			logRequestError(r, "in createWebhookV2(): request failed", err, logging.KeyStatus, statusCodes.ErrRequest)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrRequest], statusCodes.ErrRequest)
+			return
+		}
+	}
+
+	hooks, err := s.db.GetFeedWebhooks(r.Context(), feed.ID)
+	if err != nil {
+		logRequestError(r, "in createWebhookV2(): error retrieving webhooks for feed", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+	for _, hook := range hooks {
+		if hook.Url == params.URL {
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrConflict], statusCodes.ErrConflict)
+			return
+		}
+	}
+
+	secret := params.Secret
+	if secret == "" {
+		secret, err = webhook.NewSecret()
+		if err != nil {
+			logRequestError(r, "in createWebhookV2(): error generating secret", err)
+			writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+			return
+		}
+	}
+
+	createParams := database.CreateWebhookParams{
+		FeedID:    feed.ID,
+		Url:       params.URL,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	hook, err := s.db.CreateWebhook(r.Context(), createParams)
+	if err != nil {
+		logRequestError(r, "in createWebhookV2(): error creating webhook for feed", err, logging.KeyFeedID, feed.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	resource := toWebhookResource(hook)
+	resource.Secret = hook.Secret
+	writeResponse(w, resource, statusCodes.Created)
+}
+
+// DELETE - removes a webhook and its delivery history
+func (s *state) deleteWebhookV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in deleteWebhookV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	hook, statusCode, err := unpackWebhookRequest(r, s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in deleteWebhookV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	params := database.DeleteFeedWebhookParams{
+		ID:     hook.ID,
+		FeedID: feed.ID,
+	}
+	err = s.db.DeleteFeedWebhook(r.Context(), params)
+	if err != nil {
+		logRequestError(r, "in deleteWebhookV2(): error deleting webhook", err, "webhook_id", hook.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	message := fmt.Sprintf("Successfully deleted webhook with id - %v", hook.ID)
+	writeResponseMessage(w, message, statusCodes.Success)
+}
+
+// GET - lists the webhook's most recent deliveries along with every attempt made, for debugging
+func (s *state) listWebhookDeliveriesV2(w http.ResponseWriter, r *http.Request) {
+	_, feed, statusCode, err := unpackFeedRequest(r, s)
+	if err != nil {
+		logRequestError(r, "in listWebhookDeliveriesV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	hook, statusCode, err := unpackWebhookRequest(r, s, feed.ID)
+	if err != nil {
+		logRequestError(r, "in listWebhookDeliveriesV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	limit, statusCode, err := getSearchLimit(r, WEBHOOK_DELIVERY_LIMIT, WEBHOOK_DELIVERY_LIMIT_MAX)
+	if err != nil {
+		logRequestError(r, "in listWebhookDeliveriesV2(): request failed", err, logging.KeyStatus, statusCode)
+		writeResponseMessage(w, statusCodeMessages[statusCode], statusCode)
+		return
+	}
+
+	deliveryParams := database.GetWebhookDeliveriesParams{
+		WebhookID: hook.ID,
+		Limit:     limit,
+	}
+	deliveries, err := s.db.GetWebhookDeliveries(r.Context(), deliveryParams)
+	if err != nil {
+		logRequestError(r, "in listWebhookDeliveriesV2(): error retrieving deliveries for webhook", err, "webhook_id", hook.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+
+	type returnVals struct {
+		WebhookID  int32              `json:"webhookId"`
+		Deliveries []deliveryResource `json:"deliveries"`
+	}
+	resBody := returnVals{
+		WebhookID:  hook.ID,
+		Deliveries: []deliveryResource{},
+	}
+	if len(deliveries) == 0 {
+		writeResponse(w, resBody, statusCodes.Success)
+		return
+	}
+
+	deliveryIds := []int64{}
+	indexes := map[int64]int{}
+	for i, delivery := range deliveries {
+		deliveryIds = append(deliveryIds, delivery.ID)
+		indexes[delivery.ID] = i
+		resBody.Deliveries = append(resBody.Deliveries, toDeliveryResource(delivery))
+	}
+
+	attemptParams := database.GetWebhookAttemptsParams{
+		WebhookID:   hook.ID,
+		DeliveryIds: deliveryIds,
+	}
+	attempts, err := s.db.GetWebhookAttempts(r.Context(), attemptParams)
+	if err != nil {
+		logRequestError(r, "in listWebhookDeliveriesV2(): error retrieving attempts for webhook", err, "webhook_id", hook.ID)
+		writeResponseMessage(w, statusCodeMessages[statusCodes.ErrServer], statusCodes.ErrServer)
+		return
+	}
+	for _, attempt := range attempts {
+		i, ok := indexes[attempt.DeliveryID]
+		if !ok {
+			continue
+		}
+		resBody.Deliveries[i].AttemptLog = append(resBody.Deliveries[i].AttemptLog, attemptResource{
+			AttemptedAt: attempt.AttemptedAt,
+			StatusCode:  attempt.StatusCode,
+			Error:       attempt.Error,
+			DurationMs:  attempt.DurationMs,
+		})
+	}
+
+	writeResponse(w, resBody, statusCodes.Success)
+}
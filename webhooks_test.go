@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luke-mayer/youtube-custom-feeds/internal/config"
+	"github.com/luke-mayer/youtube-custom-feeds/internal/webhook"
+)
+
+// Row returned by ClaimWebhookDeliveries
+func claimedDeliveryRow(id int64, url string, attempts int64) []driver.Value {
+	return row(id, int64(3), attempts, int64(1), url, "secret",
+		"v2", "UC1", "Artist", "New song", "https://i.ytimg.com/vi/v2/hqdefault.jpg", "https://www.youtube.com/watch?v=v2", testTime)
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	doc, _ := loadSpec(t)
+	payloadSchema := doc.Components.Schemas["WebhookPayload"].Value
+
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if r.Header.Get(webhook.HeaderSignature) != webhook.Sign("secret", timestamp, body) {
+			t.Errorf("delivery signature does not match the body")
+		}
+
+		var payload any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("error decoding payload: %v", err)
+		}
+		if err := payloadSchema.VisitJSON(payload); err != nil {
+			t.Errorf("payload does not match the spec: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s, db := newFakeState(t)
+	s.cfg.Webhooks = config.WebhooksConfig{MaxAttempts: 8}
+	db.set("ClaimWebhookDeliveries", claimedDeliveryRow(10, server.URL, 0))
+
+	delivered, err := deliverWebhooks(context.Background(), s, server.Client(), time.Now())
+	if err != nil || delivered != 1 || received != 1 {
+		t.Fatalf("got %d delivered (%d received), %v, want 1 and no error", delivered, received, err)
+	}
+	if !db.called("RecordWebhookAttempt") || !db.called("UpdateWebhookDelivery") {
+		t.Errorf("delivery attempt was not recorded")
+	}
+}
+
+func TestDeliverWebhooksFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	s, db := newFakeState(t)
+	s.cfg.Webhooks = config.WebhooksConfig{MaxAttempts: 8}
+	db.set("ClaimWebhookDeliveries", claimedDeliveryRow(10, server.URL, 2), claimedDeliveryRow(11, server.URL, 7))
+
+	delivered, err := deliverWebhooks(context.Background(), s, server.Client(), time.Now())
+	if err != nil || delivered != 0 {
+		t.Fatalf("got %d, %v, want 0 delivered and no error", delivered, err)
+	}
+	if !db.called("RecordWebhookAttempt") || !db.called("UpdateWebhookDelivery") {
+		t.Errorf("failed attempts were not recorded")
+	}
+}
+
+func TestDeliverWebhooksContinuesAfterRecordError(t *testing.T) {
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s, db := newFakeState(t)
+	s.cfg.Webhooks = config.WebhooksConfig{MaxAttempts: 8}
+	db.set("ClaimWebhookDeliveries", claimedDeliveryRow(10, server.URL, 0), claimedDeliveryRow(11, server.URL, 0))
+	db.fail("RecordWebhookAttempt", errors.New("connection reset"))
+
+	delivered, err := deliverWebhooks(context.Background(), s, server.Client(), time.Now())
+	if err != nil || delivered != 0 || received != 2 {
+		t.Fatalf("got %d delivered (%d received), %v, want both deliveries attempted and no error", delivered, received, err)
+	}
+}
+
+func TestPollWebhookFeedsNoWebhooks(t *testing.T) {
+	s, db := newFakeState(t)
+
+	polled, err := pollWebhookFeeds(context.Background(), s)
+	if err != nil || polled != 0 {
+		t.Errorf("got %d, %v, want 0 polled and no error", polled, err)
+	}
+	if db.called("GetAllFeedChannelPriorities") {
+		t.Errorf("feeds polled without webhooks")
+	}
+}